@@ -184,6 +184,21 @@ def convert(infile):
             amode = chdata.setdefault('amode', {})
             amode[target] = mode
             chdata['amode'] = amode
+        elif obj.type == 'AutoKick':
+            # AKICK entries target either an account ('nc') or a nickmask ('mask')
+            chname = obj.kv['ci']
+            if chname not in out['channels']:
+                continue
+            if obj.kv.get('nc'):
+                mask = '~a:' + obj.kv['nc']
+            elif obj.kv.get('mask'):
+                mask = obj.kv['mask']
+            else:
+                continue
+            ban = {'mask': mask, 'setBy': obj.kv.get('creator', '')}
+            if obj.kv.get('addtime'):
+                ban['setAt'] = to_unixnano(obj.kv['addtime'])
+            out['channels'][chname].setdefault('bans', []).append(ban)
 
     # do some basic integrity checks
     for chname, chdata in out['channels'].items():
@@ -154,6 +154,17 @@ def convert(infile):
                 # but multiple people can receive the 'q' amode
                 chdata['amode'][username] = 'q'
                 continue
+            if 'b' in flags:
+                # AKICK: the target is a nickmask or an account name
+                if username.startswith('!'):
+                    # GroupServ groups can't be banned
+                    continue
+                mask = username if MASK_MAGIC_REGEX.search(username) else '~a:' + username
+                ban = {'mask': mask, 'setAt': to_unixnano(set_at)}
+                if len(parts) > 5:
+                    ban['setBy'] = parts[5]
+                chdata.setdefault('bans', []).append(ban)
+                continue
             if MASK_MAGIC_REGEX.search(username):
                 # ignore groups, masks, etc. for any field other than founder
                 continue
@@ -9,17 +9,24 @@ import (
 	"bufio"
 	"fmt"
 	"log"
+	"net"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/crypto/ssh/terminal"
 
 	"github.com/docopt/docopt-go"
 	"github.com/ergochat/ergo/irc"
+	"github.com/ergochat/ergo/irc/loadtest"
 	"github.com/ergochat/ergo/irc/logger"
 	"github.com/ergochat/ergo/irc/mkcerts"
+	"github.com/ergochat/ergo/irc/passwd"
+	"github.com/ergochat/ergo/irc/utils"
 )
 
 // set via linker flags, either by make or by goreleaser:
@@ -48,6 +55,44 @@ func fileDoesNotExist(file string) bool {
 	return false
 }
 
+// genpasswdCost returns the bcrypt cost for `ergo genpasswd`: the server's
+// configured cost if the config file can be read, otherwise the minimum
+func genpasswdCost(configFile string) int {
+	config, err := irc.LoadRawConfig(configFile)
+	if err != nil {
+		return passwd.MinCost
+	}
+	cost := int(config.Accounts.Registration.BcryptCost)
+	if cost == 0 {
+		// same default as LoadConfig
+		return passwd.DefaultCost
+	}
+	if cost < passwd.MinCost || bcrypt.MaxCost < cost {
+		log.Fatalf("invalid bcrypt-cost in %s: %d", configFile, cost)
+	}
+	return cost
+}
+
+// a cert/key pair referenced by the config, to be created by `ergo mkcerts`
+type certToMake struct {
+	key   string
+	hosts []string
+	users []string
+}
+
+// listenerHostname returns the hostname or IP a TCP listener is bound to,
+// or "" if it is bound to all interfaces (or is a unix domain socket)
+func listenerHostname(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return ""
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		return ""
+	}
+	return host
+}
+
 // implements the `ergo mkcerts` command
 func doMkcerts(configFile string, quiet bool) {
 	config, err := irc.LoadRawConfig(configFile)
@@ -58,39 +103,127 @@ func doMkcerts(configFile string, quiet bool) {
 		log.Println("making self-signed certificates")
 	}
 
-	certToKey := make(map[string]string)
-	for name, conf := range config.Server.Listeners {
-		if conf.TLS.Cert == "" {
-			continue
+	// collect the hostnames for each cert before creating any of them,
+	// since a cert may be shared between listeners
+	var certFiles []string
+	certs := make(map[string]*certToMake)
+	addCert := func(certFile, keyFile, user, listenAddr string) {
+		if certFile == "" {
+			return
 		}
-		existingKey, ok := certToKey[conf.TLS.Cert]
-		if ok {
-			if existingKey == conf.TLS.Key {
-				continue
-			} else {
-				log.Fatal("Conflicting TLS key files for ", conf.TLS.Cert)
-			}
+		cert, ok := certs[certFile]
+		if !ok {
+			cert = &certToMake{key: keyFile, hosts: []string{config.Server.Name}}
+			certs[certFile] = cert
+			certFiles = append(certFiles, certFile)
+		} else if cert.key != keyFile {
+			log.Fatal("Conflicting TLS key files for ", certFile)
+		}
+		cert.users = append(cert.users, user)
+		if host := listenerHostname(listenAddr); host != "" {
+			cert.hosts = append(cert.hosts, host)
+		}
+	}
+
+	var listenAddrs []string
+	for addr := range config.Server.Listeners {
+		listenAddrs = append(listenAddrs, addr)
+	}
+	sort.Strings(listenAddrs)
+	for _, addr := range listenAddrs {
+		conf := config.Server.Listeners[addr]
+		addCert(conf.TLS.Cert, conf.TLS.Key, fmt.Sprintf("%s listener", addr), addr)
+		for _, sniConf := range conf.TLSCertificates {
+			addCert(sniConf.Cert, sniConf.Key, fmt.Sprintf("%s listener", addr), addr)
 		}
+	}
+	if config.API.Enabled && config.API.TLS.Enabled {
+		addCert(config.API.TLS.Cert, config.API.TLS.Key, "API", config.API.Listener)
+	}
+
+	for _, certFile := range certFiles {
+		cert := certs[certFile]
 		if !quiet {
-			log.Printf(" making cert for %s listener\n", name)
+			log.Printf(" making cert for %s\n", strings.Join(cert.users, ", "))
 		}
-		host := config.Server.Name
-		cert, key := conf.TLS.Cert, conf.TLS.Key
-		if !(fileDoesNotExist(cert) && fileDoesNotExist(key)) {
-			log.Fatalf("Preexisting TLS cert and/or key files: %s %s", cert, key)
+		if !(fileDoesNotExist(certFile) && fileDoesNotExist(cert.key)) {
+			log.Fatalf("Preexisting TLS cert and/or key files: %s %s", certFile, cert.key)
 		}
-		err := mkcerts.CreateCert("Ergo", host, cert, key)
+		err := mkcerts.CreateCert("Ergo", cert.hosts, certFile, cert.key)
 		if err == nil {
 			if !quiet {
-				log.Printf("  Certificate created at %s : %s\n", cert, key)
+				log.Printf("  Certificate created at %s : %s\n", certFile, cert.key)
 			}
-			certToKey[cert] = key
 		} else {
 			log.Fatal("  Could not create certificate:", err.Error())
 		}
 	}
 }
 
+// exit codes for checkconf:
+const (
+	checkconfValid    = 0
+	checkconfInvalid  = 1
+	checkconfWarnings = 2
+)
+
+func doCheckconf(configFile string, quiet bool) int {
+	result := irc.CheckConfig(configFile)
+	for _, message := range result.Errors {
+		fmt.Fprintf(os.Stderr, "error: %s\n", message)
+	}
+	for _, message := range result.Warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", message)
+	}
+	if len(result.Errors) != 0 {
+		return checkconfInvalid
+	} else if len(result.Warnings) != 0 {
+		return checkconfWarnings
+	}
+	if !quiet {
+		fmt.Printf("%s: configuration is valid\n", configFile)
+	}
+	return checkconfValid
+}
+
+// implements the `ergo loadtest` command
+func doLoadtest(arguments map[string]interface{}) {
+	intArg := func(name string) int {
+		value, err := strconv.Atoi(arguments[name].(string))
+		if err != nil || value < 0 {
+			log.Fatalf("invalid value for %s: %s", name, arguments[name])
+		}
+		return value
+	}
+	durationArg := func(name string) time.Duration {
+		value, err := time.ParseDuration(arguments[name].(string))
+		if err != nil || value <= 0 {
+			log.Fatalf("invalid value for %s: %s", name, arguments[name])
+		}
+		return value
+	}
+	config := loadtest.Config{
+		Address:            arguments["<address>"].(string),
+		TLS:                arguments["--tls"].(bool) || arguments["--insecure"].(bool),
+		InsecureSkipVerify: arguments["--insecure"].(bool),
+		Clients:            intArg("--clients"),
+		Channels:           intArg("--channels"),
+		ConnectRate:        intArg("--rate"),
+		Duration:           durationArg("--duration"),
+		Interval:           durationArg("--interval"),
+		NickEvery:          intArg("--nick-every"),
+		Timeout:            durationArg("--timeout"),
+	}
+	if !arguments["--quiet"].(bool) {
+		log.Printf("connecting %d clients to %s, in %d channels\n", config.Clients, config.Address, config.Channels)
+	}
+	results := loadtest.Run(config)
+	fmt.Print(results.Report())
+	if results.Connected == 0 {
+		os.Exit(1)
+	}
+}
+
 func main() {
 	irc.SetVersionString(version, commit)
 	usage := `ergo.
@@ -98,14 +231,27 @@ Usage:
 	ergo initdb [--conf <filename>] [--quiet]
 	ergo upgradedb [--conf <filename>] [--quiet]
 	ergo importdb <database.json> [--conf <filename>] [--quiet]
+	ergo exportdb <database.json> [--conf <filename>] [--quiet]
 	ergo genpasswd [--conf <filename>] [--quiet]
 	ergo mkcerts [--conf <filename>] [--quiet]
+	ergo checkconf [--conf <filename>] [--quiet]
+	ergo gentoken
+	ergo loadtest <address> [--clients <n>] [--channels <n>] [--rate <n>] [--duration <time>] [--interval <time>] [--nick-every <n>] [--timeout <time>] [--tls] [--insecure] [--quiet]
 	ergo run [--conf <filename>] [--quiet] [--smoke]
 	ergo -h | --help
 	ergo --version
 Options:
 	--conf <filename>  Configuration file to use [default: ircd.yaml].
 	--quiet            Don't show startup/shutdown lines.
+	--clients <n>      Number of simulated clients for loadtest [default: 100].
+	--channels <n>     Number of channels to spread them over [default: 10].
+	--rate <n>         New connections per second [default: 50].
+	--duration <time>  How long each client stays in its channel [default: 1m].
+	--interval <time>  How often each client sends a message [default: 5s].
+	--nick-every <n>   Change nickname every n messages, 0 to disable [default: 5].
+	--timeout <time>   How long to wait for each reply [default: 30s].
+	--tls              Connect to the server with TLS.
+	--insecure         Connect with TLS without verifying the certificate.
 	-h --help          Show this screen.
 	--version          Show version.`
 
@@ -113,6 +259,7 @@ Options:
 
 	// don't require a config file for genpasswd
 	if arguments["genpasswd"].(bool) {
+		cost := genpasswdCost(arguments["--conf"].(string))
 		var password string
 		fd := int(os.Stdin.Fd())
 		if terminal.IsTerminal(fd) {
@@ -132,7 +279,7 @@ Options:
 			log.Printf("WARNING: this password contains characters that may cause problems with your IRC client software.\n")
 			log.Printf("We strongly recommend choosing a different password.\n")
 		}
-		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
 		if err != nil {
 			log.Fatal("encoding error:", err.Error())
 		}
@@ -141,9 +288,17 @@ Options:
 			fmt.Println()
 		}
 		return
+	} else if arguments["gentoken"].(bool) {
+		fmt.Println(utils.GenerateSecretToken())
+		return
 	} else if arguments["mkcerts"].(bool) {
 		doMkcerts(arguments["--conf"].(string), arguments["--quiet"].(bool))
 		return
+	} else if arguments["checkconf"].(bool) {
+		os.Exit(doCheckconf(arguments["--conf"].(string), arguments["--quiet"].(bool)))
+	} else if arguments["loadtest"].(bool) {
+		doLoadtest(arguments)
+		return
 	}
 
 	configfile := arguments["--conf"].(string)
@@ -181,6 +336,14 @@ Options:
 		if err != nil {
 			log.Fatal("Error while importing db:", err.Error())
 		}
+	} else if arguments["exportdb"].(bool) {
+		err = irc.ExportDB(config, arguments["<database.json>"].(string))
+		if err != nil {
+			log.Fatal("Error while exporting db:", err.Error())
+		}
+		if !arguments["--quiet"].(bool) {
+			log.Println("database exported: ", arguments["<database.json>"].(string))
+		}
 	} else if arguments["run"].(bool) {
 		if !arguments["--quiet"].(bool) {
 			logman.Info("server", fmt.Sprintf("%s starting", irc.Ver))
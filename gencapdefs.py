@@ -183,6 +183,12 @@ CAPDEFS = [
         url="https://github.com/ircv3/ircv3-specifications/pull/466",
         standard="draft IRCv3",
     ),
+    CapDef(
+        identifier="Search",
+        name="soju.im/search",
+        url="https://codeberg.org/emersion/soju/src/branch/master/doc/ext/search.md",
+        standard="Soju vendor",
+    ),
     CapDef(
         identifier="ReadMarker",
         name="draft/read-marker",
@@ -2,13 +2,20 @@ package irc
 
 import (
 	"sync"
+	"time"
 
 	"github.com/ergochat/ergo/irc/utils"
 )
 
+const (
+	// minimum interval between notifications to a +g client that
+	// someone not on their accept list is trying to message them
+	callerIDNoticeInterval = time.Minute
+)
+
 // tracks ACCEPT relationships, i.e., `accepter` is willing to receive DMs from
-// `accepted` despite some restriction (currently the only relevant restriction
-// is that `accepter` is +R and `accepted` is not logged in)
+// `accepted` despite some restriction (either `accepter` is +g, or `accepter`
+// is +R and `accepted` is not logged in)
 
 type AcceptManager struct {
 	sync.RWMutex
@@ -2,6 +2,7 @@ package irc
 
 import (
 	"testing"
+	"time"
 )
 
 func TestAccept(t *testing.T) {
@@ -106,3 +107,12 @@ func TestAcceptInternal(t *testing.T) {
 		assertEqual(len(am.clientToAccepters[client]), 0)
 	}
 }
+
+func TestCallerIDNotice(t *testing.T) {
+	client := new(Client)
+	assertEqual(client.checkCallerIDNotice(), true)
+	assertEqual(client.checkCallerIDNotice(), false)
+
+	client.lastCallerIDNotice = time.Now().Add(-callerIDNoticeInterval)
+	assertEqual(client.checkCallerIDNotice(), true)
+}
@@ -8,6 +8,7 @@ import (
 	"crypto/x509"
 	"encoding/json"
 	"fmt"
+	"net"
 	"sort"
 	"strconv"
 	"strings"
@@ -21,6 +22,7 @@ import (
 
 	"github.com/ergochat/ergo/irc/connection_limits"
 	"github.com/ergochat/ergo/irc/email"
+	"github.com/ergochat/ergo/irc/flatip"
 	"github.com/ergochat/ergo/irc/migrations"
 	"github.com/ergochat/ergo/irc/modes"
 	"github.com/ergochat/ergo/irc/passwd"
@@ -42,16 +44,27 @@ const (
 	keyAccountChannels         = "account.channels %s" // channels registered to the account
 	keyAccountLastSeen         = "account.lastseen %s"
 	keyAccountReadMarkers      = "account.readmarkers %s"
-	keyAccountModes            = "account.modes %s"     // user modes for the always-on client as a string
-	keyAccountRealname         = "account.realname %s"  // client realname stored as string
-	keyAccountSuspended        = "account.suspended %s" // client realname stored as string
+	keyAccountModes            = "account.modes %s"       // user modes for the always-on client as a string
+	keyAccountRealname         = "account.realname %s"    // client realname stored as string
+	keyAccountAwayMessage      = "account.awaymessage %s" // explicit away message of the always-on client
+	keyAccountSuspended        = "account.suspended %s"   // client realname stored as string
 	keyAccountPwReset          = "account.pwreset %s"
+	keyAccountResendCooldown   = "account.resendcooldown %s" // set while RESEND is on cooldown
 	keyAccountEmailChange      = "account.emailchange %s"
+	keyAccountMemos            = "account.memos %s" // memos stored by MemoServ, as JSON
 	// for an always-on client, a map of channel names they're in to their current modes
 	// (not to be confused with their amodes, which a non-always-on client can have):
 	keyAccountChannelToModes = "account.channeltomodes %s"
 
 	maxCertfpsPerAccount = 5
+
+	// after a failed password reset email, how long before another can be requested
+	failedPasswordResetCooldown = time.Minute
+	// how often a new verification code can be sent for a pending account; anyone
+	// can request one, which invalidates the previous code, so this is per-account
+	verificationResendCooldown = 5 * time.Minute
+	// after a failed resend, how long before another can be requested
+	failedVerificationResendCooldown = time.Minute
 )
 
 // everything about accounts is persistent; therefore, the database is the authoritative
@@ -67,6 +80,9 @@ type AccountManager struct {
 	skeletonToAccount map[string]string
 	accountToMethod   map[string]NickEnforcementMethod
 	registerThrottle  connection_limits.GenericThrottle
+	// per-network registration throttle state, keyed by masked IP:
+	registerIPThrottle       map[flatip.IP]connection_limits.ThrottleDetails
+	registerIPThrottlePruned time.Time
 }
 
 func (am *AccountManager) Initialize(server *Server) {
@@ -74,6 +90,7 @@ func (am *AccountManager) Initialize(server *Server) {
 	am.nickToAccount = make(map[string]string)
 	am.skeletonToAccount = make(map[string]string)
 	am.accountToMethod = make(map[string]NickEnforcementMethod)
+	am.registerIPThrottle = make(map[flatip.IP]connection_limits.ThrottleDetails)
 	am.server = server
 
 	config := server.Config()
@@ -99,6 +116,44 @@ func (am *AccountManager) touchRegisterThrottle() (throttled bool) {
 	return
 }
 
+// touchRegisterIPThrottle checks whether another registration is allowed from
+// the network of `ip`, recording it if so
+func (am *AccountManager) touchRegisterIPThrottle(config *Config, ip net.IP) (throttled bool) {
+	throttleConfig := &config.Accounts.Registration.IPThrottling
+	if throttleConfig.MaxAttempts == 0 || utils.IPInNets(ip, throttleConfig.exemptedNets) {
+		return false
+	}
+	key := flatip.FromNetIP(ip)
+	if key.IsIPv4() {
+		key = key.Mask(throttleConfig.CidrLenIPv4, 32)
+	} else {
+		key = key.Mask(throttleConfig.CidrLenIPv6, 128)
+	}
+
+	now := time.Now().UTC()
+	am.Lock()
+	defer am.Unlock()
+
+	// delete expired state, at most once per window, so the map doesn't grow without bound
+	if throttleConfig.Duration < now.Sub(am.registerIPThrottlePruned) {
+		am.registerIPThrottlePruned = now
+		for masked, details := range am.registerIPThrottle {
+			if throttleConfig.Duration < now.Sub(details.Start) {
+				delete(am.registerIPThrottle, masked)
+			}
+		}
+	}
+
+	g := connection_limits.GenericThrottle{
+		ThrottleDetails: am.registerIPThrottle[key],
+		Duration:        throttleConfig.Duration,
+		Limit:           throttleConfig.MaxAttempts,
+	}
+	throttled, _ = g.Touch()
+	am.registerIPThrottle[key] = g.ThrottleDetails
+	return
+}
+
 func (am *AccountManager) createAlwaysOnClients(config *Config) {
 	if config.Accounts.Multiclient.AlwaysOn == PersistentDisabled {
 		return
@@ -134,6 +189,7 @@ func (am *AccountManager) createAlwaysOnClients(config *Config) {
 				am.loadTimeMap(keyAccountReadMarkers, accountName),
 				am.loadModes(accountName),
 				am.loadRealname(accountName),
+				am.loadAwayMessage(accountName),
 			)
 		}
 	}
@@ -366,6 +422,22 @@ func (am *AccountManager) Register(client *Client, account string, callbackNames
 		return errAccountAlreadyLoggedIn
 	}
 
+	if client != nil && !client.HasMode(modes.Operator) &&
+		time.Since(client.ctime) < config.Accounts.Registration.MinConnectionAge {
+		return errAccountRegisterTooSoon
+	}
+
+	if callbackNamespace == "mailto" {
+		if emailErr := config.Accounts.Registration.EmailVerification.CheckAddress(callbackValue); emailErr != nil {
+			return emailErr
+		}
+	}
+
+	if client != nil && am.touchRegisterIPThrottle(config, client.IP()) {
+		am.server.logger.Warning("accounts", "per-network registration throttle exceeded by client", client.Nick())
+		return errLimitExceeded
+	}
+
 	if client != nil && am.touchRegisterThrottle() {
 		am.server.logger.Warning("accounts", "global registration throttle exceeded by client", client.Nick())
 		return errLimitExceeded
@@ -714,6 +786,27 @@ func (am *AccountManager) loadRealname(account string) (realname string) {
 	return
 }
 
+func (am *AccountManager) saveAwayMessage(account string, awayMessage string) {
+	key := fmt.Sprintf(keyAccountAwayMessage, account)
+	am.server.store.Update(func(tx *buntdb.Tx) error {
+		if awayMessage != "" {
+			tx.Set(key, awayMessage, nil)
+		} else {
+			tx.Delete(key)
+		}
+		return nil
+	})
+}
+
+func (am *AccountManager) loadAwayMessage(account string) (awayMessage string) {
+	key := fmt.Sprintf(keyAccountAwayMessage, account)
+	am.server.store.View(func(tx *buntdb.Tx) error {
+		awayMessage, _ = tx.Get(key)
+		return nil
+	})
+	return
+}
+
 func (am *AccountManager) addRemoveCertfp(account, certfp string, add bool, hasPrivs bool) (err error) {
 	certfp, err = utils.NormalizeCertfp(certfp)
 	if err != nil {
@@ -822,6 +915,98 @@ func (am *AccountManager) dispatchMailtoCallback(client *Client, account string,
 	return
 }
 
+// ResendVerificationCode generates a fresh verification code for an account that
+// is pending email verification, and sends it to the address it was registered with.
+func (am *AccountManager) ResendVerificationCode(client *Client, account string) (err error) {
+	casefoldedAccount, err := CasefoldName(account)
+	if err != nil || account == "" || account == "*" {
+		return errAccountDoesNotExist
+	}
+
+	if client.Account() != "" {
+		return errAccountAlreadyLoggedIn
+	}
+
+	if !am.server.Config().Accounts.Registration.EmailVerification.Enabled {
+		return errFeatureDisabled
+	}
+
+	// resending is a registration-like action, with the same potential for spam:
+	if am.touchRegisterThrottle() {
+		am.server.logger.Warning("accounts", "global registration throttle exceeded by client", client.Nick())
+		return errLimitExceeded
+	}
+
+	verificationCodeKey := fmt.Sprintf(keyAccountVerificationCode, casefoldedAccount)
+
+	var raw rawClientAccount
+	var ttl time.Duration
+	err = am.server.store.View(func(tx *buntdb.Tx) error {
+		raw, err = am.loadRawAccount(tx, casefoldedAccount)
+		if err != nil {
+			return err
+		} else if raw.Verified {
+			return errAccountAlreadyVerified
+		}
+		ttl, err = tx.TTL(verificationCodeKey)
+		return err
+	})
+	if err != nil {
+		if err == buntdb.ErrNotFound {
+			err = errAccountDoesNotExist
+		}
+		return
+	}
+
+	var settings AccountSettings
+	json.Unmarshal([]byte(raw.Settings), &settings)
+	if settings.Email == "" {
+		// registered via some other callback, or SAREGISTER'ed
+		return errAccountVerificationFailed
+	}
+
+	// anyone can request a resend, invalidating the previous code, so limit
+	// how often that can happen to a given account:
+	cooldownKey := fmt.Sprintf(keyAccountResendCooldown, casefoldedAccount)
+	err = am.server.store.Update(func(tx *buntdb.Tx) error {
+		if _, err := tx.Get(cooldownKey); err == nil {
+			return errLimitExceeded
+		}
+		_, _, err := tx.Set(cooldownKey, "1", &buntdb.SetOptions{Expires: true, TTL: verificationResendCooldown})
+		return err
+	})
+	if err != nil {
+		return
+	}
+
+	code, err := am.dispatchMailtoCallback(client, raw.Name, settings.Email)
+	if err != nil {
+		// the previous code is still valid, so shorten the cooldown
+		// (but keep one, so that failures can't be used to flood the mail server)
+		am.server.store.Update(func(tx *buntdb.Tx) error {
+			if _, err := tx.Get(cooldownKey); err == nil {
+				tx.Set(cooldownKey, "1", &buntdb.SetOptions{Expires: true, TTL: failedVerificationResendCooldown})
+			}
+			return nil
+		})
+		return &registrationCallbackError{underlying: err}
+	}
+
+	// keep the expiration time of the pending registration:
+	var setOptions *buntdb.SetOptions
+	if ttl > 0 {
+		setOptions = &buntdb.SetOptions{Expires: true, TTL: ttl}
+	}
+	return am.server.store.Update(func(tx *buntdb.Tx) error {
+		if _, err := tx.Get(verificationCodeKey); err != nil {
+			// the registration expired or was verified in the meantime
+			return errAccountVerificationFailed
+		}
+		_, _, err = tx.Set(verificationCodeKey, code, setOptions)
+		return err
+	})
+}
+
 func (am *AccountManager) Verify(client *Client, account string, code string, admin bool) error {
 	casefoldedAccount, err := CasefoldName(account)
 	var skeleton string
@@ -885,6 +1070,7 @@ func (am *AccountManager) Verify(client *Client, account string, code string, ad
 				return errAccountAlreadyVerified
 			}
 
+			settings := raw.Settings
 			if !admin {
 				// actually verify the code
 				// a stored code of "" means a none callback / no code required
@@ -899,6 +1085,11 @@ func (am *AccountManager) Verify(client *Client, account string, code string, ad
 				if !success {
 					return errAccountVerificationInvalidCode
 				}
+				if storedCode != "" {
+					// the code was e-mailed to the registration address,
+					// so the user has proven they control it
+					settings = markEmailVerified(settings)
+				}
 			}
 
 			// verify the account
@@ -910,7 +1101,7 @@ func (am *AccountManager) Verify(client *Client, account string, code string, ad
 			tx.Set(accountNameKey, raw.Name, nil)
 			tx.Set(registeredTimeKey, raw.RegisteredAt, nil)
 			tx.Set(credentialsKey, raw.Credentials, nil)
-			tx.Set(settingsKey, raw.Settings, nil)
+			tx.Set(settingsKey, settings, nil)
 
 			var creds AccountCredentials
 			// XXX we shouldn't do (de)serialization inside the txn,
@@ -972,6 +1163,26 @@ func (am *AccountManager) SARegister(account, passphrase string) (err error) {
 	return
 }
 
+// markEmailVerified records, in serialized account settings, that the
+// stored e-mail address has been confirmed
+func markEmailVerified(settingsStr string) string {
+	var settings AccountSettings
+	if settingsStr != "" {
+		if err := json.Unmarshal([]byte(settingsStr), &settings); err != nil {
+			return settingsStr
+		}
+	}
+	if settings.Email == "" {
+		return settingsStr
+	}
+	settings.EmailVerified = true
+	j, err := json.Marshal(settings)
+	if err != nil {
+		return settingsStr
+	}
+	return string(j)
+}
+
 type EmailChangeRecord struct {
 	TimeCreated time.Time
 	Code        string
@@ -993,6 +1204,9 @@ func (am *AccountManager) NsSetEmail(client *Client, emailAddr string) (err erro
 	if !config.Accounts.Registration.EmailVerification.Enabled {
 		return errFeatureDisabled // redundant check, just in case
 	}
+	if err = config.Accounts.Registration.EmailVerification.CheckAddress(emailAddr); err != nil {
+		return err
+	}
 	record := EmailChangeRecord{
 		TimeCreated: time.Now().UTC(),
 		Code:        utils.GenerateSecretToken(),
@@ -1059,6 +1273,7 @@ func (am *AccountManager) NsVerifyEmail(client *Client, code string) (err error)
 	munger := func(in AccountSettings) (out AccountSettings, err error) {
 		out = in
 		out.Email = record.Email
+		out.EmailVerified = true
 		return
 	}
 
@@ -1116,14 +1331,24 @@ func (am *AccountManager) NsSendpass(client *Client, accountName string) (err er
 		return
 	}
 
-	subject := fmt.Sprintf(client.t("Reset your password on %s"), am.server.name)
+	// the requester need not be the account owner, so prefer the languages
+	// stored with the account over the requester's own
+	languages := account.Settings.Languages
+	if len(languages) == 0 {
+		languages = client.Languages()
+	}
+	lm := am.server.Languages()
+	t := func(s string) string {
+		return lm.Translate(languages, s)
+	}
+	subject := fmt.Sprintf(t("Reset your password on %s"), am.server.name)
 	message := email.ComposeMail(config.Accounts.Registration.EmailVerification, account.Settings.Email, subject)
-	fmt.Fprintf(&message, client.t("We received a request to reset your password on %[1]s for account: %[2]s"), am.server.name, account.Name)
+	fmt.Fprintf(&message, t("We received a request to reset your password on %[1]s for account: %[2]s"), am.server.name, account.Name)
 	message.WriteString("\r\n")
-	fmt.Fprintf(&message, client.t("If you did not initiate this request, you can safely ignore this message."))
+	fmt.Fprintf(&message, t("If you did not initiate this request, you can safely ignore this message."))
 	message.WriteString("\r\n")
 	message.WriteString("\r\n")
-	message.WriteString(client.t("Otherwise, to reset your password, issue the following command (replace `new_password` with your desired password):"))
+	message.WriteString(t("Otherwise, to reset your password, issue the following command (replace `new_password` with your desired password):"))
 	message.WriteString("\r\n")
 	fmt.Fprintf(&message, "/MSG NickServ RESETPASS %s %s new_password\r\n", account.Name, record.Code)
 
@@ -1133,9 +1358,25 @@ func (am *AccountManager) NsSendpass(client *Client, accountName string) (err er
 			fmt.Sprintf("client %s sent a password reset email for account %s", client.Nick(), account.Name))
 	} else {
 		am.server.logger.Error("internal", "Failed to dispatch e-mail to", account.Settings.Email, err.Error())
+		// the code was never delivered: invalidate it, and shorten the cooldown
+		// (but keep one, so that failures can't be used to flood the mail server)
+		record.Code = ""
+		failedBytes, _ := json.Marshal(record)
+		cooldown := time.Duration(config.Accounts.Registration.EmailVerification.PasswordReset.Cooldown)
+		if cooldown > failedPasswordResetCooldown {
+			cooldown = failedPasswordResetCooldown
+		}
+		am.server.store.Update(func(tx *buntdb.Tx) error {
+			if recStr, _ := tx.Get(recordKey); recStr == recordVal {
+				tx.Set(recordKey, string(failedBytes), &buntdb.SetOptions{
+					Expires: true,
+					TTL:     cooldown,
+				})
+			}
+			return nil
+		})
 	}
 	return
-
 }
 
 func (am *AccountManager) NsResetpass(client *Client, accountName, code, password string) (err error) {
@@ -1385,7 +1626,10 @@ func (am *AccountManager) loadWithAutocreation(accountName string, autocreate bo
 	return
 }
 
-func (am *AccountManager) AuthenticateByPassphrase(client *Client, accountName string, passphrase string) (err error) {
+// AuthenticateByPassphrase logs the client into an account using a password;
+// certfp is the client certificate fingerprint of the authenticating session, if any,
+// and is passed along to the auth-script (it isn't otherwise required to match).
+func (am *AccountManager) AuthenticateByPassphrase(client *Client, accountName string, passphrase string, certfp string) (err error) {
 	// XXX check this now, so we don't allow a redundant login for an always-on client
 	// even for a brief period. the other potential source of nick-account conflicts
 	// is from force-nick-equals-account, but those will be caught later by
@@ -1412,7 +1656,7 @@ func (am *AccountManager) AuthenticateByPassphrase(client *Client, accountName s
 	if config.Accounts.AuthScript.Enabled {
 		var output AuthScriptOutput
 		output, err = CheckAuthScript(am.server.semaphores.AuthScript, config.Accounts.AuthScript.ScriptConfig,
-			AuthScriptInput{AccountName: accountName, Passphrase: passphrase, IP: client.IP().String()})
+			AuthScriptInput{AccountName: accountName, Passphrase: passphrase, Certfp: certfp, IP: client.IP().String()})
 		if err != nil {
 			am.server.logger.Error("internal", "failed shell auth invocation", err.Error())
 		} else if output.Success {
@@ -1772,9 +2016,12 @@ func (am *AccountManager) Unregister(account string, erase bool) error {
 	unregisteredKey := fmt.Sprintf(keyAccountUnregistered, casefoldedAccount)
 	modesKey := fmt.Sprintf(keyAccountModes, casefoldedAccount)
 	realnameKey := fmt.Sprintf(keyAccountRealname, casefoldedAccount)
+	awayMessageKey := fmt.Sprintf(keyAccountAwayMessage, casefoldedAccount)
 	suspendedKey := fmt.Sprintf(keyAccountSuspended, casefoldedAccount)
 	pwResetKey := fmt.Sprintf(keyAccountPwReset, casefoldedAccount)
+	resendCooldownKey := fmt.Sprintf(keyAccountResendCooldown, casefoldedAccount)
 	emailChangeKey := fmt.Sprintf(keyAccountEmailChange, casefoldedAccount)
+	memosKey := fmt.Sprintf(keyAccountMemos, casefoldedAccount)
 
 	var clients []*Client
 	defer func() {
@@ -1834,9 +2081,12 @@ func (am *AccountManager) Unregister(account string, erase bool) error {
 		tx.Delete(readMarkersKey)
 		tx.Delete(modesKey)
 		tx.Delete(realnameKey)
+		tx.Delete(awayMessageKey)
 		tx.Delete(suspendedKey)
 		tx.Delete(pwResetKey)
+		tx.Delete(resendCooldownKey)
 		tx.Delete(emailChangeKey)
+		tx.Delete(memosKey)
 
 		return nil
 	})
@@ -2013,8 +2263,18 @@ func (am *AccountManager) ModifyAccountSettings(account string, munger settingsM
 
 // represents someone's status in hostserv
 type VHostInfo struct {
-	ApprovedVHost string
-	Enabled       bool
+	ApprovedVHost   string
+	Enabled         bool
+	RequestedVHost  string
+	RejectedVHost   string
+	RejectionReason string
+	LastRequestTime time.Time
+}
+
+// pending vhost request, as displayed by HS WAITING
+type PendingVHostRequest struct {
+	VHostInfo
+	Account string
 }
 
 // callback type implementing the actual business logic of vhost operations
@@ -2031,6 +2291,84 @@ func (am *AccountManager) VHostSet(account string, vhost string) (result VHostIn
 	return am.performVHostChange(account, munger)
 }
 
+func (am *AccountManager) VHostRequest(account string, vhost string, cooldown time.Duration) (result VHostInfo, err error) {
+	munger := func(input VHostInfo) (output VHostInfo, err error) {
+		output = input
+		if !input.LastRequestTime.IsZero() && time.Since(input.LastRequestTime) < cooldown {
+			err = errLimitExceeded
+			return
+		}
+		output.RequestedVHost = vhost
+		output.RejectedVHost = ""
+		output.RejectionReason = ""
+		output.LastRequestTime = time.Now().UTC()
+		return
+	}
+
+	return am.performVHostChange(account, munger)
+}
+
+func (am *AccountManager) VHostApprove(account string) (result VHostInfo, err error) {
+	munger := func(input VHostInfo) (output VHostInfo, err error) {
+		if input.RequestedVHost == "" {
+			err = errNoVhostRequest
+			return
+		}
+		output = input
+		output.ApprovedVHost = input.RequestedVHost
+		output.Enabled = true
+		output.RequestedVHost = ""
+		return
+	}
+
+	return am.performVHostChange(account, munger)
+}
+
+func (am *AccountManager) VHostReject(account string, reason string) (result VHostInfo, err error) {
+	munger := func(input VHostInfo) (output VHostInfo, err error) {
+		if input.RequestedVHost == "" {
+			err = errNoVhostRequest
+			return
+		}
+		output = input
+		output.RejectedVHost = input.RequestedVHost
+		output.RejectionReason = reason
+		output.RequestedVHost = ""
+		return
+	}
+
+	return am.performVHostChange(account, munger)
+}
+
+// VHostListRequests returns up to `limit` pending vhost requests, oldest first,
+// along with the total number of pending requests
+func (am *AccountManager) VHostListRequests(limit int) (requests []PendingVHostRequest, total int) {
+	vhostPrefix := fmt.Sprintf(keyAccountVHost, "")
+	am.server.store.View(func(tx *buntdb.Tx) error {
+		return tx.AscendGreaterOrEqual("", vhostPrefix, func(key, value string) bool {
+			if !strings.HasPrefix(key, vhostPrefix) {
+				return false
+			}
+			var info VHostInfo
+			if json.Unmarshal([]byte(value), &info) == nil && info.RequestedVHost != "" {
+				requests = append(requests, PendingVHostRequest{
+					VHostInfo: info,
+					Account:   strings.TrimPrefix(key, vhostPrefix),
+				})
+			}
+			return true
+		})
+	})
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].LastRequestTime.Before(requests[j].LastRequestTime)
+	})
+	total = len(requests)
+	if limit < len(requests) {
+		requests = requests[:limit]
+	}
+	return
+}
+
 func (am *AccountManager) VHostSetEnabled(client *Client, enabled bool) (result VHostInfo, err error) {
 	munger := func(input VHostInfo) (output VHostInfo, err error) {
 		if input.ApprovedVHost == "" {
@@ -2134,6 +2472,16 @@ func (am *AccountManager) Login(client *Client, account ClientAccount) {
 }
 
 func (am *AccountManager) Logout(client *Client) {
+	accountName := client.AccountName()
+	settings := client.AccountSettings()
+	if am.logout(client) && settings.ForgetOnLogout && historyForgetEnabled(am.server.Config()) {
+		// the last client of the account is gone; delete its history as requested
+		go am.server.ForgetHistory(accountName)
+	}
+}
+
+// logout logs out a client, returning whether it was the last one logged into its account
+func (am *AccountManager) logout(client *Client) (last bool) {
 	am.Lock()
 	defer am.Unlock()
 
@@ -2147,7 +2495,7 @@ func (am *AccountManager) Logout(client *Client) {
 	clients := am.accountToClients[casefoldedAccount]
 	if len(clients) <= 1 {
 		delete(am.accountToClients, casefoldedAccount)
-		return
+		return true
 	}
 	remainingClients := make([]*Client, len(clients)-1)
 	remainingPos := 0
@@ -2158,6 +2506,7 @@ func (am *AccountManager) Logout(client *Client) {
 		}
 	}
 	am.accountToClients[casefoldedAccount] = remainingClients
+	return
 }
 
 var (
@@ -2352,9 +2701,24 @@ type AccountSettings struct {
 	ReplayJoins      ReplayJoinsSetting
 	AlwaysOn         PersistentStatus
 	AutoreplayMissed bool
-	DMHistory        HistoryStatus
-	AutoAway         PersistentStatus
-	Email            string
+	// if nonzero, autoreplay of missed messages goes back no further than this
+	AutoreplayWindow time.Duration
+	// if nonzero, autoreplay of missed messages replays at most this many lines per target
+	AutoreplayWindowLines int
+	DMHistory             HistoryStatus
+	AutoAway              PersistentStatus
+	Email                 string
+	// whether the user confirmed Email by answering a code sent to it
+	EmailVerified bool
+	// the zero values of these hide the e-mail address, allow DMs,
+	// and allow memo notifications:
+	ShowEmail            bool
+	BlockPrivateMessages bool
+	ForgetOnLogout       bool
+	DisableMemoEmails    bool
+	// applied on every login:
+	UserModes string
+	Languages []string
 }
 
 // ClientAccount represents a user account.
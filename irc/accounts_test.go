@@ -0,0 +1,194 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package irc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/tidwall/buntdb"
+
+	"github.com/ergochat/ergo/irc/connection_limits"
+	"github.com/ergochat/ergo/irc/flatip"
+	"github.com/ergochat/ergo/irc/history"
+	"github.com/ergochat/ergo/irc/languages"
+	"github.com/ergochat/ergo/irc/logger"
+)
+
+func TestRegisterIPThrottle(t *testing.T) {
+	var config Config
+	config.Accounts.Registration.IPThrottling = IPThrottleConfig{
+		Enabled:     true,
+		Duration:    time.Hour,
+		MaxAttempts: 2,
+		CidrLenIPv6: 64,
+		Exempted:    []string{"192.168.0.0/16"},
+	}
+	if err := config.Accounts.Registration.IPThrottling.postprocess(); err != nil {
+		t.Fatal(err)
+	}
+	am := &AccountManager{
+		registerIPThrottle: make(map[flatip.IP]connection_limits.ThrottleDetails),
+	}
+	touch := func(ip string) bool {
+		return am.touchRegisterIPThrottle(&config, net.ParseIP(ip))
+	}
+
+	assertEqual(touch("8.8.8.8"), false)
+	assertEqual(touch("8.8.8.8"), false)
+	assertEqual(touch("8.8.8.8"), true)
+	// IPv4 addresses are throttled individually by default
+	assertEqual(touch("8.8.4.4"), false)
+
+	// IPv6 addresses are throttled per /64
+	assertEqual(touch("2001:db8::1"), false)
+	assertEqual(touch("2001:db8::2"), false)
+	assertEqual(touch("2001:db8::3"), true)
+	assertEqual(touch("2001:db8:0:1::1"), false)
+
+	// exempted networks are never throttled
+	for i := 0; i < 5; i++ {
+		assertEqual(touch("192.168.1.1"), false)
+	}
+
+	config.Accounts.Registration.IPThrottling.Enabled = false
+	if err := config.Accounts.Registration.IPThrottling.postprocess(); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(touch("8.8.8.8"), false)
+}
+
+// forgetRecorder is a history.Database that records calls to Forget
+type forgetRecorder struct {
+	history.Database
+	forgotten chan string
+}
+
+func (f *forgetRecorder) Forget(account string) {
+	f.forgotten <- account
+}
+
+func TestLogoutForgetHistory(t *testing.T) {
+	var config Config
+	config.History.Enabled = true
+	config.History.Persistent.Enabled = true
+	config.History.Persistent.RegisteredChannels = PersistentMandatory
+	config.History.Persistent.UnregisteredChannels = true
+	config.History.Persistent.DirectMessages = PersistentMandatory
+	config.History.Retention.EnableAccountIndexing = true
+	recorder := &forgetRecorder{forgotten: make(chan string, 1)}
+	server := &Server{historyDB: recorder}
+	server.config.Set(&config)
+	am := &AccountManager{
+		server:           server,
+		accountToClients: make(map[string][]*Client),
+	}
+
+	newClient := func() *Client {
+		client := &Client{
+			server:          server,
+			account:         "alice",
+			accountName:     "Alice",
+			accountSettings: AccountSettings{ForgetOnLogout: true},
+		}
+		am.accountToClients["alice"] = append(am.accountToClients["alice"], client)
+		return client
+	}
+	first, second := newClient(), newClient()
+
+	// logging out the first client leaves the account logged in
+	am.Logout(first)
+	assertEqual(first.Account(), "")
+	assertEqual(len(am.accountToClients["alice"]), 1)
+	assertEqual(am.logout(first), false)
+	select {
+	case account := <-recorder.forgotten:
+		t.Fatalf("history of %s forgotten with a client still logged in", account)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// logging out the last client deletes the history
+	am.Logout(second)
+	assertEqual(len(am.accountToClients["alice"]), 0)
+	select {
+	case account := <-recorder.forgotten:
+		assertEqual(account, "alice")
+	case <-time.After(time.Second):
+		t.Fatal("history was not forgotten after the last logout")
+	}
+
+	// without the account index, persistent history can't be forgotten
+	noIndexConfig := config
+	noIndexConfig.History.Retention.EnableAccountIndexing = false
+	assertEqual(historyForgetEnabled(&noIndexConfig), false)
+	server.config.Set(&noIndexConfig)
+	am.Logout(newClient())
+	select {
+	case account := <-recorder.forgotten:
+		t.Fatalf("history of %s forgotten without account indexing", account)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// ephemeral history can always be forgotten
+	noIndexConfig.History.Persistent.Enabled = false
+	assertEqual(historyForgetEnabled(&noIndexConfig), true)
+}
+
+func TestMarkEmailVerified(t *testing.T) {
+	var settings AccountSettings
+	json.Unmarshal([]byte(markEmailVerified(`{"Email":"alice@example.com"}`)), &settings)
+	assertEqual(settings.Email, "alice@example.com")
+	assertEqual(settings.EmailVerified, true)
+
+	// nothing to verify without an address
+	assertEqual(markEmailVerified(""), "")
+	assertEqual(markEmailVerified(`{"ShowEmail":true}`), `{"ShowEmail":true}`)
+}
+
+func TestResendVerificationCooldown(t *testing.T) {
+	var config Config
+	config.languageManager = new(languages.Manager)
+	config.Accounts.Registration.EmailVerification.Enabled = true
+	store, err := buntdb.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	server := &Server{store: store, logger: new(logger.Manager)}
+	server.config.Set(&config)
+	am := &AccountManager{server: server}
+	client := &Client{server: server}
+
+	// set up a pending account whose address can't be mailed to
+	store.Update(func(tx *buntdb.Tx) error {
+		tx.Set(fmt.Sprintf(keyAccountExists, "alice"), "1", nil)
+		tx.Set(fmt.Sprintf(keyAccountName, "alice"), "Alice", nil)
+		tx.Set(fmt.Sprintf(keyAccountSettings, "alice"), `{"Email":"invalid"}`, nil)
+		tx.Set(fmt.Sprintf(keyAccountVerificationCode, "alice"), "code", nil)
+		return nil
+	})
+	cooldownTTL := func() (ttl time.Duration) {
+		store.View(func(tx *buntdb.Tx) error {
+			ttl, _ = tx.TTL(fmt.Sprintf(keyAccountResendCooldown, "alice"))
+			return nil
+		})
+		return
+	}
+
+	// a failed send keeps the old code, and only a short cooldown
+	_, ok := am.ResendVerificationCode(client, "alice").(*registrationCallbackError)
+	assertEqual(ok, true)
+	if ttl := cooldownTTL(); ttl <= 0 || ttl > failedVerificationResendCooldown {
+		t.Fatalf("unexpected cooldown after a failed send: %v", ttl)
+	}
+	assertEqual(am.ResendVerificationCode(client, "alice"), errLimitExceeded)
+	store.View(func(tx *buntdb.Tx) error {
+		code, _ := tx.Get(fmt.Sprintf(keyAccountVerificationCode, "alice"))
+		assertEqual(code, "code")
+		return nil
+	})
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package irc
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ergochat/ergo/irc/utils"
+)
+
+// support for systemd-style socket activation: a supervisor process binds
+// the listening sockets and passes them to us as file descriptors 3, 4, ...,
+// so that the server process can be restarted (e.g., to upgrade the binary)
+// without ever refusing new connections. see sd_listen_fds(3).
+
+const (
+	listenFdsStart = 3
+)
+
+var (
+	inheritedListenersOnce  sync.Once
+	inheritedListenersMutex sync.Mutex
+	// maps normalized listen addresses to (close-on-exec) duplicates of the
+	// inherited sockets. these stay open while their address is configured,
+	// so that a listener that is stopped during rehash can be recreated later
+	inheritedListeners map[string]*os.File
+)
+
+func loadInheritedListeners() {
+	pid, _ := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	numFds, _ := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	// don't leak these to subprocesses (e.g., auth scripts)
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if pid != os.Getpid() || numFds <= 0 {
+		return
+	}
+
+	inheritedListeners = make(map[string]*os.File, numFds)
+	for fd := listenFdsStart; fd < listenFdsStart+numFds; fd++ {
+		file := os.NewFile(uintptr(fd), fmt.Sprintf("listen-fd-%d", fd))
+		listener, err := net.FileListener(file)
+		// the original descriptor isn't close-on-exec; we only keep a duplicate
+		file.Close()
+		if err != nil {
+			continue
+		}
+		if filer, ok := listener.(interface{ File() (*os.File, error) }); ok {
+			if dup, err := filer.File(); err == nil {
+				inheritedListeners[normalizeListenAddr(listener.Addr().Network(), listener.Addr().String())] = dup
+			}
+		}
+		listener.Close()
+	}
+}
+
+// normalizeListenAddr canonicalizes an address so that a configured listen
+// address (e.g., ":6667") can be compared with the address of an inherited
+// socket (e.g., "[::]:6667")
+func normalizeListenAddr(network, addr string) string {
+	if network == "unix" {
+		return "unix:" + strings.TrimPrefix(addr, "unix:")
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = ""
+	} else if ip != nil {
+		host = ip.String()
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// getInheritedListener returns a listener for addr from the sockets passed
+// to us via socket activation, if there is one
+func getInheritedListener(addr string, isUnix bool) (listener net.Listener, ok bool) {
+	inheritedListenersOnce.Do(loadInheritedListeners)
+	inheritedListenersMutex.Lock()
+	defer inheritedListenersMutex.Unlock()
+	if inheritedListeners == nil {
+		return nil, false
+	}
+	network := "tcp"
+	if isUnix {
+		network = "unix"
+	}
+	file, ok := inheritedListeners[normalizeListenAddr(network, addr)]
+	if !ok {
+		return nil, false
+	}
+	// FileListener creates a new duplicate, so file remains usable after the
+	// listener is closed
+	listener, err := net.FileListener(file)
+	if err != nil {
+		return nil, false
+	}
+	return listener, true
+}
+
+// closeUnconfiguredInheritedListeners closes the inherited sockets whose
+// addresses are not among addrs (the configured listen addresses), so that
+// a listener removed from the config stops accepting connections at the
+// kernel level as well
+func closeUnconfiguredInheritedListeners(addrs []string) {
+	inheritedListenersOnce.Do(loadInheritedListeners)
+	inheritedListenersMutex.Lock()
+	defer inheritedListenersMutex.Unlock()
+	if len(inheritedListeners) == 0 {
+		return
+	}
+	configured := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		network := "tcp"
+		if utils.IsUnixListenAddr(addr) {
+			network = "unix"
+		}
+		configured[normalizeListenAddr(network, addr)] = true
+	}
+	for addr, file := range inheritedListeners {
+		if !configured[addr] {
+			file.Close()
+			delete(inheritedListeners, addr)
+		}
+	}
+}
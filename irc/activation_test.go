@@ -0,0 +1,64 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package irc
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestNormalizeListenAddr(t *testing.T) {
+	cases := []struct {
+		network, addr, expected string
+	}{
+		{"tcp", ":6667", ":6667"},
+		{"tcp", "[::]:6667", ":6667"},
+		{"tcp", "0.0.0.0:6667", ":6667"},
+		{"tcp", "127.0.0.1:6697", "127.0.0.1:6697"},
+		{"tcp", "[::1]:6697", "[::1]:6697"},
+		{"tcp", "[0:0:0:0:0:0:0:1]:6697", "[::1]:6697"},
+		{"tcp", "localhost:6667", "localhost:6667"},
+		{"unix", "/run/ergo.sock", "unix:/run/ergo.sock"},
+		{"unix", "unix:/run/ergo.sock", "unix:/run/ergo.sock"},
+		// not host:port; returned unchanged
+		{"tcp", "6667", "6667"},
+	}
+	for _, c := range cases {
+		if found := normalizeListenAddr(c.network, c.addr); found != c.expected {
+			t.Errorf("normalizeListenAddr(%s, %s): expected %s, got %s", c.network, c.addr, c.expected, found)
+		}
+	}
+}
+
+func TestCloseUnconfiguredInheritedListeners(t *testing.T) {
+	inheritedListenersOnce.Do(func() {})
+	openFile := func() *os.File {
+		file, err := os.CreateTemp(t.TempDir(), "fd")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+	kept, dropped, unix := openFile(), openFile(), openFile()
+	inheritedListeners = map[string]*os.File{
+		":6667":               kept,
+		"127.0.0.1:6697":      dropped,
+		"unix:/run/ergo.sock": unix,
+	}
+	defer func() { inheritedListeners = nil }()
+
+	closeUnconfiguredInheritedListeners([]string{"[::]:6667", "/run/ergo.sock"})
+
+	assertEqual(len(inheritedListeners), 2)
+	assertEqual(inheritedListeners[":6667"], kept)
+	assertEqual(inheritedListeners["unix:/run/ergo.sock"], unix)
+	if err := dropped.Close(); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("unconfigured inherited listener was not closed")
+	}
+	if err := kept.Close(); err != nil {
+		t.Errorf("configured inherited listener was closed")
+	}
+	unix.Close()
+}
@@ -0,0 +1,512 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package irc
+
+import (
+	"bytes"
+	"crypto/tls"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ergochat/irc-go/ircfmt"
+
+	"github.com/ergochat/ergo/irc/custime"
+	"github.com/ergochat/ergo/irc/flatip"
+	"github.com/ergochat/ergo/irc/modes"
+	"github.com/ergochat/ergo/irc/sno"
+	"github.com/ergochat/ergo/irc/utils"
+)
+
+// the HTTP admin API: a JSON interface for external moderation tools,
+// authenticated with bearer tokens from the config file. read endpoints
+// use GET, write endpoints use POST with a JSON request body.
+
+const (
+	// name used for bans and notices originating from the API
+	apiOperName = "API"
+	// limit on the size of request bodies
+	apiMaxRequestSize = 64 * 1024
+)
+
+type apiHandlerFunc func(server *Server, r *http.Request) (result interface{}, status int, err error)
+
+type apiErrorResponse struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error"`
+}
+
+type apiSuccessResponse struct {
+	Success bool `json:"success"`
+}
+
+var (
+	errAPIBadRequest = fmt.Errorf("Invalid request")
+	errAPINoSuchNick = fmt.Errorf("No such nick")
+)
+
+func (server *Server) setupAPIListener(config *Config) {
+	apiConfig := &config.API
+	listener := apiConfig.Listener
+	if !apiConfig.Enabled {
+		listener = ""
+	}
+	useTLS := apiConfig.tlsCert != nil
+	if server.apiServer != nil {
+		if listener == "" || listener != server.apiServer.Addr || useTLS != server.apiServerTLS {
+			server.logger.Info("server", "Stopping API listener", server.apiServer.Addr)
+			server.apiServer.Close()
+			server.apiServer = nil
+		}
+	}
+	if listener != "" && server.apiServer == nil {
+		as := &http.Server{
+			Addr:              listener,
+			Handler:           server.apiMux(),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		if useTLS {
+			// look up the certificate on each handshake, so that it can be rehashed
+			as.TLSConfig = &tls.Config{
+				GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+					return server.Config().API.tlsCert, nil
+				},
+			}
+		}
+		go func() {
+			var err error
+			if useTLS {
+				err = as.ListenAndServeTLS("", "")
+			} else {
+				err = as.ListenAndServe()
+			}
+			if err != nil && err != http.ErrServerClosed {
+				server.logger.Error("server", "API listener failed", err.Error())
+			}
+		}()
+		server.apiServer = as
+		server.apiServerTLS = useTLS
+		server.logger.Info("server", "Started API listener", as.Addr)
+	}
+}
+
+func (server *Server) apiMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/v1/status", server.apiHandler(http.MethodGet, apiStatusHandler))
+	mux.Handle("/v1/clients", server.apiHandler(http.MethodGet, apiClientsHandler))
+	mux.Handle("/v1/channels", server.apiHandler(http.MethodGet, apiChannelsHandler))
+	mux.Handle("/v1/bans", server.apiHandler(http.MethodGet, apiBansHandler))
+	mux.Handle("/v1/kill", server.apiHandler(http.MethodPost, apiKillHandler))
+	mux.Handle("/v1/dline", server.apiHandler(http.MethodPost, apiDlineHandler))
+	mux.Handle("/v1/rehash", server.apiHandler(http.MethodPost, apiRehashHandler))
+	mux.Handle("/v1/notice", server.apiHandler(http.MethodPost, apiNoticeHandler))
+	mux.Handle("/v1/dashboard", server.apiHandler(http.MethodGet, apiDashboardHandler))
+	// the dashboard page itself contains no data, so it doesn't require
+	// authentication; it prompts for a bearer token and uses the API
+	mux.HandleFunc("/dashboard", serveDashboard)
+	return mux
+}
+
+// apiHandler wraps an API endpoint with authentication and JSON encoding
+func (server *Server) apiHandler(method string, handler apiHandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer server.HandlePanic()
+
+		w.Header().Set("Content-Type", "application/json")
+		if !server.apiAuthenticate(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			apiWriteError(w, http.StatusUnauthorized, "Invalid or missing bearer token")
+			return
+		}
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			apiWriteError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		if method == http.MethodPost {
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, apiMaxRequestSize))
+			if err != nil {
+				apiWriteError(w, http.StatusBadRequest, errAPIBadRequest.Error())
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			entry := AuditEntry{
+				Oper:    apiOperName,
+				Command: "API " + r.URL.Path,
+			}
+			if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+				entry.IP = host
+			}
+			if trimmed := strings.TrimSpace(string(body)); trimmed != "" {
+				entry.Params = []string{trimmed}
+			}
+			if err := server.audit.Record(entry); err != nil {
+				server.logger.Error("internal", "couldn't write to audit log", err.Error())
+			}
+		}
+
+		result, status, err := handler(server, r)
+		if err != nil {
+			if status == 0 {
+				status = http.StatusBadRequest
+			}
+			apiWriteError(w, status, err.Error())
+			return
+		}
+		if result == nil {
+			result = apiSuccessResponse{Success: true}
+		}
+		if status == 0 {
+			status = http.StatusOK
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(result)
+	})
+}
+
+func (server *Server) apiAuthenticate(r *http.Request) bool {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return false
+	}
+	supplied := strings.TrimPrefix(header, "Bearer ")
+	// check every token, to avoid leaking which one matched via timing
+	matched := false
+	for _, token := range server.Config().API.BearerTokens {
+		if utils.SecretTokensMatch(token, supplied) {
+			matched = true
+		}
+	}
+	return matched
+}
+
+func apiWriteError(w http.ResponseWriter, status int, message string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(apiErrorResponse{Success: false, Error: message})
+}
+
+func apiReadRequest(r *http.Request, request interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, r.Body, apiMaxRequestSize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(request); err != nil {
+		return errAPIBadRequest
+	}
+	return nil
+}
+
+type apiStatusResponse struct {
+	Version      string    `json:"version"`
+	Network      string    `json:"network"`
+	Server       string    `json:"server"`
+	StartTime    time.Time `json:"start_time"`
+	Users        int       `json:"users"`
+	MaxUsers     int       `json:"max_users"`
+	Invisible    int       `json:"invisible"`
+	Operators    int       `json:"operators"`
+	Unregistered int       `json:"unregistered"`
+	Channels     int       `json:"channels"`
+}
+
+func apiStatusHandler(server *Server, r *http.Request) (result interface{}, status int, err error) {
+	stats := server.stats.GetValues()
+	return apiStatusResponse{
+		Version:      Ver,
+		Network:      server.Config().Network.Name,
+		Server:       server.name,
+		StartTime:    server.ctime,
+		Users:        stats.Total,
+		MaxUsers:     stats.Max,
+		Invisible:    stats.Invisible,
+		Operators:    stats.Operators,
+		Unregistered: stats.Unknown,
+		Channels:     server.channels.Len(),
+	}, 0, nil
+}
+
+type apiMemoryStats struct {
+	// bytes of allocated heap objects
+	HeapAlloc uint64 `json:"heap_alloc"`
+	// bytes of memory obtained from the OS
+	Sys        uint64 `json:"sys"`
+	NumGC      uint32 `json:"num_gc"`
+	Goroutines int    `json:"goroutines"`
+}
+
+type apiDashboardResponse struct {
+	Status      apiStatusResponse `json:"status"`
+	Memory      apiMemoryStats    `json:"memory"`
+	OperActions []RecentNotice    `json:"oper_actions"`
+}
+
+func apiDashboardHandler(server *Server, r *http.Request) (result interface{}, status int, err error) {
+	statusResponse, _, _ := apiStatusHandler(server, r)
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	return apiDashboardResponse{
+		Status: statusResponse.(apiStatusResponse),
+		Memory: apiMemoryStats{
+			HeapAlloc:  memStats.HeapAlloc,
+			Sys:        memStats.Sys,
+			NumGC:      memStats.NumGC,
+			Goroutines: runtime.NumGoroutine(),
+		},
+		OperActions: server.snomasks.Recent(),
+	}, 0, nil
+}
+
+//go:embed dashboard.html
+var dashboardPage []byte
+
+func serveDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Write(dashboardPage)
+}
+
+type apiClientInfo struct {
+	Nick     string    `json:"nick"`
+	Username string    `json:"username"`
+	Hostname string    `json:"hostname"`
+	IP       string    `json:"ip"`
+	Realname string    `json:"realname"`
+	Account  string    `json:"account,omitempty"`
+	Channels []string  `json:"channels"`
+	Operator bool      `json:"operator"`
+	Away     string    `json:"away,omitempty"`
+	Signon   time.Time `json:"signon"`
+	Idle     uint64    `json:"idle_seconds"`
+}
+
+func apiClientsHandler(server *Server, r *http.Request) (result interface{}, status int, err error) {
+	clients := server.clients.AllClients()
+	response := make([]apiClientInfo, 0, len(clients))
+	for _, client := range clients {
+		details := client.Details()
+		info := apiClientInfo{
+			Nick:     details.nick,
+			Username: details.username,
+			Hostname: details.hostname,
+			IP:       client.IP().String(),
+			Realname: details.realname,
+			Channels: make([]string, 0),
+			Operator: client.HasMode(modes.Operator),
+			Signon:   time.Unix(client.SignonTime(), 0).UTC(),
+			Idle:     client.IdleSeconds(),
+		}
+		if details.account != "" {
+			info.Account = details.accountName
+		}
+		if away, message := client.Away(); away {
+			info.Away = message
+		}
+		for _, channel := range client.Channels() {
+			info.Channels = append(info.Channels, channel.Name())
+		}
+		sort.Strings(info.Channels)
+		response = append(response, info)
+	}
+	sort.Slice(response, func(i, j int) bool { return response[i].Nick < response[j].Nick })
+	return response, 0, nil
+}
+
+type apiChannelInfo struct {
+	Name       string    `json:"name"`
+	Users      int       `json:"users"`
+	Topic      string    `json:"topic"`
+	Registered bool      `json:"registered"`
+	Founder    string    `json:"founder,omitempty"`
+	Created    time.Time `json:"created"`
+}
+
+func apiChannelsHandler(server *Server, r *http.Request) (result interface{}, status int, err error) {
+	channels := server.channels.Channels()
+	response := make([]apiChannelInfo, 0, len(channels))
+	for _, channel := range channels {
+		users, name, topic := channel.listData()
+		response = append(response, apiChannelInfo{
+			Name:       name,
+			Users:      users,
+			Topic:      topic,
+			Registered: channel.IsRegistered(),
+			Founder:    channel.Founder(),
+			Created:    channel.Ctime(),
+		})
+	}
+	sort.Slice(response, func(i, j int) bool { return response[i].Name < response[j].Name })
+	return response, 0, nil
+}
+
+type apiBanInfo struct {
+	Mask        string    `json:"mask"`
+	Reason      string    `json:"reason"`
+	OperReason  string    `json:"oper_reason,omitempty"`
+	OperName    string    `json:"oper_name,omitempty"`
+	RequireSASL bool      `json:"require_sasl,omitempty"`
+	Created     time.Time `json:"created"`
+	// omitted for permanent bans
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+type apiBansResponse struct {
+	Dlines []apiBanInfo `json:"dlines"`
+	Klines []apiBanInfo `json:"klines"`
+	Qlines []apiBanInfo `json:"qlines"`
+}
+
+func apiBanList(bans map[string]IPBanInfo) (result []apiBanInfo) {
+	result = make([]apiBanInfo, 0, len(bans))
+	for mask, info := range bans {
+		ban := apiBanInfo{
+			Mask:        mask,
+			Reason:      info.Reason,
+			OperReason:  info.OperReason,
+			OperName:    info.OperName,
+			RequireSASL: info.RequireSASL,
+			Created:     info.TimeCreated,
+		}
+		if info.Duration != 0 {
+			expires := info.TimeCreated.Add(info.Duration)
+			ban.Expires = &expires
+		}
+		result = append(result, ban)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Mask < result[j].Mask })
+	return
+}
+
+func apiBansHandler(server *Server, r *http.Request) (result interface{}, status int, err error) {
+	return apiBansResponse{
+		Dlines: apiBanList(server.dlines.AllBans()),
+		Klines: apiBanList(server.klines.AllBans()),
+		Qlines: apiBanList(server.qlines.AllBans()),
+	}, 0, nil
+}
+
+type apiKillRequest struct {
+	Nick   string `json:"nick"`
+	Reason string `json:"reason"`
+}
+
+func apiKillHandler(server *Server, r *http.Request) (result interface{}, status int, err error) {
+	var request apiKillRequest
+	if err = apiReadRequest(r, &request); err != nil {
+		return
+	}
+	target := server.clients.Get(request.Nick)
+	if target == nil {
+		return nil, http.StatusNotFound, errAPINoSuchNick
+	}
+	if request.Reason == "" {
+		request.Reason = "<no reason supplied>"
+	}
+	server.snomasks.Send(sno.LocalKills, fmt.Sprintf(ircfmt.Unescape("%s$r was killed by %s $c[grey][$r%s$c[grey]]"), target.Nick(), apiOperName, request.Reason))
+	target.Quit(fmt.Sprintf("Killed (%s (%s))", apiOperName, request.Reason), nil)
+	target.destroy(nil)
+	return
+}
+
+type apiDlineRequest struct {
+	Mask string `json:"mask"`
+	// e.g., "1h"; empty for a permanent ban
+	Duration   string `json:"duration"`
+	Reason     string `json:"reason"`
+	OperReason string `json:"oper_reason"`
+	// disconnect matching clients
+	Kill bool `json:"kill"`
+}
+
+func apiDlineHandler(server *Server, r *http.Request) (result interface{}, status int, err error) {
+	var request apiDlineRequest
+	if err = apiReadRequest(r, &request); err != nil {
+		return
+	}
+	network, err := flatip.ParseToNormalizedNet(request.Mask)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Could not parse IP address or CIDR network")
+	}
+	var duration time.Duration
+	if request.Duration != "" {
+		duration, err = custime.ParseDuration(request.Duration)
+		if err != nil {
+			return nil, 0, fmt.Errorf("Invalid ban duration")
+		}
+	}
+	if request.Reason == "" {
+		request.Reason = "No reason given"
+	}
+	err = server.dlines.AddNetwork(network, duration, false, request.Reason, request.OperReason, apiOperName)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("Could not successfully save new D-LINE: %s", err.Error())
+	}
+
+	hostString := utils.NetToNormalizedString(network.ToNetIPNet())
+	if duration != 0 {
+		server.snomasks.Send(sno.LocalXline, fmt.Sprintf(ircfmt.Unescape("%s$r added temporary (%s) D-Line for %s"), apiOperName, duration.String(), hostString))
+	} else {
+		server.snomasks.Send(sno.LocalXline, fmt.Sprintf(ircfmt.Unescape("%s$r added D-Line for %s"), apiOperName, hostString))
+	}
+
+	if request.Kill {
+		var killedClientNicks []string
+		for _, mcl := range server.clients.AllClients() {
+			nickKilled := false
+			for _, session := range mcl.Sessions() {
+				if network.Contains(flatip.FromNetIP(session.IP())) {
+					mcl.Quit(fmt.Sprintf(mcl.t("You have been banned from this server (%s)"), request.Reason), session)
+					mcl.destroy(session)
+					if !nickKilled {
+						killedClientNicks = append(killedClientNicks, mcl.Nick())
+						nickKilled = true
+					}
+				}
+			}
+		}
+		sort.Strings(killedClientNicks)
+		server.snomasks.Send(sno.LocalKills, fmt.Sprintf(ircfmt.Unescape("%s$r killed %d clients with a DLINE $c[grey][$r%s$c[grey]]"), apiOperName, len(killedClientNicks), strings.Join(killedClientNicks, ", ")))
+	}
+	return
+}
+
+func apiRehashHandler(server *Server, r *http.Request) (result interface{}, status int, err error) {
+	server.logger.Info("server", "Rehash initiated via API")
+	err = server.rehash()
+	server.notifyRehash(apiOperName, err)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	return
+}
+
+type apiNoticeRequest struct {
+	Message string `json:"message"`
+}
+
+func apiNoticeHandler(server *Server, r *http.Request) (result interface{}, status int, err error) {
+	var request apiNoticeRequest
+	if err = apiReadRequest(r, &request); err != nil {
+		return
+	}
+	if request.Message == "" || strings.ContainsAny(request.Message, "\x00\r\n") {
+		return nil, 0, errAPIBadRequest
+	}
+	server.snomasks.Send(sno.LocalAnnouncements, fmt.Sprintf("%s sent a global notice: %s", apiOperName, request.Message))
+	for _, client := range server.clients.AllClients() {
+		client.Send(nil, server.name, "NOTICE", client.Nick(), request.Message)
+	}
+	return
+}
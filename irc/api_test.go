@@ -0,0 +1,37 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package irc
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAPIAuthenticate(t *testing.T) {
+	var server Server
+	config := &Config{}
+	config.API.BearerTokens = []string{"first", "second"}
+	server.config.Set(config)
+
+	check := func(header string, expected bool) {
+		r, err := http.NewRequest(http.MethodGet, "/v1/status", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header != "" {
+			r.Header.Set("Authorization", header)
+		}
+		if result := server.apiAuthenticate(r); result != expected {
+			t.Errorf("%q: expected %t, got %t", header, expected, result)
+		}
+	}
+
+	check("Bearer first", true)
+	check("Bearer second", true)
+	check("Bearer third", false)
+	check("Bearer ", false)
+	check("first", false)
+	check("Basic Zmlyc3Q=", false)
+	check("", false)
+}
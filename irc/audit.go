@@ -0,0 +1,204 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package irc
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// placeholder for secrets (e.g., passwords) in recorded parameters
+	auditRedacted = "<redacted>"
+)
+
+// AuditLogConfig controls the operator action audit log
+type AuditLogConfig struct {
+	Enabled  bool
+	Filename string
+}
+
+// AuditEntry is a single privileged action, as recorded in the audit log
+type AuditEntry struct {
+	Time    time.Time `json:"time"`
+	Oper    string    `json:"oper"`
+	Nick    string    `json:"nick,omitempty"`
+	Account string    `json:"account,omitempty"`
+	IP      string    `json:"ip,omitempty"`
+	Command string    `json:"command"`
+	Params  []string  `json:"params,omitempty"`
+}
+
+func (entry *AuditEntry) String() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "%s %s", entry.Time.Format(IRCv3TimestampFormat), entry.Oper)
+	if entry.Nick != "" {
+		fmt.Fprintf(&buf, " (%s)", entry.Nick)
+	}
+	buf.WriteString(" ")
+	buf.WriteString(entry.Command)
+	for _, param := range entry.Params {
+		buf.WriteString(" ")
+		buf.WriteString(param)
+	}
+	return buf.String()
+}
+
+// matches returns whether the entry matches a case-insensitive search string
+func (entry *AuditEntry) matches(search string) bool {
+	if search == "" {
+		return true
+	}
+	return strings.Contains(strings.ToLower(entry.String()), strings.ToLower(search))
+}
+
+// AuditLog is an append-only log of the privileged actions taken by operators.
+// Entries are stored one per line, as JSON.
+type AuditLog struct {
+	sync.Mutex // tier 1
+
+	filename string
+	file     *os.File
+}
+
+// ApplyConfig opens the configured file, closing any previously opened one.
+func (audit *AuditLog) ApplyConfig(config *AuditLogConfig) (err error) {
+	filename := config.Filename
+	if !config.Enabled {
+		filename = ""
+	}
+
+	audit.Lock()
+	defer audit.Unlock()
+
+	if audit.filename == filename {
+		return nil
+	}
+	if audit.file != nil {
+		audit.file.Close()
+		audit.file = nil
+	}
+	audit.filename = ""
+	if filename != "" {
+		audit.file, err = os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return fmt.Errorf("Could not open audit log %s: %w", filename, err)
+		}
+		audit.filename = filename
+	}
+	return nil
+}
+
+// Record appends an entry to the log.
+func (audit *AuditLog) Record(entry AuditEntry) (err error) {
+	entry.Time = time.Now().UTC()
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	audit.Lock()
+	defer audit.Unlock()
+
+	if audit.file == nil {
+		return nil
+	}
+	// a single write on an O_APPEND file, so that lines are never interleaved
+	_, err = audit.file.Write(line)
+	return
+}
+
+// RecordClient records a privileged command run by an operator.
+func (audit *AuditLog) RecordClient(client *Client, command string, params []string) {
+	details := client.Details()
+	entry := AuditEntry{
+		Nick:    details.nick,
+		Account: details.accountName,
+		IP:      client.IP().String(),
+		Command: command,
+		Params:  auditRedactParams(command, params),
+	}
+	if details.account == "" {
+		entry.Account = ""
+	}
+	if oper := client.Oper(); oper != nil {
+		entry.Oper = oper.Name
+	} else {
+		entry.Oper = "*"
+	}
+	if err := audit.Record(entry); err != nil {
+		client.server.logger.Error("internal", "couldn't write to audit log", err.Error())
+	}
+}
+
+// Query returns the most recent entries matching search, oldest first.
+func (audit *AuditLog) Query(limit int, search string) (result []AuditEntry, err error) {
+	audit.Lock()
+	filename := audit.filename
+	audit.Unlock()
+
+	if filename == "" {
+		return nil, errFeatureDisabled
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	// keep a ring buffer of the last `limit` matches
+	ring := make([]AuditEntry, limit)
+	count := 0
+	reader := bufio.NewReader(file)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if len(line) != 0 {
+			var entry AuditEntry
+			if json.Unmarshal(line, &entry) == nil && entry.matches(search) {
+				ring[count%limit] = entry
+				count++
+			}
+		}
+		if readErr != nil {
+			break
+		}
+	}
+
+	if count < limit {
+		return ring[:count], nil
+	}
+	result = make([]AuditEntry, 0, limit)
+	for i := 0; i < limit; i++ {
+		result = append(result, ring[(count+i)%limit])
+	}
+	return result, nil
+}
+
+// auditRedactParams removes secrets from the parameters of a command
+func auditRedactParams(command string, params []string) (result []string) {
+	result = make([]string, len(params))
+	copy(result, params)
+	switch command {
+	case "NICKSERV SAREGISTER":
+		// SAREGISTER <username> [password]
+		for i := 1; i < len(result); i++ {
+			result[i] = auditRedacted
+		}
+	case "NICKSERV SASET":
+		// SASET <account> password <value>
+		if 2 < len(result) {
+			switch strings.ToLower(result[1]) {
+			case "pass", "password":
+				result[2] = auditRedacted
+			}
+		}
+	}
+	return
+}
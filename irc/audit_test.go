@@ -0,0 +1,80 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package irc
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAuditLog(t *testing.T) {
+	var audit AuditLog
+	if _, err := audit.Query(10, ""); err != errFeatureDisabled {
+		t.Errorf("expected disabled audit log, got %v", err)
+	}
+	// recording to a disabled log is a no-op
+	if err := audit.Record(AuditEntry{Oper: "admin", Command: "KILL"}); err != nil {
+		t.Fatal(err)
+	}
+
+	config := AuditLogConfig{Enabled: true, Filename: filepath.Join(t.TempDir(), "audit.log")}
+	if err := audit.ApplyConfig(&config); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		audit.Record(AuditEntry{Oper: "admin", Nick: "alice", Command: "KILL", Params: []string{fmt.Sprintf("spammer%d", i)}})
+	}
+	audit.Record(AuditEntry{Oper: "helper", Nick: "bob", Command: "REHASH"})
+
+	entries, err := audit.Query(3, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[0].Params[0] != "spammer3" || entries[2].Command != "REHASH" {
+		t.Errorf("unexpected entries: %v", entries)
+	}
+
+	entries, err = audit.Query(10, "SPAMMER")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 5 {
+		t.Errorf("expected 5 matching entries, got %d", len(entries))
+	}
+	if str := entries[0].String(); str != entries[0].Time.Format(IRCv3TimestampFormat)+" admin (alice) KILL spammer0" {
+		t.Errorf("unexpected string: %s", str)
+	}
+
+	// disabling keeps the file, but closes it
+	config.Enabled = false
+	if err := audit.ApplyConfig(&config); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := audit.Query(10, ""); err != errFeatureDisabled {
+		t.Errorf("expected disabled audit log, got %v", err)
+	}
+}
+
+func TestAuditRedactParams(t *testing.T) {
+	check := func(command string, params, expected []string) {
+		result := auditRedactParams(command, params)
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("%s %v: expected %v, got %v", command, params, expected, result)
+		}
+	}
+	check("KILL", []string{"alice", "spam"}, []string{"alice", "spam"})
+	check("NICKSERV SAREGISTER", []string{"alice", "hunter2"}, []string{"alice", auditRedacted})
+	check("NICKSERV SAREGISTER", []string{"alice"}, []string{"alice"})
+	check("NICKSERV SASET", []string{"alice", "PASSWORD", "hunter2"}, []string{"alice", "PASSWORD", auditRedacted})
+	check("NICKSERV SASET", []string{"alice", "enforce", "strict"}, []string{"alice", "enforce", "strict"})
+
+	// the original params must not be modified
+	params := []string{"alice", "hunter2"}
+	auditRedactParams("NICKSERV SAREGISTER", params)
+	if params[1] != "hunter2" {
+		t.Errorf("params were modified")
+	}
+}
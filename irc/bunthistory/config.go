@@ -0,0 +1,20 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package bunthistory
+
+import (
+	"time"
+)
+
+type Config struct {
+	// these are intended to be written directly into the config file:
+	Enabled bool
+	Path    string
+	// maximum number of messages retained for a single channel or conversation
+	MaxMessagesPerTarget int `yaml:"max-messages-per-target"`
+
+	// XXX these are copied from elsewhere in the config:
+	ExpireTime           time.Duration
+	TrackAccountMessages bool
+}
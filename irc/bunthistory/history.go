@@ -0,0 +1,766 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+// Package bunthistory implements persistent history on top of an embedded
+// buntdb database, as an alternative to MySQL for smaller deployments.
+package bunthistory
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tidwall/buntdb"
+
+	"github.com/ergochat/ergo/irc/history"
+	"github.com/ergochat/ergo/irc/logger"
+	"github.com/ergochat/ergo/irc/utils"
+)
+
+var (
+	ErrDisallowed = errors.New("disallowed")
+)
+
+const (
+	// the item itself, as JSON:
+	keyItem = "history.item %020d"
+	// index entries: the bucket (a channel, or a DM conversation), then the
+	// timestamp and item id, so that lexicographic order is chronological order:
+	keySequenceBucket     = "history.sequence %s "
+	keyConversationBucket = "history.conversation %s %s "
+	keyBucketEntry        = "%s%020d %020d"
+	// number of entries in a bucket, for enforcing max-messages-per-target:
+	keyBucketCount = "history.count %s"
+	// the time of the latest DM between a target and a correspondent:
+	keyCorrespondent       = "history.correspondent %s %s"
+	keyCorrespondentPrefix = "history.correspondent %s "
+	// msgid -> item id:
+	keyMsgid = "history.msgid %s"
+
+	keyItemPrefix = "history.item "
+
+	cleanupRowLimit  = 50
+	cleanupPauseTime = 10 * time.Minute
+)
+
+// storedItem is the value stored under keyItem
+type storedItem struct {
+	Item history.Item
+	// for channel messages, the casefolded channel name
+	Target string `json:",omitempty"`
+	// casefolded account of the sender, if account messages are being tracked
+	Account string `json:",omitempty"`
+	// bucket prefixes with an index entry pointing to this item
+	Buckets []string
+}
+
+type History struct {
+	db     *buntdb.DB
+	logger *logger.Manager
+	lastID uint64
+
+	stateMutex sync.Mutex
+	config     Config
+
+	quit chan struct{}
+}
+
+func (h *History) Initialize(logger *logger.Manager, config Config) {
+	h.logger = logger
+	h.quit = make(chan struct{})
+	h.SetConfig(config)
+}
+
+func (h *History) SetConfig(config Config) {
+	h.stateMutex.Lock()
+	h.config = config
+	h.stateMutex.Unlock()
+}
+
+func (h *History) getConfig() (config Config) {
+	h.stateMutex.Lock()
+	config = h.config
+	h.stateMutex.Unlock()
+	return
+}
+
+func (h *History) Open() (err error) {
+	h.db, err = buntdb.Open(h.getConfig().Path)
+	if err != nil {
+		return err
+	}
+
+	// resume numbering items after the last one stored
+	h.db.View(func(tx *buntdb.Tx) error {
+		tx.DescendLessOrEqual("", keyItemPrefix+"~", func(key, value string) bool {
+			if strings.HasPrefix(key, keyItemPrefix) {
+				h.lastID, _ = strconv.ParseUint(strings.TrimPrefix(key, keyItemPrefix), 10, 64)
+			}
+			return false
+		})
+		return nil
+	})
+
+	go h.cleanupLoop()
+
+	return nil
+}
+
+func (h *History) Close() {
+	if h.db != nil {
+		close(h.quit)
+		h.db.Close()
+	}
+	h.db = nil
+}
+
+func (h *History) logError(context string, err error) (quit bool) {
+	if err != nil {
+		h.logger.Error("history", context, err.Error())
+		return true
+	}
+	return false
+}
+
+func bucketEntryKey(bucket string, nanotime int64, id uint64) string {
+	return fmt.Sprintf(keyBucketEntry, bucket, nanotime, id)
+}
+
+func loadItem(tx *buntdb.Tx, id uint64) (stored storedItem, err error) {
+	raw, err := tx.Get(fmt.Sprintf(keyItem, id))
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal([]byte(raw), &stored)
+	return
+}
+
+func saveItem(tx *buntdb.Tx, id uint64, stored storedItem) (err error) {
+	raw, err := json.Marshal(stored)
+	if err != nil {
+		return
+	}
+	_, _, err = tx.Set(fmt.Sprintf(keyItem, id), string(raw), nil)
+	return
+}
+
+func adjustCount(tx *buntdb.Tx, bucket string, delta int) (count int) {
+	key := fmt.Sprintf(keyBucketCount, bucket)
+	raw, _ := tx.Get(key)
+	count, _ = strconv.Atoi(raw)
+	count += delta
+	if count <= 0 {
+		tx.Delete(key)
+		return 0
+	}
+	tx.Set(key, strconv.Itoa(count), nil)
+	return
+}
+
+func (h *History) addItem(item history.Item, target, account string, buckets []string) (err error) {
+	config := h.getConfig()
+	if account == "" || !config.TrackAccountMessages {
+		account = ""
+	}
+	id := atomic.AddUint64(&h.lastID, 1)
+	nanotime := item.Message.Time.UnixNano()
+	stored := storedItem{
+		Item:    item,
+		Target:  target,
+		Account: account,
+		Buckets: buckets,
+	}
+
+	err = h.db.Update(func(tx *buntdb.Tx) (err error) {
+		if err = saveItem(tx, id, stored); err != nil {
+			return
+		}
+		if item.Message.Msgid != "" {
+			tx.Set(fmt.Sprintf(keyMsgid, item.Message.Msgid), strconv.FormatUint(id, 10), nil)
+		}
+		for _, bucket := range buckets {
+			tx.Set(bucketEntryKey(bucket, nanotime, id), strconv.FormatUint(id, 10), nil)
+			count := adjustCount(tx, bucket, 1)
+			if config.MaxMessagesPerTarget != 0 && config.MaxMessagesPerTarget < count {
+				trimBucket(tx, bucket, count-config.MaxMessagesPerTarget)
+			}
+		}
+		return nil
+	})
+	h.logError("could not insert item", err)
+	return
+}
+
+// trimBucket deletes the oldest `count` entries in a bucket
+func trimBucket(tx *buntdb.Tx, bucket string, count int) {
+	// buntdb doesn't allow modifications during iteration
+	var ids []uint64
+	tx.AscendGreaterOrEqual("", bucket, func(key, value string) bool {
+		if !strings.HasPrefix(key, bucket) {
+			return false
+		}
+		if id, err := strconv.ParseUint(value, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+		return len(ids) < count
+	})
+	for _, id := range ids {
+		removeFromBucket(tx, id, bucket)
+	}
+}
+
+// removeFromBucket deletes a single index entry, and the item itself if nothing
+// else refers to it (e.g., the other side of a DM conversation)
+func removeFromBucket(tx *buntdb.Tx, id uint64, bucket string) {
+	stored, err := loadItem(tx, id)
+	if err != nil {
+		return
+	}
+	adjustCount(tx, bucket, -1)
+	tx.Delete(bucketEntryKey(bucket, stored.Item.Message.Time.UnixNano(), id))
+	buckets := stored.Buckets[:0]
+	for _, b := range stored.Buckets {
+		if b != bucket {
+			buckets = append(buckets, b)
+		}
+	}
+	stored.Buckets = buckets
+	if len(stored.Buckets) == 0 {
+		deleteItem(tx, id, stored)
+	} else {
+		saveItem(tx, id, stored)
+	}
+}
+
+// deleteItem deletes an item along with all of its index entries
+func deleteItem(tx *buntdb.Tx, id uint64, stored storedItem) {
+	nanotime := stored.Item.Message.Time.UnixNano()
+	for _, bucket := range stored.Buckets {
+		if _, err := tx.Delete(bucketEntryKey(bucket, nanotime, id)); err == nil {
+			adjustCount(tx, bucket, -1)
+		}
+	}
+	if stored.Item.Message.Msgid != "" {
+		tx.Delete(fmt.Sprintf(keyMsgid, stored.Item.Message.Msgid))
+	}
+	tx.Delete(fmt.Sprintf(keyItem, id))
+}
+
+func (h *History) cleanupLoop() {
+	defer func() {
+		if r := recover(); r != nil {
+			h.logger.Error("history",
+				fmt.Sprintf("Panic in cleanup routine: %v\n%s", r, debug.Stack()))
+			time.Sleep(cleanupPauseTime)
+			go h.cleanupLoop()
+		}
+	}()
+
+	for {
+		expireTime := h.getConfig().ExpireTime
+		if expireTime != 0 {
+			for {
+				rowsDeleted, err := h.doCleanup(expireTime)
+				h.logError("error during history cleanup", err)
+				if err != nil || rowsDeleted < cleanupRowLimit {
+					break
+				}
+			}
+		}
+		select {
+		case <-h.quit:
+			return
+		case <-time.After(cleanupPauseTime):
+		}
+	}
+}
+
+func (h *History) doCleanup(age time.Duration) (count int, err error) {
+	threshold := time.Now().UTC().Add(-age)
+	err = h.db.Update(func(tx *buntdb.Tx) error {
+		// item ids are assigned in order of arrival, so expired items come first
+		expired := make(map[uint64]storedItem)
+		tx.AscendGreaterOrEqual("", keyItemPrefix, func(key, value string) bool {
+			if !strings.HasPrefix(key, keyItemPrefix) {
+				return false
+			}
+			var stored storedItem
+			id, err := strconv.ParseUint(strings.TrimPrefix(key, keyItemPrefix), 10, 64)
+			if err != nil || json.Unmarshal([]byte(value), &stored) != nil {
+				return true
+			}
+			if !stored.Item.Message.Time.Before(threshold) {
+				return false
+			}
+			expired[id] = stored
+			return len(expired) < cleanupRowLimit
+		})
+		for id, stored := range expired {
+			deleteItem(tx, id, stored)
+		}
+		count = len(expired)
+
+		var correspondents []string
+		tx.AscendGreaterOrEqual("", "history.correspondent ", func(key, value string) bool {
+			if !strings.HasPrefix(key, "history.correspondent ") {
+				return false
+			}
+			if nanotime, err := strconv.ParseInt(value, 10, 64); err == nil && nanotime < threshold.UnixNano() {
+				correspondents = append(correspondents, key)
+			}
+			return true
+		})
+		for _, key := range correspondents {
+			tx.Delete(key)
+		}
+		return nil
+	})
+	if count != 0 {
+		h.logger.Debug("history", fmt.Sprintf("deleted %d expired history items", count))
+	}
+	return
+}
+
+func (h *History) AddChannelItem(target string, item history.Item, account string) (err error) {
+	if h.db == nil {
+		return
+	}
+
+	if target == "" {
+		return utils.ErrInvalidParams
+	}
+
+	return h.addItem(item, target, account, []string{fmt.Sprintf(keySequenceBucket, target)})
+}
+
+func (h *History) AddDirectMessage(sender, senderAccount, recipient, recipientAccount string, item history.Item) (err error) {
+	if h.db == nil {
+		return
+	}
+
+	if senderAccount == "" && recipientAccount == "" {
+		return
+	}
+
+	if sender == "" || recipient == "" {
+		return utils.ErrInvalidParams
+	}
+
+	var buckets []string
+	if senderAccount != "" {
+		buckets = append(buckets, fmt.Sprintf(keyConversationBucket, senderAccount, recipient))
+	}
+	if recipientAccount != "" && sender != recipient {
+		buckets = append(buckets, fmt.Sprintf(keyConversationBucket, recipientAccount, sender))
+	}
+
+	err = h.addItem(item, "", senderAccount, buckets)
+	if err != nil {
+		return
+	}
+
+	nanotime := strconv.FormatInt(item.Message.Time.UnixNano(), 10)
+	err = h.db.Update(func(tx *buntdb.Tx) error {
+		if senderAccount != "" {
+			tx.Set(fmt.Sprintf(keyCorrespondent, senderAccount, recipient), nanotime, nil)
+		}
+		if recipientAccount != "" && sender != recipient {
+			tx.Set(fmt.Sprintf(keyCorrespondent, recipientAccount, sender), nanotime, nil)
+		}
+		return nil
+	})
+	h.logError("could not insert correspondents entry", err)
+	return
+}
+
+func (h *History) RenameTarget(oldTarget, newTarget string) (err error) {
+	if h.db == nil {
+		return
+	}
+
+	oldBucket := fmt.Sprintf(keySequenceBucket, oldTarget)
+	newBucket := fmt.Sprintf(keySequenceBucket, newTarget)
+	config := h.getConfig()
+	err = h.db.Update(func(tx *buntdb.Tx) error {
+		// buntdb doesn't allow modifications during iteration
+		var ids []uint64
+		tx.AscendGreaterOrEqual("", oldBucket, func(key, value string) bool {
+			if !strings.HasPrefix(key, oldBucket) {
+				return false
+			}
+			if id, err := strconv.ParseUint(value, 10, 64); err == nil {
+				ids = append(ids, id)
+			}
+			return true
+		})
+		for _, id := range ids {
+			stored, err := loadItem(tx, id)
+			if err != nil {
+				continue
+			}
+			nanotime := stored.Item.Message.Time.UnixNano()
+			tx.Delete(bucketEntryKey(oldBucket, nanotime, id))
+			tx.Set(bucketEntryKey(newBucket, nanotime, id), strconv.FormatUint(id, 10), nil)
+			for i, bucket := range stored.Buckets {
+				if bucket == oldBucket {
+					stored.Buckets[i] = newBucket
+				}
+			}
+			stored.Target = newTarget
+			saveItem(tx, id, stored)
+		}
+		adjustCount(tx, oldBucket, -len(ids))
+		count := adjustCount(tx, newBucket, len(ids))
+		if config.MaxMessagesPerTarget != 0 && config.MaxMessagesPerTarget < count {
+			trimBucket(tx, newBucket, count-config.MaxMessagesPerTarget)
+		}
+		return nil
+	})
+	h.logError("could not rename history target", err)
+	return
+}
+
+// note that accountName is the unfolded name
+func (h *History) DeleteMsgid(msgid, accountName string) (err error) {
+	if h.db == nil {
+		return nil
+	}
+
+	err = h.db.Update(func(tx *buntdb.Tx) error {
+		id, stored, err := lookupMsgid(tx, msgid)
+		if err != nil {
+			return err
+		}
+		if accountName != "*" && stored.Item.AccountName != accountName {
+			return ErrDisallowed
+		}
+		deleteItem(tx, id, stored)
+		return nil
+	})
+	if err != buntdb.ErrNotFound && err != ErrDisallowed {
+		h.logError("couldn't delete msgid", err)
+	}
+	return
+}
+
+func lookupMsgid(tx *buntdb.Tx, msgid string) (id uint64, stored storedItem, err error) {
+	raw, err := tx.Get(fmt.Sprintf(keyMsgid, msgid))
+	if err != nil {
+		return
+	}
+	id, err = strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return
+	}
+	stored, err = loadItem(tx, id)
+	return
+}
+
+// scanItems calls `f` on every stored item, in batches, so that long scans
+// don't block writers for too long
+func (h *History) scanItems(f func(id uint64, stored storedItem)) (err error) {
+	pivot := keyItemPrefix
+	for {
+		var ids []uint64
+		var batch []storedItem
+		err = h.db.View(func(tx *buntdb.Tx) error {
+			return tx.AscendGreaterOrEqual("", pivot, func(key, value string) bool {
+				if key == pivot {
+					return true
+				} else if !strings.HasPrefix(key, keyItemPrefix) {
+					return false
+				}
+				pivot = key
+				var stored storedItem
+				id, err := strconv.ParseUint(strings.TrimPrefix(key, keyItemPrefix), 10, 64)
+				if err == nil && json.Unmarshal([]byte(value), &stored) == nil {
+					ids = append(ids, id)
+					batch = append(batch, stored)
+				}
+				return len(ids) < cleanupRowLimit
+			})
+		})
+		if err != nil || len(ids) == 0 {
+			return
+		}
+		for i, id := range ids {
+			f(id, batch[i])
+		}
+	}
+}
+
+func (h *History) Forget(account string) {
+	if h.db == nil || account == "" {
+		return
+	}
+
+	go func() {
+		var ids []uint64
+		err := h.scanItems(func(id uint64, stored storedItem) {
+			if stored.Account == account {
+				ids = append(ids, id)
+			}
+		})
+		if h.logError("could not scan items to forget", err) {
+			return
+		}
+		for len(ids) != 0 {
+			batch := ids
+			if cleanupRowLimit < len(batch) {
+				batch = batch[:cleanupRowLimit]
+			}
+			ids = ids[len(batch):]
+			err = h.db.Update(func(tx *buntdb.Tx) error {
+				for _, id := range batch {
+					if stored, err := loadItem(tx, id); err == nil {
+						deleteItem(tx, id, stored)
+					}
+				}
+				return nil
+			})
+			if h.logError("could not forget items", err) {
+				return
+			}
+		}
+		h.logger.Debug("history", fmt.Sprintf("forgot all messages for account %s", account))
+	}()
+}
+
+func (h *History) Export(account string, writer io.Writer) {
+	if h.db == nil {
+		return
+	}
+
+	// a DM sent by the account is indexed in the account's side of the conversation:
+	conversationPrefix := strings.TrimSuffix(fmt.Sprintf(keyConversationBucket, account, ""), " ")
+	var writeErr error
+	err := h.scanItems(func(id uint64, stored storedItem) {
+		if stored.Account != account || writeErr != nil {
+			return
+		}
+		item := stored.Item
+		item.CfCorrespondent = stored.Target
+		if item.CfCorrespondent == "" {
+			for _, bucket := range stored.Buckets {
+				if strings.HasPrefix(bucket, conversationPrefix) {
+					item.CfCorrespondent = strings.TrimSuffix(strings.TrimPrefix(bucket, conversationPrefix), " ")
+					break
+				}
+			}
+		}
+		jsonBlob, err := json.Marshal(item)
+		if err != nil {
+			writeErr = err
+			return
+		}
+		writer.Write(jsonBlob)
+		writer.Write([]byte{'\n'})
+	})
+	if err == nil {
+		err = writeErr
+	}
+	h.logError("could not export history", err)
+}
+
+func (h *History) ListChannels(cfchannels []string) (results []history.TargetListing, err error) {
+	if h.db == nil {
+		return
+	}
+
+	err = h.db.View(func(tx *buntdb.Tx) error {
+		for _, cfchannel := range cfchannels {
+			bucket := fmt.Sprintf(keySequenceBucket, cfchannel)
+			tx.DescendLessOrEqual("", bucket+"~", func(key, value string) bool {
+				if nanotime, _, ok := parseBucketEntry(bucket, key); ok {
+					results = append(results, history.TargetListing{
+						CfName: cfchannel,
+						Time:   time.Unix(0, nanotime),
+					})
+				}
+				return false
+			})
+		}
+		return nil
+	})
+	h.logError("could not query channel listings", err)
+	return
+}
+
+func parseBucketEntry(bucket, key string) (nanotime int64, id uint64, ok bool) {
+	if !strings.HasPrefix(key, bucket) {
+		return
+	}
+	nanoStr, idStr, found := strings.Cut(strings.TrimPrefix(key, bucket), " ")
+	if !found {
+		return
+	}
+	nanotime, err := strconv.ParseInt(nanoStr, 10, 64)
+	if err != nil {
+		return
+	}
+	id, err = strconv.ParseUint(idStr, 10, 64)
+	return nanotime, id, err == nil
+}
+
+func (h *History) resolveSelector(selector history.Selector) (result time.Time, err error) {
+	if selector.Msgid == "" {
+		return selector.Time, nil
+	}
+	err = h.db.View(func(tx *buntdb.Tx) error {
+		_, stored, err := lookupMsgid(tx, selector.Msgid)
+		result = stored.Item.Message.Time
+		return err
+	})
+	return
+}
+
+func (h *History) betweenTimestamps(bucket string, after, before, cutoff time.Time, limit int) (results []history.Item, err error) {
+	after, before, ascending := history.MinMaxAsc(after, before, cutoff)
+
+	// both bounds are exclusive; neither of these is an actual key
+	lower := bucket
+	if !after.IsZero() {
+		lower = fmt.Sprintf("%s%020d", bucket, after.UnixNano()+1)
+	}
+	upper := bucket + "~"
+	if !before.IsZero() {
+		upper = fmt.Sprintf("%s%020d", bucket, before.UnixNano())
+	}
+
+	err = h.db.View(func(tx *buntdb.Tx) error {
+		var ids []uint64
+		iter := func(key, value string) bool {
+			if id, err := strconv.ParseUint(value, 10, 64); err == nil {
+				ids = append(ids, id)
+			}
+			return len(ids) < limit
+		}
+		if ascending {
+			tx.AscendRange("", lower, upper, iter)
+		} else {
+			tx.DescendRange("", upper, lower, iter)
+		}
+		for _, id := range ids {
+			stored, err := loadItem(tx, id)
+			if err != nil {
+				return err
+			}
+			results = append(results, stored.Item)
+		}
+		return nil
+	})
+	if h.logError("could not select history items", err) {
+		return
+	}
+	if !ascending {
+		utils.ReverseSlice(results)
+	}
+	return
+}
+
+func (h *History) listCorrespondentsInternal(target string, after, before, cutoff time.Time, limit int) (results []history.TargetListing, err error) {
+	after, before, ascending := history.MinMaxAsc(after, before, cutoff)
+
+	prefix := fmt.Sprintf(keyCorrespondentPrefix, target)
+	err = h.db.View(func(tx *buntdb.Tx) error {
+		return tx.AscendGreaterOrEqual("", prefix, func(key, value string) bool {
+			if !strings.HasPrefix(key, prefix) {
+				return false
+			}
+			nanotime, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return true
+			}
+			listing := history.TargetListing{
+				CfName: strings.TrimPrefix(key, prefix),
+				Time:   time.Unix(0, nanotime),
+			}
+			if (after.IsZero() || listing.Time.After(after)) && (before.IsZero() || listing.Time.Before(before)) {
+				results = append(results, listing)
+			}
+			return true
+		})
+	})
+	if err != nil {
+		return
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if ascending {
+			return results[i].Time.Before(results[j].Time)
+		}
+		return results[j].Time.Before(results[i].Time)
+	})
+	if limit < len(results) {
+		results = results[:limit]
+	}
+	if !ascending {
+		utils.ReverseSlice(results)
+	}
+	return
+}
+
+// implements history.Sequence, emulating a single history buffer (for a channel
+// or a DM conversation)
+type buntHistorySequence struct {
+	h             *History
+	target        string
+	correspondent string
+	cutoff        time.Time
+}
+
+func (s *buntHistorySequence) Between(start, end history.Selector, limit int) (results []history.Item, err error) {
+	startTime, err := s.h.resolveSelector(start)
+	if err == buntdb.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	endTime, err := s.h.resolveSelector(end)
+	if err == buntdb.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	bucket := fmt.Sprintf(keySequenceBucket, s.target)
+	if s.correspondent != "" {
+		bucket = fmt.Sprintf(keyConversationBucket, s.target, s.correspondent)
+	}
+	return s.h.betweenTimestamps(bucket, startTime, endTime, s.cutoff, limit)
+}
+
+func (s *buntHistorySequence) Around(start history.Selector, limit int) (results []history.Item, err error) {
+	return history.GenericAround(s, start, limit)
+}
+
+func (seq *buntHistorySequence) ListCorrespondents(start, end history.Selector, limit int) (results []history.TargetListing, err error) {
+	results, err = seq.h.listCorrespondentsInternal(seq.target, start.Time, end.Time, seq.cutoff, limit)
+	seq.h.logError("could not read correspondents", err)
+	return
+}
+
+func (seq *buntHistorySequence) Cutoff() time.Time {
+	return seq.cutoff
+}
+
+func (seq *buntHistorySequence) Ephemeral() bool {
+	return false
+}
+
+func (h *History) MakeSequence(target, correspondent string, cutoff time.Time) history.Sequence {
+	return &buntHistorySequence{
+		h:             h,
+		target:        target,
+		correspondent: correspondent,
+		cutoff:        cutoff,
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package bunthistory
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ergochat/ergo/irc/history"
+	"github.com/ergochat/ergo/irc/logger"
+	"github.com/ergochat/ergo/irc/utils"
+)
+
+func newTestHistory(t *testing.T, maxMessages int) *History {
+	logger, err := logger.NewManager(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := new(History)
+	h.Initialize(logger, Config{
+		Enabled:              true,
+		Path:                 ":memory:",
+		MaxMessagesPerTarget: maxMessages,
+		TrackAccountMessages: true,
+	})
+	if err := h.Open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(h.Close)
+	return h
+}
+
+func makeItem(message string, t time.Time) history.Item {
+	return history.Item{
+		Type:        history.Privmsg,
+		Nick:        "shivaram!shivaram@localhost",
+		AccountName: "shivaram",
+		Message: utils.SplitMessage{
+			Message: message,
+			Msgid:   utils.GenerateSecretToken(),
+			Time:    t,
+		},
+	}
+}
+
+func messages(items []history.Item) (result []string) {
+	for _, item := range items {
+		result = append(result, item.Message.Message)
+	}
+	return
+}
+
+func assertMessages(t *testing.T, items []history.Item, expected ...string) {
+	t.Helper()
+	actual := messages(items)
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+	for i := range actual {
+		if actual[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, actual)
+		}
+	}
+}
+
+func TestChannelHistory(t *testing.T) {
+	h := newTestHistory(t, 0)
+	start := time.Now().UTC().Add(-time.Hour)
+	var items []history.Item
+	for i, message := range []string{"a", "b", "c", "d"} {
+		item := makeItem(message, start.Add(time.Duration(i)*time.Minute))
+		items = append(items, item)
+		if err := h.AddChannelItem("#ergo", item, "shivaram"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h.AddChannelItem("#other", makeItem("z", start), "")
+
+	seq := h.MakeSequence("#ergo", "", time.Time{})
+	results, err := seq.Between(history.Selector{}, history.Selector{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertMessages(t, results, "a", "b", "c", "d")
+
+	// LATEST with a limit returns the most recent messages, in order
+	results, _ = seq.Between(history.Selector{}, history.Selector{}, 2)
+	assertMessages(t, results, "c", "d")
+
+	// AFTER and BEFORE are exclusive
+	results, _ = seq.Between(history.Selector{Msgid: items[1].Message.Msgid}, history.Selector{}, 10)
+	assertMessages(t, results, "c", "d")
+	results, _ = seq.Between(history.Selector{}, history.Selector{Time: items[2].Message.Time}, 10)
+	assertMessages(t, results, "a", "b")
+
+	listings, _ := h.ListChannels([]string{"#ergo", "#other", "#empty"})
+	if len(listings) != 2 || !listings[0].Time.Equal(items[3].Message.Time) {
+		t.Errorf("unexpected channel listings %v", listings)
+	}
+
+	if err := h.DeleteMsgid(items[0].Message.Msgid, "dan"); err != ErrDisallowed {
+		t.Errorf("deletion by another account should be disallowed, got %v", err)
+	}
+	if err := h.DeleteMsgid(items[0].Message.Msgid, "*"); err != nil {
+		t.Fatal(err)
+	}
+	results, _ = seq.Between(history.Selector{}, history.Selector{}, 10)
+	assertMessages(t, results, "b", "c", "d")
+}
+
+func TestMaxMessagesPerTarget(t *testing.T) {
+	h := newTestHistory(t, 2)
+	start := time.Now().UTC().Add(-time.Hour)
+	for i, message := range []string{"a", "b", "c"} {
+		item := makeItem(message, start.Add(time.Duration(i)*time.Minute))
+		h.AddDirectMessage("shivaram", "shivaram", "dan", "dan", item)
+	}
+	// dan's side of the conversation is capped independently
+	h.AddDirectMessage("dan", "dan", "slingamn", "", makeItem("d", start.Add(time.Hour)))
+
+	results, _ := h.MakeSequence("shivaram", "dan", time.Time{}).Between(history.Selector{}, history.Selector{}, 10)
+	assertMessages(t, results, "b", "c")
+	results, _ = h.MakeSequence("dan", "shivaram", time.Time{}).Between(history.Selector{}, history.Selector{}, 10)
+	assertMessages(t, results, "b", "c")
+	results, _ = h.MakeSequence("dan", "slingamn", time.Time{}).Between(history.Selector{}, history.Selector{}, 10)
+	assertMessages(t, results, "d")
+
+	correspondents, _ := h.MakeSequence("dan", "", time.Time{}).ListCorrespondents(history.Selector{}, history.Selector{}, 10)
+	if len(correspondents) != 2 || correspondents[0].CfName != "shivaram" || correspondents[1].CfName != "slingamn" {
+		t.Errorf("unexpected correspondents %v", correspondents)
+	}
+}
+
+func TestRenameTarget(t *testing.T) {
+	h := newTestHistory(t, 3)
+	start := time.Now().UTC().Add(-time.Hour)
+	h.AddChannelItem("#old", makeItem("a", start), "shivaram")
+	h.AddChannelItem("#old", makeItem("b", start.Add(time.Minute)), "shivaram")
+	h.AddChannelItem("#new", makeItem("c", start.Add(2*time.Minute)), "shivaram")
+	h.AddChannelItem("#new", makeItem("d", start.Add(3*time.Minute)), "shivaram")
+
+	// history already stored under the new name is merged, subject to the cap
+	if err := h.RenameTarget("#old", "#new"); err != nil {
+		t.Fatal(err)
+	}
+	results, _ := h.MakeSequence("#old", "", time.Time{}).Between(history.Selector{}, history.Selector{}, 10)
+	assertMessages(t, results)
+	results, _ = h.MakeSequence("#new", "", time.Time{}).Between(history.Selector{}, history.Selector{}, 10)
+	assertMessages(t, results, "b", "c", "d")
+
+	// the count moved with the messages
+	h.AddChannelItem("#new", makeItem("e", start.Add(4*time.Minute)), "shivaram")
+	results, _ = h.MakeSequence("#new", "", time.Time{}).Between(history.Selector{}, history.Selector{}, 10)
+	assertMessages(t, results, "c", "d", "e")
+}
+
+func TestExport(t *testing.T) {
+	h := newTestHistory(t, 0)
+	start := time.Now().UTC().Add(-time.Hour)
+	h.AddChannelItem("#ergo", makeItem("a", start), "shivaram")
+	h.AddDirectMessage("shivaram", "shivaram", "dan", "dan", makeItem("b", start.Add(time.Minute)))
+	// messages sent by other accounts aren't exported
+	h.AddDirectMessage("dan", "dan", "shivaram", "shivaram", makeItem("c", start.Add(2*time.Minute)))
+
+	var buf bytes.Buffer
+	h.Export("shivaram", &buf)
+	var correspondents, messages []string
+	decoder := json.NewDecoder(&buf)
+	for decoder.More() {
+		var item history.Item
+		if err := decoder.Decode(&item); err != nil {
+			t.Fatal(err)
+		}
+		correspondents = append(correspondents, item.CfCorrespondent)
+		messages = append(messages, item.Message.Message)
+	}
+	if len(messages) != 2 || messages[0] != "a" || messages[1] != "b" ||
+		correspondents[0] != "#ergo" || correspondents[1] != "dan" {
+		t.Errorf("unexpected export: %v %v", messages, correspondents)
+	}
+}
+
+func TestExpiration(t *testing.T) {
+	h := newTestHistory(t, 0)
+	now := time.Now().UTC()
+	h.AddChannelItem("#ergo", makeItem("old", now.Add(-2*time.Hour)), "shivaram")
+	h.AddChannelItem("#ergo", makeItem("new", now), "shivaram")
+
+	count, err := h.doCleanup(time.Hour)
+	if err != nil || count != 1 {
+		t.Fatalf("expected to expire one item, got %d (%v)", count, err)
+	}
+	results, _ := h.MakeSequence("#ergo", "", time.Time{}).Between(history.Selector{}, history.Selector{}, 10)
+	assertMessages(t, results, "new")
+}
@@ -7,7 +7,7 @@ package caps
 
 const (
 	// number of recognized capabilities:
-	numCapabs = 29
+	numCapabs = 30
 	// length of the uint64 array that represents the bitset:
 	bitsetLen = 1
 )
@@ -113,6 +113,10 @@ const (
 	// https://ircv3.net/specs/extensions/setname.html
 	SetName Capability = iota
 
+	// Search is the Soju vendor capability named "soju.im/search":
+	// https://codeberg.org/emersion/soju/src/branch/master/doc/ext/search.md
+	Search Capability = iota
+
 	// STS is the IRCv3 capability named "sts":
 	// https://ircv3.net/specs/extensions/sts.html
 	STS Capability = iota
@@ -158,6 +162,7 @@ var (
 		"sasl",
 		"server-time",
 		"setname",
+		"soju.im/search",
 		"sts",
 		"userhost-in-names",
 		"znc.in/playback",
@@ -7,15 +7,19 @@ package irc
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
+	"unsafe"
 
 	"sync"
 
 	"github.com/ergochat/irc-go/ircutils"
 
 	"github.com/ergochat/ergo/irc/caps"
+	"github.com/ergochat/ergo/irc/connection_limits"
 	"github.com/ergochat/ergo/irc/history"
 	"github.com/ergochat/ergo/irc/modes"
 	"github.com/ergochat/ergo/irc/utils"
@@ -33,7 +37,8 @@ type Channel struct {
 	key               string
 	forward           string
 	members           MemberSet
-	membersCache      []*Client // allow iteration over channel members without holding the lock
+	membersCache      []*Client      // allow iteration over channel members without holding the lock
+	listEntry         unsafe.Pointer // *channelListEntry, allows LIST without holding the lock
 	name              string
 	nameCasefolded    string
 	server            *Server
@@ -45,6 +50,7 @@ type Channel struct {
 	topicSetBy        string
 	topicSetTime      time.Time
 	userLimit         int
+	joinThrottle      connection_limits.GenericThrottle // +j; Limit of 0 means unset
 	accountToUMode    map[string]modes.Mode
 	history           history.Buffer
 	stateMutex        sync.RWMutex    // tier 1
@@ -55,6 +61,17 @@ type Channel struct {
 	settings          ChannelSettings
 }
 
+// channelListEntry is an immutable snapshot of the channel data needed by LIST.
+// It is replaced whenever that data changes (on join, part, topic change, etc.).
+type channelListEntry struct {
+	name           string
+	nameCasefolded string
+	topic          string
+	memberCount    int
+	createdTime    time.Time
+	topicSetTime   time.Time
+}
+
 // NewChannel creates a new channel from a `Server` and a `name`
 // string, which must be unique on the server.
 func NewChannel(s *Server, name, casefoldedName string, registered bool) *Channel {
@@ -71,6 +88,7 @@ func NewChannel(s *Server, name, casefoldedName string, registered bool) *Channe
 
 	channel.initializeLists()
 	channel.history.Initialize(0, 0)
+	channel.updateListEntryNoMutex()
 
 	if !registered {
 		channel.resizeHistory(config)
@@ -129,6 +147,7 @@ func (channel *Channel) applyRegInfo(chanReg RegisteredChannel) {
 
 	channel.registeredFounder = chanReg.Founder
 	channel.registeredTime = chanReg.RegisteredAt
+	channel.transferPendingTo = chanReg.TransferPendingTo
 	channel.topic = chanReg.Topic
 	channel.topicSetBy = chanReg.TopicSetBy
 	channel.topicSetTime = chanReg.TopicSetTime
@@ -138,6 +157,7 @@ func (channel *Channel) applyRegInfo(chanReg RegisteredChannel) {
 	channel.userLimit = chanReg.UserLimit
 	channel.settings = chanReg.Settings
 	channel.forward = chanReg.Forward
+	channel.joinThrottle.Limit, channel.joinThrottle.Duration, _ = parseJoinThrottle(chanReg.JoinThrottle)
 
 	for _, mode := range chanReg.Modes {
 		channel.flags.SetMode(mode, true)
@@ -148,6 +168,7 @@ func (channel *Channel) applyRegInfo(chanReg RegisteredChannel) {
 	channel.lists[modes.BanMask].SetMasks(chanReg.Bans)
 	channel.lists[modes.InviteMask].SetMasks(chanReg.Invites)
 	channel.lists[modes.ExceptMask].SetMasks(chanReg.Excepts)
+	channel.updateListEntryNoMutex()
 }
 
 // obtain a consistent snapshot of the channel state that can be persisted to the DB
@@ -159,6 +180,7 @@ func (channel *Channel) ExportRegistration(includeFlags uint) (info RegisteredCh
 	info.NameCasefolded = channel.nameCasefolded
 	info.Founder = channel.registeredFounder
 	info.RegisteredAt = channel.registeredTime
+	info.TransferPendingTo = channel.transferPendingTo
 
 	if includeFlags&IncludeTopic != 0 {
 		info.Topic = channel.topic
@@ -171,6 +193,7 @@ func (channel *Channel) ExportRegistration(includeFlags uint) (info RegisteredCh
 		info.Forward = channel.forward
 		info.Modes = channel.flags.AllModes()
 		info.UserLimit = channel.userLimit
+		info.JoinThrottle = channel.joinThrottleString()
 	}
 
 	if includeFlags&IncludeLists != 0 {
@@ -325,6 +348,7 @@ func (channel *Channel) SetUnregistered(expectedFounder string) {
 	var zeroTime time.Time
 	channel.registeredTime = zeroTime
 	channel.accountToUMode = make(map[string]modes.Mode)
+	channel.transferPendingTo = ""
 }
 
 // implements `CHANSERV CLEAR #chan ACCESS` (resets bans, invites, excepts, and amodes)
@@ -359,8 +383,14 @@ const (
 func (channel *Channel) Transfer(client *Client, target string, hasPrivs bool) (status channelTransferStatus, err error) {
 	status = channelTransferFailed
 	defer func() {
-		if status == channelTransferComplete && err == nil {
-			channel.Store(IncludeAllAttrs)
+		if err == nil {
+			switch status {
+			case channelTransferComplete:
+				channel.Store(IncludeAllAttrs)
+			case channelTransferPending, channelTransferCancelled:
+				// persist the offer, so it survives a restart
+				channel.Store(IncludeInitial)
+			}
 		}
 	}()
 
@@ -430,9 +460,28 @@ func (channel *Channel) regenerateMembersCache() {
 
 	channel.stateMutex.Lock()
 	channel.membersCache = result
+	channel.updateListEntryNoMutex()
 	channel.stateMutex.Unlock()
 }
 
+// updateListEntryNoMutex refreshes the LIST snapshot; you must be holding
+// the write lock, so that concurrent updates can't publish stale data
+func (channel *Channel) updateListEntryNoMutex() {
+	entry := &channelListEntry{
+		name:           channel.name,
+		nameCasefolded: channel.nameCasefolded,
+		topic:          channel.topic,
+		memberCount:    len(channel.members),
+		createdTime:    channel.createdTime,
+		topicSetTime:   channel.topicSetTime,
+	}
+	atomic.StorePointer(&channel.listEntry, unsafe.Pointer(entry))
+}
+
+func (channel *Channel) getListEntry() *channelListEntry {
+	return (*channelListEntry)(atomic.LoadPointer(&channel.listEntry))
+}
+
 // Names sends the list of users joined to the channel to the given client.
 func (channel *Channel) Names(client *Client, rb *ResponseBuffer) {
 	channel.stateMutex.RLock()
@@ -521,8 +570,12 @@ func (channel *Channel) ClientIsAtLeast(client *Client, permission modes.Mode) b
 		return true
 	}
 
+	return memberModesAtLeast(memberData.modes, permission)
+}
+
+func memberModesAtLeast(memberModes *modes.ModeSet, permission modes.Mode) bool {
 	for _, mode := range modes.ChannelUserModes {
-		if memberData.modes.HasMode(mode) {
+		if memberModes.HasMode(mode) {
 			return true
 		}
 		if mode == permission {
@@ -532,6 +585,30 @@ func (channel *Channel) ClientIsAtLeast(client *Client, permission modes.Mode) b
 	return false
 }
 
+// membersAtLeast returns the members satisfying ClientIsAtLeast(member, permission);
+// it acquires the channel lock once, instead of once per member
+func (channel *Channel) membersAtLeast(permission modes.Mode) (result []*Client) {
+	var others []*Client
+	channel.stateMutex.RLock()
+	founder := channel.registeredFounder
+	for member, memberData := range channel.members {
+		if memberModesAtLeast(memberData.modes, permission) {
+			result = append(result, member)
+		} else if founder != "" {
+			others = append(others, member)
+		}
+	}
+	channel.stateMutex.RUnlock()
+
+	// check the founder outside the channel lock, since it requires the client lock
+	for _, member := range others {
+		if member.Account() == founder {
+			result = append(result, member)
+		}
+	}
+	return
+}
+
 func (channel *Channel) ClientPrefixes(client *Client, isMultiPrefix bool) string {
 	channel.stateMutex.RLock()
 	defer channel.stateMutex.RUnlock()
@@ -615,6 +692,7 @@ func (channel *Channel) modeStrings(client *Client) (result []string) {
 	showKey := isMember && (channel.key != "")
 	showUserLimit := channel.userLimit > 0
 	showForward := channel.forward != ""
+	showJoinThrottle := channel.joinThrottle.Limit != 0
 
 	var mods strings.Builder
 	mods.WriteRune('+')
@@ -629,6 +707,9 @@ func (channel *Channel) modeStrings(client *Client) (result []string) {
 	if showForward {
 		mods.WriteRune(rune(modes.Forward))
 	}
+	if showJoinThrottle {
+		mods.WriteRune(rune(modes.JoinThrottle))
+	}
 
 	for _, m := range channel.flags.AllModes() {
 		mods.WriteRune(rune(m))
@@ -647,6 +728,9 @@ func (channel *Channel) modeStrings(client *Client) (result []string) {
 	if showForward {
 		result = append(result, channel.forward)
 	}
+	if showJoinThrottle {
+		result = append(result, channel.joinThrottleString())
+	}
 
 	return
 }
@@ -748,6 +832,11 @@ func (channel *Channel) Join(client *Client, key string, isSajoin bool, rb *Resp
 		return nil, ""
 	}
 
+	// +z is not bypassable by channel privileges, since it protects the channel's traffic
+	if !isSajoin && channel.flags.HasMode(modes.SecureOnly) && !client.HasMode(modes.TLS) {
+		return errSecureOnly, forward
+	}
+
 	// 0. SAJOIN always succeeds
 	// 1. the founder can always join (even if they disabled auto +q on join)
 	// 2. anyone who automatically receives halfop or higher can always join
@@ -766,28 +855,40 @@ func (channel *Channel) Join(client *Client, key string, isSajoin bool, rb *Resp
 
 		// #1901: +h and up exempt from all restrictions, but +v additionally exempts from +i:
 		if channel.flags.HasMode(modes.InviteOnly) && persistentMode == 0 &&
-			!channel.lists[modes.InviteMask].Match(details.nickMaskCasefolded) {
+			!channel.lists[modes.InviteMask].MatchClient(client, details.nickMaskCasefolded) {
 			return errInviteOnly, forward
 		}
 
-		if channel.lists[modes.BanMask].Match(details.nickMaskCasefolded) &&
-			!channel.lists[modes.ExceptMask].Match(details.nickMaskCasefolded) &&
-			!channel.lists[modes.InviteMask].Match(details.nickMaskCasefolded) {
+		if channel.lists[modes.BanMask].MatchClient(client, details.nickMaskCasefolded) &&
+			!channel.lists[modes.ExceptMask].MatchClient(client, details.nickMaskCasefolded) &&
+			!channel.lists[modes.InviteMask].MatchClient(client, details.nickMaskCasefolded) {
 			// do not forward people who are banned:
 			return errBanned, ""
 		}
 
 		if details.account == "" &&
 			(channel.flags.HasMode(modes.RegisteredOnly) || channel.server.Defcon() <= 2) &&
-			!channel.lists[modes.InviteMask].Match(details.nickMaskCasefolded) {
-			return errRegisteredOnly, forward
+			!channel.lists[modes.InviteMask].MatchClient(client, details.nickMaskCasefolded) {
+			if channel.flags.HasMode(modes.RegisteredOnly) {
+				return errRegisteredOnly, forward
+			}
+			// the restriction comes from DEFCON, not from the channel
+			return errRegisteredOnlyDefcon, forward
 		}
+
 	}
 
 	if joinErr := client.addChannel(channel, rb == nil); joinErr != nil {
 		return joinErr, ""
 	}
 
+	// check this once the join can no longer fail otherwise,
+	// so that rejected joins don't count against the throttle
+	if !hasPrivs && channel.touchJoinThrottle() {
+		client.removeChannel(channel)
+		return errJoinThrottled, forward
+	}
+
 	client.server.logger.Debug("channels", fmt.Sprintf("%s joined channel %s", details.nick, chname))
 
 	givenMode := func() (givenMode modes.Mode) {
@@ -909,21 +1010,24 @@ func (channel *Channel) autoReplayHistory(client *Client, rb *ResponseBuffer, sk
 
 	hasAutoreplayTimestamps := false
 	var start, end time.Time
+	var limit int
 	if rb.session.zncPlaybackTimes.ValidFor(channel.NameCasefolded()) {
 		hasAutoreplayTimestamps = true
 		start, end = rb.session.zncPlaybackTimes.start, rb.session.zncPlaybackTimes.end
+		limit = channel.server.Config().History.ZNCMax
 	} else if !rb.session.autoreplayMissedSince.IsZero() {
 		// we already checked for history caps in `playReattachMessages`
 		hasAutoreplayTimestamps = true
+		// start is after end, so the latest `limit` missed items are replayed:
 		start = time.Now().UTC()
 		end = rb.session.autoreplayMissedSince
+		limit = client.autoreplayMissedLimit()
 	}
 
 	if hasAutoreplayTimestamps {
 		_, seq, _ := channel.server.GetHistorySequence(channel, client, "")
 		if seq != nil {
-			zncMax := channel.server.Config().History.ZNCMax
-			items, _ = seq.Between(history.Selector{Time: start}, history.Selector{Time: end}, zncMax)
+			items, _ = seq.Between(history.Selector{Time: start}, history.Selector{Time: end}, limit)
 		}
 	} else if !rb.session.HasHistoryCaps() {
 		var replayLimit int
@@ -968,11 +1072,12 @@ func (channel *Channel) playJoinForSession(session *Session) {
 	client := session.client
 	sessionRb := NewResponseBuffer(session)
 	details := client.Details()
+	isBot := client.HasMode(modes.Bot)
 	chname := channel.Name()
 	if session.capabilities.Has(caps.ExtendedJoin) {
-		sessionRb.Add(nil, details.nickMask, "JOIN", chname, details.accountName, details.realname)
+		sessionRb.AddFromClient(time.Time{}, "", details.nickMask, details.accountName, isBot, nil, "JOIN", chname, details.accountName, details.realname)
 	} else {
-		sessionRb.Add(nil, details.nickMask, "JOIN", chname)
+		sessionRb.AddFromClient(time.Time{}, "", details.nickMask, details.accountName, isBot, nil, "JOIN", chname)
 	}
 	if session.capabilities.Has(caps.ReadMarker) {
 		chcfname := channel.NameCasefolded()
@@ -1202,6 +1307,7 @@ func (channel *Channel) SetTopic(client *Client, topic string, rb *ResponseBuffe
 	channel.topic = topic
 	channel.topicSetBy = client.nickMaskString
 	channel.topicSetTime = time.Now().UTC()
+	channel.updateListEntryNoMutex()
 	channel.stateMutex.Unlock()
 
 	details := client.Details()
@@ -1252,12 +1358,12 @@ func (channel *Channel) CanSpeak(client *Client) (bool, modes.Mode) {
 }
 
 func (channel *Channel) isMuted(client *Client) bool {
-	muteRe := channel.lists[modes.BanMask].MuteRegexp()
-	if muteRe == nil {
+	bans := channel.lists[modes.BanMask]
+	if bans.MuteRegexp() == nil && bans.compiledExtbans() == nil {
 		return false
 	}
 	nuh := client.NickMaskCasefolded()
-	return muteRe.MatchString(nuh) && !channel.lists[modes.ExceptMask].MatchMute(nuh)
+	return bans.MatchMuteClient(client, nuh) && !channel.lists[modes.ExceptMask].MatchMuteClient(client, nuh)
 }
 
 func (channel *Channel) relayNickMuted(relayNick string) bool {
@@ -1286,10 +1392,14 @@ func (channel *Channel) SendSplitMessage(command string, minPrefixMode modes.Mod
 	}
 
 	if canSpeak, mode := channel.CanSpeak(client); !canSpeak {
-		if histType != history.Notice {
-			rb.Add(nil, client.server.name, ERR_CANNOTSENDTOCHAN, client.Nick(), channel.Name(), fmt.Sprintf(client.t("Cannot send to channel (+%s)"), mode))
+		// with +U, messages from members that would be blocked by a mute, +m, or +M
+		// are relayed to channel operators (see below) instead of being dropped
+		if !(mode != modes.NoOutside && channel.flags.HasMode(modes.OpModerated)) {
+			if histType != history.Notice {
+				rb.Add(nil, client.server.name, ERR_CANNOTSENDTOCHAN, client.Nick(), channel.Name(), fmt.Sprintf(client.t("Cannot send to channel (+%s)"), mode))
+			}
+			return
 		}
-		return
 	}
 
 	isCTCP := message.IsRestrictedCTCPMessage()
@@ -1333,12 +1443,14 @@ func (channel *Channel) SendSplitMessage(command string, minPrefixMode modes.Mod
 
 	var cache MessageCache
 	cache.InitializeSplitMessage(channel.server, details.nickMask, details.accountName, isBot, clientOnlyTags, command, chname, message)
-	for _, member := range channel.Members() {
-		if minPrefixMode != modes.Mode(0) && !channel.ClientIsAtLeast(member, minPrefixMode) {
-			// STATUSMSG or OpModerated
-			continue
-		}
-
+	var recipients []*Client
+	if minPrefixMode == modes.Mode(0) {
+		recipients = channel.Members()
+	} else {
+		// STATUSMSG or OpModerated
+		recipients = channel.membersAtLeast(minPrefixMode)
+	}
+	for _, member := range recipients {
 		for _, session := range member.Sessions() {
 			if session == rb.session {
 				continue // we already sent echo-message, if applicable
@@ -1409,7 +1521,21 @@ func (channel *Channel) ShowMaskList(client *Client, mode modes.Mode, rb *Respon
 
 	nick := client.Nick()
 	chname := channel.Name()
-	for mask, info := range channel.lists[mode].Masks() {
+	masks := channel.lists[mode].Masks()
+	// display in the order the entries were set, rather than in map order
+	sortedMasks := make([]string, 0, len(masks))
+	for mask := range masks {
+		sortedMasks = append(sortedMasks, mask)
+	}
+	sort.Slice(sortedMasks, func(i, j int) bool {
+		ti, tj := masks[sortedMasks[i]].TimeCreated, masks[sortedMasks[j]].TimeCreated
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return sortedMasks[i] < sortedMasks[j]
+	})
+	for _, mask := range sortedMasks {
+		info := masks[mask]
 		rb.Add(nil, client.server.name, rpllist, nick, chname, mask, info.CreatorNickmask, strconv.FormatInt(info.TimeCreated.Unix(), 10))
 	}
 
@@ -1611,7 +1737,6 @@ func (channel *Channel) auditoriumFriends(client *Client) (friends []*Client) {
 
 // data for RPL_LIST
 func (channel *Channel) listData() (memberCount int, name, topic string) {
-	channel.stateMutex.RLock()
-	defer channel.stateMutex.RUnlock()
-	return len(channel.members), channel.name, channel.topic
+	entry := channel.getListEntry()
+	return entry.memberCount, entry.name, entry.topic
 }
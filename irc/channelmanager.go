@@ -117,6 +117,12 @@ func (cm *ChannelManager) Join(client *Client, name string, key string, isSajoin
 		return errNoSuchChannel, ""
 	}
 
+	if !(isSajoin || client.HasRoleCapabs("ban")) {
+		if isForbidden, info := server.qlines.CheckChannel(casefoldedName); isForbidden {
+			return &QLineError{Info: info}, ""
+		}
+	}
+
 	channel, err, newChannel := func() (*Channel, error, bool) {
 		var newChannel bool
 		cm.Lock()
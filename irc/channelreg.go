@@ -36,6 +36,8 @@ const (
 	keyChannelUserLimit      = "channel.userlimit %s"
 	keyChannelSettings       = "channel.settings %s"
 	keyChannelForward        = "channel.forward %s"
+	keyChannelJoinThrottle   = "channel.jointhrottle %s"
+	keyChannelTransferTo     = "channel.transfer.pending %s"
 
 	keyChannelPurged = "channel.purged %s"
 )
@@ -58,6 +60,8 @@ var (
 		keyChannelUserLimit,
 		keyChannelSettings,
 		keyChannelForward,
+		keyChannelJoinThrottle,
+		keyChannelTransferTo,
 	}
 )
 
@@ -86,6 +90,8 @@ type RegisteredChannel struct {
 	RegisteredAt time.Time
 	// Founder indicates the founder of the channel.
 	Founder string
+	// TransferPendingTo is the account that has been offered ownership of the channel, if any
+	TransferPendingTo string
 	// Topic represents the channel topic.
 	Topic string
 	// TopicSetBy represents the host that set the topic.
@@ -100,6 +106,8 @@ type RegisteredChannel struct {
 	Forward string
 	// UserLimit is the user limit (0 for no limit)
 	UserLimit int
+	// JoinThrottle is the join throttle (+j) parameter, e.g. "5:10"
+	JoinThrottle string
 	// AccountToUMode maps user accounts to their persistent channel modes (e.g., +q, +h)
 	AccountToUMode map[string]modes.Mode
 	// Bans represents the bans set on the channel.
@@ -202,6 +210,7 @@ func (reg *ChannelRegistry) LoadChannel(nameCasefolded string) (info RegisteredC
 		regTime, _ := tx.Get(fmt.Sprintf(keyChannelRegTime, channelKey))
 		regTimeInt, _ := strconv.ParseInt(regTime, 10, 64)
 		founder, _ := tx.Get(fmt.Sprintf(keyChannelFounder, channelKey))
+		transferPendingTo, _ := tx.Get(fmt.Sprintf(keyChannelTransferTo, channelKey))
 		topic, _ := tx.Get(fmt.Sprintf(keyChannelTopic, channelKey))
 		topicSetBy, _ := tx.Get(fmt.Sprintf(keyChannelTopicSetBy, channelKey))
 		var topicSetTime time.Time
@@ -213,6 +222,7 @@ func (reg *ChannelRegistry) LoadChannel(nameCasefolded string) (info RegisteredC
 		modeString, _ := tx.Get(fmt.Sprintf(keyChannelModes, channelKey))
 		userLimitString, _ := tx.Get(fmt.Sprintf(keyChannelUserLimit, channelKey))
 		forward, _ := tx.Get(fmt.Sprintf(keyChannelForward, channelKey))
+		joinThrottle, _ := tx.Get(fmt.Sprintf(keyChannelJoinThrottle, channelKey))
 		banlistString, _ := tx.Get(fmt.Sprintf(keyChannelBanlist, channelKey))
 		exceptlistString, _ := tx.Get(fmt.Sprintf(keyChannelExceptlist, channelKey))
 		invitelistString, _ := tx.Get(fmt.Sprintf(keyChannelInvitelist, channelKey))
@@ -239,22 +249,24 @@ func (reg *ChannelRegistry) LoadChannel(nameCasefolded string) (info RegisteredC
 		_ = json.Unmarshal([]byte(settingsString), &settings)
 
 		info = RegisteredChannel{
-			Name:           name,
-			NameCasefolded: nameCasefolded,
-			RegisteredAt:   time.Unix(0, regTimeInt).UTC(),
-			Founder:        founder,
-			Topic:          topic,
-			TopicSetBy:     topicSetBy,
-			TopicSetTime:   topicSetTime,
-			Key:            password,
-			Modes:          modeSlice,
-			Bans:           banlist,
-			Excepts:        exceptlist,
-			Invites:        invitelist,
-			AccountToUMode: accountToUMode,
-			UserLimit:      int(userLimit),
-			Settings:       settings,
-			Forward:        forward,
+			Name:              name,
+			NameCasefolded:    nameCasefolded,
+			RegisteredAt:      time.Unix(0, regTimeInt).UTC(),
+			Founder:           founder,
+			TransferPendingTo: transferPendingTo,
+			Topic:             topic,
+			TopicSetBy:        topicSetBy,
+			TopicSetTime:      topicSetTime,
+			Key:               password,
+			Modes:             modeSlice,
+			Bans:              banlist,
+			Excepts:           exceptlist,
+			Invites:           invitelist,
+			AccountToUMode:    accountToUMode,
+			UserLimit:         int(userLimit),
+			Settings:          settings,
+			Forward:           forward,
+			JoinThrottle:      joinThrottle,
 		}
 		return nil
 	})
@@ -350,6 +362,7 @@ func (reg *ChannelRegistry) saveChannel(tx *buntdb.Tx, channelInfo RegisteredCha
 		tx.Set(fmt.Sprintf(keyChannelName, channelKey), channelInfo.Name, nil)
 		tx.Set(fmt.Sprintf(keyChannelRegTime, channelKey), strconv.FormatInt(channelInfo.RegisteredAt.UnixNano(), 10), nil)
 		tx.Set(fmt.Sprintf(keyChannelFounder, channelKey), channelInfo.Founder, nil)
+		tx.Set(fmt.Sprintf(keyChannelTransferTo, channelKey), channelInfo.TransferPendingTo, nil)
 	}
 
 	if includeFlags&IncludeTopic != 0 {
@@ -368,6 +381,7 @@ func (reg *ChannelRegistry) saveChannel(tx *buntdb.Tx, channelInfo RegisteredCha
 		tx.Set(fmt.Sprintf(keyChannelModes, channelKey), modeString, nil)
 		tx.Set(fmt.Sprintf(keyChannelUserLimit, channelKey), strconv.Itoa(channelInfo.UserLimit), nil)
 		tx.Set(fmt.Sprintf(keyChannelForward, channelKey), channelInfo.Forward, nil)
+		tx.Set(fmt.Sprintf(keyChannelJoinThrottle, channelKey), channelInfo.JoinThrottle, nil)
 	}
 
 	if includeFlags&IncludeLists != 0 {
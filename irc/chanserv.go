@@ -200,6 +200,15 @@ connected to the server. $bHOWTOBAN$b suggests a ban command that will
 	}
 )
 
+func isChannelUserMode(mode modes.Mode) bool {
+	for _, userMode := range modes.ChannelUserModes {
+		if mode == userMode {
+			return true
+		}
+	}
+	return false
+}
+
 func csAmodeHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
 	channelName := params[0]
 
@@ -219,6 +228,11 @@ func csAmodeHandler(service *ircService, server *Server, client *Client, command
 		return
 	} else if len(modeChanges) == 1 {
 		change = modeChanges[0]
+		// only prefix modes (+qaohv) can be granted persistently
+		if !isChannelUserMode(change.Mode) {
+			service.Notice(rb, client.t("Invalid mode change"))
+			return
+		}
 	} else {
 		change = modes.ModeChange{Op: modes.List}
 	}
@@ -780,7 +794,7 @@ func csInfoHandler(service *ircService, server *Server, client *Client, command
 	var chinfo RegisteredChannel
 	channel := server.channels.Get(params[0])
 	if channel != nil {
-		chinfo = channel.ExportRegistration(0)
+		chinfo = channel.ExportRegistration(IncludeTopic | IncludeModes)
 	} else {
 		chinfo, err = server.channelRegistry.LoadChannel(chname)
 		if err != nil && !(err == errNoSuchChannel || err == errFeatureDisabled) {
@@ -797,6 +811,35 @@ func csInfoHandler(service *ircService, server *Server, client *Client, command
 	service.Notice(rb, fmt.Sprintf(client.t("Channel %s is registered"), chinfo.Name))
 	service.Notice(rb, fmt.Sprintf(client.t("Founder: %s"), chinfo.Founder))
 	service.Notice(rb, fmt.Sprintf(client.t("Registered at: %s"), chinfo.RegisteredAt.Format(time.RFC1123)))
+
+	// the persisted state that will be restored on server restart
+	if client.Account() == chinfo.Founder || client.HasRoleCapabs("chanreg") {
+		if chinfo.Topic != "" {
+			service.Notice(rb, fmt.Sprintf(client.t("Stored topic: %s"), chinfo.Topic))
+			service.Notice(rb, fmt.Sprintf(client.t("Topic set by %[1]s at %[2]s"), chinfo.TopicSetBy, chinfo.TopicSetTime.Format(time.RFC1123)))
+		}
+		var modeBuf strings.Builder
+		modeBuf.WriteByte('+')
+		for _, mode := range chinfo.Modes {
+			modeBuf.WriteRune(rune(mode))
+		}
+		if chinfo.Key != "" {
+			modeBuf.WriteRune(rune(modes.Key))
+		}
+		if chinfo.UserLimit != 0 {
+			modeBuf.WriteRune(rune(modes.UserLimit))
+		}
+		if chinfo.Forward != "" {
+			modeBuf.WriteRune(rune(modes.Forward))
+		}
+		if chinfo.JoinThrottle != "" {
+			modeBuf.WriteRune(rune(modes.JoinThrottle))
+		}
+		service.Notice(rb, fmt.Sprintf(client.t("Stored modes: %s"), modeBuf.String()))
+		if chinfo.TransferPendingTo != "" {
+			service.Notice(rb, fmt.Sprintf(client.t("Pending transfer to account: %s"), chinfo.TransferPendingTo))
+		}
+	}
 }
 
 func displayChannelSetting(service *ircService, settingName string, settings ChannelSettings, client *Client, rb *ResponseBuffer) {
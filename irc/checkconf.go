@@ -0,0 +1,186 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package irc
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	// yaml.v2's error message for unknown keys in strict mode
+	unknownKeyRegexp = regexp.MustCompile(`^line (\d+): field (.*) not found in type (.*)$`)
+)
+
+// ConfigCheckResult is the result of validating a config file with CheckConfig.
+type ConfigCheckResult struct {
+	// problems that would prevent the server from starting, or that indicate
+	// the config does not mean what its author intended (e.g., misspelled keys)
+	Errors []string
+	// problems that don't affect the server, like deprecated options
+	Warnings []string
+}
+
+// CheckConfig loads and validates a config file, without starting a server.
+func CheckConfig(filename string) (result ConfigCheckResult) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		result.Errors = append(result.Errors, err.Error())
+		return
+	}
+
+	var config Config
+	// a strict unmarshal reports unknown and duplicate keys, as well as type errors:
+	err = yaml.UnmarshalStrict(data, &config)
+	typeErrors := false
+	if err != nil {
+		yamlErr, ok := err.(*yaml.TypeError)
+		if !ok {
+			// syntax error; there's nothing else we can check
+			result.Errors = append(result.Errors, err.Error())
+			return
+		}
+		for _, message := range yamlErr.Errors {
+			if match := unknownKeyRegexp.FindStringSubmatch(message); match != nil {
+				message = fmt.Sprintf("line %s: unknown key `%s`", match[1], match[2])
+			} else {
+				typeErrors = true
+			}
+			result.Errors = append(result.Errors, message)
+		}
+	}
+
+	result.Warnings = append(result.Warnings, deprecatedOptions(&config)...)
+	result.Errors = append(result.Errors, listenerConflicts(&config)...)
+
+	// a type error would just be reported again
+	if !typeErrors {
+		if loaded, err := LoadConfig(filename); err != nil {
+			result.Errors = append(result.Errors, err.Error())
+		} else if loaded.Server.motdError != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("could not load MOTD file: %v", loaded.Server.motdError))
+		}
+	}
+	return
+}
+
+// deprecatedOptions lists the legacy keys that are set in a raw (unprocessed) config
+func deprecatedOptions(config *Config) (result []string) {
+	deprecated := func(key, replacement string) {
+		result = append(result, fmt.Sprintf("`%s` is deprecated; use `%s` instead", key, replacement))
+	}
+
+	var listenerAddrs []string
+	for addr := range config.Server.Listeners {
+		listenerAddrs = append(listenerAddrs, addr)
+	}
+	sort.Strings(listenerAddrs)
+	for _, addr := range listenerAddrs {
+		listener := config.Server.Listeners[addr]
+		if listener.TLS.Proxy {
+			deprecated(fmt.Sprintf("server.listeners.%s.tls.proxy", addr), fmt.Sprintf("server.listeners.%s.proxy", addr))
+		}
+	}
+	if len(config.Server.TorListeners.Listeners) != 0 {
+		deprecated("server.tor-listeners.listeners", "server.listeners.<address>.tor")
+	}
+	if config.Accounts.Bouncer != nil {
+		deprecated("accounts.bouncer", "accounts.multiclient")
+	}
+	if config.Accounts.NickReservation.RenamePrefix != "" {
+		deprecated("accounts.nick-reservation.rename-prefix", "accounts.nick-reservation.guest-nickname-format")
+	}
+	if len(config.Accounts.Registration.LegacyEnabledCallbacks) != 0 {
+		deprecated("accounts.registration.enabled-callbacks", "accounts.registration.email-verification")
+	}
+	if config.Accounts.Registration.LegacyCallbacks.Mailto.Enabled {
+		deprecated("accounts.registration.callbacks", "accounts.registration.email-verification")
+	}
+	var operNames []string
+	for name := range config.Opers {
+		operNames = append(operNames, name)
+	}
+	sort.Strings(operNames)
+	for _, name := range operNames {
+		if oper := config.Opers[name]; oper != nil && oper.Fingerprint != nil {
+			deprecated(fmt.Sprintf("opers.%s.fingerprint", name), fmt.Sprintf("opers.%s.certfp", name))
+		}
+	}
+	if config.History.Restrictions.EnforceRegistrationDate_ {
+		deprecated("history.restrictions.enforce-registration-date", "history.restrictions.query-cutoff")
+	}
+	return
+}
+
+type configListener struct {
+	key  string
+	addr string
+}
+
+// listenerConflicts lists pairs of listeners in a raw (unprocessed) config
+// that would try to bind the same address
+func listenerConflicts(config *Config) (result []string) {
+	var listeners []configListener
+	for addr := range config.Server.Listeners {
+		listeners = append(listeners, configListener{key: "server.listeners", addr: addr})
+	}
+	sort.Slice(listeners, func(i, j int) bool { return listeners[i].addr < listeners[j].addr })
+	for _, addr := range config.Server.TorListeners.Listeners {
+		listeners = append(listeners, configListener{key: "server.tor-listeners.listeners", addr: addr})
+	}
+	if config.API.Enabled && config.API.Listener != "" {
+		listeners = append(listeners, configListener{key: "api.listener", addr: config.API.Listener})
+	}
+	if config.Debug.PprofListener != "" {
+		listeners = append(listeners, configListener{key: "debug.pprof-listener", addr: config.Debug.PprofListener})
+	}
+
+	for i := 0; i < len(listeners); i++ {
+		for j := i + 1; j < len(listeners); j++ {
+			if listenAddrsConflict(listeners[i].addr, listeners[j].addr) {
+				result = append(result, fmt.Sprintf("listener %s (`%s`) conflicts with listener %s (`%s`)", listeners[i].addr, listeners[i].key, listeners[j].addr, listeners[j].key))
+			}
+		}
+	}
+	return
+}
+
+// listenAddrsConflict returns whether two listen addresses can't be bound at the same time
+func listenAddrsConflict(first, second string) bool {
+	// unix domain sockets
+	if strings.HasPrefix(first, "/") || strings.HasPrefix(second, "/") {
+		return first == second
+	}
+	firstHost, firstPort, err := net.SplitHostPort(first)
+	if err != nil {
+		return false
+	}
+	secondHost, secondPort, err := net.SplitHostPort(second)
+	if err != nil || firstPort != secondPort {
+		return false
+	}
+	// a wildcard address conflicts with every other address on the same port
+	if isWildcardHost(firstHost) || isWildcardHost(secondHost) {
+		return true
+	}
+	firstIP, secondIP := net.ParseIP(firstHost), net.ParseIP(secondHost)
+	if firstIP != nil && secondIP != nil {
+		return firstIP.Equal(secondIP)
+	}
+	return strings.EqualFold(firstHost, secondHost)
+}
+
+func isWildcardHost(host string) bool {
+	if host == "" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsUnspecified()
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package irc
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestListenAddrsConflict(t *testing.T) {
+	conflict := func(first, second string, expected bool) {
+		if listenAddrsConflict(first, second) != expected {
+			t.Errorf("expected conflict between %s and %s to be %t", first, second, expected)
+		}
+	}
+	conflict(":6667", "127.0.0.1:6667", true)
+	conflict("0.0.0.0:6667", "[::1]:6667", true)
+	conflict("127.0.0.1:6667", "127.0.0.1:6667", true)
+	conflict("[::1]:6667", "[0:0::1]:6667", true)
+	conflict("localhost:6667", "LOCALHOST:6667", true)
+	conflict("/tmp/ergo_sock", "/tmp/ergo_sock", true)
+	conflict(":6667", ":6697", false)
+	conflict("127.0.0.1:6667", "[::1]:6667", false)
+	conflict("/tmp/ergo_sock", ":6667", false)
+}
+
+func TestCheckConfigUnknownKeys(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "ircd.yaml")
+	config := `
+network:
+    name: "ErgoTest"
+    nmae: "ErgoTest"
+server:
+    listeners:
+        ":6667": {}
+        "127.0.0.1:6667": {}
+accounts:
+    bouncer:
+        enabled: true
+`
+	if err := os.WriteFile(filename, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	result := CheckConfig(filename)
+
+	contains := func(messages []string, substring string) bool {
+		for _, message := range messages {
+			if strings.Contains(message, substring) {
+				return true
+			}
+		}
+		return false
+	}
+	if !contains(result.Errors, "line 4: unknown key `nmae`") {
+		t.Errorf("unknown key not reported: %v", result.Errors)
+	}
+	if !contains(result.Errors, "conflicts with listener") {
+		t.Errorf("listener conflict not reported: %v", result.Errors)
+	}
+	if !contains(result.Warnings, "`accounts.bouncer` is deprecated") {
+		t.Errorf("deprecated key not reported: %v", result.Warnings)
+	}
+}
@@ -57,6 +57,8 @@ const (
 	// This is how long a client gets without sending any message, including the PONG to our
 	// PING, before we disconnect them:
 	DefaultTotalTimeout = 2*time.Minute + 30*time.Second
+	// DefaultWriteTimeout is how long a write to a client can block before we disconnect them
+	DefaultWriteTimeout = time.Minute
 
 	// round off the ping interval by this much, see below:
 	PingCoalesceThreshold = time.Second
@@ -83,9 +85,12 @@ type Client struct {
 	isKlined           bool // #1941: k-line kills are special-cased to suppress some triggered notices/events
 	languages          []string
 	lastActive         time.Time            // last time they sent a command that wasn't PONG or similar
+	lastCallerIDNotice time.Time            // last time they were told that a +g-blocked user messaged them
 	lastSeen           map[string]time.Time // maps device ID (including "") to time of last received command
 	readMarkers        map[string]time.Time // maps casefolded target to time of last read marker
 	loginThrottle      connection_limits.GenericThrottle
+	searchThrottle     connection_limits.GenericThrottle
+	memoThrottle       connection_limits.GenericThrottle
 	nextSessionID      int64 // Incremented when a new session is established
 	nick               string
 	nickCasefolded     string
@@ -149,6 +154,12 @@ type Session struct {
 	idleTimer  *time.Timer
 	pingSent   bool // we sent PING to a putatively idle connection and we're waiting for PONG
 
+	// name of the matching server.connection-classes entry, if any
+	connectionClass string
+	// how long without traffic before we send PING, and before we disconnect:
+	idleTimeout  time.Duration
+	totalTimeout time.Duration
+
 	sessionID   int64
 	socket      *Socket
 	realIP      net.IP
@@ -156,6 +167,9 @@ type Session struct {
 	rawHostname string
 	isTor       bool
 	hideSTS     bool
+	// whether this session's connection is secure (TLS, or a trusted
+	// gateway reporting TLS); the client's +Z reflects all its sessions
+	isSecure bool
 
 	fakelag              Fakelag
 	deferredFakelagCount int
@@ -165,6 +179,8 @@ type Session struct {
 	sasl       saslStatus
 	passStatus serverPassStatus
 
+	pendingOper *pendingOper // OPER awaiting TOTP VERIFY
+
 	batchCounter uint32
 
 	quitMessage string
@@ -277,6 +293,8 @@ type WhoWas struct {
 	// technically not required for WHOWAS:
 	account     string
 	accountName string
+	// when the client stopped using the nickname (set by WhoWasList.Append)
+	signoff time.Time
 }
 
 // ClientDetails is a standard set of details about a client
@@ -293,6 +311,7 @@ func (server *Server) RunClient(conn IRCConn) {
 	wConn := conn.UnderlyingConn()
 	var isBanned, requireSASL bool
 	var banMsg string
+	var connectionClass *ConnectionClassConfig
 	realIP := utils.AddrToIP(wConn.RemoteAddr())
 	var proxiedIP net.IP
 	if wConn.Config.Tor {
@@ -310,6 +329,7 @@ func (server *Server) RunClient(conn IRCConn) {
 		// otherwise we'll do it in ApplyProxiedIP.
 		checkScripts := proxiedIP != nil || !utils.IPInNets(realIP, config.Server.proxyAllowedFromNets)
 		isBanned, requireSASL, banMsg = server.checkBans(config, ipToCheck, checkScripts)
+		connectionClass = config.connectionClass(ipToCheck)
 	}
 
 	if isBanned {
@@ -323,8 +343,23 @@ func (server *Server) RunClient(conn IRCConn) {
 	server.logger.Info("connect-ip", fmt.Sprintf("Client connecting: real IP %v, proxied IP %v", realIP, proxiedIP))
 
 	now := time.Now().UTC()
+	maxSendQBytes, writeTimeout := config.Server.MaxSendQBytes, config.Server.WriteTimeout
+	idleTimeout, totalTimeout := DefaultIdleTimeout, DefaultTotalTimeout
+	if wConn.Config.Tor {
+		idleTimeout = TorIdleTimeout
+	}
+	var connectionClassName string
+	if connectionClass != nil {
+		connectionClassName = connectionClass.name
+		maxSendQBytes = connectionClass.maxSendQBytes
+		writeTimeout = connectionClass.WriteTimeout
+		if connectionClass.PingTimeout != 0 {
+			idleTimeout = connectionClass.PingTimeout
+			totalTimeout = idleTimeout + (DefaultTotalTimeout - DefaultIdleTimeout)
+		}
+	}
 	// give them 1k of grace over the limit:
-	socket := NewSocket(conn, config.Server.MaxSendQBytes)
+	socket := NewSocket(conn, maxSendQBytes, writeTimeout)
 	client := &Client{
 		lastActive: now,
 		channels:   make(ChannelSet),
@@ -361,6 +396,11 @@ func (server *Server) RunClient(conn IRCConn) {
 		proxiedIP:  proxiedIP,
 		isTor:      wConn.Config.Tor,
 		hideSTS:    wConn.Config.Tor || wConn.Config.HideSTS,
+		isSecure:   wConn.Secure,
+
+		connectionClass: connectionClassName,
+		idleTimeout:     idleTimeout,
+		totalTimeout:    totalTimeout,
 	}
 	client.sessions = []*Session{session}
 
@@ -379,7 +419,7 @@ func (server *Server) RunClient(conn IRCConn) {
 		session.rawHostname = config.Server.TorListeners.Vhost
 		client.rawHostname = session.rawHostname
 	} else {
-		if config.Server.CheckIdent {
+		if wConn.Config.CheckIdent {
 			client.doIdentLookup(wConn.Conn)
 		}
 	}
@@ -389,7 +429,7 @@ func (server *Server) RunClient(conn IRCConn) {
 	client.run(session)
 }
 
-func (server *Server) AddAlwaysOnClient(account ClientAccount, channelToStatus map[string]alwaysOnChannelStatus, lastSeen, readMarkers map[string]time.Time, uModes modes.Modes, realname string) {
+func (server *Server) AddAlwaysOnClient(account ClientAccount, channelToStatus map[string]alwaysOnChannelStatus, lastSeen, readMarkers map[string]time.Time, uModes modes.Modes, realname, awayMessage string) {
 	now := time.Now().UTC()
 	config := server.Config()
 	if lastSeen == nil && account.Settings.AutoreplayMissed {
@@ -467,6 +507,8 @@ func (server *Server) AddAlwaysOnClient(account ClientAccount, channelToStatus m
 
 	if persistenceEnabled(config.Accounts.Multiclient.AutoAway, client.accountSettings.AutoAway) {
 		client.setAutoAwayNoMutex(config)
+	} else {
+		client.awayMessage = awayMessage
 	}
 }
 
@@ -573,8 +615,13 @@ func (client *Client) isAuthorized(server *Server, config *Config, session *Sess
 }
 
 func (session *Session) resetFakelag() {
-	var flc FakelagConfig = session.client.server.Config().Fakelag
-	flc.Enabled = flc.Enabled && !session.client.HasRoleCapabs("nofakelag")
+	config := session.client.server.Config()
+	var flc FakelagConfig = config.Fakelag
+	if class := config.Server.ConnectionClasses[session.connectionClass]; class != nil && class.fakelag != nil {
+		flc = *class.fakelag
+	}
+	flc.Enabled = flc.Enabled && !session.client.HasRoleCapabs("nofakelag") &&
+		!utils.IPInNets(session.IP(), flc.exemptedNets)
 	session.fakelag.Initialize(flc)
 }
 
@@ -717,6 +764,16 @@ func (client *Client) run(session *Session) {
 	}
 }
 
+// autoreplayMissedLimit returns the maximum number of missed lines to replay
+// for each target, taking NS SET AUTOREPLAY-WINDOW into account
+func (client *Client) autoreplayMissedLimit() (limit int) {
+	limit = client.server.Config().History.ZNCMax
+	if lines := client.AccountSettings().AutoreplayWindowLines; lines != 0 && lines < limit {
+		limit = lines
+	}
+	return
+}
+
 func (client *Client) playReattachMessages(session *Session) {
 	client.server.playRegistrationBurst(session)
 	hasHistoryCaps := session.HasHistoryCaps()
@@ -735,7 +792,7 @@ func (client *Client) playReattachMessages(session *Session) {
 	}
 	if !session.autoreplayMissedSince.IsZero() && !hasHistoryCaps {
 		rb := NewResponseBuffer(session)
-		zncPlayPrivmsgsFromAll(client, rb, time.Now().UTC(), session.autoreplayMissedSince)
+		zncPlayPrivmsgsFromAll(client, rb, time.Now().UTC(), session.autoreplayMissedSince, client.autoreplayMissedLimit())
 		rb.Send(true)
 	}
 	session.autoreplayMissedSince = time.Time{}
@@ -772,20 +829,13 @@ func (client *Client) updateIdleTimer(session *Session, now time.Time) {
 	session.pingSent = false
 
 	if session.idleTimer == nil {
-		pingTimeout := DefaultIdleTimeout
-		if session.isTor {
-			pingTimeout = TorIdleTimeout
-		}
-		session.idleTimer = time.AfterFunc(pingTimeout, session.handleIdleTimeout)
+		session.idleTimer = time.AfterFunc(session.idleTimeout, session.handleIdleTimeout)
 	}
 }
 
 func (session *Session) handleIdleTimeout() {
-	totalTimeout := DefaultTotalTimeout
-	pingTimeout := DefaultIdleTimeout
-	if session.isTor {
-		pingTimeout = TorIdleTimeout
-	}
+	totalTimeout := session.totalTimeout
+	pingTimeout := session.idleTimeout
 
 	session.client.stateMutex.Lock()
 	now := time.Now()
@@ -838,6 +888,16 @@ func (session *Session) Ping() {
 	session.Send(nil, "", "PING", session.client.Nick())
 }
 
+// isSelfMessage returns whether a DM history item was sent by the client with this nick
+func isSelfMessage(item *history.Item, nick string) bool {
+	// XXX: Params[0] is the message target. if the source of this message is an in-memory
+	// buffer, then it's "" for an incoming message and the recipient's nick for an outgoing
+	// message. if the source of the message is mysql, then mysql only sees one copy of the
+	// message, and it's the version with the recipient's nick filled in. so this is an
+	// incoming message if Params[0] (the recipient's nick) equals the client's nick:
+	return item.Params[0] != "" && item.Params[0] != nick
+}
+
 func (client *Client) replayPrivmsgHistory(rb *ResponseBuffer, items []history.Item, target string, chathistoryCommand bool) {
 	var batchID string
 	details := client.Details()
@@ -847,22 +907,13 @@ func (client *Client) replayPrivmsgHistory(rb *ResponseBuffer, items []history.I
 	}
 	batchID = rb.StartNestedHistoryBatch(target)
 
-	isSelfMessage := func(item *history.Item) bool {
-		// XXX: Params[0] is the message target. if the source of this message is an in-memory
-		// buffer, then it's "" for an incoming message and the recipient's nick for an outgoing
-		// message. if the source of the message is mysql, then mysql only sees one copy of the
-		// message, and it's the version with the recipient's nick filled in. so this is an
-		// incoming message if Params[0] (the recipient's nick) equals the client's nick:
-		return item.Params[0] != "" && item.Params[0] != nick
-	}
-
 	hasEventPlayback := rb.session.capabilities.Has(caps.EventPlayback)
 	hasTags := rb.session.capabilities.Has(caps.MessageTags)
 	for _, item := range items {
 		var command string
 		switch item.Type {
 		case history.Invite:
-			if isSelfMessage(&item) {
+			if isSelfMessage(&item, nick) {
 				continue
 			}
 			if hasEventPlayback {
@@ -893,7 +944,7 @@ func (client *Client) replayPrivmsgHistory(rb *ResponseBuffer, items []history.I
 		if hasTags {
 			tags = item.Tags
 		}
-		if !isSelfMessage(&item) {
+		if !isSelfMessage(&item, nick) {
 			rb.AddSplitMessageFromClient(item.Nick, item.AccountName, item.IsBot, tags, command, nick, item.Message)
 		} else {
 			// this message was sent *from* the client to another nick; the target is item.Params[0]
@@ -1361,22 +1412,24 @@ func (session *Session) sendSplitMsgFromClientInternal(blocking bool, nickmask,
 				session.SendRawMessage(msg, blocking)
 			}
 		} else {
-			msgidSent := false // send msgid on the first nonblank line
-			for _, messagePair := range message.Split {
-				if len(messagePair.Message) == 0 {
-					continue
-				}
+			for i, line := range message.FallbackLines(fallbackLineLen(nickmask, command, target)) {
 				var msgid string
-				if !msgidSent {
-					msgidSent = true
+				if i == 0 {
+					// send msgid on the first nonblank line
 					msgid = message.Msgid
 				}
-				session.sendFromClientInternal(blocking, message.Time, msgid, nickmask, accountName, isBot, tags, command, target, messagePair.Message)
+				session.sendFromClientInternal(blocking, message.Time, msgid, nickmask, accountName, isBot, tags, command, target, line)
 			}
 		}
 	}
 }
 
+// fallbackLineLen is the space available for the message text when relaying
+// a line of a multiline message: `:<nickmask> <command> <target> :<text>\r\n`
+func fallbackLineLen(nickmask, command, target string) int {
+	return MaxLineLen - len(nickmask) - len(command) - len(target) - len(":   :\r\n")
+}
+
 func (session *Session) sendFromClientInternal(blocking bool, serverTime time.Time, msgid string, nickmask, accountName string, isBot bool, tags map[string]string, command string, params ...string) (err error) {
 	msg := ircmsg.MakeMessage(tags, nickmask, command, params...)
 	// attach account-tag
@@ -1607,14 +1660,19 @@ func (client *Client) attemptAutoOper(session *Session) {
 	if session.certfp == "" || client.HasMode(modes.Operator) {
 		return
 	}
-	for _, oper := range client.server.Config().operators {
-		if oper.Auto && oper.Pass == nil && oper.Certfp != "" && oper.Certfp == session.certfp {
-			rb := NewResponseBuffer(session)
-			applyOper(client, oper, rb)
-			rb.Send(true)
-			return
-		}
+	oper, requiresTOTP := client.server.autoOperFor(session.certfp)
+	if oper == nil {
+		return
+	}
+	rb := NewResponseBuffer(session)
+	if requiresTOTP {
+		// a client certificate alone is not enough; the TOTP step is still required
+		session.pendingOper = &pendingOper{oper: oper, started: time.Now()}
+		rb.Notice(client.t("This operator block requires a TOTP code; send it with TOTP VERIFY <code>"))
+	} else {
+		applyOper(client, oper, rb)
 	}
+	rb.Send(true)
 }
 
 func (client *Client) checkLoginThrottle() (throttled bool, remainingTime time.Duration) {
@@ -1623,6 +1681,24 @@ func (client *Client) checkLoginThrottle() (throttled bool, remainingTime time.D
 	return client.loginThrottle.Touch()
 }
 
+func (client *Client) checkSearchThrottle(config *Config) (throttled bool, remainingTime time.Duration) {
+	client.stateMutex.Lock()
+	defer client.stateMutex.Unlock()
+	// pick up any changes made by rehash
+	client.searchThrottle.Duration = config.History.Search.Throttling.Duration
+	client.searchThrottle.Limit = config.History.Search.Throttling.MaxSearches
+	return client.searchThrottle.Touch()
+}
+
+func (client *Client) checkMemoThrottle(config *Config) (throttled bool, remainingTime time.Duration) {
+	client.stateMutex.Lock()
+	defer client.stateMutex.Unlock()
+	// pick up any changes made by rehash
+	client.memoThrottle.Duration = config.Accounts.Memos.Throttling.Duration
+	client.memoThrottle.Limit = config.Accounts.Memos.Throttling.MaxSends
+	return client.memoThrottle.Touch()
+}
+
 func (client *Client) historyStatus(config *Config) (status HistoryStatus, target string) {
 	if !config.History.Enabled {
 		return HistoryDisabled, ""
@@ -1750,6 +1826,7 @@ const (
 	IncludeChannels uint = 1 << iota
 	IncludeUserModes
 	IncludeRealname
+	IncludeAwayMessage
 )
 
 func (client *Client) markDirty(dirtyBits uint) {
@@ -1822,6 +1899,14 @@ func (client *Client) performWrite(additionalDirtyBits uint) {
 	if (dirtyBits & IncludeRealname) != 0 {
 		client.server.accounts.saveRealname(account, client.realname)
 	}
+	if (dirtyBits & IncludeAwayMessage) != 0 {
+		// with auto-away, the away state is derived from the sessions, not persisted
+		var awayMessage string
+		if !persistenceEnabled(client.server.Config().Accounts.Multiclient.AutoAway, client.AccountSettings().AutoAway) {
+			_, awayMessage = client.Away()
+		}
+		client.server.accounts.saveAwayMessage(account, awayMessage)
+	}
 }
 
 // Blocking store; see Channel.Store and Socket.BlockingWrite
@@ -165,6 +165,12 @@ func (clients *ClientManager) SetNick(client *Client, session *Session, newNick
 			return "", errNicknameInvalid, false
 		}
 
+		if !client.HasRoleCapabs("ban") {
+			if isForbidden, info := client.server.qlines.CheckNick(newCfNick); isForbidden {
+				return "", &QLineError{Info: info}, false
+			}
+		}
+
 		reservedAccount, method := client.server.accounts.EnforcementStatus(newCfNick, newSkeleton)
 		if method == NickEnforcementStrict && reservedAccount != "" && reservedAccount != account {
 			return "", errNicknameReserved, false
@@ -257,13 +263,13 @@ func (clients *ClientManager) AllClients() (result []*Client) {
 
 // AllWithCapsNotify returns all clients with the given capabilities, and that support cap-notify.
 func (clients *ClientManager) AllWithCapsNotify(capabs ...caps.Capability) (sessions []*Session) {
-	capabs = append(capabs, caps.CapNotify)
 	clients.RLock()
 	defer clients.RUnlock()
 	for _, client := range clients.byNick {
 		for _, session := range client.Sessions() {
 			// cap-notify is implicit in cap version 302 and above
-			if session.capabilities.HasAll(capabs...) || 302 <= session.capVersion {
+			capNotify := session.capabilities.Has(caps.CapNotify) || caps.Cap302 <= session.capVersion
+			if capNotify && session.capabilities.HasAll(capabs...) {
 				sessions = append(sessions, session)
 			}
 		}
@@ -5,7 +5,9 @@ package irc
 
 import (
 	"testing"
+	"time"
 
+	"github.com/ergochat/ergo/irc/languages"
 	"github.com/ergochat/ergo/irc/utils"
 )
 
@@ -88,3 +90,79 @@ func TestWhoFields(t *testing.T) {
 		t.Error("failed to set and get")
 	}
 }
+
+func TestParseWhoxQuery(t *testing.T) {
+	fields, whoType := parseWhoxQuery("%tcuhn,42")
+	if whoType != "42" || !fields.Has('t') || !fields.Has('n') || fields.Has(',') || fields.Has('a') {
+		t.Errorf("bad parse: %v %s", fields, whoType)
+	}
+	fields, whoType = parseWhoxQuery("n%TNA")
+	if whoType != "0" || !fields.Has('t') || !fields.Has('a') || !fields.Has('n') {
+		t.Errorf("fields should be case-insensitive: %v %s", fields, whoType)
+	}
+	_, whoType = parseWhoxQuery("%tn,")
+	if whoType != "0" {
+		t.Errorf("empty query type should be ignored: %s", whoType)
+	}
+	_, whoType = parseWhoxQuery("%tn,1234")
+	if whoType != "0" {
+		t.Errorf("overlong query type should be ignored: %s", whoType)
+	}
+	_, whoType = parseWhoxQuery("%tn,4a")
+	if whoType != "0" {
+		t.Errorf("non-numeric query type should be ignored: %s", whoType)
+	}
+}
+
+func TestSetAccountSettingsAutoAway(t *testing.T) {
+	var config Config
+	config.languageManager = new(languages.Manager)
+	config.Accounts.Multiclient.AlwaysOn = PersistentOptIn
+	config.Accounts.Multiclient.AutoAway = PersistentOptIn
+	server := &Server{}
+	server.config.Set(&config)
+
+	// an always-on client with no sessions
+	client := &Client{
+		server:          server,
+		registered:      true,
+		nick:            "alice",
+		accountName:     "alice",
+		alwaysOn:        true,
+		accountSettings: AccountSettings{AlwaysOn: PersistentMandatory},
+	}
+	autoAway := AccountSettings{AlwaysOn: PersistentMandatory, AutoAway: PersistentMandatory}
+	client.SetAccountSettings(autoAway)
+	away, message := client.Away()
+	assertEqual(away, true)
+	assertEqual(message, "User is currently disconnected")
+
+	// turning auto-away off clears the generated message
+	client.SetAccountSettings(AccountSettings{AlwaysOn: PersistentMandatory, AutoAway: PersistentDisabled})
+	away, message = client.Away()
+	assertEqual(away, false)
+	assertEqual(message, "")
+
+	// with a session, the away state reverts to the session's own
+	client.SetAccountSettings(autoAway)
+	session := &Session{client: client, awayMessage: "lunch", awayAt: time.Now().UTC()}
+	client.sessions = []*Session{session}
+	client.SetAccountSettings(AccountSettings{AlwaysOn: PersistentMandatory, AutoAway: PersistentDisabled})
+	_, message = client.Away()
+	assertEqual(message, "lunch")
+}
+
+func TestAutoreplayMissedLimit(t *testing.T) {
+	var config Config
+	config.History.ZNCMax = 100
+	server := &Server{}
+	server.config.Set(&config)
+	client := &Client{server: server}
+
+	// by default, replay is only bounded by znc-maxmessages
+	assertEqual(client.autoreplayMissedLimit(), 100)
+	client.accountSettings.AutoreplayWindowLines = 25
+	assertEqual(client.autoreplayMissedLimit(), 25)
+	client.accountSettings.AutoreplayWindowLines = 1000
+	assertEqual(client.autoreplayMissedLimit(), 100)
+}
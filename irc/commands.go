@@ -38,6 +38,9 @@ func (cmd *Command) Run(server *Server, client *Client, session *Session, msg ir
 			rb.Add(nil, server.name, ERR_NEEDMOREPARAMS, client.Nick(), msg.Command, rb.target.t("Not enough parameters"))
 			return false
 		}
+		if len(cmd.capabs) > 0 {
+			server.audit.RecordClient(client, msg.Command, msg.Params)
+		}
 		if session.batch.label != "" && !cmd.allowedInBatch {
 			rb.Add(nil, server.name, "FAIL", "BATCH", "MULTILINE_INVALID", client.t("Command not allowed during a multiline batch"))
 			session.EndMultilineBatch("")
@@ -83,6 +86,11 @@ func init() {
 			handler:   sceneHandler,
 			minParams: 2,
 		},
+		"AUDIT": {
+			handler:   auditHandler,
+			minParams: 0,
+			capabs:    []string{"audit"},
+		},
 		"AUTHENTICATE": {
 			handler:      authenticateHandler,
 			usablePreReg: true,
@@ -106,6 +114,11 @@ func init() {
 			handler:   chathistoryHandler,
 			minParams: 4,
 		},
+		"CHGHOST": {
+			handler:   chghostHandler,
+			minParams: 2,
+			capabs:    []string{"vhosts"},
+		},
 		"DEBUG": {
 			handler:   debugHandler,
 			minParams: 1,
@@ -276,10 +289,19 @@ func init() {
 			minParams: 1,
 			capabs:    []string{"samode"},
 		},
+		"SAPART": {
+			handler:   sapartHandler,
+			minParams: 2,
+			capabs:    []string{"sajoin"},
+		},
 		"SCENE": {
 			handler:   sceneHandler,
 			minParams: 2,
 		},
+		"SEARCH": {
+			handler:   searchHandler,
+			minParams: 1,
+		},
 		"SETNAME": {
 			handler:   setnameHandler,
 			minParams: 1,
@@ -291,6 +313,11 @@ func init() {
 			handler:   messageHandler,
 			minParams: 1,
 		},
+		"QLINE": {
+			handler:   qlineHandler,
+			minParams: 1,
+			capabs:    []string{"ban"},
+		},
 		"QUIT": {
 			handler:      quitHandler,
 			usablePreReg: true,
@@ -309,6 +336,10 @@ func init() {
 			handler:   topicHandler,
 			minParams: 1,
 		},
+		"TOTP": {
+			handler:   totpHandler,
+			minParams: 1,
+		},
 		"UBAN": {
 			handler:   ubanHandler,
 			minParams: 1,
@@ -328,6 +359,11 @@ func init() {
 			minParams: 1,
 			capabs:    []string{"ban"},
 		},
+		"UNQLINE": {
+			handler:   unQLineHandler,
+			minParams: 1,
+			capabs:    []string{"ban"},
+		},
 		"USER": {
 			handler:      userHandler,
 			usablePreReg: true,
@@ -15,10 +15,12 @@ import (
 	"log"
 	"net"
 	"os"
+	"os/user"
 	"path/filepath"
 	"reflect"
 	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -27,11 +29,14 @@ import (
 	"github.com/ergochat/irc-go/ircfmt"
 	"gopkg.in/yaml.v2"
 
+	"github.com/ergochat/ergo/irc/bunthistory"
 	"github.com/ergochat/ergo/irc/caps"
 	"github.com/ergochat/ergo/irc/cloaks"
 	"github.com/ergochat/ergo/irc/connection_limits"
 	"github.com/ergochat/ergo/irc/custime"
+	"github.com/ergochat/ergo/irc/dnsbl"
 	"github.com/ergochat/ergo/irc/email"
+	"github.com/ergochat/ergo/irc/geoip"
 	"github.com/ergochat/ergo/irc/isupport"
 	"github.com/ergochat/ergo/irc/jwt"
 	"github.com/ergochat/ergo/irc/languages"
@@ -39,6 +44,7 @@ import (
 	"github.com/ergochat/ergo/irc/modes"
 	"github.com/ergochat/ergo/irc/mysql"
 	"github.com/ergochat/ergo/irc/passwd"
+	"github.com/ergochat/ergo/irc/postgresql"
 	"github.com/ergochat/ergo/irc/utils"
 )
 
@@ -54,6 +60,23 @@ type TLSListenConfig struct {
 	Proxy bool // XXX: legacy key: it's preferred to specify this directly in listenerConfigBlock
 }
 
+// the placeholder bearer token in the example configs, which must not be used
+const exampleAPIBearerToken = "example bearer token here"
+
+// APIConfig controls the HTTP admin API
+type APIConfig struct {
+	Enabled  bool
+	Listener string
+	TLS      struct {
+		Enabled bool
+		Cert    string
+		Key     string
+	}
+	BearerTokens []string `yaml:"bearer-tokens"`
+
+	tlsCert *tls.Certificate
+}
+
 // This is the YAML-deserializable type of the value of the `Server.Listeners` map
 type listenerConfigBlock struct {
 	// normal TLS configuration, with a single certificate:
@@ -66,6 +89,16 @@ type listenerConfigBlock struct {
 	STSOnly         bool `yaml:"sts-only"`
 	WebSocket       bool
 	HideSTS         bool `yaml:"hide-sts"`
+	// overrides server.websockets.allowed-origins for this listener:
+	AllowedOrigins []string `yaml:"allowed-origins"`
+	// overrides server.proxy-allowed-from for this listener:
+	ProxyAllowedFrom []string `yaml:"proxy-allowed-from"`
+	// for unix domain sockets: overrides server.unix-bind-mode,
+	// and optionally sets the group that owns the socket file:
+	UnixBindMode  os.FileMode `yaml:"unix-bind-mode"`
+	UnixBindGroup string      `yaml:"unix-bind-group"`
+	// overrides server.check-ident for this listener:
+	CheckIdent *bool `yaml:"check-ident"`
 }
 
 type HistoryCutoff uint
@@ -300,6 +333,34 @@ func (t *ThrottleConfig) UnmarshalYAML(unmarshal func(interface{}) error) (err e
 	return
 }
 
+// IPThrottleConfig limits the rate of an event per IP address or network.
+type IPThrottleConfig struct {
+	Enabled      bool
+	Duration     time.Duration
+	MaxAttempts  int `yaml:"max-attempts"`
+	CidrLenIPv4  int `yaml:"cidr-len-ipv4"`
+	CidrLenIPv6  int `yaml:"cidr-len-ipv6"`
+	Exempted     []string
+	exemptedNets []net.IPNet
+}
+
+func (t *IPThrottleConfig) postprocess() (err error) {
+	if !t.Enabled {
+		t.MaxAttempts = 0 // limit of 0 means disabled
+	}
+	if t.CidrLenIPv4 == 0 {
+		t.CidrLenIPv4 = 32
+	}
+	if t.CidrLenIPv6 == 0 {
+		t.CidrLenIPv6 = 64
+	}
+	if t.CidrLenIPv4 < 0 || 32 < t.CidrLenIPv4 || t.CidrLenIPv6 < 0 || 128 < t.CidrLenIPv6 {
+		return errors.New("invalid CIDR length")
+	}
+	t.exemptedNets, err = utils.ParseNetList(t.Exempted)
+	return
+}
+
 type AccountConfig struct {
 	Registration          AccountRegistrationConfig
 	AuthenticationEnabled bool `yaml:"authentication-enabled"`
@@ -314,6 +375,7 @@ type AccountConfig struct {
 	LoginThrottling     ThrottleConfig `yaml:"login-throttling"`
 	SkipServerPassword  bool           `yaml:"skip-server-password"`
 	LoginViaPassCommand bool           `yaml:"login-via-pass-command"`
+	LoginViaCertfp      bool           `yaml:"login-via-certfp"`
 	NickReservation     struct {
 		Enabled                bool
 		AdditionalNickLimit    int `yaml:"additional-nick-limit"`
@@ -331,6 +393,7 @@ type AccountConfig struct {
 	Multiclient MulticlientConfig
 	Bouncer     *MulticlientConfig // # handle old name for 'multiclient'
 	VHosts      VHostConfig
+	Memos       MemoConfig
 	AuthScript  AuthScriptConfig `yaml:"auth-script"`
 }
 
@@ -358,6 +421,10 @@ type AccountRegistrationConfig struct {
 	Enabled            bool
 	AllowBeforeConnect bool `yaml:"allow-before-connect"`
 	Throttling         ThrottleConfig
+	// per-network throttle on new account creation:
+	IPThrottling IPThrottleConfig `yaml:"ip-throttling"`
+	// minimum age of a connection before it can register an account:
+	MinConnectionAge time.Duration `yaml:"min-connection-age"`
 	// new-style (v2.4 email verification config):
 	EmailVerification email.MailtoConfig `yaml:"email-verification"`
 	// old-style email verification config, with "callbacks":
@@ -374,6 +441,21 @@ type VHostConfig struct {
 	MaxLength      int    `yaml:"max-length"`
 	ValidRegexpRaw string `yaml:"valid-regexp"`
 	validRegexp    *regexp.Regexp
+	UserRequests   struct {
+		Enabled  bool
+		Channel  string
+		Cooldown custime.Duration
+	} `yaml:"user-requests"`
+}
+
+type MemoConfig struct {
+	Enabled            bool
+	MaxMemos           int  `yaml:"max-memos"`
+	EmailNotifications bool `yaml:"email-notifications"`
+	Throttling         struct {
+		Duration time.Duration
+		MaxSends int `yaml:"max-sends"`
+	}
 }
 
 type NickEnforcementMethod int
@@ -450,6 +532,8 @@ func (cm *Casemapping) UnmarshalYAML(unmarshal func(interface{}) error) (err err
 		result = CasemappingPRECIS
 	case "permissive", "fun":
 		result = CasemappingPermissive
+	case "rfc1459":
+		result = CasemappingRFC1459
 	default:
 		return fmt.Errorf("invalid casemapping value: %s", orig)
 	}
@@ -480,16 +564,19 @@ type OperConfig struct {
 
 // Various server-enforced limits on data size.
 type Limits struct {
-	AwayLen              int `yaml:"awaylen"`
-	ChanListModes        int `yaml:"chan-list-modes"`
-	ChannelLen           int `yaml:"channellen"`
-	IdentLen             int `yaml:"identlen"`
-	KickLen              int `yaml:"kicklen"`
-	MonitorEntries       int `yaml:"monitor-entries"`
-	NickLen              int `yaml:"nicklen"`
-	TopicLen             int `yaml:"topiclen"`
-	WhowasEntries        int `yaml:"whowas-entries"`
-	RegistrationMessages int `yaml:"registration-messages"`
+	AwayLen              int              `yaml:"awaylen"`
+	ChanListModes        int              `yaml:"chan-list-modes"`
+	ChannelLen           int              `yaml:"channellen"`
+	IdentLen             int              `yaml:"identlen"`
+	KickLen              int              `yaml:"kicklen"`
+	MonitorEntries       int              `yaml:"monitor-entries"`
+	NickLen              int              `yaml:"nicklen"`
+	RealnameLen          int              `yaml:"realnamelen"`
+	TopicLen             int              `yaml:"topiclen"`
+	WhowasEntries        int              `yaml:"whowas-entries"`
+	WhowasMaxAge         custime.Duration `yaml:"whowas-max-age"`
+	WhowasPersistent     bool             `yaml:"whowas-persistent"`
+	RegistrationMessages int              `yaml:"registration-messages"`
 	Multiline            struct {
 		MaxBytes int `yaml:"max-bytes"`
 		MaxLines int `yaml:"max-lines"`
@@ -506,6 +593,16 @@ type STSConfig struct {
 	bannerLines   []string
 }
 
+// SecureValue returns the STS value to advertise in CAP on a secure connection;
+// `port` is meaningless there, since the client has already upgraded.
+func (sts *STSConfig) SecureValue() string {
+	val := fmt.Sprintf("duration=%d", int(time.Duration(sts.Duration).Seconds()))
+	if sts.Enabled && sts.Preload {
+		val += ",preload"
+	}
+	return val
+}
+
 // Value returns the STS value to advertise in CAP
 func (sts *STSConfig) Value() string {
 	val := fmt.Sprintf("duration=%d", int(time.Duration(sts.Duration).Seconds()))
@@ -524,6 +621,34 @@ type FakelagConfig struct {
 	BurstLimit        uint `yaml:"burst-limit"`
 	MessagesPerWindow uint `yaml:"messages-per-window"`
 	Cooldown          time.Duration
+	Exempted          []string
+	exemptedNets      []net.IPNet
+}
+
+// ConnectionClassConfig overrides some per-connection settings for clients
+// connecting from specific IPs or networks (e.g., trusted bots or gateways).
+type ConnectionClassConfig struct {
+	name           string
+	Nets           []string
+	nets           []net.IPNet
+	MaxSendQString string `yaml:"max-sendq"`
+	maxSendQBytes  int
+	PingTimeout    time.Duration `yaml:"ping-timeout"`
+	WriteTimeout   time.Duration `yaml:"write-timeout"`
+	Fakelag        *FakelagOverrideConfig
+	// the top-level fakelag config with Fakelag applied on top, or nil:
+	fakelag *FakelagConfig
+}
+
+// FakelagOverrideConfig is a partial FakelagConfig; unset fields
+// default to the top-level fakelag settings
+type FakelagOverrideConfig struct {
+	Enabled           *bool
+	Window            *time.Duration
+	BurstLimit        *uint `yaml:"burst-limit"`
+	MessagesPerWindow *uint `yaml:"messages-per-window"`
+	Cooldown          *time.Duration
+	Exempted          []string
 }
 
 type TorListenersConfig struct {
@@ -565,6 +690,7 @@ type Config struct {
 		CoerceIdent             string `yaml:"coerce-ident"`
 		MOTD                    string
 		motdLines               []string
+		motdError               error
 		MOTDFormatting          bool `yaml:"motd-formatting"`
 		Relaymsg                struct {
 			Enabled            bool
@@ -576,6 +702,9 @@ type Config struct {
 		WebIRC               []webircConfig `yaml:"webirc"`
 		MaxSendQString       string         `yaml:"max-sendq"`
 		MaxSendQBytes        int
+		WriteTimeout         time.Duration                     `yaml:"write-timeout"`
+		ConnectionClasses    map[string]*ConnectionClassConfig `yaml:"connection-classes"`
+		connectionClasses    []*ConnectionClassConfig
 		Compatibility        struct {
 			ForceTrailing      *bool `yaml:"force-trailing"`
 			forceTrailing      bool
@@ -591,13 +720,24 @@ type Config struct {
 		supportedCaps            *caps.Set
 		supportedCapsWithoutSTS  *caps.Set
 		capValues                caps.Values
+		capValuesSecure          caps.Values
 		Casemapping              Casemapping
-		EnforceUtf8              bool                `yaml:"enforce-utf8"`
+		EnforceUtf8              bool   `yaml:"enforce-utf8"`
+		InvalidUtf8              string `yaml:"invalid-utf8"`
+		replaceInvalidUtf8       bool
 		OutputPath               string              `yaml:"output-path"`
 		IPCheckScript            IPCheckScriptConfig `yaml:"ip-check-script"`
-		OverrideServicesHostname string              `yaml:"override-services-hostname"`
-		MaxLineLen               int                 `yaml:"max-line-len"`
-		SuppressLusers           bool                `yaml:"suppress-lusers"`
+		DNSBL                    dnsbl.Config        `yaml:"dnsbl"`
+		GeoIP                    geoip.Config        `yaml:"geoip"`
+		QLines                   []QLineConfig       `yaml:"q-lines"`
+		qLines                   []QLineInfo
+		OverrideServicesHostname string   `yaml:"override-services-hostname"`
+		MaxLineLen               int      `yaml:"max-line-len"`
+		SuppressLusers           bool     `yaml:"suppress-lusers"`
+		ClientTagDeny            []string `yaml:"client-tag-deny"`
+		// if clientTagDenyAll, this is the set of allowed tags, otherwise the set of denied tags
+		clientTagDeny    map[string]bool
+		clientTagDenyAll bool
 	}
 
 	Roleplay struct {
@@ -624,9 +764,11 @@ type Config struct {
 	LockFile string `yaml:"lock-file"`
 
 	Datastore struct {
-		Path        string
-		AutoUpgrade bool
-		MySQL       mysql.Config
+		Path            string
+		AutoUpgrade     bool
+		MySQL           mysql.Config
+		PostgreSQL      postgresql.Config
+		EmbeddedHistory bunthistory.Config `yaml:"embedded-history"`
 	}
 
 	Accounts AccountConfig
@@ -655,6 +797,10 @@ type Config struct {
 
 	Logging []logger.LoggingConfig
 
+	AuditLog AuditLogConfig `yaml:"audit-log"`
+
+	API APIConfig
+
 	Debug struct {
 		RecoverFromErrors *bool `yaml:"recover-from-errors"`
 		recoverFromErrors bool
@@ -690,12 +836,23 @@ type Config struct {
 		Retention struct {
 			AllowIndividualDelete bool `yaml:"allow-individual-delete"`
 			EnableAccountIndexing bool `yaml:"enable-account-indexing"`
+			MaxMessagesPerTarget  int  `yaml:"max-messages-per-target"`
 		}
 		TagmsgStorage struct {
 			Default   bool
 			Whitelist []string
 			Blacklist []string
 		} `yaml:"tagmsg-storage"`
+		StoreEvents *bool `yaml:"store-events"`
+		storeEvents bool
+		Search      struct {
+			Enabled    bool
+			MaxScanned int `yaml:"max-scanned"`
+			Throttling struct {
+				Duration    time.Duration
+				MaxSearches int `yaml:"max-searches"`
+			}
+		}
 	}
 
 	Filename string
@@ -766,7 +923,7 @@ func (conf *Config) OperatorClasses() (map[string]*OperClass, error) {
 				oc.WhoisLine = info.WhoisLine
 			} else {
 				oc.WhoisLine = "is a"
-				if strings.Contains(strings.ToLower(string(oc.Title[0])), "aeiou") {
+				if strings.ContainsAny(strings.ToLower(oc.Title[:1]), "aeiou") {
 					oc.WhoisLine += "n"
 				}
 				oc.WhoisLine += " "
@@ -869,11 +1026,16 @@ func loadTlsConfig(config listenerConfigBlock) (tlsConfig *tls.Config, err error
 	var certificates []tls.Certificate
 	if len(config.TLSCertificates) != 0 {
 		// SNI configuration with multiple certificates
-		for _, certPairConf := range config.TLSCertificates {
+		for i, certPairConf := range config.TLSCertificates {
 			cert, err := loadCertWithLeaf(certPairConf.Cert, certPairConf.Key)
 			if err != nil {
 				return nil, err
 			}
+			// crypto/tls matches SNI against subjectAltNames only (not the CN);
+			// only the first certificate can be served without a matching SAN:
+			if i != 0 && len(cert.Leaf.DNSNames) == 0 && len(cert.Leaf.IPAddresses) == 0 {
+				return nil, fmt.Errorf("certificate %s has no subjectAltNames, so it can never be selected via SNI", certPairConf.Cert)
+			}
 			certificates = append(certificates, cert)
 		}
 	} else if config.TLS.Cert != "" {
@@ -955,16 +1117,72 @@ func (conf *Config) prepareListeners() (err error) {
 			return &CertKeyError{Err: err}
 		}
 		lconf.RequireProxy = block.TLS.Proxy || block.Proxy
+		if len(block.ProxyAllowedFrom) != 0 {
+			lconf.ProxyAllowedFrom, err = utils.ParseNetList(block.ProxyAllowedFrom)
+			if err != nil {
+				return fmt.Errorf("Could not parse proxy-allowed-from nets for %s: %v", addr, err.Error())
+			}
+		} else {
+			lconf.ProxyAllowedFrom = conf.Server.proxyAllowedFromNets
+		}
 		lconf.WebSocket = block.WebSocket
 		if lconf.WebSocket && !conf.Server.EnforceUtf8 {
 			return fmt.Errorf("enabling a websocket listener requires the use of server.enforce-utf8")
 		}
 		lconf.HideSTS = block.HideSTS
+		lconf.CheckIdent = conf.Server.CheckIdent
+		if block.CheckIdent != nil {
+			lconf.CheckIdent = *block.CheckIdent
+		}
+		if lconf.CheckIdent && conf.Server.CoerceIdent != "" {
+			return fmt.Errorf("%s enables check-ident, which can't be combined with coerce-ident", addr)
+		}
+		if utils.IsUnixListenAddr(addr) {
+			lconf.UnixBindMode = conf.Server.UnixBindMode
+			if block.UnixBindMode != 0 {
+				lconf.UnixBindMode = block.UnixBindMode
+			}
+			lconf.UnixBindGID = -1
+			if block.UnixBindGroup != "" {
+				group, err := user.LookupGroup(block.UnixBindGroup)
+				if err != nil {
+					return fmt.Errorf("invalid unix-bind-group for %s: %w", addr, err)
+				}
+				lconf.UnixBindGID, err = strconv.Atoi(group.Gid)
+				if err != nil {
+					return fmt.Errorf("invalid unix-bind-group for %s: %w", addr, err)
+				}
+			}
+		} else if block.UnixBindMode != 0 || block.UnixBindGroup != "" {
+			return fmt.Errorf("%s configures unix socket permissions, but is not a unix domain socket", addr)
+		}
+		if len(block.AllowedOrigins) != 0 {
+			if !lconf.WebSocket {
+				return fmt.Errorf("%s configures allowed-origins, but is not a websocket listener", addr)
+			}
+			lconf.AllowedOrigins, err = compileAllowedOrigins(block.AllowedOrigins)
+			if err != nil {
+				return err
+			}
+		} else if lconf.WebSocket {
+			lconf.AllowedOrigins = conf.Server.WebSockets.allowedOriginRegexps
+		}
 		conf.Server.trueListeners[addr] = lconf
 	}
 	return nil
 }
 
+func compileAllowedOrigins(origins []string) (result []*regexp.Regexp, err error) {
+	for _, glob := range origins {
+		globre, err := utils.CompileGlob(glob, false)
+		if err != nil {
+			return nil, fmt.Errorf("invalid websocket allowed-origin expression: %s", glob)
+		}
+		result = append(result, globre)
+	}
+	return
+}
+
 func (config *Config) processExtjwt() (err error) {
 	// first process the default service, which may be disabled
 	err = config.Extjwt.Default.Postprocess()
@@ -1175,17 +1393,19 @@ func LoadConfig(filename string) (config *Config, err error) {
 	config.Server.supportedCaps = caps.NewCompleteSet()
 	config.Server.capValues = make(caps.Values)
 
-	err = config.prepareListeners()
+	config.Server.proxyAllowedFromNets, err = utils.ParseNetList(config.Server.ProxyAllowedFrom)
 	if err != nil {
-		return nil, fmt.Errorf("failed to prepare listeners: %v", err)
+		return nil, fmt.Errorf("Could not parse proxy-allowed-from nets: %v", err.Error())
 	}
 
-	for _, glob := range config.Server.WebSockets.AllowedOrigins {
-		globre, err := utils.CompileGlob(glob, false)
-		if err != nil {
-			return nil, fmt.Errorf("invalid websocket allowed-origin expression: %s", glob)
-		}
-		config.Server.WebSockets.allowedOriginRegexps = append(config.Server.WebSockets.allowedOriginRegexps, globre)
+	config.Server.WebSockets.allowedOriginRegexps, err = compileAllowedOrigins(config.Server.WebSockets.AllowedOrigins)
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.prepareListeners()
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare listeners: %v", err)
 	}
 
 	if config.Server.STS.Enabled {
@@ -1283,6 +1503,10 @@ func LoadConfig(filename string) (config *Config, err error) {
 		logConfig.MethodFile = methods["file"]
 		logConfig.MethodStdout = methods["stdout"]
 		logConfig.MethodStderr = methods["stderr"]
+		logConfig.MethodSyslog = methods["syslog"]
+		if err := logConfig.Rotation.Postprocess(); err != nil {
+			return nil, err
+		}
 
 		// levels
 		level, exists := logger.LogLevelNames[strings.ToLower(logConfig.LevelString)]
@@ -1339,6 +1563,10 @@ func LoadConfig(filename string) (config *Config, err error) {
 		}
 	}
 
+	if err = config.Accounts.Registration.IPThrottling.postprocess(); err != nil {
+		return nil, fmt.Errorf("Could not parse accounts.registration.ip-throttling: %v", err.Error())
+	}
+
 	config.Accounts.defaultUserModes = ParseDefaultUserModes(config.Accounts.DefaultUserModes)
 
 	if config.Server.Password != "" {
@@ -1365,9 +1593,9 @@ func LoadConfig(filename string) (config *Config, err error) {
 		return nil, fmt.Errorf("Could not parse require-sasl exempted nets: %v", err.Error())
 	}
 
-	config.Server.proxyAllowedFromNets, err = utils.ParseNetList(config.Server.ProxyAllowedFrom)
+	config.Fakelag.exemptedNets, err = utils.ParseNetList(config.Fakelag.Exempted)
 	if err != nil {
-		return nil, fmt.Errorf("Could not parse proxy-allowed-from nets: %v", err.Error())
+		return nil, fmt.Errorf("Could not parse fakelag exempted nets: %v", err.Error())
 	}
 
 	config.Server.secureNets, err = utils.ParseNetList(config.Server.SecureNetDefs)
@@ -1375,6 +1603,11 @@ func LoadConfig(filename string) (config *Config, err error) {
 		return nil, fmt.Errorf("Could not parse secure-nets: %v\n", err.Error())
 	}
 
+	err = config.processClientTagDeny()
+	if err != nil {
+		return nil, err
+	}
+
 	rawRegexp := config.Accounts.VHosts.ValidRegexpRaw
 	if rawRegexp != "" {
 		regexp, err := regexp.Compile(rawRegexp)
@@ -1421,6 +1654,16 @@ func LoadConfig(filename string) (config *Config, err error) {
 		return nil, fmt.Errorf("Could not parse maximum SendQ size (make sure it only contains whole numbers): %s", err.Error())
 	}
 	config.Server.MaxSendQBytes = int(maxSendQBytes)
+	if config.Server.WriteTimeout < 0 {
+		return nil, fmt.Errorf("Invalid server.write-timeout: %v", config.Server.WriteTimeout)
+	} else if config.Server.WriteTimeout == 0 {
+		config.Server.WriteTimeout = DefaultWriteTimeout
+	}
+
+	err = config.processConnectionClasses()
+	if err != nil {
+		return nil, err
+	}
 
 	config.languageManager, err = languages.NewManager(config.Languages.Enabled, config.Languages.Path, config.Languages.Default)
 	if err != nil {
@@ -1441,6 +1684,32 @@ func LoadConfig(filename string) (config *Config, err error) {
 
 	config.Debug.recoverFromErrors = utils.BoolDefaultTrue(config.Debug.RecoverFromErrors)
 
+	if config.AuditLog.Enabled && config.AuditLog.Filename == "" {
+		return nil, fmt.Errorf("audit-log is enabled, but no filename is configured")
+	}
+
+	if config.API.Enabled {
+		if config.API.Listener == "" {
+			return nil, fmt.Errorf("api is enabled, but no listener is configured")
+		}
+		if err := checkAPIConfig(&config.API); err != nil {
+			return nil, err
+		}
+		if config.API.TLS.Enabled {
+			cert, err := loadCertWithLeaf(config.API.TLS.Cert, config.API.TLS.Key)
+			if err != nil {
+				return nil, fmt.Errorf("couldn't load api tls certificate: %w", err)
+			}
+			config.API.tlsCert = &cert
+		}
+	}
+
+	if config.Debug.PprofListener != "" {
+		if err := checkPprofListener(config.Debug.PprofListener); err != nil {
+			return nil, err
+		}
+	}
+
 	// process operator definitions, store them to config.operators
 	operclasses, err := config.OperatorClasses()
 	if err != nil {
@@ -1469,7 +1738,8 @@ func LoadConfig(filename string) (config *Config, err error) {
 	config.Server.Compatibility.forceTrailing = utils.BoolDefaultTrue(config.Server.Compatibility.ForceTrailing)
 	config.Server.Compatibility.allowTruncation = utils.BoolDefaultTrue(config.Server.Compatibility.AllowTruncation)
 
-	config.loadMOTD()
+	// a missing MOTD isn't fatal, but the server will warn about it:
+	config.Server.motdError = config.loadMOTD()
 
 	// in the current implementation, we disable history by creating a history buffer
 	// with zero capacity. but the `enabled` config option MUST be respected regardless
@@ -1481,6 +1751,12 @@ func LoadConfig(filename string) (config *Config, err error) {
 		config.Server.supportedCaps.Disable(caps.EventPlayback)
 		config.Server.supportedCaps.Disable(caps.ZNCPlayback)
 	}
+	if !config.History.Enabled || !config.History.Search.Enabled {
+		config.Server.supportedCaps.Disable(caps.Search)
+	}
+	if config.History.Search.MaxScanned <= 0 {
+		config.History.Search.MaxScanned = 10000
+	}
 
 	if !config.History.Enabled || !config.History.Persistent.Enabled {
 		config.History.Persistent.Enabled = false
@@ -1489,8 +1765,17 @@ func LoadConfig(filename string) (config *Config, err error) {
 		config.History.Persistent.DirectMessages = PersistentDisabled
 	}
 
-	if config.History.Persistent.Enabled && !config.Datastore.MySQL.Enabled {
-		return nil, fmt.Errorf("You must configure a MySQL server in order to enable persistent history")
+	historyBackends := 0
+	for _, enabled := range []bool{config.Datastore.MySQL.Enabled, config.Datastore.PostgreSQL.Enabled, config.Datastore.EmbeddedHistory.Enabled} {
+		if enabled {
+			historyBackends++
+		}
+	}
+	if historyBackends > 1 {
+		return nil, fmt.Errorf("Only one of MySQL, PostgreSQL, and embedded history can be enabled")
+	}
+	if config.History.Persistent.Enabled && historyBackends == 0 {
+		return nil, fmt.Errorf("You must configure MySQL, PostgreSQL, or embedded history in order to enable persistent history")
 	}
 
 	if config.History.ZNCMax == 0 {
@@ -1511,21 +1796,72 @@ func LoadConfig(filename string) (config *Config, err error) {
 	}
 
 	config.Roleplay.addSuffix = utils.BoolDefaultTrue(config.Roleplay.AddSuffix)
+	config.History.storeEvents = utils.BoolDefaultTrue(config.History.StoreEvents)
 
+	if config.History.Retention.MaxMessagesPerTarget < 0 {
+		return nil, fmt.Errorf("history.retention.max-messages-per-target cannot be negative")
+	}
 	config.Datastore.MySQL.ExpireTime = time.Duration(config.History.Restrictions.ExpireTime)
 	config.Datastore.MySQL.TrackAccountMessages = config.History.Retention.EnableAccountIndexing
+	config.Datastore.MySQL.MaxMessagesPerTarget = config.History.Retention.MaxMessagesPerTarget
+	config.Datastore.PostgreSQL.ExpireTime = time.Duration(config.History.Restrictions.ExpireTime)
+	config.Datastore.PostgreSQL.TrackAccountMessages = config.History.Retention.EnableAccountIndexing
+	config.Datastore.PostgreSQL.MaxMessagesPerTarget = config.History.Retention.MaxMessagesPerTarget
+	config.Datastore.EmbeddedHistory.ExpireTime = time.Duration(config.History.Restrictions.ExpireTime)
+	config.Datastore.EmbeddedHistory.TrackAccountMessages = config.History.Retention.EnableAccountIndexing
+	// the embedded store enforces the stricter of its own cap and the general one:
+	if maxMessages := config.History.Retention.MaxMessagesPerTarget; maxMessages != 0 {
+		if embeddedMax := config.Datastore.EmbeddedHistory.MaxMessagesPerTarget; embeddedMax == 0 || maxMessages < embeddedMax {
+			config.Datastore.EmbeddedHistory.MaxMessagesPerTarget = maxMessages
+		}
+	}
+	if config.Datastore.EmbeddedHistory.Path == "" {
+		config.Datastore.EmbeddedHistory.Path = "history.db"
+	}
 	if config.Datastore.MySQL.MaxConns == 0 {
 		// #1622: not putting an upper limit on the number of MySQL connections is
 		// potentially dangerous. as a naive heuristic, assume they're running on the
 		// same machine:
 		config.Datastore.MySQL.MaxConns = runtime.NumCPU()
 	}
+	if config.Datastore.PostgreSQL.MaxConns == 0 {
+		config.Datastore.PostgreSQL.MaxConns = runtime.NumCPU()
+	}
+
+	switch strings.ToLower(config.Server.InvalidUtf8) {
+	case "", "reject":
+		config.Server.replaceInvalidUtf8 = false
+	case "replace":
+		config.Server.replaceInvalidUtf8 = config.Server.EnforceUtf8
+	default:
+		return nil, fmt.Errorf("invalid value for server.invalid-utf8: %s", config.Server.InvalidUtf8)
+	}
+
+	if err = config.Server.DNSBL.Postprocess(); err != nil {
+		return nil, err
+	}
+
+	if err = config.Server.GeoIP.Load(); err != nil {
+		return nil, err
+	}
+
+	config.Server.qLines, err = compileConfigQLines(config.Server.QLines)
+	if err != nil {
+		return nil, err
+	}
 
 	config.Server.Cloaks.Initialize()
 	if config.Server.Cloaks.Enabled {
 		if !utils.IsHostname(config.Server.Cloaks.Netname) {
 			return nil, fmt.Errorf("Invalid netname for cloaked hostnames: %s", config.Server.Cloaks.Netname)
 		}
+		// out-of-range values would silently give every client the same cloak
+		if config.Server.Cloaks.CidrLenIPv4 < 0 || 32 < config.Server.Cloaks.CidrLenIPv4 {
+			return nil, fmt.Errorf("Invalid cidr-len-ipv4 for ip-cloaking: %d", config.Server.Cloaks.CidrLenIPv4)
+		}
+		if config.Server.Cloaks.CidrLenIPv6 < 0 || 128 < config.Server.Cloaks.CidrLenIPv6 {
+			return nil, fmt.Errorf("Invalid cidr-len-ipv6 for ip-cloaking: %d", config.Server.Cloaks.CidrLenIPv6)
+		}
 	}
 
 	err = config.processExtjwt()
@@ -1544,9 +1880,78 @@ func LoadConfig(filename string) (config *Config, err error) {
 	config.Server.supportedCapsWithoutSTS.Union(config.Server.supportedCaps)
 	config.Server.supportedCapsWithoutSTS.Disable(caps.STS)
 
+	config.Server.capValuesSecure = make(caps.Values, len(config.Server.capValues))
+	for capab, value := range config.Server.capValues {
+		config.Server.capValuesSecure[capab] = value
+	}
+	config.Server.capValuesSecure[caps.STS] = config.Server.STS.SecureValue()
+
 	return config, nil
 }
 
+// capValuesFor returns the CAP values to advertise to a session;
+// these depend on whether the session is already connected securely.
+func (config *Config) capValuesFor(session *Session) caps.Values {
+	if session.isSecure {
+		return config.Server.capValuesSecure
+	}
+	return config.Server.capValues
+}
+
+// checkPprofListener ensures that the pprof endpoint is only reachable
+// from the local machine, since it allows inspecting server memory
+func checkPprofListener(addr string) error {
+	loopback, err := isLoopbackListener(addr)
+	if err != nil {
+		return fmt.Errorf("invalid pprof-listener %s: %w", addr, err)
+	}
+	if !loopback {
+		return fmt.Errorf("pprof-listener must be a loopback address (e.g., localhost:6060), not %s", addr)
+	}
+	return nil
+}
+
+// checkAPIConfig validates the parts of the API config that could expose it
+// to unauthorized users: bearer tokens, and plaintext listeners
+func checkAPIConfig(config *APIConfig) error {
+	if len(config.BearerTokens) == 0 {
+		return fmt.Errorf("api is enabled, but no bearer tokens are configured")
+	}
+	for _, token := range config.BearerTokens {
+		if token == "" {
+			return fmt.Errorf("api bearer tokens cannot be empty")
+		}
+		if token == exampleAPIBearerToken {
+			return fmt.Errorf("api bearer tokens must be changed from the example value; generate one with `ergo gentoken`")
+		}
+	}
+	if !config.TLS.Enabled {
+		loopback, err := isLoopbackListener(config.Listener)
+		if err != nil {
+			return fmt.Errorf("invalid api listener %s: %w", config.Listener, err)
+		}
+		if !loopback {
+			// bearer tokens would be sent in plaintext over the network
+			return fmt.Errorf("api listener must be a loopback address unless tls is enabled, not %s", config.Listener)
+		}
+	}
+	return nil
+}
+
+// isLoopbackListener returns whether a host:port listen address
+// is only reachable from the local machine
+func isLoopbackListener(addr string) (loopback bool, err error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false, err
+	}
+	if host == "localhost" {
+		return true, nil
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback(), nil
+}
+
 func (config *Config) getOutputPath(filename string) string {
 	return filepath.Join(config.Server.OutputPath, filename)
 }
@@ -1564,7 +1969,85 @@ func (config *Config) isRelaymsgIdentifier(nick string) bool {
 	return false
 }
 
-// setISupport sets up our RPL_ISUPPORT reply.
+// processClientTagDeny parses server.client-tag-deny: either a list of denied
+// tags, or "*" followed by a list of exempted ones
+func (config *Config) processClientTagDeny() (err error) {
+	denied := make(map[string]bool)
+	exempted := make(map[string]bool)
+	for _, entry := range config.Server.ClientTagDeny {
+		entry = strings.TrimPrefix(strings.TrimSpace(entry), "+")
+		if entry == "*" {
+			config.Server.clientTagDenyAll = true
+			continue
+		}
+		exempt := strings.HasPrefix(entry, "-")
+		entry = strings.TrimPrefix(entry, "-")
+		if entry == "" || strings.ContainsAny(entry, " ,=;") {
+			return fmt.Errorf("invalid client-tag-deny entry: %s", entry)
+		}
+		if exempt {
+			exempted[entry] = true
+		} else {
+			denied[entry] = true
+		}
+	}
+	// exemptions are only meaningful with *, and plain entries only without it
+	if config.Server.clientTagDenyAll {
+		if len(denied) != 0 {
+			return fmt.Errorf("client-tag-deny cannot combine * with specific denied tags; use - to exempt tags instead")
+		}
+		config.Server.clientTagDeny = exempted
+	} else {
+		if len(exempted) != 0 {
+			return fmt.Errorf("client-tag-deny can only exempt tags with - when * is also given")
+		}
+		config.Server.clientTagDeny = denied
+	}
+	return nil
+}
+
+// clientTagAllowed returns whether a client-only tag (e.g., +typing)
+// may be relayed, according to client-tag-deny
+func (config *Config) clientTagAllowed(tagName string) bool {
+	listed := config.Server.clientTagDeny[strings.TrimPrefix(tagName, "+")]
+	if config.Server.clientTagDenyAll {
+		return listed
+	}
+	return !listed
+}
+
+// filterClientOnlyTags removes any denied client-only tags
+func (config *Config) filterClientOnlyTags(tags map[string]string) map[string]string {
+	if len(tags) == 0 || (!config.Server.clientTagDenyAll && len(config.Server.clientTagDeny) == 0) {
+		return tags
+	}
+	result := make(map[string]string, len(tags))
+	for name, value := range tags {
+		if config.clientTagAllowed(name) {
+			result[name] = value
+		}
+	}
+	return result
+}
+
+// clientTagDenyISupportToken returns the value of the CLIENTTAGDENY ISUPPORT token
+func (config *Config) clientTagDenyISupportToken() string {
+	tags := make([]string, 0, len(config.Server.clientTagDeny)+1)
+	for name := range config.Server.clientTagDeny {
+		if config.Server.clientTagDenyAll {
+			tags = append(tags, "-"+name)
+		} else {
+			tags = append(tags, name)
+		}
+	}
+	sort.Strings(tags)
+	if config.Server.clientTagDenyAll {
+		tags = append([]string{"*"}, tags...)
+	}
+	return strings.Join(tags, ",")
+}
+
+// generateISupport sets up our RPL_ISUPPORT reply.
 func (config *Config) generateISupport() (err error) {
 	maxTargetsString := strconv.Itoa(maxTargets)
 
@@ -1573,7 +2056,12 @@ func (config *Config) generateISupport() (err error) {
 	isupport.Initialize()
 	isupport.Add("AWAYLEN", strconv.Itoa(config.Limits.AwayLen))
 	isupport.Add("BOT", "B")
-	isupport.Add("CASEMAPPING", "ascii")
+	isupport.Add("CALLERID", "g")
+	if config.Server.Casemapping == CasemappingRFC1459 {
+		isupport.Add("CASEMAPPING", "rfc1459")
+	} else {
+		isupport.Add("CASEMAPPING", "ascii")
+	}
 	isupport.Add("CHANLIMIT", fmt.Sprintf("%s:%d", chanTypes, config.Channels.MaxChannelsPerClient))
 	isupport.Add("CHANMODES", chanmodesToken)
 	if config.History.Enabled && config.History.ChathistoryMax > 0 {
@@ -1581,12 +2069,15 @@ func (config *Config) generateISupport() (err error) {
 	}
 	isupport.Add("CHANNELLEN", strconv.Itoa(config.Limits.ChannelLen))
 	isupport.Add("CHANTYPES", chanTypes)
-	isupport.Add("ELIST", "U")
+	if clientTagDeny := config.clientTagDenyISupportToken(); clientTagDeny != "" {
+		isupport.Add("CLIENTTAGDENY", clientTagDeny)
+	}
+	isupport.Add("ELIST", "CMNTU")
 	isupport.Add("EXCEPTS", "")
 	if config.Extjwt.Default.Enabled() || len(config.Extjwt.Services) != 0 {
 		isupport.Add("EXTJWT", "1")
 	}
-	isupport.Add("EXTBAN", ",m")
+	isupport.Add("EXTBAN", extbanISupportToken())
 	isupport.Add("FORWARD", "f")
 	isupport.Add("INVEX", "")
 	isupport.Add("KICKLEN", strconv.Itoa(config.Limits.KickLen))
@@ -1596,11 +2087,15 @@ func (config *Config) generateISupport() (err error) {
 	isupport.Add("MONITOR", strconv.Itoa(config.Limits.MonitorEntries))
 	isupport.Add("NETWORK", config.Network.Name)
 	isupport.Add("NICKLEN", strconv.Itoa(config.Limits.NickLen))
+	if config.Limits.RealnameLen != 0 {
+		isupport.Add("NAMELEN", strconv.Itoa(config.Limits.RealnameLen))
+	}
 	isupport.Add("PREFIX", "(qaohv)~&@%+")
 	if config.Roleplay.Enabled {
 		isupport.Add("RPCHAN", "E")
 		isupport.Add("RPUSER", "E")
 	}
+	isupport.Add("SAFELIST", "")
 	isupport.Add("STATUSMSG", "~&@%+")
 	isupport.Add("TARGMAX", fmt.Sprintf("NAMES:1,LIST:1,KICK:,WHOIS:1,USERHOST:10,PRIVMSG:%s,TAGMSG:%s,NOTICE:%s,MONITOR:%d", maxTargetsString, maxTargetsString, maxTargetsString, config.Limits.MonitorEntries))
 	isupport.Add("TOPICLEN", strconv.Itoa(config.Limits.TopicLen))
@@ -1690,6 +2185,86 @@ func compileGuestRegexp(guestFormat string, casemapping Casemapping) (standard,
 	return
 }
 
+func (config *Config) processConnectionClasses() (err error) {
+	for name, class := range config.Server.ConnectionClasses {
+		if class == nil {
+			return fmt.Errorf("Connection class %s is empty", name)
+		}
+		class.name = name
+		if len(class.Nets) == 0 {
+			return fmt.Errorf("Connection class %s has no defined nets", name)
+		}
+		class.nets, err = utils.ParseNetList(class.Nets)
+		if err != nil {
+			return fmt.Errorf("Could not parse nets of connection class %s: %v", name, err.Error())
+		}
+		class.maxSendQBytes = config.Server.MaxSendQBytes
+		if class.MaxSendQString != "" {
+			maxSendQBytes, err := bytefmt.ToBytes(class.MaxSendQString)
+			if err != nil {
+				return fmt.Errorf("Could not parse maximum SendQ size of connection class %s: %v", name, err.Error())
+			}
+			class.maxSendQBytes = int(maxSendQBytes)
+		}
+		if class.PingTimeout < 0 || class.WriteTimeout < 0 {
+			return fmt.Errorf("Invalid timeout for connection class %s", name)
+		}
+		if class.WriteTimeout == 0 {
+			class.WriteTimeout = config.Server.WriteTimeout
+		}
+		if class.Fakelag != nil {
+			class.fakelag, err = config.Fakelag.withOverrides(class.Fakelag)
+			if err != nil {
+				return fmt.Errorf("Could not parse fakelag exempted nets of connection class %s: %v", name, err.Error())
+			}
+		}
+		config.Server.connectionClasses = append(config.Server.connectionClasses, class)
+	}
+	// if an IP matches more than one class, the first one by name wins:
+	sort.Slice(config.Server.connectionClasses, func(i, j int) bool {
+		return config.Server.connectionClasses[i].name < config.Server.connectionClasses[j].name
+	})
+	return nil
+}
+
+// withOverrides returns a copy of flc with the fields set in overrides replaced
+func (flc FakelagConfig) withOverrides(overrides *FakelagOverrideConfig) (result *FakelagConfig, err error) {
+	if overrides.Enabled != nil {
+		flc.Enabled = *overrides.Enabled
+	}
+	if overrides.Window != nil {
+		flc.Window = *overrides.Window
+	}
+	if overrides.BurstLimit != nil {
+		flc.BurstLimit = *overrides.BurstLimit
+	}
+	if overrides.MessagesPerWindow != nil {
+		flc.MessagesPerWindow = *overrides.MessagesPerWindow
+	}
+	if overrides.Cooldown != nil {
+		flc.Cooldown = *overrides.Cooldown
+	}
+	if overrides.Exempted != nil {
+		flc.Exempted = overrides.Exempted
+		flc.exemptedNets, err = utils.ParseNetList(flc.Exempted)
+		if err != nil {
+			return
+		}
+	}
+	return &flc, nil
+}
+
+// connectionClass returns the connection class of clients connecting from ip,
+// or nil if none of the classes apply
+func (config *Config) connectionClass(ip net.IP) *ConnectionClassConfig {
+	for _, class := range config.Server.connectionClasses {
+		if utils.IPInNets(ip, class.nets) {
+			return class
+		}
+	}
+	return nil
+}
+
 func (config *Config) loadMOTD() error {
 	if config.Server.MOTD != "" {
 		file, err := os.Open(config.Server.MOTD)
@@ -4,8 +4,16 @@
 package irc
 
 import (
+	"net"
 	"reflect"
 	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/ergochat/ergo/irc/caps"
+	"github.com/ergochat/ergo/irc/custime"
+	"github.com/ergochat/ergo/irc/modes"
 )
 
 func TestEnvironmentOverrides(t *testing.T) {
@@ -99,3 +107,222 @@ func TestEnvironmentOverrideErrors(t *testing.T) {
 		}
 	}
 }
+
+func TestSTSValues(t *testing.T) {
+	sts := STSConfig{
+		Enabled:  true,
+		Duration: custime.Duration(time.Hour),
+		Port:     6697,
+		Preload:  true,
+	}
+	if val := sts.Value(); val != "duration=3600,port=6697,preload" {
+		t.Errorf("unexpected insecure STS value: %s", val)
+	}
+	if val := sts.SecureValue(); val != "duration=3600,preload" {
+		t.Errorf("unexpected secure STS value: %s", val)
+	}
+}
+
+func TestCapValuesFor(t *testing.T) {
+	var config Config
+	config.Server.STS = STSConfig{Enabled: true, Duration: custime.Duration(time.Hour), Port: 6697}
+	config.Server.capValues = caps.Values{caps.STS: config.Server.STS.Value()}
+	config.Server.capValuesSecure = caps.Values{caps.STS: config.Server.STS.SecureValue()}
+
+	// a client with other TLS sessions may still be using a plaintext one:
+	client := &Client{}
+	client.SetMode(modes.TLS, true)
+	session := &Session{client: client}
+	assertEqual(config.capValuesFor(session)[caps.STS], "duration=3600,port=6697")
+	session.isSecure = true
+	assertEqual(config.capValuesFor(session)[caps.STS], "duration=3600")
+}
+
+func TestClientTagDeny(t *testing.T) {
+	var config Config
+	config.Server.ClientTagDeny = []string{"*", "-typing", "-draft/react"}
+	if err := config.processClientTagDeny(); err != nil {
+		t.Fatal(err)
+	}
+	if !config.clientTagAllowed("+typing") || config.clientTagAllowed("+draft/reply") {
+		t.Errorf("incorrect handling of * with exemptions")
+	}
+	if token := config.clientTagDenyISupportToken(); token != "*,-draft/react,-typing" {
+		t.Errorf("unexpected CLIENTTAGDENY token: %s", token)
+	}
+	filtered := config.filterClientOnlyTags(map[string]string{"+typing": "active", "+example/foo": "bar"})
+	if !reflect.DeepEqual(filtered, map[string]string{"+typing": "active"}) {
+		t.Errorf("unexpected filtered tags: %#v", filtered)
+	}
+
+	config = Config{}
+	config.Server.ClientTagDeny = []string{"typing"}
+	if err := config.processClientTagDeny(); err != nil {
+		t.Fatal(err)
+	}
+	if config.clientTagAllowed("+typing") || !config.clientTagAllowed("+draft/reply") {
+		t.Errorf("incorrect handling of a denied tag")
+	}
+
+	config = Config{}
+	if err := config.processClientTagDeny(); err != nil {
+		t.Fatal(err)
+	}
+	if token := config.clientTagDenyISupportToken(); token != "" {
+		t.Errorf("unexpected CLIENTTAGDENY token: %s", token)
+	}
+
+	for _, entries := range [][]string{{"*", "typing"}, {"typing", "-draft/react"}} {
+		config = Config{}
+		config.Server.ClientTagDeny = entries
+		if err := config.processClientTagDeny(); err == nil {
+			t.Errorf("client-tag-deny %v should be rejected", entries)
+		}
+	}
+}
+
+func TestOperClassWhoisLine(t *testing.T) {
+	var config Config
+	config.OperClasses = map[string]*OperClassConfig{
+		"helper": {Title: "Helper"},
+		"admin":  {Title: "Admin", Extends: "helper", Capabilities: []string{"rehash"}},
+	}
+	classes, err := config.OperatorClasses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line := classes["helper"].WhoisLine; line != "is a Helper" {
+		t.Errorf("unexpected whois line: %s", line)
+	}
+	if line := classes["admin"].WhoisLine; line != "is an Admin" {
+		t.Errorf("unexpected whois line: %s", line)
+	}
+	if !classes["admin"].Capabilities.Has("rehash") {
+		t.Errorf("admin class should have the rehash capability")
+	}
+}
+
+func TestCheckPprofListener(t *testing.T) {
+	for _, addr := range []string{"localhost:6060", "127.0.0.1:6060", "[::1]:6060"} {
+		if err := checkPprofListener(addr); err != nil {
+			t.Errorf("%s should be accepted: %v", addr, err)
+		}
+	}
+	for _, addr := range []string{":6060", "0.0.0.0:6060", "[::]:6060", "192.168.1.1:6060", "example.com:6060", "localhost"} {
+		if err := checkPprofListener(addr); err == nil {
+			t.Errorf("%s should be rejected", addr)
+		}
+	}
+}
+
+func TestConnectionClasses(t *testing.T) {
+	var config Config
+	config.Server.MaxSendQBytes = 96 * 1024
+	config.Server.ConnectionClasses = map[string]*ConnectionClassConfig{
+		"bots": {
+			Nets:           []string{"10.0.0.0/24"},
+			MaxSendQString: "1M",
+			PingTimeout:    5 * time.Minute,
+		},
+		"gateways": {
+			Nets: []string{"10.0.0.1", "192.0.2.0/24"},
+		},
+	}
+	if err := config.processConnectionClasses(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 10.0.0.1 is in both classes; "bots" comes first
+	if class := config.connectionClass(net.ParseIP("10.0.0.1")); class == nil || class.name != "bots" || class.maxSendQBytes != 1024*1024 {
+		t.Errorf("unexpected connection class %v", class)
+	}
+	if class := config.connectionClass(net.ParseIP("192.0.2.7")); class == nil || class.name != "gateways" || class.maxSendQBytes != 96*1024 {
+		t.Errorf("unexpected connection class %v", class)
+	}
+	if class := config.connectionClass(net.ParseIP("203.0.113.1")); class != nil {
+		t.Errorf("unexpected connection class %v", class)
+	}
+
+	config.Server.connectionClasses = nil
+	config.Server.ConnectionClasses["empty"] = &ConnectionClassConfig{}
+	if err := config.processConnectionClasses(); err == nil {
+		t.Errorf("connection class with no nets should be rejected")
+	}
+}
+
+func TestConnectionClassFakelag(t *testing.T) {
+	var config Config
+	config.Fakelag = FakelagConfig{
+		Enabled:           true,
+		Window:            time.Second,
+		BurstLimit:        5,
+		MessagesPerWindow: 2,
+		Cooldown:          2 * time.Second,
+	}
+	err := yaml.Unmarshal([]byte(`
+bots:
+    nets: ["10.0.0.0/24"]
+    fakelag:
+        burst-limit: 20
+        exempted: ["10.0.0.7"]
+gateways:
+    nets: ["192.0.2.0/24"]
+    fakelag:
+        enabled: false
+`), &config.Server.ConnectionClasses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.processConnectionClasses(); err != nil {
+		t.Fatal(err)
+	}
+
+	// unset fields are inherited from the top-level config
+	bots := config.Server.ConnectionClasses["bots"].fakelag
+	assertEqual(bots.Enabled, true)
+	assertEqual(bots.Window, time.Second)
+	assertEqual(bots.BurstLimit, uint(20))
+	assertEqual(bots.MessagesPerWindow, uint(2))
+	assertEqual(bots.Cooldown, 2*time.Second)
+	assertEqual(len(bots.exemptedNets), 1)
+	assertEqual(bots.exemptedNets[0].Contains(net.ParseIP("10.0.0.7")), true)
+
+	gateways := config.Server.ConnectionClasses["gateways"].fakelag
+	assertEqual(gateways.Enabled, false)
+	assertEqual(gateways.BurstLimit, uint(5))
+	// the top-level config is unaffected
+	assertEqual(config.Fakelag.BurstLimit, uint(5))
+
+	config.Server.connectionClasses = nil
+	config.Server.ConnectionClasses["bots"].Fakelag.Exempted = []string{"not an ip"}
+	if err := config.processConnectionClasses(); err == nil {
+		t.Errorf("invalid fakelag exempted nets should be rejected")
+	}
+}
+
+func TestCheckAPIConfig(t *testing.T) {
+	config := APIConfig{
+		Enabled:      true,
+		Listener:     "127.0.0.1:8089",
+		BearerTokens: []string{"8pc5mfmrn5bdignmcggrdk6r2a"},
+	}
+	if err := checkAPIConfig(&config); err != nil {
+		t.Errorf("valid api config rejected: %v", err)
+	}
+
+	config.BearerTokens = []string{exampleAPIBearerToken}
+	if err := checkAPIConfig(&config); err == nil {
+		t.Errorf("the example bearer token should be rejected")
+	}
+	config.BearerTokens = []string{"8pc5mfmrn5bdignmcggrdk6r2a"}
+
+	config.Listener = "0.0.0.0:8089"
+	if err := checkAPIConfig(&config); err == nil {
+		t.Errorf("a public plaintext listener should be rejected")
+	}
+	// with TLS, a public listener is fine
+	config.TLS.Enabled = true
+	if err := checkAPIConfig(&config); err != nil {
+		t.Errorf("a public tls listener should be accepted: %v", err)
+	}
+}
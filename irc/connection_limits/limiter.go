@@ -122,6 +122,8 @@ type Limiter struct {
 	limiter map[limiterKey]int
 	// IP/CIDR -> throttle state:
 	throttler map[limiterKey]ThrottleDetails
+	// last time expired throttle state was pruned:
+	lastPrune time.Time
 }
 
 // addrToKey canonicalizes `addr` to a string key, and returns
@@ -170,6 +172,7 @@ func (cl *Limiter) AddClient(addr flatip.IP) error {
 	}
 
 	if cl.config.Throttle {
+		cl.maybePrune(time.Now().UTC())
 		details := cl.throttler[addrString] // retrieve mutable throttle state from the map
 		// add in constant state to process the limiting operation
 		g := GenericThrottle{
@@ -193,6 +196,20 @@ func (cl *Limiter) AddClient(addr flatip.IP) error {
 	return nil
 }
 
+// maybePrune deletes throttle state whose window has expired, so that the map
+// doesn't grow without bound; this is done at most once per window
+func (cl *Limiter) maybePrune(now time.Time) {
+	if now.Sub(cl.lastPrune) < cl.config.Window {
+		return
+	}
+	cl.lastPrune = now
+	for key, details := range cl.throttler {
+		if now.Sub(details.Start) > cl.config.Window {
+			delete(cl.throttler, key)
+		}
+	}
+}
+
 // RemoveClient removes the given address from our population
 func (cl *Limiter) RemoveClient(addr flatip.IP) {
 	cl.Lock()
@@ -93,3 +93,24 @@ func TestLimits(t *testing.T) {
 		t.Errorf("ip should not be blocked, but %v", err)
 	}
 }
+
+func TestThrottlePruning(t *testing.T) {
+	config := baseConfig
+	config.postprocess()
+	var limiter Limiter
+	limiter.ApplyConfig(&config)
+
+	limiter.AddClient(easyParseIP("1.1.1.1"))
+	limiter.AddClient(easyParseIP("2.2.2.2"))
+	assertEqual(len(limiter.throttler), 2, t)
+
+	// within the window, nothing is pruned
+	limiter.maybePrune(time.Now().UTC().Add(time.Second))
+	assertEqual(len(limiter.throttler), 2, t)
+
+	later := time.Now().UTC().Add(config.Window + time.Second)
+	key, _, _, _ := limiter.addrToKey(easyParseIP("2.2.2.2"))
+	limiter.throttler[key] = ThrottleDetails{Start: later, Count: 1}
+	limiter.maybePrune(later)
+	assertEqual(len(limiter.throttler), 1, t)
+}
@@ -112,6 +112,11 @@ func openDatabaseInternal(config *Config, allowAutoupgrade bool) (db *buntdb.DB,
 	if version == latestDbSchema {
 		// success
 		return
+	} else if latestDbSchema < version {
+		// we can't migrate backwards (e.g., after downgrading the server);
+		// don't make a useless backup trying
+		err = &utils.IncompatibleSchemaError{CurrentVersion: version, RequiredVersion: latestDbSchema}
+		return
 	}
 
 	// XXX quiesce the DB so we can be sure it's safe to make a backup copy
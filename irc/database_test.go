@@ -0,0 +1,55 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package irc
+
+import (
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/ergochat/ergo/irc/utils"
+
+	"github.com/tidwall/buntdb"
+)
+
+func TestSchemaChangesContiguous(t *testing.T) {
+	version := allChanges[0].InitialVersion
+	for version != latestDbSchema {
+		change, ok := getSchemaChange(version)
+		if !ok {
+			t.Fatalf("no schema change from version %d", version)
+		}
+		if change.TargetVersion != version+1 {
+			t.Fatalf("schema change from version %d skips to %d", version, change.TargetVersion)
+		}
+		version = change.TargetVersion
+	}
+}
+
+func TestOpenDatabaseNewerSchema(t *testing.T) {
+	var config Config
+	config.Datastore.Path = filepath.Join(t.TempDir(), "ircd.db")
+	config.Datastore.AutoUpgrade = true
+	store, err := buntdb.Open(config.Datastore.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Update(func(tx *buntdb.Tx) error {
+		tx.Set(keySchemaVersion, strconv.Itoa(latestDbSchema+1), nil)
+		return nil
+	})
+	store.Close()
+
+	db, err := OpenDatabase(&config)
+	if err == nil {
+		db.Close()
+		t.Fatal("opened a database with a newer schema")
+	}
+	if schemaErr, ok := err.(*utils.IncompatibleSchemaError); !ok || schemaErr.CurrentVersion != latestDbSchema+1 {
+		t.Errorf("unexpected error %v", err)
+	}
+	if matches, _ := filepath.Glob(config.Datastore.Path + ".*.bak"); len(matches) != 0 {
+		t.Errorf("unexpected backups %v", matches)
+	}
+}
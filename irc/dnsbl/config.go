@@ -0,0 +1,98 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package dnsbl
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// Action is what to do with a client whose IP is listed in a DNSBL
+type Action uint
+
+const (
+	ActionNone Action = iota
+	// send a server notice to operators, but allow the connection:
+	ActionNotify
+	// require the client to authenticate with SASL:
+	ActionRequireSASL
+	// reject the connection:
+	ActionBlock
+)
+
+func actionFromString(str string) (Action, error) {
+	switch strings.ToLower(str) {
+	case "", "block":
+		return ActionBlock, nil
+	case "require-sasl":
+		return ActionRequireSASL, nil
+	case "notify":
+		return ActionNotify, nil
+	default:
+		return ActionNone, fmt.Errorf("invalid dnsbl action: %s", str)
+	}
+}
+
+// ListConfig is the configuration for a single DNSBL
+type ListConfig struct {
+	Host   string
+	Action string
+	// if nonempty, only these A records count as a listing
+	// (many lists encode the reason for the listing in the reply)
+	Replies []string
+	// message sent to the rejected client; defaults to a generic message
+	Reason string
+
+	action  Action
+	replies map[string]bool
+}
+
+type Config struct {
+	Enabled bool
+	// how long to wait for all lists to respond:
+	Timeout time.Duration
+	// how long to remember the result for an IP:
+	CacheDuration time.Duration `yaml:"cache-duration"`
+	Lists         []ListConfig
+}
+
+// Postprocess validates the config and computes derived fields
+func (config *Config) Postprocess() (err error) {
+	if !config.Enabled {
+		return nil
+	}
+	if len(config.Lists) == 0 {
+		return fmt.Errorf("dnsbl is enabled, but no lists are configured")
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 5 * time.Second
+	}
+	for i := range config.Lists {
+		list := &config.Lists[i]
+		list.Host = strings.Trim(list.Host, ".")
+		if list.Host == "" {
+			return fmt.Errorf("dnsbl list has no host")
+		}
+		list.action, err = actionFromString(list.Action)
+		if err != nil {
+			return err
+		}
+		if list.Reason == "" {
+			list.Reason = fmt.Sprintf("Your IP address is listed in %s", list.Host)
+		}
+		if len(list.Replies) != 0 {
+			list.replies = make(map[string]bool, len(list.Replies))
+			for _, reply := range list.Replies {
+				ip := net.ParseIP(reply)
+				if ip == nil {
+					return fmt.Errorf("invalid reply %s for dnsbl %s", reply, list.Host)
+				}
+				list.replies[ip.String()] = true
+			}
+		}
+	}
+	return nil
+}
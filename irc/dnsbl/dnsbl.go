@@ -0,0 +1,217 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+// Package dnsbl checks client IPs against DNS blocklists.
+package dnsbl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ergochat/ergo/irc/flatip"
+	"github.com/ergochat/ergo/irc/utils"
+)
+
+const (
+	// maximum number of IPs being checked at once; past this, checks wait
+	// (up to the timeout) for a slot, so that a connection flood can't
+	// flood the resolver in turn
+	maxConcurrentChecks = 64
+)
+
+// Result is the outcome of checking an IP against the configured lists;
+// if it is listed in more than one, the most severe action wins
+type Result struct {
+	Action Action
+	// the list that produced the result:
+	Host   string
+	Reason string
+}
+
+type cacheEntry struct {
+	result  Result
+	expires time.Time
+}
+
+// pendingCheck is a check in progress, which concurrent checks
+// of the same IP wait for instead of repeating the lookups
+type pendingCheck struct {
+	done   chan struct{}
+	result Result
+}
+
+// Checker queries the configured DNSBLs and caches the results
+type Checker struct {
+	sync.Mutex // tier 1
+
+	config    *Config
+	cache     map[flatip.IP]cacheEntry
+	lastPrune time.Time
+	pending   map[flatip.IP]*pendingCheck
+	semaphore utils.Semaphore
+
+	// for testing:
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+}
+
+// ApplyConfig applies a new config; cached results are discarded,
+// since they may have been computed from different lists
+func (c *Checker) ApplyConfig(config *Config) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.config = config
+	c.cache = make(map[flatip.IP]cacheEntry)
+	if c.pending == nil {
+		c.pending = make(map[flatip.IP]*pendingCheck)
+		c.semaphore = utils.NewSemaphore(maxConcurrentChecks)
+	}
+}
+
+// Check returns the result of looking up ip in all configured lists.
+// It blocks until all lists have responded, or the timeout has elapsed.
+func (c *Checker) Check(ip net.IP) (result Result) {
+	flat := flatip.FromNetIP(ip)
+	now := time.Now().UTC()
+
+	c.Lock()
+	config := c.config
+	if entry, ok := c.cache[flat]; ok && now.Before(entry.expires) {
+		c.Unlock()
+		return entry.result
+	}
+	if config == nil || !config.Enabled {
+		c.Unlock()
+		return
+	}
+	if pending, ok := c.pending[flat]; ok {
+		c.Unlock()
+		<-pending.done
+		return pending.result
+	}
+	pending := &pendingCheck{done: make(chan struct{})}
+	c.pending[flat] = pending
+	lookupHost := c.lookupHost
+	semaphore := c.semaphore
+	c.Unlock()
+
+	defer func() {
+		c.Lock()
+		delete(c.pending, flat)
+		c.Unlock()
+		pending.result = result
+		close(pending.done)
+	}()
+
+	if lookupHost == nil {
+		lookupHost = net.DefaultResolver.LookupHost
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+	defer cancel()
+
+	// if we can't get a slot in time, give up (and allow the client)
+	if !semaphore.AcquireWithContext(ctx) {
+		return
+	}
+	defer semaphore.Release()
+
+	reversed := reverseIP(ip)
+	results := make([]Result, len(config.Lists))
+	failed := make([]bool, len(config.Lists))
+	var wg sync.WaitGroup
+	for i := range config.Lists {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			list := &config.Lists[i]
+			replies, err := lookupHost(ctx, fmt.Sprintf("%s.%s", reversed, list.Host))
+			if err == nil && list.matches(replies) {
+				results[i] = Result{Action: list.action, Host: list.Host, Reason: list.Reason}
+			} else if err != nil && !isNotFound(err) {
+				// timeouts, SERVFAIL, etc. are treated as "not listed",
+				// but unlike NXDOMAIN, they aren't a definite answer
+				failed[i] = true
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	complete := true
+	for i, r := range results {
+		if result.Action < r.Action {
+			result = r
+		}
+		complete = complete && !failed[i]
+	}
+
+	// only cache definite answers, so that a transient resolver failure
+	// doesn't exempt an IP for the whole cache duration
+	if config.CacheDuration != 0 && complete {
+		c.Lock()
+		// don't cache a result computed from an outdated config
+		if c.config == config {
+			c.maybePrune(now)
+			c.cache[flat] = cacheEntry{result: result, expires: now.Add(config.CacheDuration)}
+		}
+		c.Unlock()
+	}
+	return
+}
+
+// isNotFound returns whether a lookup error means that the name doesn't
+// exist, i.e., the IP is definitely not listed
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+func (list *ListConfig) matches(replies []string) bool {
+	if len(replies) == 0 {
+		return false
+	}
+	if list.replies == nil {
+		return true
+	}
+	for _, reply := range replies {
+		if ip := net.ParseIP(reply); ip != nil && list.replies[ip.String()] {
+			return true
+		}
+	}
+	return false
+}
+
+// maybePrune deletes expired cache entries, at most once per cache duration
+func (c *Checker) maybePrune(now time.Time) {
+	if now.Sub(c.lastPrune) < c.config.CacheDuration {
+		return
+	}
+	c.lastPrune = now
+	for ip, entry := range c.cache {
+		if !now.Before(entry.expires) {
+			delete(c.cache, ip)
+		}
+	}
+}
+
+// reverseIP returns the DNSBL query prefix for an IP: the reversed octets
+// of an IPv4 address, or the reversed nibbles of an IPv6 address
+func reverseIP(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d", ip4[3], ip4[2], ip4[1], ip4[0])
+	}
+	ip16 := ip.To16()
+	var buf strings.Builder
+	for i := len(ip16) - 1; 0 <= i; i-- {
+		fmt.Fprintf(&buf, "%x.%x", ip16[i]&0xf, ip16[i]>>4)
+		if i != 0 {
+			buf.WriteByte('.')
+		}
+	}
+	return buf.String()
+}
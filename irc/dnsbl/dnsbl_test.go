@@ -0,0 +1,124 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package dnsbl
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReverseIP(t *testing.T) {
+	if r := reverseIP(net.ParseIP("192.0.2.99")); r != "99.2.0.192" {
+		t.Errorf("unexpected reversed ipv4: %s", r)
+	}
+	expected := "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2"
+	if r := reverseIP(net.ParseIP("2001:db8::1")); r != expected {
+		t.Errorf("unexpected reversed ipv6: %s", r)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	config := Config{
+		Enabled:       true,
+		CacheDuration: time.Hour,
+		Lists: []ListConfig{
+			{Host: "notify.example", Action: "notify"},
+			{Host: "block.example", Action: "block", Replies: []string{"127.0.0.3"}},
+		},
+	}
+	if err := config.Postprocess(); err != nil {
+		t.Fatal(err)
+	}
+
+	records := map[string][]string{
+		"2.2.0.192.notify.example": {"127.0.0.2"},
+		"2.2.0.192.block.example":  {"127.0.0.2"},
+		"3.2.0.192.notify.example": {"127.0.0.2"},
+		"3.2.0.192.block.example":  {"127.0.0.3"},
+	}
+	var lookups int32
+	var checker Checker
+	checker.ApplyConfig(&config)
+	checker.lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		atomic.AddInt32(&lookups, 1)
+		if result, ok := records[host]; ok {
+			return result, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	if result := checker.Check(net.ParseIP("192.0.2.1")); result.Action != ActionNone {
+		t.Errorf("unlisted IP should not match, got %v", result)
+	}
+	// the reply doesn't match the block list's configured replies:
+	if result := checker.Check(net.ParseIP("192.0.2.2")); result.Action != ActionNotify || result.Host != "notify.example" {
+		t.Errorf("expected notify, got %v", result)
+	}
+	// the most severe action wins:
+	if result := checker.Check(net.ParseIP("192.0.2.3")); result.Action != ActionBlock || result.Reason != "Your IP address is listed in block.example" {
+		t.Errorf("expected block, got %v", result)
+	}
+
+	// cached results don't require new lookups
+	before := atomic.LoadInt32(&lookups)
+	checker.Check(net.ParseIP("192.0.2.3"))
+	if atomic.LoadInt32(&lookups) != before {
+		t.Errorf("expected a cached result")
+	}
+}
+
+func TestCheckFailures(t *testing.T) {
+	config := Config{
+		Enabled:       true,
+		CacheDuration: time.Hour,
+		Lists:         []ListConfig{{Host: "block.example"}},
+	}
+	if err := config.Postprocess(); err != nil {
+		t.Fatal(err)
+	}
+	var lookups int32
+	var checker Checker
+	checker.ApplyConfig(&config)
+	release := make(chan struct{})
+	checker.lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		atomic.AddInt32(&lookups, 1)
+		<-release
+		return nil, errors.New("SERVFAIL")
+	}
+
+	// concurrent checks of the same IP share one set of lookups
+	results := make(chan Result)
+	for i := 0; i < 3; i++ {
+		go func() {
+			results <- checker.Check(net.ParseIP("192.0.2.1"))
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	for i := 0; i < 3; i++ {
+		if result := <-results; result.Action != ActionNone {
+			t.Errorf("a failed lookup should not match, got %v", result)
+		}
+	}
+	if found := atomic.LoadInt32(&lookups); found != 1 {
+		t.Errorf("expected 1 lookup, got %d", found)
+	}
+
+	// a failed lookup isn't a definite answer, so it isn't cached
+	checker.Check(net.ParseIP("192.0.2.1"))
+	if found := atomic.LoadInt32(&lookups); found != 2 {
+		t.Errorf("expected a failed result not to be cached, got %d lookups", found)
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	config := Config{Enabled: true, Lists: []ListConfig{{Host: "example", Action: "explode"}}}
+	if err := config.Postprocess(); err == nil {
+		t.Errorf("invalid action should be rejected")
+	}
+}
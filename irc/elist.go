@@ -0,0 +1,177 @@
+// Copyright (c) 2016-2017 Daniel Oaks <daniel@danieloaks.net>
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package irc
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ergochat/ergo/irc/utils"
+)
+
+// elistMatcher takes and matches ELIST conditions:
+// C (creation time), M (mask), N (negated mask), T (topic time), and U (user count).
+// Times are given in minutes before the present, as in `C<60` for
+// "channels created less than an hour ago".
+type elistMatcher struct {
+	MinClientsActive bool
+	MinClients       int
+	MaxClientsActive bool
+	MaxClients       int
+
+	// zero values mean the condition is inactive
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	TopicAfter    time.Time
+	TopicBefore   time.Time
+
+	Masks    []*regexp.Regexp
+	NotMasks []*regexp.Regexp
+}
+
+// AddCondition parses a single LIST parameter token, returning whether it was an
+// ELIST condition (otherwise it's a channel name, or something else that we ignore).
+func (matcher *elistMatcher) AddCondition(token string, now time.Time) bool {
+	if len(token) < 2 {
+		return false
+	}
+
+	switch token[0] {
+	case '<', '>':
+		val, err := strconv.Atoi(token[1:])
+		if err != nil {
+			return false
+		}
+		if token[0] == '<' {
+			matcher.MaxClientsActive = true
+			matcher.MaxClients = val - 1 // -1 because < means less than the given number
+		} else {
+			matcher.MinClientsActive = true
+			matcher.MinClients = val + 1 // +1 because > means more than the given number
+		}
+		return true
+	case 'C', 'T':
+		if token[1] != '<' && token[1] != '>' {
+			return false
+		}
+		minutes, err := strconv.Atoi(token[2:])
+		if err != nil || minutes < 0 {
+			return false
+		}
+		cutoff := now.Add(-time.Duration(minutes) * time.Minute)
+		// `<` means "less than n minutes ago", i.e., after the cutoff
+		switch token[:2] {
+		case "C<":
+			matcher.CreatedAfter = cutoff
+		case "C>":
+			matcher.CreatedBefore = cutoff
+		case "T<":
+			matcher.TopicAfter = cutoff
+		case "T>":
+			matcher.TopicBefore = cutoff
+		}
+		return true
+	case '!':
+		if mask := compileElistMask(token[1:]); mask != nil {
+			matcher.NotMasks = append(matcher.NotMasks, mask)
+			return true
+		}
+		return false
+	}
+
+	if strings.ContainsAny(token, "*?") {
+		if mask := compileElistMask(token); mask != nil {
+			matcher.Masks = append(matcher.Masks, mask)
+			return true
+		}
+	}
+	return false
+}
+
+func compileElistMask(mask string) *regexp.Regexp {
+	cfmask, err := casefoldChannelMask(mask)
+	if err != nil || cfmask == "" {
+		return nil
+	}
+	result, err := utils.CompileGlob(cfmask, false)
+	if err != nil {
+		return nil
+	}
+	return result
+}
+
+// casefoldChannelMask casefolds a channel mask in the same way as a channel
+// name, except that the wildcards are preserved (and it needn't start with #)
+func casefoldChannelMask(mask string) (string, error) {
+	var buf strings.Builder
+	for len(mask) != 0 {
+		i := strings.IndexAny(mask, "*?")
+		if i == -1 {
+			i = len(mask)
+		}
+		if i != 0 {
+			// CasefoldChannel requires a leading #, so add one and strip it off
+			folded, err := CasefoldChannel("#" + mask[:i])
+			if err != nil {
+				return "", err
+			}
+			buf.WriteString(folded[1:])
+		}
+		if i < len(mask) {
+			buf.WriteByte(mask[i])
+			i++
+		}
+		mask = mask[i:]
+	}
+	return buf.String(), nil
+}
+
+// Matches checks whether the given channel matches our matches.
+func (matcher *elistMatcher) Matches(entry *channelListEntry) bool {
+	memberCount, name, created, topicSet := entry.memberCount, entry.nameCasefolded, entry.createdTime, entry.topicSetTime
+
+	if matcher.MinClientsActive && memberCount < matcher.MinClients {
+		return false
+	}
+	if matcher.MaxClientsActive && memberCount > matcher.MaxClients {
+		return false
+	}
+
+	if !matcher.CreatedAfter.IsZero() && !created.After(matcher.CreatedAfter) {
+		return false
+	}
+	if !matcher.CreatedBefore.IsZero() && !created.Before(matcher.CreatedBefore) {
+		return false
+	}
+	// channels whose topic was never set don't match topic conditions
+	if !matcher.TopicAfter.IsZero() && (topicSet.IsZero() || !topicSet.After(matcher.TopicAfter)) {
+		return false
+	}
+	if !matcher.TopicBefore.IsZero() && (topicSet.IsZero() || !topicSet.Before(matcher.TopicBefore)) {
+		return false
+	}
+
+	if len(matcher.Masks) != 0 {
+		matched := false
+		for _, mask := range matcher.Masks {
+			if mask.MatchString(name) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	for _, mask := range matcher.NotMasks {
+		if mask.MatchString(name) {
+			return false
+		}
+	}
+
+	return true
+}
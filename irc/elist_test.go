@@ -0,0 +1,105 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package irc
+
+import (
+	"testing"
+	"time"
+)
+
+func makeTestChannel(name string, memberCount int, created, topicSet time.Time) *Channel {
+	cfname, err := CasefoldChannel(name)
+	if err != nil {
+		panic(err)
+	}
+	channel := &Channel{
+		name:           name,
+		nameCasefolded: cfname,
+		members:        make(MemberSet),
+		createdTime:    created,
+		topicSetTime:   topicSet,
+	}
+	for i := 0; i < memberCount; i++ {
+		channel.members.Add(new(Client))
+	}
+	channel.updateListEntryNoMutex()
+	return channel
+}
+
+func elistMatches(channel *Channel, now time.Time, conditions ...string) bool {
+	var matcher elistMatcher
+	for _, condition := range conditions {
+		if !matcher.AddCondition(condition, now) {
+			panic(condition)
+		}
+	}
+	return matcher.Matches(channel.getListEntry())
+}
+
+func TestElistMatcher(t *testing.T) {
+	now := time.Now().UTC()
+	channel := makeTestChannel("#Ergo-Dev", 3, now.Add(-2*time.Hour), now.Add(-10*time.Minute))
+	noTopic := makeTestChannel("#empty", 1, now.Add(-time.Minute), time.Time{})
+
+	assertEqual(elistMatches(channel, now), true)
+
+	// U: user counts
+	assertEqual(elistMatches(channel, now, ">2"), true)
+	assertEqual(elistMatches(channel, now, ">3"), false)
+	assertEqual(elistMatches(channel, now, "<4"), true)
+	assertEqual(elistMatches(channel, now, "<3"), false)
+
+	// C: creation time, in minutes
+	assertEqual(elistMatches(channel, now, "C>60"), true)
+	assertEqual(elistMatches(channel, now, "C<60"), false)
+	assertEqual(elistMatches(noTopic, now, "C<60"), true)
+
+	// T: topic time, in minutes
+	assertEqual(elistMatches(channel, now, "T<30"), true)
+	assertEqual(elistMatches(channel, now, "T>30"), false)
+	assertEqual(elistMatches(noTopic, now, "T<30"), false)
+	assertEqual(elistMatches(noTopic, now, "T>30"), false)
+
+	// M and N: masks and negated masks, case-insensitive
+	assertEqual(elistMatches(channel, now, "#ergo*"), true)
+	assertEqual(elistMatches(channel, now, "*DEV"), true)
+	assertEqual(elistMatches(channel, now, "#foo*", "*dev"), true)
+	assertEqual(elistMatches(channel, now, "#foo*"), false)
+	assertEqual(elistMatches(channel, now, "!*dev"), false)
+	assertEqual(elistMatches(noTopic, now, "!*dev"), true)
+
+	// conditions are combined with AND
+	assertEqual(elistMatches(channel, now, "#ergo*", ">2", "C>60", "T<30"), true)
+	assertEqual(elistMatches(channel, now, "#ergo*", ">2", "C>60", "T>30"), false)
+}
+
+func TestElistNonConditions(t *testing.T) {
+	var matcher elistMatcher
+	now := time.Now().UTC()
+	for _, token := range []string{"#ergo", "irc.example.com", "", "<", ">abc", "C", "Cx5", "T<abc"} {
+		if matcher.AddCondition(token, now) {
+			t.Errorf("%s should not have been parsed as an ELIST condition", token)
+		}
+	}
+}
+
+func TestCasefoldChannelMask(t *testing.T) {
+	for mask, expected := range map[string]string{
+		"#Ergo":     "#ergo",
+		"#Ergo*":    "#ergo*",
+		"*DEV":      "*dev",
+		"#?RGO*Dev": "#?rgo*dev",
+		"*##Ergo":   "*##ergo",
+		"**":        "**",
+	} {
+		cfmask, err := casefoldChannelMask(mask)
+		if err != nil || cfmask != expected {
+			t.Errorf("casefolding %s: got (%s, %v), expected %s", mask, cfmask, err, expected)
+		}
+	}
+	// characters that can't be in a channel name can't be in a mask either
+	if _, err := casefoldChannelMask("#ergo dev*"); err == nil {
+		t.Errorf("expected a mask with a space to be invalid")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"os"
 	"regexp"
 	"strings"
 	"time"
@@ -19,6 +20,7 @@ import (
 
 var (
 	ErrBlacklistedAddress = errors.New("Email address is blacklisted")
+	ErrDisallowedDomain   = errors.New("Email addresses from that domain are not accepted")
 	ErrInvalidAddress     = errors.New("Email address is invalid")
 	ErrNoMXRecord         = errors.New("Couldn't resolve MX record")
 )
@@ -28,6 +30,9 @@ type MTAConfig struct {
 	Port     int
 	Username string
 	Password string
+	// connect with TLS from the start (typically on port 465),
+	// instead of upgrading the connection with STARTTLS
+	ImplicitTLS bool `yaml:"implicit-tls"`
 }
 
 type MailtoConfig struct {
@@ -50,6 +55,13 @@ type MailtoConfig struct {
 		Cooldown custime.Duration
 		Timeout  custime.Duration
 	} `yaml:"password-reset"`
+	// addresses in these domains (or their subdomains) are refused:
+	BlockedDomains     []string `yaml:"blocked-domains"`
+	BlockedDomainsFile string   `yaml:"blocked-domains-file"`
+	blockedDomains     utils.HashSet[string]
+	// if nonempty, only addresses in these domains (or their subdomains) are accepted:
+	AllowedDomains []string `yaml:"allowed-domains"`
+	allowedDomains utils.HashSet[string]
 }
 
 func (config *MailtoConfig) Postprocess(heloDomain string) (err error) {
@@ -75,6 +87,30 @@ func (config *MailtoConfig) Postprocess(heloDomain string) (err error) {
 		config.blacklistRegexes = append(config.blacklistRegexes, compiled)
 	}
 
+	config.blockedDomains = make(utils.HashSet[string])
+	for _, domain := range config.BlockedDomains {
+		config.blockedDomains.Add(normalizeDomain(domain))
+	}
+	if config.BlockedDomainsFile != "" {
+		// one domain per line, the format of the usual lists of disposable email domains
+		contents, err := os.ReadFile(config.BlockedDomainsFile)
+		if err != nil {
+			return fmt.Errorf("couldn't read blocked-domains-file: %w", err)
+		}
+		for _, line := range strings.Split(string(contents), "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				config.blockedDomains.Add(normalizeDomain(line))
+			}
+		}
+	}
+	if len(config.AllowedDomains) != 0 {
+		config.allowedDomains = make(utils.HashSet[string])
+		for _, domain := range config.AllowedDomains {
+			config.allowedDomains.Add(normalizeDomain(domain))
+		}
+	}
+
 	if config.MTAConfig.Server != "" {
 		// smarthost, nothing more to validate
 		return nil
@@ -83,6 +119,47 @@ func (config *MailtoConfig) Postprocess(heloDomain string) (err error) {
 	return config.DKIM.Postprocess()
 }
 
+func normalizeDomain(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
+
+// domainInSet tests whether domain, or any of its parent domains, is in the set
+func domainInSet(domain string, set utils.HashSet[string]) bool {
+	for {
+		if set.Has(domain) {
+			return true
+		}
+		dot := strings.IndexByte(domain, '.')
+		if dot == -1 {
+			return false
+		}
+		domain = domain[dot+1:]
+	}
+}
+
+// CheckAddress tests whether an address may be used, according to
+// blacklist-regexes and the blocked and allowed domains
+func (config *MailtoConfig) CheckAddress(address string) error {
+	for _, reg := range config.blacklistRegexes {
+		if reg.MatchString(address) {
+			return ErrBlacklistedAddress
+		}
+	}
+
+	idx := strings.LastIndexByte(address, '@')
+	if idx == -1 {
+		return ErrInvalidAddress
+	}
+	domain := normalizeDomain(address[idx+1:])
+	if domainInSet(domain, config.blockedDomains) {
+		return ErrDisallowedDomain
+	}
+	if config.allowedDomains != nil && !domainInSet(domain, config.allowedDomains) {
+		return ErrDisallowedDomain
+	}
+	return nil
+}
+
 // are we sending email directly, as opposed to deferring to an MTA?
 func (config *MailtoConfig) DirectSendingEnabled() bool {
 	return config.MTAReal.Server == ""
@@ -117,10 +194,8 @@ func ComposeMail(config MailtoConfig, recipient, subject string) (message bytes.
 }
 
 func SendMail(config MailtoConfig, recipient string, msg []byte) (err error) {
-	for _, reg := range config.blacklistRegexes {
-		if reg.MatchString(recipient) {
-			return ErrBlacklistedAddress
-		}
+	if err = config.CheckAddress(recipient); err != nil {
+		return
 	}
 
 	if config.DKIM.Domain != "" {
@@ -132,7 +207,9 @@ func SendMail(config MailtoConfig, recipient string, msg []byte) (err error) {
 
 	var addr string
 	var auth smtp.Auth
+	var implicitTLS bool
 	if !config.DirectSendingEnabled() {
+		implicitTLS = config.MTAReal.ImplicitTLS
 		addr = fmt.Sprintf("%s:%d", config.MTAReal.Server, config.MTAReal.Port)
 		if config.MTAReal.Username != "" && config.MTAReal.Password != "" {
 			auth = smtp.PlainAuth("", config.MTAReal.Username, config.MTAReal.Password, config.MTAReal.Server)
@@ -149,5 +226,5 @@ func SendMail(config MailtoConfig, recipient string, msg []byte) (err error) {
 		addr = fmt.Sprintf("%s:smtp", mx)
 	}
 
-	return smtp.SendMail(addr, auth, config.HeloDomain, config.Sender, []string{recipient}, msg, config.RequireTLS, config.Timeout)
+	return smtp.SendMail(addr, auth, config.HeloDomain, config.Sender, []string{recipient}, msg, config.RequireTLS, implicitTLS, config.Timeout)
 }
@@ -0,0 +1,62 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package email
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckAddress(t *testing.T) {
+	dir := t.TempDir()
+	blocklist := filepath.Join(dir, "disposable.txt")
+	if err := os.WriteFile(blocklist, []byte("# disposable domains\nguerrillamail.com\n\n  Trashmail.net  \n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := MailtoConfig{
+		Sender:             "admin@my.network",
+		MTAConfig:          MTAConfig{Server: "localhost", Port: 25},
+		BlacklistRegexes:   []string{".*@spam\\.example"},
+		BlockedDomains:     []string{"mailinator.com"},
+		BlockedDomainsFile: blocklist,
+	}
+	if err := config.Postprocess("my.network"); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(address string, expected error) {
+		if err := config.CheckAddress(address); err != expected {
+			t.Errorf("CheckAddress(%s): expected %v, got %v", address, expected, err)
+		}
+	}
+	check("user@example.com", nil)
+	check("user@spam.example", ErrBlacklistedAddress)
+	check("user@mailinator.com", ErrDisallowedDomain)
+	check("user@eu.mailinator.com", ErrDisallowedDomain)
+	check("user@notmailinator.com", nil)
+	check("user@guerrillamail.com", ErrDisallowedDomain)
+	check("user@trashmail.net", ErrDisallowedDomain)
+	check("user", ErrInvalidAddress)
+
+	config.AllowedDomains = []string{"example.com"}
+	if err := config.Postprocess("my.network"); err != nil {
+		t.Fatal(err)
+	}
+	check("user@example.com", nil)
+	check("user@mail.example.com", nil)
+	check("user@example.org", ErrDisallowedDomain)
+}
+
+func TestBlockedDomainsFileMissing(t *testing.T) {
+	config := MailtoConfig{
+		Sender:             "admin@my.network",
+		MTAConfig:          MTAConfig{Server: "localhost", Port: 25},
+		BlockedDomainsFile: filepath.Join(t.TempDir(), "nonexistent.txt"),
+	}
+	if err := config.Postprocess("my.network"); err == nil {
+		t.Errorf("a missing blocked-domains-file should be a config error")
+	}
+}
@@ -20,6 +20,7 @@ var (
 	errAccountAlreadyVerified         = errors.New(`Account is already verified`)
 	errAccountCantDropPrimaryNick     = errors.New("Can't unreserve primary nickname")
 	errAccountCreation                = errors.New("Account could not be created")
+	errAccountRegisterTooSoon         = errors.New("You must wait longer after connecting before you can register an account")
 	errAccountDoesNotExist            = errors.New("Account does not exist")
 	errAccountInvalidCredentials      = errors.New("Invalid account credentials")
 	errAccountBadPassphrase           = errors.New(`Passphrase contains forbidden characters or is otherwise invalid`)
@@ -58,6 +59,9 @@ var (
 	errBanned                         = errors.New("IP or nickmask banned")
 	errInvalidParams                  = utils.ErrInvalidParams
 	errNoVhost                        = errors.New(`You do not have an approved vhost`)
+	errSecureOnly                     = errors.New("Only clients connected via TLS can join the channel")
+	errJoinThrottled                  = errors.New("Too many recent joins to the channel")
+	errNoVhostRequest                 = errors.New(`There is no pending vhost request`)
 	errLimitExceeded                  = errors.New("Limit exceeded")
 	errNoop                           = errors.New("Action was a no-op")
 	errCASFailed                      = errors.New("Compare-and-swap update of database value failed")
@@ -72,6 +76,7 @@ var (
 	errWrongChannelKey                = errors.New("Cannot join password-protected channel without the password")
 	errInviteOnly                     = errors.New("Cannot join invite-only channel without an invite")
 	errRegisteredOnly                 = errors.New("Cannot join registered-only channel without an account")
+	errRegisteredOnlyDefcon           = errors.New("Cannot join channels without an account while the server is under DEFCON restrictions")
 	errValidEmailRequired             = errors.New("A valid email address is required for account registration")
 	errInvalidAccountRename           = errors.New("Account renames can only change the casefolding of the account name")
 	errNameReserved                   = errors.New(`Name reserved due to a prior registration`)
@@ -0,0 +1,149 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package irc
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidwall/buntdb"
+)
+
+const (
+	// version of the export format (not of the database schema)
+	exportDBVersion = 1
+	// value of `source` in exported databases, for `ergo importdb`
+	exportDBSource = "ergo"
+)
+
+// databaseExport is a dump of an Ergo database, produced by `ergo exportdb`.
+// Datastore keys are grouped by category (accounts, including vhosts; channels;
+// bans, including D-Lines, K-Lines, and Q-Lines; and other), but are otherwise
+// stored verbatim, so that an import reproduces the original database exactly.
+type databaseExport struct {
+	Version       int                          `json:"version"`
+	Source        string                       `json:"source"`
+	SchemaVersion int                          `json:"schemaVersion"`
+	ExportedAt    time.Time                    `json:"exportedAt"`
+	Data          map[string]map[string]string `json:"data"`
+	// expiration times of keys that have a TTL
+	Expires map[string]time.Time `json:"expires,omitempty"`
+}
+
+func exportCategory(key string) string {
+	switch {
+	case strings.HasPrefix(key, "account."):
+		return "accounts"
+	case strings.HasPrefix(key, "channel."):
+		return "channels"
+	case strings.HasPrefix(key, "bans."):
+		return "bans"
+	default:
+		return "other"
+	}
+}
+
+func doExportDB(tx *buntdb.Tx) (dbExport databaseExport, err error) {
+	dbExport = databaseExport{
+		Version:    exportDBVersion,
+		Source:     exportDBSource,
+		ExportedAt: time.Now().UTC(),
+		Data:       make(map[string]map[string]string),
+		Expires:    make(map[string]time.Time),
+	}
+
+	versionStr, err := tx.Get(keySchemaVersion)
+	if err != nil {
+		return dbExport, fmt.Errorf("could not read database schema version: %w", err)
+	}
+	dbExport.SchemaVersion, err = strconv.Atoi(versionStr)
+	if err != nil {
+		return dbExport, fmt.Errorf("invalid database schema version %s: %w", versionStr, err)
+	}
+
+	err = tx.Ascend("", func(key, value string) bool {
+		category := exportCategory(key)
+		if dbExport.Data[category] == nil {
+			dbExport.Data[category] = make(map[string]string)
+		}
+		dbExport.Data[category][key] = value
+		if ttl, ttlErr := tx.TTL(key); ttlErr == nil && 0 <= ttl {
+			dbExport.Expires[key] = dbExport.ExportedAt.Add(ttl)
+		}
+		return true
+	})
+	return
+}
+
+// ExportDB writes the contents of the database to a JSON file,
+// implementing the `ergo exportdb` command.
+func ExportDB(config *Config, outfile string) (err error) {
+	// buntdb.Open would create a missing database
+	if _, err = os.Stat(config.Datastore.Path); err != nil {
+		return err
+	}
+	db, err := buntdb.Open(config.Datastore.Path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var dbExport databaseExport
+	err = db.View(func(tx *buntdb.Tx) (err error) {
+		dbExport, err = doExportDB(tx)
+		return
+	})
+	if err != nil {
+		return
+	}
+
+	data, err := json.MarshalIndent(dbExport, "", "\t")
+	if err != nil {
+		return
+	}
+	// the export contains password hashes and other secrets:
+	return os.WriteFile(outfile, data, 0600)
+}
+
+func doImportDBErgo(data []byte, tx *buntdb.Tx) (err error) {
+	var dbExport databaseExport
+	if err = json.Unmarshal(data, &dbExport); err != nil {
+		return err
+	}
+	if dbExport.Version != exportDBVersion {
+		return fmt.Errorf("unsupported version of the db for import: version %d is required", exportDBVersion)
+	}
+	if latestDbSchema < dbExport.SchemaVersion {
+		return fmt.Errorf("the database was exported by a newer version of Ergo (schema version %d)", dbExport.SchemaVersion)
+	}
+	if dbExport.Data["other"][keySchemaVersion] != strconv.Itoa(dbExport.SchemaVersion) {
+		return fmt.Errorf("the exported database is missing its schema version")
+	}
+
+	for _, category := range dbExport.Data {
+		for key, value := range category {
+			var setOptions *buntdb.SetOptions
+			if expires, ok := dbExport.Expires[key]; ok {
+				ttl := time.Until(expires)
+				if ttl <= 0 {
+					continue
+				}
+				setOptions = &buntdb.SetOptions{Expires: true, TTL: ttl}
+			}
+			if _, _, err = tx.Set(key, value, setOptions); err != nil {
+				return err
+			}
+		}
+	}
+
+	if dbExport.SchemaVersion < latestDbSchema {
+		log.Printf("NOTE: the imported database has schema version %d; run `ergo upgradedb` to upgrade it\n", dbExport.SchemaVersion)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package irc
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/tidwall/buntdb"
+)
+
+func TestExportImportDB(t *testing.T) {
+	source, err := buntdb.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+	err = source.Update(func(tx *buntdb.Tx) error {
+		tx.Set(keySchemaVersion, strconv.Itoa(latestDbSchema), nil)
+		tx.Set(fmt.Sprintf(keyAccountName, "shivaram"), "Shivaram", nil)
+		tx.Set(fmt.Sprintf(keyAccountVHost, "shivaram"), `{"Enabled":true,"ApprovedVHost":"good.fortune"}`, nil)
+		tx.Set(fmt.Sprintf(keyChannelFounder, "#ergo"), "shivaram", nil)
+		tx.Set(fmt.Sprintf(keyKlineEntry, "*!*@example.com"), "{}", &buntdb.SetOptions{Expires: true, TTL: time.Hour})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dbExport databaseExport
+	err = source.View(func(tx *buntdb.Tx) (err error) {
+		dbExport, err = doExportDB(tx)
+		return
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(dbExport.SchemaVersion, latestDbSchema)
+	assertEqual(dbExport.Data["accounts"][fmt.Sprintf(keyAccountName, "shivaram")], "Shivaram")
+	assertEqual(dbExport.Data["channels"][fmt.Sprintf(keyChannelFounder, "#ergo")], "shivaram")
+	assertEqual(len(dbExport.Data["bans"]), 1)
+	assertEqual(len(dbExport.Expires), 1)
+
+	data, err := json.Marshal(dbExport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest, err := buntdb.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dest.Close()
+	err = dest.Update(func(tx *buntdb.Tx) error {
+		return doImportDBErgo(data, tx)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reexport databaseExport
+	err = dest.View(func(tx *buntdb.Tx) (err error) {
+		reexport, err = doExportDB(tx)
+		return
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dbExport.Data, reexport.Data) {
+		t.Errorf("import did not reproduce the database: %v != %v", dbExport.Data, reexport.Data)
+	}
+	klineKey := fmt.Sprintf(keyKlineEntry, "*!*@example.com")
+	if expires, ok := reexport.Expires[klineKey]; !ok || time.Until(expires) <= 0 {
+		t.Errorf("TTL of %s was not preserved", klineKey)
+	}
+}
+
+func TestImportDBErgoVersion(t *testing.T) {
+	db, err := buntdb.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	data := fmt.Sprintf(`{"version": 1, "source": "ergo", "schemaVersion": %d, "data": {"other": {"db.version": "%d"}}}`, latestDbSchema+1, latestDbSchema+1)
+	err = db.Update(func(tx *buntdb.Tx) error {
+		return doImportDBErgo([]byte(data), tx)
+	})
+	if err == nil {
+		t.Errorf("import of a newer schema version should fail")
+	}
+}
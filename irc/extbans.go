@@ -0,0 +1,174 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package irc
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/ergochat/ergo/irc/modes"
+	"github.com/ergochat/ergo/irc/utils"
+)
+
+// extended bans match clients by some property other than their nickmask.
+// the syntax is ~<type>:<argument>, or just ~<type> for types that take no
+// argument (e.g., ~a:shivaram, ~z). like an ordinary mask, an extban can be
+// prefixed with m: (or ~m:) to mute matching clients instead of banning them.
+
+// extbanType implements a single extban type; to add a new one, add it to extbanTypes.
+type extbanType struct {
+	// canonicalize validates and normalizes the argument (which may be empty)
+	canonicalize func(arg string) (string, error)
+	// compile prepares the canonicalized argument for matching
+	compile func(arg string) (extbanMatcher, error)
+}
+
+// extbanMatcher reports whether a client matches a compiled extban
+type extbanMatcher func(client *Client) bool
+
+var extbanTypes = map[byte]extbanType{
+	// ~a matches any logged-in client; ~a:<account> matches clients logged
+	// into an account (wildcards are permitted)
+	'a': {
+		canonicalize: canonicalizeAccountExtban,
+		compile:      compileAccountExtban,
+	},
+	// ~z matches clients connected via TLS; e.g., +i with +I ~z makes a channel TLS-only
+	'z': {
+		canonicalize: canonicalizeNoArgExtban,
+		compile: func(arg string) (extbanMatcher, error) {
+			return func(client *Client) bool {
+				return client.HasMode(modes.TLS)
+			}, nil
+		},
+	},
+}
+
+// extbanISupportToken returns the value of the EXTBAN ISUPPORT token
+func extbanISupportToken() string {
+	// m (mute) is listed as well, since ~m: is accepted as a synonym for m:
+	types := []byte{'m'}
+	for typeChar := range extbanTypes {
+		types = append(types, typeChar)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return "~," + string(types)
+}
+
+func isExtban(mask string) bool {
+	return strings.HasPrefix(mask, "~")
+}
+
+// CanonicalizeListMask canonicalizes an entry for the +b, +e, or +I lists,
+// which may be an extban, an ordinary nickmask, or a mute of either.
+func CanonicalizeListMask(mask string) (result string, err error) {
+	mask = strings.TrimSpace(mask)
+	var mutePrefix string
+	if strings.HasPrefix(mask, "~m:") {
+		mutePrefix, mask = "m:", mask[3:]
+	} else if strings.HasPrefix(mask, "m:") && isExtban(mask[2:]) {
+		mutePrefix, mask = "m:", mask[2:]
+	}
+
+	if isExtban(mask) {
+		result, err = canonicalizeExtban(mask)
+	} else {
+		// existing behavior: m:nick!user@host is canonicalized as a nickmask
+		result, err = CanonicalizeMaskWildcard(mutePrefix + mask)
+		mutePrefix = ""
+	}
+	if err != nil {
+		return
+	}
+	return mutePrefix + result, nil
+}
+
+func parseExtban(mask string) (extType extbanType, typeChar byte, arg string, err error) {
+	if len(mask) < 2 || mask[0] != '~' {
+		err = errInvalidParams
+		return
+	}
+	typeChar = mask[1]
+	extType, ok := extbanTypes[typeChar]
+	if !ok {
+		err = errInvalidParams
+		return
+	}
+	switch {
+	case len(mask) == 2:
+		// no argument
+	case mask[2] == ':':
+		arg = mask[3:]
+	default:
+		err = errInvalidParams
+	}
+	return
+}
+
+func canonicalizeExtban(mask string) (result string, err error) {
+	extType, typeChar, arg, err := parseExtban(mask)
+	if err != nil {
+		return
+	}
+	arg, err = extType.canonicalize(arg)
+	if err != nil {
+		return
+	}
+	if arg == "" {
+		return string([]byte{'~', typeChar}), nil
+	}
+	return string([]byte{'~', typeChar, ':'}) + arg, nil
+}
+
+func compileExtban(mask string) (matcher extbanMatcher, err error) {
+	extType, _, arg, err := parseExtban(mask)
+	if err != nil {
+		return
+	}
+	return extType.compile(arg)
+}
+
+func canonicalizeNoArgExtban(arg string) (string, error) {
+	if arg != "" {
+		return "", errInvalidParams
+	}
+	return "", nil
+}
+
+func canonicalizeAccountExtban(arg string) (string, error) {
+	if arg == "" {
+		return "", nil
+	}
+	if strings.ContainsAny(arg, "*?") {
+		// wildcards break casefolding, same as with nickmasks
+		return strings.ToLower(arg), nil
+	}
+	return CasefoldName(arg)
+}
+
+func compileAccountExtban(arg string) (extbanMatcher, error) {
+	if arg == "" {
+		return func(client *Client) bool {
+			return client.Account() != ""
+		}, nil
+	}
+	re, err := utils.CompileGlob(arg, false)
+	if err != nil {
+		return nil, err
+	}
+	return func(client *Client) bool {
+		account := client.Account()
+		return account != "" && re.MatchString(account)
+	}, nil
+}
+
+// compileExtbans compiles a list of canonicalized extbans, skipping invalid ones
+func compileExtbans(masks []string) (matchers []extbanMatcher) {
+	for _, mask := range masks {
+		if matcher, err := compileExtban(mask); err == nil {
+			matchers = append(matchers, matcher)
+		}
+	}
+	return
+}
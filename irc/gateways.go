@@ -101,6 +101,7 @@ func (client *Client) ApplyProxiedIP(session *Session, proxiedIP net.IP, tls boo
 	// set tls info
 	session.certfp = ""
 	session.peerCerts = nil
+	session.isSecure = tls
 	client.SetMode(modes.TLS, tls)
 
 	return nil, ""
@@ -0,0 +1,130 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+// Package geoip looks up the country and autonomous system of IP addresses,
+// using MaxMind databases (e.g., GeoLite2-Country and GeoLite2-ASN).
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+type Config struct {
+	Enabled bool
+	// path to a country database, e.g., GeoLite2-Country.mmdb:
+	CountryDatabase string `yaml:"country-database"`
+	// path to an ASN database, e.g., GeoLite2-ASN.mmdb:
+	ASNDatabase string `yaml:"asn-database"`
+	// ISO 3166-1 country codes whose connections are rejected:
+	BlockedCountries []string `yaml:"blocked-countries"`
+
+	country          *mmdbReader
+	asn              *mmdbReader
+	blockedCountries map[string]bool
+}
+
+// Info is what we know about an IP address
+type Info struct {
+	// ISO 3166-1 code, e.g., "US"
+	Country string
+	ASN     uint64
+	// name of the organization that owns the AS
+	Org string
+}
+
+// String formats the info for display, e.g., "US AS15169 (Google LLC)"
+func (info Info) String() string {
+	var parts []string
+	if info.Country != "" {
+		parts = append(parts, info.Country)
+	}
+	if info.ASN != 0 {
+		if info.Org != "" {
+			parts = append(parts, fmt.Sprintf("AS%d (%s)", info.ASN, info.Org))
+		} else {
+			parts = append(parts, fmt.Sprintf("AS%d", info.ASN))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Load validates the config and loads the databases into memory
+func (config *Config) Load() (err error) {
+	if !config.Enabled {
+		return nil
+	}
+	if config.CountryDatabase == "" && config.ASNDatabase == "" {
+		return fmt.Errorf("geoip is enabled, but no databases are configured")
+	}
+	if config.CountryDatabase != "" {
+		if config.country, err = openMMDB(config.CountryDatabase); err != nil {
+			return fmt.Errorf("couldn't load geoip country database: %w", err)
+		}
+	}
+	if config.ASNDatabase != "" {
+		if config.asn, err = openMMDB(config.ASNDatabase); err != nil {
+			return fmt.Errorf("couldn't load geoip asn database: %w", err)
+		}
+	}
+	if len(config.BlockedCountries) != 0 {
+		if config.country == nil {
+			return fmt.Errorf("geoip blocked-countries requires a country database")
+		}
+		config.blockedCountries = make(map[string]bool, len(config.BlockedCountries))
+		for _, country := range config.BlockedCountries {
+			config.blockedCountries[strings.ToUpper(country)] = true
+		}
+	}
+	return nil
+}
+
+// Lookup returns whatever information the databases have about ip;
+// lookup errors are treated as missing information
+func (config *Config) Lookup(ip net.IP) (info Info) {
+	if !config.Enabled {
+		return
+	}
+	if config.country != nil {
+		if record, err := config.country.lookup(ip); err == nil {
+			info.Country = strings.ToUpper(getString(record, "country", "iso_code"))
+			if info.Country == "" {
+				// e.g., satellite providers, or anycast addresses
+				info.Country = strings.ToUpper(getString(record, "registered_country", "iso_code"))
+			}
+		}
+	}
+	if config.asn != nil {
+		if record, err := config.asn.lookup(ip); err == nil {
+			info.ASN, _ = getField(record, "autonomous_system_number").(uint64)
+			info.Org = getString(record, "autonomous_system_organization")
+		}
+	}
+	return
+}
+
+// CountryBlocked returns whether connections from ip should be rejected
+func (config *Config) CountryBlocked(ip net.IP) (blocked bool, country string) {
+	if config.blockedCountries == nil {
+		return false, ""
+	}
+	country = config.Lookup(ip).Country
+	return country != "" && config.blockedCountries[country], country
+}
+
+func getField(record interface{}, path ...string) interface{} {
+	for _, key := range path {
+		m, ok := record.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		record = m[key]
+	}
+	return record
+}
+
+func getString(record interface{}, path ...string) string {
+	result, _ := getField(record, path...).(string)
+	return result
+}
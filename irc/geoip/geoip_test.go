@@ -0,0 +1,187 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package geoip
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// minimal MaxMind DB encoder, for building test databases
+
+func encodeControl(buf *bytes.Buffer, fieldType, size uint) {
+	var ctrl byte
+	if fieldType <= 7 {
+		ctrl = byte(fieldType << 5)
+	}
+	switch {
+	case size < 29:
+		ctrl |= byte(size)
+		buf.WriteByte(ctrl)
+	default:
+		ctrl |= 29
+		buf.WriteByte(ctrl)
+	}
+	if fieldType > 7 {
+		buf.WriteByte(byte(fieldType - 7))
+	}
+	if size >= 29 {
+		buf.WriteByte(byte(size - 29))
+	}
+}
+
+func encodeValue(buf *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		encodeControl(buf, typeString, uint(len(v)))
+		buf.WriteString(v)
+	case uint64:
+		var b []byte
+		for ; v != 0; v >>= 8 {
+			b = append([]byte{byte(v)}, b...)
+		}
+		encodeControl(buf, typeUint32, uint(len(b)))
+		buf.Write(b)
+	case map[string]interface{}:
+		encodeControl(buf, typeMap, uint(len(v)))
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			encodeValue(buf, key)
+			encodeValue(buf, v[key])
+		}
+	default:
+		panic("unsupported type")
+	}
+}
+
+// buildIPv4Database builds a 24-bit database with a tree of two nodes:
+// 0.0.0.0/1 maps to low, 128.0.0.0/2 has no data, and 192.0.0.0/2 maps to high
+func buildIPv4Database(low, high map[string]interface{}) []byte {
+	const nodeCount = 2
+	var data bytes.Buffer
+	lowOffset := uint(data.Len())
+	encodeValue(&data, low)
+	highOffset := uint(data.Len())
+	encodeValue(&data, high)
+
+	record := func(buf *bytes.Buffer, value uint) {
+		buf.Write([]byte{byte(value >> 16), byte(value >> 8), byte(value)})
+	}
+	var db bytes.Buffer
+	record(&db, nodeCount+dataSectionSeparatorSize+lowOffset)
+	record(&db, 1)
+	record(&db, nodeCount)
+	record(&db, nodeCount+dataSectionSeparatorSize+highOffset)
+	db.Write(make([]byte, dataSectionSeparatorSize))
+	db.Write(data.Bytes())
+	db.Write(metadataMarker)
+	encodeValue(&db, map[string]interface{}{
+		"node_count":    uint64(nodeCount),
+		"record_size":   uint64(24),
+		"ip_version":    uint64(4),
+		"database_type": "Test",
+	})
+	return db.Bytes()
+}
+
+func writeDatabase(t *testing.T, name string, contents []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, contents, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLookup(t *testing.T) {
+	countryDB := buildIPv4Database(
+		map[string]interface{}{
+			"country": map[string]interface{}{"iso_code": "US"},
+		},
+		map[string]interface{}{
+			"registered_country": map[string]interface{}{"iso_code": "de"},
+		},
+	)
+	asnDB := buildIPv4Database(
+		map[string]interface{}{
+			"autonomous_system_number":       uint64(15169),
+			"autonomous_system_organization": "Google LLC",
+		},
+		map[string]interface{}{
+			"autonomous_system_number": uint64(3320),
+		},
+	)
+
+	config := Config{
+		Enabled:          true,
+		CountryDatabase:  writeDatabase(t, "country.mmdb", countryDB),
+		ASNDatabase:      writeDatabase(t, "asn.mmdb", asnDB),
+		BlockedCountries: []string{"de"},
+	}
+	if err := config.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		ip       string
+		expected Info
+		str      string
+		blocked  bool
+	}{
+		{"8.8.8.8", Info{Country: "US", ASN: 15169, Org: "Google LLC"}, "US AS15169 (Google LLC)", false},
+		{"130.1.2.3", Info{}, "", false},
+		{"217.0.0.1", Info{Country: "DE", ASN: 3320}, "DE AS3320", true},
+		// IPv6 addresses aren't in an IPv4 database
+		{"2001:db8::1", Info{}, "", false},
+	}
+	for _, c := range cases {
+		ip := net.ParseIP(c.ip)
+		info := config.Lookup(ip)
+		if info != c.expected {
+			t.Errorf("%s: expected %#v, got %#v", c.ip, c.expected, info)
+		}
+		if info.String() != c.str {
+			t.Errorf("%s: expected %q, got %q", c.ip, c.str, info.String())
+		}
+		if blocked, _ := config.CountryBlocked(ip); blocked != c.blocked {
+			t.Errorf("%s: expected blocked=%t", c.ip, c.blocked)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	disabled := Config{CountryDatabase: "/nonexistent"}
+	if err := disabled.Load(); err != nil {
+		t.Errorf("disabled config should not load databases: %v", err)
+	}
+	if info := disabled.Lookup(net.ParseIP("8.8.8.8")); info != (Info{}) {
+		t.Errorf("disabled config should not return info: %#v", info)
+	}
+
+	empty := Config{Enabled: true}
+	if err := empty.Load(); err == nil {
+		t.Errorf("config with no databases should fail")
+	}
+
+	invalid := Config{Enabled: true, CountryDatabase: writeDatabase(t, "invalid.mmdb", []byte("not a database"))}
+	if err := invalid.Load(); err == nil {
+		t.Errorf("invalid database should fail")
+	}
+
+	asnOnly := Config{
+		Enabled:          true,
+		ASNDatabase:      writeDatabase(t, "asn.mmdb", buildIPv4Database(nil, nil)),
+		BlockedCountries: []string{"US"},
+	}
+	if err := asnOnly.Load(); err == nil {
+		t.Errorf("blocked-countries without a country database should fail")
+	}
+}
@@ -0,0 +1,320 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+)
+
+// a minimal reader for the MaxMind DB format, as used by the GeoLite2 and
+// GeoIP2 databases: https://maxmind.github.io/MaxMind-DB/
+// it decodes records into generic Go values (map[string]interface{}, []interface{},
+// string, uint64, int64, float64, bool, []byte).
+
+var (
+	metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+	errInvalidDatabase = errors.New("invalid MaxMind database")
+)
+
+const (
+	// the search tree is followed by 16 bytes of zeroes
+	dataSectionSeparatorSize = 16
+	// sanity limit on nesting, to prevent pointer loops from recursing forever
+	maxDecodeDepth = 32
+)
+
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// mmdbReader is an in-memory MaxMind database
+type mmdbReader struct {
+	buf          []byte
+	data         []byte // the data section
+	databaseType string
+	nodeCount    uint
+	recordSize   uint
+	ipVersion    uint
+	// node at which IPv4 lookups start in an IPv6 tree (i.e., ::/96)
+	ipv4Start uint
+}
+
+func openMMDB(path string) (*mmdbReader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := newMMDBReader(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return reader, nil
+}
+
+func newMMDBReader(buf []byte) (reader *mmdbReader, err error) {
+	markerIndex := bytes.LastIndex(buf, metadataMarker)
+	if markerIndex == -1 {
+		return nil, errInvalidDatabase
+	}
+	metadataBuf := buf[markerIndex+len(metadataMarker):]
+	rawMetadata, _, err := decode(metadataBuf, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	metadata, ok := rawMetadata.(map[string]interface{})
+	if !ok {
+		return nil, errInvalidDatabase
+	}
+	nodeCount, _ := metadata["node_count"].(uint64)
+	recordSize, _ := metadata["record_size"].(uint64)
+	ipVersion, _ := metadata["ip_version"].(uint64)
+	databaseType, _ := metadata["database_type"].(string)
+
+	reader = &mmdbReader{
+		buf:          buf,
+		databaseType: databaseType,
+		nodeCount:    uint(nodeCount),
+		recordSize:   uint(recordSize),
+		ipVersion:    uint(ipVersion),
+	}
+	if reader.recordSize != 24 && reader.recordSize != 28 && reader.recordSize != 32 {
+		return nil, fmt.Errorf("unsupported record size %d", reader.recordSize)
+	}
+	if reader.ipVersion != 4 && reader.ipVersion != 6 {
+		return nil, fmt.Errorf("unsupported ip version %d", reader.ipVersion)
+	}
+	treeSize := reader.nodeCount * reader.recordSize / 4
+	dataStart := treeSize + dataSectionSeparatorSize
+	if uint(markerIndex) < dataStart {
+		return nil, errInvalidDatabase
+	}
+	reader.data = buf[dataStart:markerIndex]
+
+	if reader.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < reader.nodeCount; i++ {
+			node = reader.readRecord(node, 0)
+		}
+		reader.ipv4Start = node
+	}
+	return reader, nil
+}
+
+// readRecord reads the left (bit == 0) or right (bit == 1) record of a node
+func (reader *mmdbReader) readRecord(node uint, bit byte) uint {
+	switch reader.recordSize {
+	case 24:
+		offset := node*6 + uint(bit)*3
+		b := reader.buf[offset : offset+3]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := reader.buf[node*7 : node*7+7]
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		offset := node*8 + uint(bit)*4
+		return uint(binary.BigEndian.Uint32(reader.buf[offset : offset+4]))
+	}
+}
+
+// lookup returns the record for ip, or nil if there is none
+func (reader *mmdbReader) lookup(ip net.IP) (result interface{}, err error) {
+	var address net.IP
+	node := uint(0)
+	if ip4 := ip.To4(); ip4 != nil {
+		address = ip4
+		if reader.ipVersion == 6 {
+			node = reader.ipv4Start
+		}
+	} else if reader.ipVersion == 6 {
+		address = ip.To16()
+	} else {
+		// IPv6 address in an IPv4-only database
+		return nil, nil
+	}
+	if address == nil {
+		return nil, nil
+	}
+
+	for i := 0; i < len(address)*8 && node < reader.nodeCount; i++ {
+		bit := (address[i/8] >> (7 - uint(i%8))) & 1
+		node = reader.readRecord(node, bit)
+	}
+	if node == reader.nodeCount {
+		// no data for this address
+		return nil, nil
+	} else if node < reader.nodeCount {
+		return nil, errInvalidDatabase
+	}
+	offset := node - reader.nodeCount - dataSectionSeparatorSize
+	result, _, err = decode(reader.data, offset, 0)
+	return
+}
+
+// decode decodes the data field at offset, returning its value and the
+// offset of the next field
+func decode(buf []byte, offset uint, depth int) (value interface{}, next uint, err error) {
+	if depth > maxDecodeDepth {
+		return nil, 0, errInvalidDatabase
+	}
+	if offset >= uint(len(buf)) {
+		return nil, 0, errInvalidDatabase
+	}
+	ctrl := buf[offset]
+	offset++
+	fieldType := uint(ctrl >> 5)
+
+	if fieldType == typePointer {
+		pointerSize := uint((ctrl>>3)&0x3) + 1
+		if offset+pointerSize > uint(len(buf)) {
+			return nil, 0, errInvalidDatabase
+		}
+		b := buf[offset : offset+pointerSize]
+		var pointer uint
+		switch pointerSize {
+		case 1:
+			pointer = uint(ctrl&0x7)<<8 | uint(b[0])
+		case 2:
+			pointer = (uint(ctrl&0x7)<<16 | uint(b[0])<<8 | uint(b[1])) + 2048
+		case 3:
+			pointer = (uint(ctrl&0x7)<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])) + 526336
+		case 4:
+			pointer = uint(binary.BigEndian.Uint32(b))
+		}
+		value, _, err = decode(buf, pointer, depth+1)
+		return value, offset + pointerSize, err
+	}
+
+	if fieldType == typeExtended {
+		if offset >= uint(len(buf)) {
+			return nil, 0, errInvalidDatabase
+		}
+		fieldType = 7 + uint(buf[offset])
+		offset++
+	}
+
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		extra := size - 28
+		if offset+extra > uint(len(buf)) {
+			return nil, 0, errInvalidDatabase
+		}
+		b := buf[offset : offset+extra]
+		switch extra {
+		case 1:
+			size = 29 + uint(b[0])
+		case 2:
+			size = 285 + (uint(b[0])<<8 | uint(b[1]))
+		case 3:
+			size = 65821 + (uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]))
+		}
+		offset += extra
+	}
+
+	switch fieldType {
+	case typeMap:
+		result := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			var key, val interface{}
+			key, offset, err = decode(buf, offset, depth+1)
+			if err != nil {
+				return
+			}
+			keyString, ok := key.(string)
+			if !ok {
+				return nil, 0, errInvalidDatabase
+			}
+			val, offset, err = decode(buf, offset, depth+1)
+			if err != nil {
+				return
+			}
+			result[keyString] = val
+		}
+		return result, offset, nil
+	case typeArray:
+		result := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			var val interface{}
+			val, offset, err = decode(buf, offset, depth+1)
+			if err != nil {
+				return
+			}
+			result = append(result, val)
+		}
+		return result, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	case typeContainer, typeEndMarker:
+		return nil, 0, errInvalidDatabase
+	}
+
+	if offset+size > uint(len(buf)) {
+		return nil, 0, errInvalidDatabase
+	}
+	b := buf[offset : offset+size]
+	next = offset + size
+	switch fieldType {
+	case typeString:
+		return string(b), next, nil
+	case typeBytes:
+		return append([]byte(nil), b...), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, errInvalidDatabase
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, errInvalidDatabase
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), next, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, errInvalidDatabase
+		}
+		var result uint64
+		for _, c := range b {
+			result = result<<8 | uint64(c)
+		}
+		return result, next, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, errInvalidDatabase
+		}
+		var result uint32
+		for _, c := range b {
+			result = result<<8 | uint32(c)
+		}
+		return int64(int32(result)), next, nil
+	case typeUint128:
+		// not used by any field we care about
+		return append([]byte(nil), b...), next, nil
+	default:
+		return nil, 0, errInvalidDatabase
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/ergochat/ergo/irc/caps"
+	"github.com/ergochat/ergo/irc/connection_limits"
 	"github.com/ergochat/ergo/irc/languages"
 	"github.com/ergochat/ergo/irc/modes"
 	"github.com/ergochat/ergo/irc/utils"
@@ -39,10 +40,6 @@ func (server *Server) Defcon() uint32 {
 	return atomic.LoadUint32(&server.defcon)
 }
 
-func (server *Server) SetDefcon(defcon uint32) {
-	atomic.StoreUint32(&server.defcon, defcon)
-}
-
 func (client *Client) Sessions() (sessions []*Session) {
 	client.stateMutex.RLock()
 	sessions = client.sessions
@@ -110,8 +107,14 @@ func (client *Client) AddSession(session *Session) (success bool, numSessions in
 	copy(newSessions, client.sessions)
 	newSessions[len(newSessions)-1] = session
 	if client.accountSettings.AutoreplayMissed || session.deviceID != "" {
+		now := time.Now().UTC()
 		lastSeen = client.lastSeen[session.deviceID]
-		client.setLastSeen(time.Now().UTC(), session.deviceID)
+		if window := client.accountSettings.AutoreplayWindow; window != 0 && !lastSeen.IsZero() {
+			if cutoff := now.Add(-window); lastSeen.Before(cutoff) {
+				lastSeen = cutoff
+			}
+		}
+		client.setLastSeen(now, session.deviceID)
 	}
 	client.sessions = newSessions
 	// TODO(#1551) there should be a cap to opt out of this behavior on a session
@@ -196,7 +199,10 @@ func (client *Client) Away() (result bool, message string) {
 	return
 }
 
-func (session *Session) SetAway(awayMessage string) {
+// SetAway sets the away status of a session, returning the resulting away
+// message of the client as a whole (which, with auto-away, aggregates the
+// statuses of all its sessions), and whether that changed
+func (session *Session) SetAway(awayMessage string) (clientAwayMessage string, changed bool) {
 	client := session.client
 	config := client.server.Config()
 
@@ -206,13 +212,14 @@ func (session *Session) SetAway(awayMessage string) {
 	session.awayMessage = awayMessage
 	session.awayAt = time.Now().UTC()
 
+	oldAwayMessage := client.awayMessage
 	autoAway := client.registered && client.alwaysOn && persistenceEnabled(config.Accounts.Multiclient.AutoAway, client.accountSettings.AutoAway)
 	if autoAway {
 		client.setAutoAwayNoMutex(config)
 	} else {
 		client.awayMessage = awayMessage
 	}
-	return
+	return client.awayMessage, client.awayMessage != oldAwayMessage
 }
 
 func (client *Client) setAutoAwayNoMutex(config *Config) {
@@ -238,6 +245,19 @@ func (client *Client) setAutoAwayNoMutex(config *Config) {
 	}
 }
 
+// setManualAwayNoMutex sets the away state without auto-away, where it is
+// whatever the most recent AWAY from any session set it to
+func (client *Client) setManualAwayNoMutex() {
+	var awaySetAt time.Time
+	client.awayMessage = ""
+	for _, cSession := range client.sessions {
+		if cSession.awayAt.After(awaySetAt) {
+			client.awayMessage = cSession.awayMessage
+			awaySetAt = cSession.awayAt
+		}
+	}
+}
+
 func (client *Client) AlwaysOn() (alwaysOn bool) {
 	client.stateMutex.RLock()
 	alwaysOn = client.registered && client.alwaysOn
@@ -361,18 +381,41 @@ func (client *Client) AccountSettings() (result AccountSettings) {
 func (client *Client) SetAccountSettings(settings AccountSettings) {
 	// we mark dirty if the client is transitioning to always-on
 	var becameAlwaysOn bool
-	alwaysOn := persistenceEnabled(client.server.Config().Accounts.Multiclient.AlwaysOn, settings.AlwaysOn)
+	config := client.server.Config()
+	alwaysOn := persistenceEnabled(config.Accounts.Multiclient.AlwaysOn, settings.AlwaysOn)
+	var autoAwayChanged, awayChanged bool
+	var awayMessage string
 	client.stateMutex.Lock()
 	if client.registered {
 		// only allow the client to become always-on if their nick equals their account name
 		alwaysOn = alwaysOn && client.nick == client.accountName
 		becameAlwaysOn = (!client.alwaysOn && alwaysOn)
+		autoAwayBefore := client.alwaysOn && persistenceEnabled(config.Accounts.Multiclient.AutoAway, client.accountSettings.AutoAway)
+		autoAwayAfter := alwaysOn && persistenceEnabled(config.Accounts.Multiclient.AutoAway, settings.AutoAway)
+		autoAwayChanged = autoAwayBefore != autoAwayAfter
 		client.alwaysOn = alwaysOn
+		if autoAwayChanged {
+			// recompute the visible away state from the sessions' individual states
+			oldAwayMessage := client.awayMessage
+			if autoAwayAfter {
+				client.setAutoAwayNoMutex(config)
+			} else {
+				// drop any generated "disconnected" message
+				client.setManualAwayNoMutex()
+			}
+			awayMessage = client.awayMessage
+			awayChanged = awayMessage != oldAwayMessage
+		}
 	}
 	client.accountSettings = settings
 	client.stateMutex.Unlock()
+	if awayChanged {
+		dispatchAwayNotify(client, awayMessage != "", awayMessage)
+	}
 	if becameAlwaysOn {
 		client.markDirty(IncludeAllAttrs)
+	} else if autoAwayChanged {
+		client.markDirty(IncludeAwayMessage)
 	}
 }
 
@@ -546,6 +589,19 @@ func (client *Client) shouldFlushTimestamps() (result bool) {
 	return
 }
 
+// checkCallerIDNotice returns whether the client (who is +g) should be told
+// about a blocked direct message, rate-limiting these notices
+func (client *Client) checkCallerIDNotice() (result bool) {
+	now := time.Now()
+	client.stateMutex.Lock()
+	defer client.stateMutex.Unlock()
+	if callerIDNoticeInterval <= now.Sub(client.lastCallerIDNotice) {
+		client.lastCallerIDNotice = now
+		result = true
+	}
+	return
+}
+
 func (client *Client) setKlined() {
 	client.stateMutex.Lock()
 	client.isKlined = true
@@ -573,6 +629,7 @@ func (channel *Channel) Rename(name, nameCasefolded string) {
 			channel.registeredTime = time.Now().UTC()
 		}
 	}
+	channel.updateListEntryNoMutex()
 	channel.stateMutex.Unlock()
 }
 
@@ -588,6 +645,31 @@ func (channel *Channel) setUserLimit(limit int) {
 	channel.stateMutex.Unlock()
 }
 
+func (channel *Channel) setJoinThrottle(limit int, duration time.Duration) {
+	channel.stateMutex.Lock()
+	defer channel.stateMutex.Unlock()
+	channel.joinThrottle = connection_limits.GenericThrottle{
+		Limit:    limit,
+		Duration: duration,
+	}
+}
+
+// requires holding stateMutex
+func (channel *Channel) joinThrottleString() string {
+	if channel.joinThrottle.Limit == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", channel.joinThrottle.Limit, int(channel.joinThrottle.Duration/time.Second))
+}
+
+// touchJoinThrottle records a join against +j, returning whether it should be rejected
+func (channel *Channel) touchJoinThrottle() (throttled bool) {
+	channel.stateMutex.Lock()
+	defer channel.stateMutex.Unlock()
+	throttled, _ = channel.joinThrottle.Touch()
+	return
+}
+
 func (channel *Channel) setKey(key string) {
 	channel.stateMutex.Lock()
 	defer channel.stateMutex.Unlock()
@@ -27,6 +27,7 @@ import (
 
 	"github.com/ergochat/ergo/irc/caps"
 	"github.com/ergochat/ergo/irc/custime"
+	"github.com/ergochat/ergo/irc/email"
 	"github.com/ergochat/ergo/irc/flatip"
 	"github.com/ergochat/ergo/irc/history"
 	"github.com/ergochat/ergo/irc/jwt"
@@ -69,7 +70,9 @@ func registrationErrorToMessage(config *Config, client *Client, err error) (mess
 	}
 
 	switch err {
-	case errAccountAlreadyRegistered, errAccountAlreadyVerified, errAccountAlreadyUnregistered, errAccountAlreadyLoggedIn, errAccountCreation, errAccountMustHoldNick, errAccountBadPassphrase, errCertfpAlreadyExists, errFeatureDisabled, errAccountBadPassphrase, errNameReserved:
+	case errAccountAlreadyRegistered, errAccountAlreadyVerified, errAccountAlreadyUnregistered, errAccountAlreadyLoggedIn, errAccountCreation, errAccountMustHoldNick, errAccountBadPassphrase, errCertfpAlreadyExists, errFeatureDisabled, errAccountBadPassphrase, errNameReserved, errAccountRegisterTooSoon:
+		message = err.Error()
+	case email.ErrBlacklistedAddress, email.ErrDisallowedDomain:
 		message = err.Error()
 	case errLimitExceeded:
 		message = `There have been too many registration attempts recently; try again later`
@@ -112,16 +115,9 @@ func sendSuccessfulAccountAuth(service *ircService, client *Client, rb *Response
 	}
 
 	if client.Registered() {
-		// dispatch account-notify
-		for friend := range client.FriendsMonitors(caps.AccountNotify) {
-			if friend != rb.session {
-				friend.Send(nil, details.nickMask, "ACCOUNT", details.accountName)
-			}
-		}
-		if rb.session.capabilities.Has(caps.AccountNotify) {
-			rb.Add(nil, details.nickMask, "ACCOUNT", details.accountName)
-		}
+		dispatchAccountNotify(client, details.nickMask, details.accountName, rb)
 		client.server.sendLoginSnomask(details.nickMask, details.accountName)
+		deliverMemos(client, rb)
 	}
 
 	// #1479: for Tor clients, replace the hostname with the always-on cloak here
@@ -138,9 +134,67 @@ func sendSuccessfulAccountAuth(service *ircService, client *Client, rb *Response
 		}
 	}
 
+	applyAccountPreferences(client, rb)
+
 	client.server.logger.Info("accounts", "client", details.nick, "logged into account", details.accountName)
 }
 
+// applyAccountPreferences applies the user modes and languages stored in the
+// account settings (NS SET USER-MODES and NS SET LANGUAGE) after a login
+func applyAccountPreferences(client *Client, rb *ResponseBuffer) {
+	settings := client.AccountSettings()
+
+	if len(settings.Languages) != 0 {
+		lm := client.server.Languages()
+		var languages []string
+		for _, language := range settings.Languages {
+			// the server may no longer support a stored language
+			if _, exists := lm.Languages[language]; exists {
+				languages = append(languages, language)
+			}
+		}
+		if len(languages) != 0 {
+			client.SetLanguages(languages)
+		}
+	}
+
+	if settings.UserModes == "" {
+		return
+	}
+	if !client.Registered() {
+		// as with the default user modes, these will be counted in LUSERS
+		// when the client registers:
+		for _, mode := range settings.UserModes {
+			client.SetMode(modes.Mode(mode), true)
+		}
+		return
+	}
+	changes := make(modes.ModeChanges, 0, len(settings.UserModes))
+	for _, mode := range settings.UserModes {
+		changes = append(changes, modes.ModeChange{Mode: modes.Mode(mode), Op: modes.Add})
+	}
+	applied := ApplyUserModeChanges(client, changes, false, nil)
+	if len(applied) != 0 {
+		details := client.Details()
+		args := append([]string{details.nick}, applied.Strings()...)
+		rb.Add(nil, details.nickMask, "MODE", args...)
+	}
+}
+
+// dispatchAccountNotify sends ACCOUNT to everyone who can see the client,
+// with `accountName` being "*" for a logout
+func dispatchAccountNotify(client *Client, nickMask, accountName string, rb *ResponseBuffer) {
+	isBot := client.HasMode(modes.Bot)
+	for friend := range client.FriendsMonitors(caps.AccountNotify) {
+		if friend != rb.session {
+			friend.sendFromClientInternal(false, time.Time{}, "", nickMask, accountName, isBot, nil, "ACCOUNT", accountName)
+		}
+	}
+	if rb.session.capabilities.Has(caps.AccountNotify) {
+		rb.AddFromClient(time.Time{}, "", nickMask, accountName, isBot, nil, "ACCOUNT", accountName)
+	}
+}
+
 func (server *Server) sendLoginSnomask(nickMask, accountName string) {
 	server.snomasks.Send(sno.LocalAccounts, fmt.Sprintf(ircfmt.Unescape("Client $c[grey][$r%s$c[grey]] logged into account $c[grey][$r%s$c[grey]]"), nickMask, accountName))
 }
@@ -306,7 +360,7 @@ func authPlainHandler(server *Server, client *Client, session *Session, value []
 		}
 	}
 	password := string(splitValue[2])
-	err := server.accounts.AuthenticateByPassphrase(client, authcid, password)
+	err := server.accounts.AuthenticateByPassphrase(client, authcid, password, rb.session.certfp)
 	if err != nil {
 		sendAuthErrorResponse(client, rb, err)
 		return false
@@ -444,6 +498,48 @@ func authScramHandler(server *Server, client *Client, session *Session, value []
 	return false
 }
 
+// AUDIT [count] [search]
+func auditHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
+	const (
+		defaultCount = 20
+		maxCount     = 1000
+	)
+	count := defaultCount
+	params := msg.Params
+	if 0 < len(params) {
+		if parsed, err := strconv.Atoi(params[0]); err == nil {
+			if parsed <= 0 {
+				rb.Add(nil, server.name, "FAIL", "AUDIT", "INVALID_PARAMS", client.t("Invalid count"))
+				return false
+			}
+			if maxCount < parsed {
+				parsed = maxCount
+			}
+			count = parsed
+			params = params[1:]
+		}
+	}
+	search := strings.Join(params, " ")
+
+	entries, err := server.audit.Query(count, search)
+	if err == errFeatureDisabled {
+		rb.Add(nil, server.name, "FAIL", "AUDIT", "UNAVAILABLE", client.t("The audit log is disabled"))
+		return false
+	} else if err != nil {
+		server.logger.Error("internal", "couldn't read audit log", err.Error())
+		rb.Add(nil, server.name, "FAIL", "AUDIT", "UNKNOWN_ERROR", client.t("Couldn't read the audit log"))
+		return false
+	}
+
+	if len(entries) == 0 {
+		rb.Notice(client.t("No matching audit log entries"))
+	}
+	for _, entry := range entries {
+		rb.Notice(entry.String())
+	}
+	return false
+}
+
 // AWAY [<message>]
 func awayHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
 	var isAway bool
@@ -454,7 +550,7 @@ func awayHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respons
 		awayMessage = ircutils.TruncateUTF8Safe(awayMessage, server.Config().Limits.AwayLen)
 	}
 
-	rb.session.SetAway(awayMessage)
+	clientAwayMessage, changed := rb.session.SetAway(awayMessage)
 
 	if isAway {
 		rb.Add(nil, server.name, RPL_NOWAWAY, client.nick, client.t("You have been marked as being away"))
@@ -462,7 +558,12 @@ func awayHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respons
 		rb.Add(nil, server.name, RPL_UNAWAY, client.nick, client.t("You are no longer marked as being away"))
 	}
 
-	dispatchAwayNotify(client, isAway, awayMessage)
+	// with auto-away, other sessions may keep the client as a whole
+	// from becoming away (or back), in which case there's nothing to notify:
+	if changed {
+		dispatchAwayNotify(client, clientAwayMessage != "", clientAwayMessage)
+		client.markDirty(IncludeAwayMessage)
+	}
 	return false
 }
 
@@ -490,7 +591,7 @@ func batchHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respon
 		if len(msg.Params) < 3 || msg.Params[1] != caps.MultilineBatchType {
 			fail = true
 		} else {
-			err := rb.session.StartMultilineBatch(tag[1:], msg.Params[2], rb.Label, msg.ClientOnlyTags())
+			err := rb.session.StartMultilineBatch(tag[1:], msg.Params[2], rb.Label, server.Config().filterClientOnlyTags(msg.ClientOnlyTags()))
 			fail = (err != nil)
 			if !fail {
 				// suppress ACK for the initial BATCH message (we'll apply the stored label later)
@@ -591,7 +692,7 @@ func capHandler(server *Server, client *Client, msg ircmsg.Message, rb *Response
 				rb.session.capVersion = newVersion
 			}
 		}
-		sendCapLines(supportedCaps, config.Server.capValues)
+		sendCapLines(supportedCaps, config.capValuesFor(rb.session))
 
 	case "LIST":
 		// values not sent on LIST
@@ -640,10 +741,13 @@ func chathistoryHandler(server *Server, client *Client, msg ircmsg.Message, rb *
 	var sequence history.Sequence
 	var err error
 	var listTargets bool
+	var unknownCommand bool
 	var targets []history.TargetListing
 	defer func() {
 		// errors are sent either without a batch, or in a draft/labeled-response batch as usual
-		if err == utils.ErrInvalidParams {
+		if unknownCommand {
+			rb.Add(nil, server.name, "FAIL", "CHATHISTORY", "UNKNOWN_COMMAND", utils.SafeErrorParam(msg.Params[0]), client.t("Unknown command"))
+		} else if err == utils.ErrInvalidParams {
 			rb.Add(nil, server.name, "FAIL", "CHATHISTORY", "INVALID_PARAMS", msg.Params[0], client.t("Invalid parameters"))
 		} else if !listTargets && sequence == nil {
 			rb.Add(nil, server.name, "FAIL", "CHATHISTORY", "INVALID_TARGET", msg.Params[0], utils.SafeErrorParam(target), client.t("Messages could not be retrieved"))
@@ -703,7 +807,7 @@ func chathistoryHandler(server *Server, client *Client, msg ircmsg.Message, rb *
 			return maxChathistoryLimit
 		}
 		limit, err := strconv.Atoi(msg.Params[paramIndex])
-		if err != nil || limit == 0 || limit > maxChathistoryLimit {
+		if err != nil || limit <= 0 || limit > maxChathistoryLimit {
 			limit = maxChathistoryLimit
 		}
 		return
@@ -767,7 +871,7 @@ func chathistoryHandler(server *Server, client *Client, msg ircmsg.Message, rb *
 		}
 		limit = parseHistoryLimit(3)
 	default:
-		err = utils.ErrInvalidParams
+		unknownCommand = true
 		return
 	}
 
@@ -864,9 +968,17 @@ func debugHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respon
 func defconHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
 	if len(msg.Params) > 0 {
 		level, err := strconv.Atoi(msg.Params[0])
-		if err == nil && 1 <= level && level <= 5 {
-			server.SetDefcon(uint32(level))
-			server.snomasks.Send(sno.LocalAnnouncements, fmt.Sprintf("%s [%s] set DEFCON level to %d", client.Nick(), client.Oper().Name, level))
+		var duration time.Duration
+		if err == nil && len(msg.Params) > 1 {
+			duration, err = custime.ParseDuration(msg.Params[1])
+		}
+		if err == nil && 1 <= level && level <= 5 && 0 <= duration {
+			server.SetDefcon(uint32(level), duration)
+			if duration != 0 && level != 5 {
+				server.snomasks.Send(sno.LocalAnnouncements, fmt.Sprintf("%s [%s] set DEFCON level to %d for %v", client.Nick(), client.Oper().Name, level, duration))
+			} else {
+				server.snomasks.Send(sno.LocalAnnouncements, fmt.Sprintf("%s [%s] set DEFCON level to %d", client.Nick(), client.Oper().Name, level))
+			}
 		} else {
 			rb.Add(nil, server.name, ERR_UNKNOWNERROR, client.Nick(), msg.Command, client.t("Invalid DEFCON parameter"))
 			return false
@@ -929,7 +1041,7 @@ func dlineHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respon
 		}
 
 		for key, info := range bans {
-			client.Notice(formatBanForListing(client, key, info))
+			rb.Notice(formatBanForListing(client, key, info))
 		}
 
 		return false
@@ -1055,11 +1167,16 @@ func extjwtHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respo
 		accountName = ""
 	}
 
+	uModes := []string{}
+	for _, uMode := range client.modes.AllModes() {
+		uModes = append(uModes, string(uMode))
+	}
+
 	claims := jwt.MapClaims{
 		"iss":     server.name,
 		"sub":     client.Nick(),
 		"account": accountName,
-		"umodes":  []string{},
+		"umodes":  uModes,
 	}
 
 	if msg.Params[0] != "*" {
@@ -1310,6 +1427,11 @@ func joinHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respons
 
 func sendJoinError(client *Client, name string, rb *ResponseBuffer, err error) {
 	var code, errMsg, forbiddingMode string
+	if qlined, ok := err.(*QLineError); ok {
+		errMsg = qlined.Info.BanMessage(client.t("Cannot join channel: the name is forbidden (%s)"))
+		rb.Add(nil, client.server.name, ERR_NOSUCHCHANNEL, client.Nick(), utils.SafeErrorParam(name), errMsg)
+		return
+	}
 	switch err {
 	case errInsufficientPrivs:
 		code, errMsg = ERR_NOSUCHCHANNEL, `Only server operators can create new channels`
@@ -1321,6 +1443,8 @@ func sendJoinError(client *Client, name string, rb *ResponseBuffer, err error) {
 		code, errMsg = ERR_TOOMANYCHANNELS, `You have joined too many channels`
 	case errLimitExceeded:
 		code, forbiddingMode = ERR_CHANNELISFULL, "l"
+	case errJoinThrottled:
+		code, forbiddingMode = ERR_CHANNELISFULL, "j"
 	case errWrongChannelKey:
 		code, forbiddingMode = ERR_BADCHANNELKEY, "k"
 	case errInviteOnly:
@@ -1328,7 +1452,11 @@ func sendJoinError(client *Client, name string, rb *ResponseBuffer, err error) {
 	case errBanned:
 		code, forbiddingMode = ERR_BANNEDFROMCHAN, "b"
 	case errRegisteredOnly:
+		code, errMsg = ERR_NEEDREGGEDNICK, `Cannot join channel (+R) - you must be logged into an account`
+	case errRegisteredOnlyDefcon:
 		code, errMsg = ERR_NEEDREGGEDNICK, `You must be registered to join that channel`
+	case errSecureOnly:
+		code, errMsg = ERR_SECUREONLYCHAN, `Cannot join channel (+z) - you must be connected via TLS`
 	default:
 		code, errMsg = ERR_NOSUCHCHANNEL, `No such channel`
 	}
@@ -1375,6 +1503,49 @@ func sajoinHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respo
 	return false
 }
 
+// SAPART <nick> #channel{,#channel} [reason]
+func sapartHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
+	target := server.clients.Get(msg.Params[0])
+	if target == nil {
+		rb.Add(nil, server.name, ERR_NOSUCHNICK, client.Nick(), utils.SafeErrorParam(msg.Params[0]), client.t("No such nick"))
+		return false
+	}
+	var reason string
+	if len(msg.Params) > 2 {
+		reason = msg.Params[2]
+	}
+
+	message := fmt.Sprintf("Operator %s ran SAPART %s", client.Oper().Name, strings.Join(msg.Params, " "))
+	server.snomasks.Send(sno.LocalOpers, message)
+	server.logger.Info("opers", message)
+
+	// the target's own copy of the PART goes to one of its sessions, not to the operator
+	targetRb := rb
+	if target != client {
+		if sessions := target.Sessions(); len(sessions) != 0 {
+			targetRb = NewResponseBuffer(sessions[0])
+			defer targetRb.Send(true)
+		} else {
+			// an always-on client with no sessions: there is nothing to send the PART to
+			targetRb = NewResponseBuffer(&Session{client: target})
+		}
+	}
+
+	for _, chname := range strings.Split(msg.Params[1], ",") {
+		channel := server.channels.Get(chname)
+		if channel == nil {
+			rb.Add(nil, server.name, ERR_NOSUCHCHANNEL, client.Nick(), utils.SafeErrorParam(chname), client.t("No such channel"))
+			continue
+		}
+		if !channel.hasClient(target) {
+			rb.Add(nil, server.name, ERR_USERNOTINCHANNEL, client.Nick(), target.Nick(), channel.Name(), client.t("They aren't on that channel"))
+			continue
+		}
+		channel.Part(target, reason, targetRb)
+	}
+	return false
+}
+
 // KICK <channel>{,<channel>} <user>{,<user>} [<comment>]
 // RFC 2812 requires the number of channels to be either 1 or equal to
 // the number of users.
@@ -1485,11 +1656,11 @@ func klineHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respon
 		bans := server.klines.AllBans()
 
 		if len(bans) == 0 {
-			client.Notice("No KLINEs have been set!")
+			rb.Notice(client.t("No KLINEs have been set!"))
 		}
 
 		for key, info := range bans {
-			client.Notice(formatBanForListing(client, key, info))
+			rb.Notice(formatBanForListing(client, key, info))
 		}
 
 		return false
@@ -1644,6 +1815,7 @@ func languageHandler(server *Server, client *Client, msg ircmsg.Message, rb *Res
 		if exists {
 			continue
 		}
+		alreadyDoneLanguages[value] = true
 
 		appliedLanguages = append(appliedLanguages, value)
 	}
@@ -1664,6 +1836,9 @@ func languageHandler(server *Server, client *Client, msg ircmsg.Message, rb *Res
 	return false
 }
 
+// how many RPL_LIST lines to send at a time
+const listChunkSize = 100
+
 // LIST [<channel>{,<channel>}] [<elistcond>{,<elistcond>}]
 func listHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
 	config := server.Config()
@@ -1674,59 +1849,47 @@ func listHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respons
 		return false
 	}
 
-	// get channels
+	// get channels and elist conditions
 	var channels []string
-	for _, param := range msg.Params {
-		if 0 < len(param) && param[0] == '#' {
-			for _, channame := range strings.Split(param, ",") {
-				if 0 < len(channame) && channame[0] == '#' {
-					channels = append(channels, channame)
-				}
-			}
-		}
-	}
-
-	// get elist conditions
 	var matcher elistMatcher
+	now := time.Now().UTC()
 	for _, param := range msg.Params {
-		if len(param) < 1 {
-			continue
-		}
-
-		if param[0] == '<' {
-			param = param[1:]
-			val, err := strconv.Atoi(param)
-			if err != nil {
+		for _, token := range strings.Split(param, ",") {
+			if matcher.AddCondition(token, now) {
 				continue
 			}
-			matcher.MaxClientsActive = true
-			matcher.MaxClients = val - 1 // -1 because < means less than the given number
-		}
-		if param[0] == '>' {
-			param = param[1:]
-			val, err := strconv.Atoi(param)
-			if err != nil {
-				continue
+			if 0 < len(token) && token[0] == '#' {
+				channels = append(channels, token)
 			}
-			matcher.MinClientsActive = true
-			matcher.MinClients = val + 1 // +1 because > means more than the given number
 		}
 	}
 
 	nick := client.Nick()
-	rplList := func(channel *Channel) {
-		members, name, topic := channel.listData()
-		rb.Add(nil, client.server.name, RPL_LIST, nick, name, strconv.Itoa(members), topic)
+	// SAFELIST: instead of buffering the entire list, send it in chunks, blocking
+	// until each one is written; a slow reader only delays its own LIST, which
+	// resumes from its snapshot of the channel list once the socket drains
+	pending := 0
+	var sendErr error
+	rplList := func(entry *channelListEntry) {
+		rb.Add(nil, client.server.name, RPL_LIST, nick, entry.name, strconv.Itoa(entry.memberCount), entry.topic)
+		pending++
+		if pending == listChunkSize {
+			pending = 0
+			sendErr = rb.Flush(true)
+		}
 	}
 
 	clientIsOp := client.HasRoleCapabs("sajoin")
 	if len(channels) == 0 {
 		for _, channel := range server.channels.Channels() {
+			if sendErr != nil {
+				return false
+			}
 			if !clientIsOp && channel.flags.HasMode(modes.Secret) && !channel.hasClient(client) {
 				continue
 			}
-			if matcher.Matches(channel) {
-				rplList(channel)
+			if entry := channel.getListEntry(); matcher.Matches(entry) {
+				rplList(entry)
 			}
 		}
 	} else {
@@ -1740,8 +1903,8 @@ func listHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respons
 			if channel == nil || (!clientIsOp && channel.flags.HasMode(modes.Secret) && !channel.hasClient(client)) {
 				continue
 			}
-			if matcher.Matches(channel) {
-				rplList(channel)
+			if entry := channel.getListEntry(); matcher.Matches(entry) {
+				rplList(entry)
 			}
 		}
 	}
@@ -1805,6 +1968,16 @@ func cmodeHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respon
 }
 
 func announceCmodeChanges(channel *Channel, applied modes.ModeChanges, source, accountName, account string, isBot bool, rb *ResponseBuffer) {
+	// canonicalized masks can be much longer than what the client sent,
+	// so split the changes over multiple lines if they won't fit in one:
+	// :<source> MODE <channel> <changes>\r\n
+	maxLen := MaxLineLen - len(source) - len(channel.Name()) - len(": MODE  \r\n")
+	for _, chunk := range applied.Split(maxLen) {
+		announceCmodeChangesInternal(channel, chunk, source, accountName, account, isBot, rb)
+	}
+}
+
+func announceCmodeChangesInternal(channel *Channel, applied modes.ModeChanges, source, accountName, account string, isBot bool, rb *ResponseBuffer) {
 	// send out changes
 	if len(applied) > 0 {
 		message := utils.MakeMessage("")
@@ -1881,6 +2054,12 @@ func umodeHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respon
 	if len(applied) > 0 {
 		args := append([]string{targetNick}, applied.Strings()...)
 		rb.Add(nil, cDetails.nickMask, "MODE", args...)
+		// keep the target's other sessions (or all of them, for SAMODE) in sync
+		for _, session := range target.Sessions() {
+			if session != rb.session {
+				session.Send(nil, cDetails.nickMask, "MODE", args...)
+			}
+		}
 	} else if hasPrivs {
 		rb.Add(nil, server.name, RPL_UMODEIS, targetNick, target.ModeString())
 		if target.HasMode(modes.Operator) {
@@ -2189,7 +2368,7 @@ func messageHandler(server *Server, client *Client, msg ircmsg.Message, rb *Resp
 		return false
 	}
 
-	clientOnlyTags := msg.ClientOnlyTags()
+	clientOnlyTags := server.Config().filterClientOnlyTags(msg.ClientOnlyTags())
 	if histType == history.Tagmsg && len(clientOnlyTags) == 0 {
 		// nothing to do
 		return false
@@ -2320,10 +2499,33 @@ func dispatchMessageToTarget(client *Client, tags map[string]string, histType hi
 		}
 		// restrict messages appropriately when +R is set
 		if details.account == "" && user.HasMode(modes.RegisteredOnly) && !server.accepts.MaySendTo(client, user) {
-			rb.Add(nil, server.name, ERR_NEEDREGGEDNICK, client.Nick(), tnick, client.t("You must be registered to send a direct message to this user"))
+			// as with +g, don't send errors for NOTICE or TAGMSG
+			if histType == history.Privmsg {
+				rb.Add(nil, server.name, "FAIL", command, "NEED_REGISTRATION", tnick, client.t("You must be logged into an account to send a direct message to this user"))
+			}
+			return
+		}
+		// caller-ID: when +g is set, only clients on the accept list may send DMs
+		if user.HasMode(modes.CallerID) && client != user && !server.accepts.MaySendTo(client, user) {
+			// don't send errors for NOTICE or TAGMSG (e.g., typing notifications)
+			if histType == history.Privmsg {
+				rb.Add(nil, server.name, ERR_TARGUMODEG, client.Nick(), tnick, client.t("is in +g mode (server-side ignore)"))
+				if user.checkCallerIDNotice() {
+					rb.Add(nil, server.name, RPL_TARGNOTIFY, client.Nick(), tnick, client.t("has been informed that you messaged them"))
+					user.Send(nil, server.name, RPL_UMODEGMSG, tnick, details.nick, fmt.Sprintf("%s@%s", details.username, details.hostname), user.t("is messaging you, and you have user mode +g set. Use /ACCEPT to allow them to message you"))
+				}
+			}
 			return
 		}
-		if client.HasMode(modes.RegisteredOnly) && tDetails.account == "" {
+		// NS SET ALLOW-PRIVATE-MESSAGES off: only opers and accepted clients may send DMs
+		if client != user && user.AccountSettings().BlockPrivateMessages && !client.HasMode(modes.Operator) && !server.accepts.MaySendTo(client, user) {
+			if histType == history.Privmsg {
+				rb.Add(nil, server.name, "FAIL", command, "DM_REFUSED", tnick, client.t("This user does not accept direct messages"))
+			}
+			return
+		}
+		if client.HasMode(modes.CallerID) || (client.HasMode(modes.RegisteredOnly) && tDetails.account == "") ||
+			client.AccountSettings().BlockPrivateMessages {
 			// #1688: auto-ACCEPT on DM
 			server.accepts.Accept(client, user)
 		}
@@ -2404,6 +2606,8 @@ func itemIsStorable(item *history.Item, config *Config) bool {
 	case history.Privmsg, history.Notice:
 		// don't store CTCP other than ACTION
 		return !item.Message.IsRestrictedCTCPMessage()
+	case history.Join, history.Part, history.Kick, history.Quit, history.Mode, history.Nick, history.Topic:
+		return config.History.storeEvents
 	default:
 		return true
 	}
@@ -2462,6 +2666,8 @@ func operHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respons
 	}
 
 	if !checkPassed || checkFailed {
+		server.snomasks.Send(sno.LocalOpers, fmt.Sprintf(ircfmt.Unescape("Client failed to oper up $c[grey][$r%s$c[grey], $r%s$c[grey]]"), client.NickMaskString(), msg.Params[0]))
+		server.logger.Info("opers", "Client failed to oper up", client.NickMaskString(), msg.Params[0])
 		rb.Add(nil, server.name, ERR_PASSWDMISMATCH, client.Nick(), client.t("Password incorrect"))
 		// #951: only disconnect them if we actually tried to check a password for them
 		if passwordFailed {
@@ -2473,6 +2679,11 @@ func operHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respons
 	}
 
 	if oper != nil {
+		if server.operRequiresTOTP(oper) {
+			rb.session.pendingOper = &pendingOper{oper: oper, started: time.Now()}
+			rb.Notice(client.t("This operator block requires a TOTP code; send it with TOTP VERIFY <code>"))
+			return false
+		}
 		applyOper(client, oper, rb)
 	}
 	return false
@@ -2569,7 +2780,7 @@ func passHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respons
 			if strudelIndex := strings.IndexByte(account, '@'); strudelIndex != -1 {
 				account, rb.session.deviceID = account[:strudelIndex], account[strudelIndex+1:]
 			}
-			err := server.accounts.AuthenticateByPassphrase(client, account, accountPass)
+			err := server.accounts.AuthenticateByPassphrase(client, account, accountPass, rb.session.certfp)
 			if err == nil {
 				sendSuccessfulAccountAuth(nil, client, rb, true)
 				// login-via-pass-command entails that we do not need to check
@@ -2696,6 +2907,12 @@ func registerHandler(server *Server, client *Client, msg ircmsg.Message, rb *Res
 		rb.Add(nil, server.name, "FAIL", "REGISTER", "USERNAME_EXISTS", accountName, client.t("Username is already registered or otherwise unavailable"))
 	case errAccountBadPassphrase:
 		rb.Add(nil, server.name, "FAIL", "REGISTER", "INVALID_PASSWORD", accountName, client.t("Password was invalid"))
+	case email.ErrBlacklistedAddress, email.ErrDisallowedDomain:
+		rb.Add(nil, server.name, "FAIL", "REGISTER", "UNACCEPTABLE_EMAIL", accountName, client.t(err.Error()))
+	case errAccountRegisterTooSoon:
+		rb.Add(nil, server.name, "FAIL", "REGISTER", "TEMPORARILY_UNAVAILABLE", accountName, client.t(err.Error()))
+	case errLimitExceeded:
+		rb.Add(nil, server.name, "FAIL", "REGISTER", "TEMPORARILY_UNAVAILABLE", accountName, client.t("There have been too many registration attempts recently; try again later"))
 	default:
 		if emailError := registrationCallbackErrorText(config, client, err); emailError != "" {
 			rb.Add(nil, server.name, "FAIL", "REGISTER", "UNACCEPTABLE_EMAIL", accountName, emailError)
@@ -2797,12 +3014,12 @@ func rehashHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respo
 	nick := client.Nick()
 	server.logger.Info("server", "REHASH command used by", nick)
 	err := server.rehash()
+	server.notifyRehash(nick, err)
 
 	if err == nil {
 		// we used to send RPL_REHASHING here but i don't think it really makes sense
 		// in the labeled-response world, since the intent is "rehash in progress" but
 		// it won't display until the rehash is actually complete
-		// TODO all operators should get a notice of some kind here
 		rb.Notice(client.t("Rehash complete"))
 	} else {
 		rb.Add(nil, server.name, ERR_UNKNOWNERROR, nick, "REHASH", err.Error())
@@ -2867,18 +3084,12 @@ func relaymsgHandler(server *Server, client *Client, msg ircmsg.Message, rb *Res
 	}
 	nuh := fmt.Sprintf("%s!%s@%s", nick, ident, hostname)
 
-	channel.AddHistoryItem(history.Item{
-		Type:    history.Privmsg,
-		Message: message,
-		Nick:    nuh,
-	}, "")
-
 	// 3 possibilities for tags:
 	// no tags, the relaymsg tag only, or the relaymsg tag together with all client-only tags
 	relayTag := map[string]string{
 		caps.RelaymsgTagName: details.nick,
 	}
-	clientOnlyTags := msg.ClientOnlyTags()
+	clientOnlyTags := server.Config().filterClientOnlyTags(msg.ClientOnlyTags())
 	var fullTags map[string]string
 	if len(clientOnlyTags) == 0 {
 		fullTags = relayTag
@@ -2890,6 +3101,15 @@ func relaymsgHandler(server *Server, client *Client, msg ircmsg.Message, rb *Res
 		}
 	}
 
+	// store the tags as well, so that history playback still identifies the relayer
+	channel.AddHistoryItem(history.Item{
+		Type:        history.Privmsg,
+		Message:     message,
+		Nick:        nuh,
+		AccountName: "*",
+		Tags:        fullTags,
+	}, "")
+
 	// actually send the message
 	channelName := channel.Name()
 	for _, member := range channel.Members() {
@@ -2911,6 +3131,113 @@ func relaymsgHandler(server *Server, client *Client, msg ircmsg.Message, rb *Res
 	return false
 }
 
+// QLINE [duration] <mask> [reason [| oper reason]]
+// QLINE LIST
+func qlineHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
+	details := client.Details()
+	oper := client.Oper()
+	if !oper.HasRoleCapab("ban") {
+		rb.Add(nil, server.name, ERR_NOPRIVS, details.nick, msg.Command, client.t("Insufficient oper privs"))
+		return false
+	}
+
+	currentArg := 0
+
+	// if they say LIST, we just list the current qlines
+	if len(msg.Params) == currentArg+1 && strings.ToLower(msg.Params[currentArg]) == "list" {
+		configured := server.Config().Server.qLines
+		bans := server.qlines.AllBans()
+
+		if len(bans) == 0 && len(configured) == 0 {
+			rb.Notice(client.t("No QLINEs have been set!"))
+		}
+
+		for _, qline := range configured {
+			rb.Notice(fmt.Sprintf(client.t("Q-Line - %[1]s - set in the config file - %[2]s"), qline.Mask, qline.Info.Reason))
+		}
+		for key, info := range bans {
+			rb.Notice(formatBanForListing(client, key, info))
+		}
+
+		return false
+	}
+
+	// duration
+	duration, err := custime.ParseDuration(msg.Params[currentArg])
+	if err != nil {
+		duration = 0
+	} else {
+		currentArg++
+	}
+
+	// get mask
+	if len(msg.Params) < currentArg+1 {
+		rb.Add(nil, server.name, ERR_NEEDMOREPARAMS, details.nick, msg.Command, client.t("Not enough parameters"))
+		return false
+	}
+	mask, err := CanonicalizeQLineMask(msg.Params[currentArg])
+	if err != nil {
+		rb.Add(nil, server.name, ERR_UNKNOWNERROR, details.nick, msg.Command, client.t("Erroneous nickname or channel name"))
+		return false
+	}
+	currentArg++
+
+	if _, err := utils.CompileGlob(mask, false); err != nil {
+		rb.Add(nil, server.name, ERR_UNKNOWNERROR, details.nick, msg.Command, client.t("Erroneous nickname or channel name"))
+		return false
+	}
+
+	operName := oper.Name
+	if operName == "" {
+		operName = server.name
+	}
+
+	reason, operReason := getReasonsFromParams(msg.Params, currentArg)
+
+	err = server.qlines.AddMask(mask, duration, reason, operReason, operName)
+	if err != nil {
+		rb.Notice(fmt.Sprintf(client.t("Could not successfully save new Q-LINE: %s"), err.Error()))
+		return false
+	}
+
+	var snoDescription string
+	if duration != 0 {
+		rb.Notice(fmt.Sprintf(client.t("Added temporary (%[1]s) Q-Line for %[2]s"), duration.String(), mask))
+		snoDescription = fmt.Sprintf(ircfmt.Unescape("%s [%s]$r added temporary (%s) Q-Line for %s"), details.nick, operName, duration.String(), mask)
+	} else {
+		rb.Notice(fmt.Sprintf(client.t("Added Q-Line for %s"), mask))
+		snoDescription = fmt.Sprintf(ircfmt.Unescape("%s [%s]$r added Q-Line for %s"), details.nick, operName, mask)
+	}
+	server.snomasks.Send(sno.LocalXline, snoDescription)
+	return false
+}
+
+// UNQLINE <mask>
+func unQLineHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
+	details := client.Details()
+	oper := client.Oper()
+	if !oper.HasRoleCapab("ban") {
+		rb.Add(nil, server.name, ERR_NOPRIVS, details.nick, msg.Command, client.t("Insufficient oper privs"))
+		return false
+	}
+
+	mask, err := CanonicalizeQLineMask(msg.Params[0])
+	if err != nil {
+		rb.Add(nil, server.name, ERR_UNKNOWNERROR, details.nick, msg.Command, client.t("Erroneous nickname or channel name"))
+		return false
+	}
+
+	err = server.qlines.RemoveMask(mask)
+	if err != nil {
+		rb.Add(nil, server.name, ERR_UNKNOWNERROR, details.nick, msg.Command, fmt.Sprintf(client.t("Could not remove Q-Line [%s]"), err.Error()))
+		return false
+	}
+
+	rb.Notice(fmt.Sprintf(client.t("Removed Q-Line for %s"), mask))
+	server.snomasks.Send(sno.LocalXline, fmt.Sprintf(ircfmt.Unescape("%s$r removed Q-Line for %s"), details.nick, mask))
+	return false
+}
+
 // RENAME <oldchan> <newchan> [<reason>]
 func renameHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
 	oldName, newName := msg.Params[0], msg.Params[1]
@@ -2937,11 +3264,13 @@ func renameHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respo
 		return false
 	}
 
-	config := server.Config()
-	status, _, _ := channel.historyStatus(config)
-	if status == HistoryPersistent {
-		rb.Add(nil, server.name, "FAIL", "RENAME", "CANNOT_RENAME", oldName, utils.SafeErrorParam(newName), client.t("Channels with persistent history cannot be renamed"))
-		return false
+	if !client.HasRoleCapabs("ban") {
+		if cfNewName, err := CasefoldChannel(newName); err == nil {
+			if isForbidden, info := server.qlines.CheckChannel(cfNewName); isForbidden {
+				rb.Add(nil, server.name, "FAIL", "RENAME", "CANNOT_RENAME", oldName, utils.SafeErrorParam(newName), info.BanMessage(client.t("Channel name is forbidden (%s)")))
+				return false
+			}
+		}
 	}
 
 	// perform the channel rename
@@ -2957,33 +3286,46 @@ func renameHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respo
 		return false
 	}
 
+	// move persistent history to the new name (in-memory history moves with the channel)
+	if status, cfNewName, _ := channel.historyStatus(server.Config()); status == HistoryPersistent {
+		if cfOldName, err := CasefoldChannel(oldName); err == nil {
+			server.historyDB.RenameTarget(cfOldName, cfNewName)
+		}
+	}
+
 	// send RENAME messages
 	clientPrefix := client.NickMaskString()
+	clientAccount := client.AccountName()
+	clientIsBot := client.HasMode(modes.Bot)
 	for _, mcl := range channel.Members() {
+		// always-on clients persist their channels by name; rewrite them
+		// so the client rejoins under the new name after a restart
+		mcl.markDirty(IncludeChannels)
 		mDetails := mcl.Details()
+		mIsBot := mcl.HasMode(modes.Bot)
 		for _, mSession := range mcl.Sessions() {
 			targetRb := rb
-			targetPrefix := clientPrefix
+			targetPrefix, targetAccount, targetIsBot := clientPrefix, clientAccount, clientIsBot
 			if mSession != rb.session {
 				targetRb = NewResponseBuffer(mSession)
-				targetPrefix = mDetails.nickMask
+				targetPrefix, targetAccount, targetIsBot = mDetails.nickMask, mDetails.accountName, mIsBot
 			}
 			if mSession.capabilities.Has(caps.ChannelRename) {
 				if reason != "" {
-					targetRb.Add(nil, clientPrefix, "RENAME", oldName, newName, reason)
+					targetRb.AddFromClient(time.Time{}, "", clientPrefix, clientAccount, clientIsBot, nil, "RENAME", oldName, newName, reason)
 				} else {
-					targetRb.Add(nil, clientPrefix, "RENAME", oldName, newName)
+					targetRb.AddFromClient(time.Time{}, "", clientPrefix, clientAccount, clientIsBot, nil, "RENAME", oldName, newName)
 				}
 			} else {
 				if reason != "" {
-					targetRb.Add(nil, targetPrefix, "PART", oldName, fmt.Sprintf(mcl.t("Channel renamed: %s"), reason))
+					targetRb.AddFromClient(time.Time{}, "", targetPrefix, targetAccount, targetIsBot, nil, "PART", oldName, fmt.Sprintf(mcl.t("Channel renamed: %s"), reason))
 				} else {
-					targetRb.Add(nil, targetPrefix, "PART", oldName, mcl.t("Channel renamed"))
+					targetRb.AddFromClient(time.Time{}, "", targetPrefix, targetAccount, targetIsBot, nil, "PART", oldName, mcl.t("Channel renamed"))
 				}
 				if mSession.capabilities.Has(caps.ExtendedJoin) {
-					targetRb.Add(nil, targetPrefix, "JOIN", newName, mDetails.accountName, mDetails.realname)
+					targetRb.AddFromClient(time.Time{}, "", targetPrefix, targetAccount, targetIsBot, nil, "JOIN", newName, mDetails.accountName, mDetails.realname)
 				} else {
-					targetRb.Add(nil, targetPrefix, "JOIN", newName)
+					targetRb.AddFromClient(time.Time{}, "", targetPrefix, targetAccount, targetIsBot, nil, "JOIN", newName)
 				}
 				channel.SendTopic(mcl, targetRb, false)
 				channel.Names(mcl, targetRb)
@@ -2997,6 +3339,30 @@ func renameHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respo
 	return false
 }
 
+// CHGHOST <nickname> <hostname>
+func chghostHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
+	target := server.clients.Get(msg.Params[0])
+	if target == nil {
+		rb.Add(nil, server.name, ERR_NOSUCHNICK, client.Nick(), utils.SafeErrorParam(msg.Params[0]), client.t("No such nick"))
+		return false
+	}
+	vhost := msg.Params[1]
+	if validateVhost(server, vhost, true) != nil {
+		rb.Add(nil, server.name, "FAIL", "CHGHOST", "INVALID_HOSTNAME", utils.SafeErrorParam(vhost), client.t("Invalid hostname"))
+		return false
+	}
+
+	details := target.Details()
+	if target.SetVHost(vhost) && target.Registered() {
+		target.sendChghost(details.nickMask, target.Hostname())
+	}
+	message := fmt.Sprintf("Operator %s ran CHGHOST on %s to %s", client.Oper().Name, details.nick, vhost)
+	server.snomasks.Send(sno.LocalOpers, message)
+	server.logger.Info("opers", message)
+	rb.Notice(fmt.Sprintf(client.t("Changed the hostname of %[1]s to %[2]s"), details.nick, vhost))
+	return false
+}
+
 // SANICK <oldnick> <nickname>
 func sanickHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
 	targetNick := msg.Params[0]
@@ -3027,7 +3393,8 @@ func setnameHandler(server *Server, client *Client, msg ircmsg.Message, rb *Resp
 		// so you can do `/setname Jane Doe` in the client and get the expected result
 		realname = strings.Join(msg.Params, " ")
 	}
-	if realname == "" {
+	realnameLen := server.Config().Limits.RealnameLen
+	if realname == "" || (realnameLen != 0 && realnameLen < len(realname)) {
 		rb.Add(nil, server.name, "FAIL", "SETNAME", "INVALID_REALNAME", client.t("Realname is not valid"))
 		return false
 	}
@@ -3151,6 +3518,9 @@ func userHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respons
 		rb.Add(nil, server.name, ERR_NEEDMOREPARAMS, client.Nick(), "USER", client.t("Not enough parameters"))
 		return false
 	}
+	if realnameLen := server.Config().Limits.RealnameLen; realnameLen != 0 {
+		realname = ircutils.TruncateUTF8Safe(realname, realnameLen)
+	}
 
 	// #843: we accept either: `USER user:pass@clientid` or `USER user@clientid`
 	if strudelIndex := strings.IndexByte(username, '@'); strudelIndex != -1 {
@@ -3158,7 +3528,7 @@ func userHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respons
 		if colonIndex := strings.IndexByte(username, ':'); colonIndex != -1 {
 			var password string
 			username, password = username[:colonIndex], username[colonIndex+1:]
-			err := server.accounts.AuthenticateByPassphrase(client, username, password)
+			err := server.accounts.AuthenticateByPassphrase(client, username, password, rb.session.certfp)
 			if err == nil {
 				sendSuccessfulAccountAuth(nil, client, rb, true)
 			} else {
@@ -3330,6 +3700,35 @@ func (fields whoxFields) Has(field rune) bool {
 	}
 }
 
+// parseWhoxQuery parses the second parameter of a WHOX query, e.g., `%tcuhn,42`
+// (any filter flags preceding the % are ignored)
+func parseWhoxQuery(query string) (fields whoxFields, whoType string) {
+	whoType = "0"
+	if fieldStart := strings.IndexByte(query, '%'); fieldStart != -1 {
+		query = query[fieldStart+1:]
+	}
+	if typeIndex := strings.IndexByte(query, ','); typeIndex != -1 {
+		// the query type is a token of up to 3 digits, echoed back for the 't' field
+		if token := query[typeIndex+1:]; 0 < len(token) && len(token) <= 3 && isWhoxQueryType(token) {
+			whoType = token
+		}
+		query = query[:typeIndex]
+	}
+	for _, field := range strings.ToLower(query) {
+		fields = fields.Add(field)
+	}
+	return
+}
+
+func isWhoxQueryType(token string) bool {
+	for _, c := range token {
+		if c < '0' || '9' < c {
+			return false
+		}
+	}
+	return true
+}
+
 // rplWhoReply returns the WHO(X) reply between one user and another channel/user.
 // who format:
 // <channel> <user> <host> <server> <nick> <H|G>[*][~|&|@|%|+][B] :<hopcount> <real name>
@@ -3458,24 +3857,11 @@ func whoHandler(server *Server, client *Client, msg ircmsg.Message, rb *Response
 		!config.Accounts.NickReservation.AllowCustomEnforcement &&
 		config.Accounts.NickReservation.ForceNickEqualsAccount
 
-	sFields := "cuhsnf"
-	whoType := "0"
+	fields, whoType := parseWhoxQuery("%cuhsnf")
 	isWhox := false
 	if len(msg.Params) > 1 && strings.Contains(msg.Params[1], "%") {
 		isWhox = true
-		whoxData := msg.Params[1]
-		fieldStart := strings.Index(whoxData, "%")
-		sFields = whoxData[fieldStart+1:]
-
-		typeIndex := strings.Index(sFields, ",")
-		if typeIndex > -1 && typeIndex < (len(sFields)-1) { // make sure there's , and a value after it
-			whoType = sFields[typeIndex+1:]
-			sFields = strings.ToLower(sFields[:typeIndex])
-		}
-	}
-	var fields whoxFields
-	for _, field := range sFields {
-		fields = fields.Add(field)
+		fields, whoType = parseWhoxQuery(msg.Params[1])
 	}
 
 	// successfully parsed query, ensure we send the success response:
@@ -3608,6 +3994,8 @@ func whoisHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respon
 }
 
 // WHOWAS <nickname> [<count> [<server>]]
+// opers with the ban capability can also look up entries
+// by account (~a:<account>) or by IP (~i:<ip or network>)
 func whowasHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
 	nicknames := strings.Split(msg.Params[0], ",")
 
@@ -3622,7 +4010,16 @@ func whowasHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respo
 	cnick := client.Nick()
 	canSeeIP := client.Oper().HasRoleCapab("ban")
 	for _, nickname := range nicknames {
-		results := server.whoWas.Find(nickname, count)
+		var results []WhoWas
+		if canSeeIP && strings.HasPrefix(nickname, "~a:") {
+			results = server.whoWas.FindByAccount(strings.TrimPrefix(nickname, "~a:"), count)
+		} else if canSeeIP && strings.HasPrefix(nickname, "~i:") {
+			if network, err := utils.NormalizedNetFromString(strings.TrimPrefix(nickname, "~i:")); err == nil {
+				results = server.whoWas.FindByNet(network, count)
+			}
+		} else {
+			results = server.whoWas.Find(nickname, count)
+		}
 		if len(results) == 0 {
 			rb.Add(nil, server.name, ERR_WASNOSUCHNICK, cnick, utils.SafeErrorParam(nickname), client.t("There was no such nickname"))
 		} else {
@@ -3631,6 +4028,10 @@ func whowasHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respo
 				if canSeeIP {
 					rb.Add(nil, server.name, RPL_WHOWASIP, cnick, whoWas.nick, fmt.Sprintf(client.t("was connecting from %s"), utils.IPStringToHostname(whoWas.ip.String())))
 				}
+				if whoWas.account != "" {
+					rb.Add(nil, server.name, RPL_WHOISACCOUNT, cnick, whoWas.nick, whoWas.accountName, client.t("was logged in as"))
+				}
+				rb.Add(nil, server.name, RPL_WHOISSERVER, cnick, whoWas.nick, server.name, whoWas.signoff.Format(time.RFC1123))
 			}
 		}
 		rb.Add(nil, server.name, RPL_ENDOFWHOWAS, cnick, utils.SafeErrorParam(nickname), client.t("End of WHOWAS"))
@@ -0,0 +1,148 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package irc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ergochat/irc-go/ircmsg"
+
+	"github.com/ergochat/ergo/irc/history"
+	"github.com/ergochat/ergo/irc/languages"
+	"github.com/ergochat/ergo/irc/logger"
+	"github.com/ergochat/ergo/irc/modes"
+	"github.com/ergochat/ergo/irc/utils"
+)
+
+func TestDMRefused(t *testing.T) {
+	var config Config
+	config.languageManager = new(languages.Manager)
+	server := &Server{defcon: 5}
+	server.config.Set(&config)
+	server.accepts.Initialize()
+
+	newClient := func(nick string, settings AccountSettings) *Client {
+		client := &Client{
+			server:          server,
+			nick:            nick,
+			nickCasefolded:  nick,
+			nickMaskString:  nick + "!u@example.com",
+			account:         nick,
+			accountName:     nick,
+			accountSettings: settings,
+		}
+		return client
+	}
+	alice := newClient("alice", AccountSettings{BlockPrivateMessages: true})
+	bob := newClient("bob", AccountSettings{})
+	oper := newClient("oper", AccountSettings{})
+	oper.SetMode(modes.Operator, true)
+	server.clients.byNick = map[string]*Client{"alice": alice, "bob": bob, "oper": oper}
+
+	// sendDM returns the FAIL code sent back to the sender, if any
+	sendDM := func(sender *Client, target string, histType history.ItemType) (code string) {
+		command := "PRIVMSG"
+		if histType == history.Notice {
+			command = "NOTICE"
+		}
+		// the recipient has no sessions, so nothing is actually delivered
+		rb := NewResponseBuffer(&Session{client: sender})
+		dispatchMessageToTarget(sender, nil, histType, command, target, utils.MakeMessage("hi"), rb)
+		for _, message := range rb.messages {
+			if message.Command == "FAIL" {
+				return message.Params[1]
+			}
+		}
+		return ""
+	}
+
+	assertEqual(sendDM(bob, "alice", history.Privmsg), "DM_REFUSED")
+	// as with +g, NOTICE is dropped silently
+	assertEqual(sendDM(bob, "alice", history.Notice), "")
+	// the setting only affects messages to alice
+	assertEqual(sendDM(bob, "oper", history.Privmsg), "")
+
+	// operators can always send DMs
+	assertEqual(sendDM(oper, "alice", history.Privmsg), "")
+
+	// so can clients that alice has ACCEPTed
+	server.accepts.Accept(alice, bob)
+	assertEqual(sendDM(bob, "alice", history.Privmsg), "")
+	server.accepts.Unaccept(alice, bob)
+	assertEqual(sendDM(bob, "alice", history.Privmsg), "DM_REFUSED")
+
+	// messaging eve auto-ACCEPTs them, so they can reply
+	eve := newClient("eve", AccountSettings{})
+	server.clients.byNick["eve"] = eve
+	assertEqual(sendDM(alice, "eve", history.Privmsg), "")
+	assertEqual(server.accepts.MaySendTo(eve, alice), true)
+	assertEqual(sendDM(eve, "alice", history.Privmsg), "")
+	// but not anyone else
+	assertEqual(sendDM(bob, "alice", history.Privmsg), "DM_REFUSED")
+}
+
+func TestSapartResponseBuffers(t *testing.T) {
+	var config Config
+	config.languageManager = new(languages.Manager)
+	server := &Server{logger: new(logger.Manager)}
+	server.config.Set(&config)
+	server.channels.chans = make(map[string]*channelManagerEntry)
+
+	newClient := func(nick string) *Client {
+		return &Client{
+			server:         server,
+			nick:           nick,
+			nickCasefolded: nick,
+			nickMaskString: nick + "!u@example.com",
+		}
+	}
+	oper := newClient("oper")
+	oper.oper = &Oper{Name: "admin"}
+	alice := newClient("alice")
+	bob := newClient("bob")
+	server.clients.byNick = map[string]*Client{"oper": oper, "alice": alice, "bob": bob}
+
+	channel := NewChannel(server, "#test", "#test", false)
+	server.channels.chans["#test"] = &channelManagerEntry{channel: channel}
+	join := func(client *Client) {
+		channel.members.Add(client)
+		channel.regenerateMembersCache()
+		client.channels = make(ChannelSet)
+		client.channels.Add(channel)
+	}
+
+	// returns the commands sent to the operator
+	sapart := func(params ...string) (commands []string) {
+		rb := NewResponseBuffer(&Session{client: oper})
+		sapartHandler(server, oper, ircmsg.MakeMessage(nil, "", "SAPART", params...), rb)
+		for _, message := range rb.messages {
+			commands = append(commands, message.Command)
+		}
+		return
+	}
+
+	// alice has a session, which receives her PART
+	conn := newRecordingConn()
+	socket, writerDone := newTestSocket(conn, 1<<16)
+	alice.sessions = []*Session{{client: alice, socket: socket}}
+	join(oper)
+	join(alice)
+	join(bob)
+	assertEqual(sapart("alice", "#test", "bye"), []string(nil))
+	assertEqual(channel.hasClient(alice), false)
+	socket.Close()
+	<-writerDone
+	lines := conn.lines()
+	assertEqual(len(lines), 1)
+	assertEqual(strings.HasPrefix(lines[0], ":alice!u@example.com PART #test bye"), true)
+
+	// bob is always-on with no sessions, so nobody gets his PART
+	assertEqual(sapart("bob", "#test"), []string(nil))
+	assertEqual(channel.hasClient(bob), false)
+
+	// errors still go to the operator
+	assertEqual(sapart("bob", "#test"), []string{ERR_USERNOTINCHANNEL})
+	assertEqual(sapart("bob", "#nonexistent"), []string{ERR_NOSUCHCHANNEL})
+}
@@ -45,6 +45,7 @@ Ergo supports the following channel modes:
   +i  |  Invite-only mode, only invited clients can join the channel.
   +k  |  Key required when joining the channel.
   +l  |  Client join limit for the channel.
+  +j  |  Join throttle (e.g. 5:10), limiting joins to 5 in any 10 seconds.
   +f  |  Users who are unable to join this channel (due to another mode) are forwarded
          to the provided channel instead.
   +m  |  Moderated mode, only privileged clients can talk on the channel.
@@ -56,10 +57,12 @@ Ergo supports the following channel modes:
   +t  |  Only channel opers can modify the topic.
   +E  |  Roleplaying commands are enabled in the channel.
   +C  |  Clients are blocked from sending CTCP messages in the channel.
+  +z  |  Only clients connected via TLS can join the channel.
   +u  |  Auditorium mode: JOIN, PART, QUIT, NAMES, and WHO are hidden
          from unvoiced clients.
-  +U  |  Op-moderated mode: messages from unprivileged clients are sent
-         only to channel operators.
+  +U  |  Op-moderated mode: messages from unprivileged clients (including
+         messages that +m, +M, or a mute would block) are sent only to
+         channel operators.
 
 = Prefixes =
 
@@ -80,7 +83,8 @@ Ergo supports the following user modes:
   +Z  |  User is connected via TLS.
   +B  |  User is a bot.
   +E  |  User can receive roleplaying commands.
-  +T  |  CTCP messages to the user are blocked.`
+  +T  |  CTCP messages to the user are blocked.
+  +g  |  User only accepts direct messages from users on their ACCEPT list.`
 	snomaskHelpText = `== Server Notice Masks ==
 
 Ergo supports the following server notice masks for operators:
@@ -114,13 +118,24 @@ var Help = map[string]HelpEntry{
 		text: `ACCEPT <target>
 
 ACCEPT allows the target user to send you direct messages, overriding any
-restrictions that might otherwise prevent this. Currently, the only
-applicable restriction is the +R registered-only mode.`,
+restrictions that might otherwise prevent this. The applicable restrictions
+are the +g caller-ID mode and the +R registered-only mode. Users you send
+direct messages to while +g is set are accepted automatically. To remove a
+user from the list, prefix their nickname with -, e.g., ACCEPT -nick.`,
 	},
 	"ambiance": {
 		text: `AMBIANCE <target> <text to be sent>
 
 The AMBIANCE command is used to send a scene notification to the given target.`,
+	},
+	"audit": {
+		oper: true,
+		text: `AUDIT [count] [search]
+
+Shows the most recent entries in the audit log of privileged operator actions
+(e.g., KILL, DLINE, SAMODE, REHASH, and restricted services commands). [count]
+is the number of entries to show (default 20); if [search] is given, only
+entries containing it (case-insensitively) are shown.`,
 	},
 	"authenticate": {
 		text: `AUTHENTICATE
@@ -153,6 +168,14 @@ http://ircv3.net/specs/core/capability-negotiation-3.2.html`,
 CHATHISTORY is a history replay command associated with the IRCv3
 chathistory extension. See this document:
 https://ircv3.net/specs/extensions/chathistory`,
+	},
+	"chghost": {
+		oper: true,
+		text: `CHGHOST <nickname> <hostname>
+
+Changes the displayed hostname of the given user, until they disconnect or
+their account's vhost (if any) is applied again. Clients that support the
+chghost capability are informed of the change.`,
 	},
 	"debug": {
 		oper: true,
@@ -169,11 +192,13 @@ Provides various debugging commands for the IRCd. <option> can be one of:
 	},
 	"defcon": {
 		oper: true,
-		text: `DEFCON [level]
+		text: `DEFCON [level [duration]]
 
 The DEFCON system can disable server features at runtime, to mitigate
-spam or other hostile activity. It has five levels, which are cumulative
-(i.e., level 3 includes all restrictions from level 4 and so on):
+spam or other hostile activity. If a duration is given (e.g., 30m), the
+level automatically reverts to 5 once it elapses. It has five levels,
+which are cumulative (i.e., level 3 includes all restrictions from level 4
+and so on):
 
 5: Normal operation
 4: No new account or channel registrations; if Tor is enabled, no new
@@ -318,8 +343,17 @@ Sets your preferred languages to the given ones.`,
 		text: `LIST [<channel>{,<channel>}] [<elistcond>{,<elistcond>}]
 
 Shows information on the given channels (or if none are given, then on all
-channels). <elistcond>s modify how the channels are selected.`,
-		//TODO(dan): Explain <elistcond>s in more specific detail
+channels). <elistcond>s modify how the channels are selected; a channel must
+match all of them to be shown:
+
+	<n		Fewer than n users
+	>n		More than n users
+	C<n		Created less than n minutes ago
+	C>n		Created more than n minutes ago
+	T<n		Topic changed less than n minutes ago
+	T>n		Topic changed more than n minutes ago
+	<mask>		Name matches the mask, e.g., #ergo*
+	!<mask>		Name does not match the mask`,
 	},
 	"lusers": {
 		text: `LUSERS [<mask> [<server>]]
@@ -394,7 +428,7 @@ Requires the roleplay mode (+E) to be set on the target.`,
 	"npca": {
 		text: `NPCA <target> <sourcenick> <text to be sent>
 		
-The NPC command is used to send an action to the target as the source.
+The NPCA command is used to send an action to the target as the source.
 
 Requires the roleplay mode (+E) to be set on the target.`,
 	},
@@ -467,11 +501,31 @@ Gives the given user a new nickname.`,
 Forcibly sets and removes modes from the given target -- only available to
 opers. For more specific information on mode characters, see the help for
 "cmode" and "umode".`,
+	},
+	"sapart": {
+		oper: true,
+		text: `SAPART <nick> #channel{,#channel} [reason]
+
+Forcibly parts a user from one or more channels.`,
 	},
 	"scene": {
 		text: `SCENE <target> <text to be sent>
 
 The SCENE command is used to send a scene notification to the given target.`,
+	},
+	"search": {
+		text: `SEARCH <attributes>
+
+SEARCH looks for messages in a channel's history, or in your direct messages
+with a user. The attributes are given in the form key=value, separated by
+semicolons, for example:
+
+    SEARCH in=#ergo;from=shivaram;text=release;after=2026-01-01T00:00:00.000Z
+
+'in' (the channel or nickname to search) is required. 'from' matches the
+sender's nickname or account name, 'text' matches part of the message,
+'after' and 'before' restrict the time range, and 'limit' bounds the number
+of results.`,
 	},
 	"setname": {
 		text: `SETNAME <realname>
@@ -488,6 +542,28 @@ The SUMMON command is not implemented.`,
 
 Sends the given client-only tags to the given targets as a TAGMSG. See the IRCv3
 specs for more info: http://ircv3.net/specs/core/message-tags-3.3.html`,
+	},
+	"qline": {
+		oper: true,
+		text: `QLINE [duration] <mask> [reason [| oper reason]]
+QLINE LIST
+
+Forbids the use of nicknames or channel names matching a mask; masks beginning
+with # apply to channel names, all others to nicknames. If the duration
+is given then only for that long. The reason is shown to users who try to use
+a matching name. The oper reason is shown to operators getting info about the
+QLINEs that exist. Operators with the "ban" capability are exempt.
+
+Q-Lines are saved across subsequent launches of the server. Q-Lines can also
+be set in the config file; these are shown by QLINE LIST, but can't be removed
+with UNQLINE.
+
+[duration] can be of the following forms:
+	1y 12mo 31d 10h 8m 13s
+
+<mask> is a nickname or a channel name, and may contain wildcards. For example:
+	*serv
+	#staff*`,
 	},
 	"quit": {
 		text: `QUIT [reason]
@@ -515,6 +591,25 @@ Shows the time of the current, or the given, server.`,
 
 If [topic] is given, sets the topic in the channel to that. If [topic] is not
 given, views the current topic on the channel.`,
+	},
+	"totp": {
+		text: `TOTP <subcommand> [code]
+
+Manages TOTP (time-based one-time password) two-factor authentication for
+operator blocks. Accepts the following subcommands:
+
+1. TOTP VERIFY <code>
+   Completes an OPER for a block with TOTP enabled.
+2. TOTP ENROLL
+   Generates a new secret for your current operator block.
+3. TOTP CONFIRM <code>
+   Confirms enrollment; OPER will require a code from then on.
+4. TOTP BACKUPCODES <code>
+   Replaces your single-use backup codes.
+5. TOTP DISABLE <code>
+   Removes the device from your current operator block.
+
+A backup code may be given in place of <code>.`,
 	},
 	"uban": {
 		text: `UBAN <subcommand> [arguments]
@@ -549,6 +644,16 @@ For example:
 	dan
 	dan!5*@127.*`,
 	},
+	"unqline": {
+		oper: true,
+		text: `UNQLINE <mask>
+
+Removes an existing Q-Line (forbidden nickname or channel name mask).
+
+For example:
+	*serv
+	#staff*`,
+	},
 	"user": {
 		text: `USER <username> 0 * <realname>
 
@@ -604,9 +709,15 @@ Returns information for the given user.`,
 Returns information for the given user(s).`,
 	},
 	"whowas": {
-		text: `WHOWAS <nickname>
+		text: `WHOWAS <nickname> [count]
 
-Returns historical information on the last user with the given nickname.`,
+Returns historical information on the last users with the given nickname,
+including the account they were logged into and when they signed off.
+
+Operators with the ban capability can also look up entries by account or by
+IP (or network in CIDR notation):
+	WHOWAS ~a:<account> [count]
+	WHOWAS ~i:<ip | network> [count]`,
 	},
 	"znc": {
 		text: `ZNC <module> [params]
@@ -657,7 +768,11 @@ for direct use by end users.`,
 
 Ergo supports an experimental unicode casemapping designed for extended
 Unicode support. This casemapping is based off RFC 7613 and the draft rfc7613
-casemapping spec here: https://ergo.chat/specs.html`,
+casemapping spec here: https://ergo.chat/specs.html
+
+Depending on the server configuration, Ergo may instead advertise "rfc1459",
+in which case the characters []\~ are treated as the uppercase equivalents
+of {}|^.`,
 		helpType: ISupportHelpEntry,
 	},
 	"prefix": {
@@ -0,0 +1,24 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package history
+
+import (
+	"io"
+	"time"
+)
+
+// Database is a persistent store for history (e.g., MySQL), as opposed to
+// the in-memory Buffer
+type Database interface {
+	AddChannelItem(target string, item Item, account string) (err error)
+	AddDirectMessage(sender, senderAccount, recipient, recipientAccount string, item Item) (err error)
+	DeleteMsgid(msgid, accountName string) (err error)
+	Export(account string, writer io.Writer)
+	Forget(account string)
+	ListChannels(cfchannels []string) (results []TargetListing, err error)
+	MakeSequence(target, correspondent string, cutoff time.Time) Sequence
+	// RenameTarget moves a channel's history to a new (casefolded) name
+	RenameTarget(oldTarget, newTarget string) (err error)
+	Close()
+}
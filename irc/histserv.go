@@ -27,6 +27,12 @@ func historyComplianceEnabled(config *Config) bool {
 	return config.History.Enabled && config.History.Persistent.Enabled && config.History.Retention.EnableAccountIndexing
 }
 
+// can an account's messages be reliably deleted? persistent history can only
+// find them via the account index
+func historyForgetEnabled(config *Config) bool {
+	return config.History.Enabled && (!config.History.Persistent.Enabled || config.History.Retention.EnableAccountIndexing)
+}
+
 var (
 	histservCommands = map[string]*serviceCommand{
 		"forget": {
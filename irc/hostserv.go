@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"time"
 
 	"github.com/ergochat/irc-go/ircfmt"
 
@@ -30,6 +31,10 @@ func hostservEnabled(config *Config) bool {
 	return config.Accounts.VHosts.Enabled
 }
 
+func hostservRequestsEnabled(config *Config) bool {
+	return config.Accounts.VHosts.Enabled && config.Accounts.VHosts.UserRequests.Enabled
+}
+
 var (
 	hostservCommands = map[string]*serviceCommand{
 		"on": {
@@ -79,6 +84,49 @@ DEL deletes a user's vhost.`,
 			enabled:   hostservEnabled,
 			minParams: 1,
 		},
+		"request": {
+			handler: hsRequestHandler,
+			help: `Syntax: $bREQUEST <vhost>$b
+
+REQUEST requests that a new vhost be assigned to your account. The request must
+then be approved by a server operator.`,
+			helpShort:    `$bREQUEST$b requests a new vhost, pending operator approval.`,
+			authRequired: true,
+			enabled:      hostservRequestsEnabled,
+			minParams:    1,
+		},
+		"waiting": {
+			handler: hsWaitingHandler,
+			help: `Syntax: $bWAITING$b
+
+WAITING shows a list of pending vhost requests, which can then be approved
+or rejected.`,
+			helpShort: `$bWAITING$b shows a list of pending vhost requests.`,
+			capabs:    []string{"vhosts"},
+			enabled:   hostservRequestsEnabled,
+		},
+		"approve": {
+			handler: hsApproveHandler,
+			help: `Syntax: $bAPPROVE <user>$b
+
+APPROVE approves a user's vhost request.`,
+			helpShort: `$bAPPROVE$b approves a user's vhost request.`,
+			capabs:    []string{"vhosts"},
+			enabled:   hostservRequestsEnabled,
+			minParams: 1,
+		},
+		"reject": {
+			handler: hsRejectHandler,
+			help: `Syntax: $bREJECT <user> [<reason>]$b
+
+REJECT rejects a user's vhost request, optionally giving them a reason
+for the rejection.`,
+			helpShort: `$bREJECT$b rejects a user's vhost request.`,
+			capabs:    []string{"vhosts"},
+			enabled:   hostservRequestsEnabled,
+			minParams: 1,
+			maxParams: 2,
+		},
 		"setcloaksecret": {
 			handler: hsSetCloakSecretHandler,
 			help: `Syntax: $bSETCLOAKSECRET$b <secret> [code]
@@ -146,6 +194,13 @@ func hsStatusHandler(service *ircService, server *Server, client *Client, comman
 	} else {
 		service.Notice(rb, fmt.Sprintf(client.t("Account %s has no vhost"), accountName))
 	}
+	if account.VHost.RequestedVHost != "" {
+		service.Notice(rb, fmt.Sprintf(client.t("A request is pending for vhost: %s"), account.VHost.RequestedVHost))
+	}
+	if account.VHost.RejectedVHost != "" {
+		service.Notice(rb, fmt.Sprintf(client.t("A request was previously made for vhost: %s"), account.VHost.RejectedVHost))
+		service.Notice(rb, fmt.Sprintf(client.t("It was rejected for reason: %s"), account.VHost.RejectionReason))
+	}
 }
 
 func validateVhost(server *Server, vhost string, oper bool) error {
@@ -185,6 +240,105 @@ func hsSetHandler(service *ircService, server *Server, client *Client, command s
 	}
 }
 
+func hsRequestHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
+	vhost := params[0]
+	if validateVhost(server, vhost, false) != nil {
+		service.Notice(rb, client.t("Invalid vhost"))
+		return
+	}
+
+	accountName := client.Account()
+	cooldown := time.Duration(server.Config().Accounts.VHosts.UserRequests.Cooldown)
+	info, err := server.accounts.VHostRequest(accountName, vhost, cooldown)
+	if err == errLimitExceeded {
+		remaining := time.Until(info.LastRequestTime.Add(cooldown))
+		service.Notice(rb, fmt.Sprintf(client.t("You must wait an additional %v before making another request"), remaining.Round(time.Second)))
+		return
+	} else if err == errAccountUnverified {
+		service.Notice(rb, client.t("You must verify your account before requesting a vhost"))
+		return
+	} else if err != nil {
+		service.Notice(rb, client.t("An error occurred"))
+		return
+	}
+
+	service.Notice(rb, client.t("Your vhost request will be reviewed by an administrator"))
+	message := fmt.Sprintf("Account %[1]s requested vhost %[2]s", accountName, vhost)
+	server.snomasks.Send(sno.LocalVhosts, message)
+	hsNotifyChannel(server, service, message)
+}
+
+// hsNotifyChannel sends a notice about vhost requests to the configured channel, if any
+func hsNotifyChannel(server *Server, service *ircService, message string) {
+	chname := server.Config().Accounts.VHosts.UserRequests.Channel
+	if chname == "" {
+		return
+	}
+	channel := server.channels.Get(chname)
+	if channel == nil {
+		return
+	}
+	for _, member := range channel.Members() {
+		member.Send(nil, service.prefix, "NOTICE", channel.Name(), message)
+	}
+}
+
+func hsWaitingHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
+	requests, total := server.accounts.VHostListRequests(10)
+	if total == 0 {
+		service.Notice(rb, client.t("There are no pending vhost requests"))
+		return
+	}
+	service.Notice(rb, fmt.Sprintf(client.t("There are %[1]d pending requests for vhosts (%[2]d displayed)"), total, len(requests)))
+	for i, request := range requests {
+		service.Notice(rb, fmt.Sprintf(client.t("%[1]d. User %[2]s requests vhost: %[3]s"), i+1, request.Account, request.RequestedVHost))
+	}
+}
+
+func hsApproveHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
+	user := params[0]
+	info, err := server.accounts.VHostApprove(user)
+	if err == errNoVhostRequest {
+		service.Notice(rb, client.t(err.Error()))
+		return
+	} else if err != nil {
+		service.Notice(rb, client.t("An error occurred"))
+		return
+	}
+
+	service.Notice(rb, fmt.Sprintf(client.t("Successfully approved vhost request for %s"), user))
+	message := fmt.Sprintf("Operator %[1]s approved vhost %[2]s for account %[3]s", client.Oper().Name, info.ApprovedVHost, user)
+	server.snomasks.Send(sno.LocalVhosts, message)
+	hsNotifyChannel(server, service, message)
+	for _, target := range server.accounts.AccountToClients(user) {
+		target.Send(nil, service.prefix, "NOTICE", target.Nick(), target.t("Your vhost request was approved by an administrator"))
+	}
+}
+
+func hsRejectHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
+	user := params[0]
+	var reason string
+	if 1 < len(params) {
+		reason = params[1]
+	}
+	info, err := server.accounts.VHostReject(user, reason)
+	if err == errNoVhostRequest {
+		service.Notice(rb, client.t(err.Error()))
+		return
+	} else if err != nil {
+		service.Notice(rb, client.t("An error occurred"))
+		return
+	}
+
+	service.Notice(rb, fmt.Sprintf(client.t("Successfully rejected vhost request for %s"), user))
+	message := fmt.Sprintf("Operator %[1]s rejected vhost %[2]s for account %[3]s, with the reason: %[4]s", client.Oper().Name, info.RejectedVHost, user, reason)
+	server.snomasks.Send(sno.LocalVhosts, message)
+	hsNotifyChannel(server, service, message)
+	for _, target := range server.accounts.AccountToClients(user) {
+		target.Send(nil, service.prefix, "NOTICE", target.Nick(), fmt.Sprintf(target.t("Your vhost request was rejected by an administrator. The reason given was: %s"), reason))
+	}
+}
+
 func hsSetCloakSecretHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
 	secret := params[0]
 	expectedCode := utils.ConfirmationCode(secret, server.ctime)
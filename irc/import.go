@@ -9,6 +9,7 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/tidwall/buntdb"
 
@@ -45,6 +46,14 @@ type channelImport struct {
 	Key          string
 	Limit        int
 	Forward      string
+	Bans         []channelBanImport
+}
+
+type channelBanImport struct {
+	// a nickmask or an extban (e.g., ~a:account)
+	Mask  string
+	SetBy string `json:"setBy"`
+	SetAt int64  `json:"setAt"`
 }
 
 type databaseImport struct {
@@ -71,6 +80,23 @@ func serializeAmodes(raw map[string]string, validCfUsernames utils.HashSet[strin
 	return
 }
 
+func serializeBans(raw []channelBanImport, chname string) (result []byte, err error) {
+	banlist := make(map[string]MaskInfo, len(raw))
+	for _, ban := range raw {
+		mask, err := CanonicalizeListMask(ban.Mask)
+		if err != nil {
+			log.Printf("skipping invalid ban mask %s for channel %s\n", ban.Mask, chname)
+			continue
+		}
+		info := MaskInfo{CreatorNickmask: ban.SetBy}
+		if ban.SetAt != 0 {
+			info.TimeCreated = time.Unix(0, ban.SetAt).UTC()
+		}
+		banlist[mask] = info
+	}
+	return json.Marshal(banlist)
+}
+
 func doImportDBGeneric(config *Config, dbImport databaseImport, credsType CredentialsVersion, tx *buntdb.Tx) (err error) {
 	requiredVersion := 1
 	if dbImport.Version != requiredVersion {
@@ -195,6 +221,14 @@ func doImportDBGeneric(config *Config, dbImport databaseImport, credsType Creden
 				tx.Set(fmt.Sprintf(keyChannelForward, cfchname), chInfo.Forward, nil)
 			}
 		}
+		if len(chInfo.Bans) != 0 {
+			b, err := serializeBans(chInfo.Bans, chname)
+			if err == nil {
+				tx.Set(fmt.Sprintf(keyChannelBanlist, cfchname), string(b), nil)
+			} else {
+				log.Printf("couldn't serialize bans for %s: %v", chname, err)
+			}
+		}
 	}
 
 	if warnSkeletons {
@@ -239,6 +273,9 @@ func ImportDB(config *Config, infile string) (err error) {
 	}
 
 	performImport := func(tx *buntdb.Tx) (err error) {
+		if dbImport.Source == exportDBSource {
+			return doImportDBErgo(data, tx)
+		}
 		return doImportDB(config, dbImport, tx)
 	}
 
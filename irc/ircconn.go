@@ -4,8 +4,10 @@
 package irc
 
 import (
+	"bufio"
 	"bytes"
-	"net"
+	"sync"
+	"time"
 	"unicode/utf8"
 
 	"github.com/ergochat/irc-go/ircmsg"
@@ -17,10 +19,22 @@ import (
 
 const (
 	initialBufferSize = 1024
+	// lines are coalesced into writes of up to this size:
+	writeBufferSize = 4096
 )
 
 var (
 	crlf = []byte{'\r', '\n'}
+
+	// write buffers are only needed for the duration of a flush, so connections
+	// share them instead of each holding one while idle:
+	writeBufferPool = sync.Pool{
+		New: func() interface{} { return bufio.NewWriterSize(nil, writeBufferSize) },
+	}
+	// likewise for buffers that incoming websocket messages are read into:
+	wsReadBufferPool = sync.Pool{
+		New: func() interface{} { return new(bytes.Buffer) },
+	}
 )
 
 // maximum total length, in bytes, of a single IRC message:
@@ -39,8 +53,11 @@ type IRCConn interface {
 	// these take an IRC line or lines, correctly terminated with CRLF:
 	WriteLine([]byte) error
 	WriteLines([][]byte) error
-	// this returns an IRC line, possibly terminated with CRLF, LF, or nothing:
+	// this returns an IRC line, possibly terminated with CRLF, LF, or nothing;
+	// the line is only valid until the next call to ReadLine:
 	ReadLine() (line []byte, err error)
+	// this sets a deadline for future WriteLine(s) calls, like net.Conn:
+	SetWriteDeadline(time.Time) error
 
 	Close() error
 }
@@ -64,23 +81,39 @@ func (cc *IRCStreamConn) UnderlyingConn() *utils.WrappedConn {
 }
 
 func (cc *IRCStreamConn) WriteLine(buf []byte) (err error) {
-	_, err = cc.conn.Write(buf)
-	return
+	return cc.WriteLines([][]byte{buf})
 }
 
 func (cc *IRCStreamConn) WriteLines(buffers [][]byte) (err error) {
-	// on Linux, with a plaintext TCP or Unix domain socket,
-	// the Go runtime will optimize this into a single writev(2) call:
-	_, err = (*net.Buffers)(&buffers).WriteTo(cc.conn)
+	// the lines are coalesced in a bufio.Writer, so that they go out in
+	// as few writes as possible (for TLS, as few records as possible);
+	// a line longer than the free space in the buffer is written directly
+	writer := writeBufferPool.Get().(*bufio.Writer)
+	writer.Reset(cc.conn)
+	for _, buf := range buffers {
+		if _, err = writer.Write(buf); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	// on error, this discards any unwritten data
+	writer.Reset(nil)
+	writeBufferPool.Put(writer)
 	return
 }
 
+func (cc *IRCStreamConn) SetWriteDeadline(t time.Time) error {
+	return cc.conn.SetWriteDeadline(t)
+}
+
 func (cc *IRCStreamConn) ReadLine() ([]byte, error) {
 	line, err := cc.reader.ReadLine()
 	if err != nil {
 		return nil, err
-	} else if globalUtf8EnforcementSetting && !utf8.Valid(line) {
-		return line, errInvalidUtf8
+	} else if globalUtf8EnforcementSetting {
+		return enforceUtf8(line)
 	} else {
 		return line, nil
 	}
@@ -94,20 +127,23 @@ func (cc *IRCStreamConn) Close() (err error) {
 type IRCWSConn struct {
 	conn   *websocket.Conn
 	binary bool
+
+	// holds the most recently read message; owned by the reading goroutine
+	readBuf *bytes.Buffer
 }
 
-func NewIRCWSConn(conn *websocket.Conn) IRCWSConn {
+func NewIRCWSConn(conn *websocket.Conn) *IRCWSConn {
 	binary := conn.Subprotocol() == "binary.ircv3.net"
-	return IRCWSConn{conn: conn, binary: binary}
+	return &IRCWSConn{conn: conn, binary: binary}
 }
 
-func (wc IRCWSConn) UnderlyingConn() *utils.WrappedConn {
+func (wc *IRCWSConn) UnderlyingConn() *utils.WrappedConn {
 	// just assume that the type is OK
 	wConn, _ := wc.conn.UnderlyingConn().(*utils.WrappedConn)
 	return wConn
 }
 
-func (wc IRCWSConn) WriteLine(buf []byte) (err error) {
+func (wc *IRCWSConn) WriteLine(buf []byte) (err error) {
 	buf = bytes.TrimSuffix(buf, crlf)
 	// #1483: if we have websockets at all, then we're enforcing utf8
 	messageType := websocket.TextMessage
@@ -117,7 +153,7 @@ func (wc IRCWSConn) WriteLine(buf []byte) (err error) {
 	return wc.conn.WriteMessage(messageType, buf)
 }
 
-func (wc IRCWSConn) WriteLines(buffers [][]byte) (err error) {
+func (wc *IRCWSConn) WriteLines(buffers [][]byte) (err error) {
 	for _, buf := range buffers {
 		err = wc.WriteLine(buf)
 		if err != nil {
@@ -127,11 +163,24 @@ func (wc IRCWSConn) WriteLines(buffers [][]byte) (err error) {
 	return
 }
 
-func (wc IRCWSConn) ReadLine() (line []byte, err error) {
-	messageType, line, err := wc.conn.ReadMessage()
+func (wc *IRCWSConn) ReadLine() (line []byte, err error) {
+	// the caller is done with the previous line
+	if wc.readBuf != nil {
+		wc.readBuf.Reset()
+		wsReadBufferPool.Put(wc.readBuf)
+		wc.readBuf = nil
+	}
+
+	messageType, reader, err := wc.conn.NextReader()
+	if err != nil {
+		return nil, err
+	}
+	wc.readBuf = wsReadBufferPool.Get().(*bytes.Buffer)
+	_, err = wc.readBuf.ReadFrom(reader)
+	line = wc.readBuf.Bytes()
 	if err == nil {
-		if messageType == websocket.BinaryMessage && !utf8.Valid(line) {
-			return line, errInvalidUtf8
+		if messageType == websocket.BinaryMessage {
+			return enforceUtf8(line)
 		}
 		return line, nil
 	} else if err == websocket.ErrReadLimit {
@@ -141,6 +190,33 @@ func (wc IRCWSConn) ReadLine() (line []byte, err error) {
 	}
 }
 
-func (wc IRCWSConn) Close() (err error) {
+func (wc *IRCWSConn) SetWriteDeadline(t time.Time) error {
+	return wc.conn.SetWriteDeadline(t)
+}
+
+func (wc *IRCWSConn) Close() (err error) {
 	return wc.conn.Close()
 }
+
+var utf8ReplacementChar = []byte(string(utf8.RuneError))
+
+// enforceUtf8 either rejects an input line that isn't valid UTF-8,
+// or replaces its invalid sequences, depending on the server's strategy
+func enforceUtf8(line []byte) ([]byte, error) {
+	if utf8.Valid(line) {
+		return line, nil
+	} else if globalUtf8ReplaceInvalid {
+		line = bytes.ToValidUTF8(line, utf8ReplacementChar)
+		// each replacement can be longer than the bytes it replaces;
+		// truncate (at a rune boundary) to the maximum line length again
+		if maxLen := maxReadQBytes(); maxLen < len(line) {
+			for maxLen > 0 && !utf8.RuneStart(line[maxLen]) {
+				maxLen--
+			}
+			line = line[:maxLen]
+		}
+		return line, nil
+	} else {
+		return line, errInvalidUtf8
+	}
+}
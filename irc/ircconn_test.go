@@ -0,0 +1,113 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package irc
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/ergochat/ergo/irc/utils"
+)
+
+// newWebsocketPair returns the server and client ends of a websocket connection
+func newWebsocketPair(t testing.TB) (server IRCConn, client *websocket.Conn) {
+	serverConns := make(chan *websocket.Conn, 1)
+	upgrader := websocket.Upgrader{}
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		serverConns <- conn
+	}))
+	t.Cleanup(httpServer.Close)
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	serverConn := <-serverConns
+	serverConn.SetReadLimit(int64(maxReadQBytes()))
+	server = NewIRCWSConn(serverConn)
+	t.Cleanup(func() { server.Close() })
+	return
+}
+
+func TestWebsocketReadLine(t *testing.T) {
+	server, client := newWebsocketPair(t)
+	lines := []string{"NICK alice", "USER u 0 * :Alice", "PRIVMSG #ergo :" + strings.Repeat("a", 1000)}
+	for _, line := range lines {
+		if err := client.WriteMessage(websocket.TextMessage, []byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, expected := range lines {
+		line, err := server.ReadLine()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(line) != expected {
+			t.Errorf("expected %q, got %q", expected, line)
+		}
+	}
+
+	// exceeding the read limit is reported as a readq error
+	client.WriteMessage(websocket.TextMessage, bytes.Repeat([]byte{'a'}, maxReadQBytes()+1))
+	if _, err := server.ReadLine(); err == nil {
+		t.Errorf("expected an error for an oversized message")
+	}
+}
+
+func BenchmarkWebsocketReadLine(b *testing.B) {
+	server, client := newWebsocketPair(b)
+	message, err := websocket.NewPreparedMessage(websocket.TextMessage,
+		[]byte("@label=abc PRIVMSG #ergo :"+strings.Repeat("hello, world ", 20)))
+	if err != nil {
+		b.Fatal(err)
+	}
+	n := b.N
+	go func() {
+		for i := 0; i < n; i++ {
+			if client.WritePreparedMessage(message) != nil {
+				return
+			}
+		}
+	}()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := server.ReadLine(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// discardNetConn is a net.Conn that discards all writes
+type discardNetConn struct {
+	net.Conn
+}
+
+func (discardNetConn) Write(b []byte) (int, error) { return len(b), nil }
+
+func BenchmarkIRCStreamConnWrite(b *testing.B) {
+	// set up a connection and write a burst to it: measures the write
+	// buffering memory that a connection holds onto
+	lines := [][]byte{
+		[]byte(":alice!~u@example.com PRIVMSG #ergo :hello, world\r\n"),
+		[]byte(":bob!~u@example.com PRIVMSG #ergo :hello, alice\r\n"),
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		conn := NewIRCStreamConn(&utils.WrappedConn{Conn: discardNetConn{}})
+		conn.WriteLines(lines)
+	}
+}
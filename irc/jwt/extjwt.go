@@ -39,8 +39,8 @@ func (t *JwtServiceConfig) Postprocess() (err error) {
 			return err
 		}
 		d, _ := pem.Decode(keyBytes)
-		if err != nil {
-			return err
+		if d == nil {
+			return fmt.Errorf("Invalid PEM data in extjwt key file %s", t.RSAPrivateKeyFile)
 		}
 		t.rsaPrivateKey, err = x509.ParsePKCS1PrivateKey(d.Bytes)
 		if err != nil {
@@ -28,8 +28,8 @@ type IRCListener interface {
 }
 
 // NewListener creates a new listener according to the specifications in the config file
-func NewListener(server *Server, addr string, config utils.ListenerConfig, bindMode os.FileMode) (result IRCListener, err error) {
-	baseListener, err := createBaseListener(addr, bindMode)
+func NewListener(server *Server, addr string, config utils.ListenerConfig) (result IRCListener, err error) {
+	baseListener, err := createBaseListener(addr, config)
 	if err != nil {
 		return
 	}
@@ -43,14 +43,27 @@ func NewListener(server *Server, addr string, config utils.ListenerConfig, bindM
 	}
 }
 
-func createBaseListener(addr string, bindMode os.FileMode) (listener net.Listener, err error) {
-	addr = strings.TrimPrefix(addr, "unix:")
-	if strings.HasPrefix(addr, "/") {
+func createBaseListener(addr string, config utils.ListenerConfig) (listener net.Listener, err error) {
+	if inherited, ok := getInheritedListener(addr, utils.IsUnixListenAddr(addr)); ok {
+		return inherited, nil
+	}
+	if utils.IsUnixListenAddr(addr) {
+		addr = strings.TrimPrefix(addr, "unix:")
 		// https://stackoverflow.com/a/34881585
 		os.Remove(addr)
 		listener, err = net.Listen("unix", addr)
-		if err == nil && bindMode != 0 {
-			os.Chmod(addr, bindMode)
+		if err != nil {
+			return
+		}
+		if config.UnixBindGID != -1 {
+			err = os.Chown(addr, -1, config.UnixBindGID)
+		}
+		if err == nil && config.UnixBindMode != 0 {
+			err = os.Chmod(addr, config.UnixBindMode)
+		}
+		if err != nil {
+			listener.Close()
+			listener = nil
 		}
 	} else {
 		listener, err = net.Listen("tcp", addr)
@@ -146,20 +159,21 @@ func (wl *WSListener) Stop() error {
 
 func (wl *WSListener) handle(w http.ResponseWriter, r *http.Request) {
 	config := wl.server.Config()
+	allowedOrigins := config.Server.trueListeners[wl.addr].AllowedOrigins
 	remoteAddr := r.RemoteAddr
 	xff := r.Header.Get("X-Forwarded-For")
 	xfp := r.Header.Get("X-Forwarded-Proto")
 
 	wsUpgrader := websocket.Upgrader{
 		CheckOrigin: func(r *http.Request) bool {
-			if len(config.Server.WebSockets.allowedOriginRegexps) == 0 {
+			if len(allowedOrigins) == 0 {
 				return true
 			}
 			origin := strings.TrimSpace(r.Header.Get("Origin"))
 			if len(origin) == 0 {
 				return false
 			}
-			for _, re := range config.Server.WebSockets.allowedOriginRegexps {
+			for _, re := range allowedOrigins {
 				if re.MatchString(origin) {
 					return true
 				}
@@ -193,7 +207,7 @@ func (wl *WSListener) handle(w http.ResponseWriter, r *http.Request) {
 // validate conn.ProxiedIP and conn.Secure against config, HTTP headers, etc.
 func confirmProxyData(conn *utils.WrappedConn, remoteAddr, xForwardedFor, xForwardedProto string, config *Config) {
 	if conn.ProxiedIP != nil {
-		if !utils.IPInNets(utils.AddrToIP(conn.RemoteAddr()), config.Server.proxyAllowedFromNets) {
+		if !utils.IPInNets(utils.AddrToIP(conn.RemoteAddr()), conn.Config.ProxyAllowedFrom) {
 			conn.ProxiedIP = nil
 		}
 	} else if xForwardedFor != "" {
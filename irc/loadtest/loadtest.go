@@ -0,0 +1,399 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+// Package loadtest implements `ergo loadtest`, which connects many simulated
+// clients to a server and measures how quickly it responds to them.
+package loadtest
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ergochat/irc-go/ircmsg"
+	"github.com/ergochat/irc-go/ircreader"
+)
+
+const (
+	// limit on the number of latency samples kept per operation;
+	// past this, we keep a uniform random sample
+	maxSamples = 1 << 20
+
+	messagePrefix = "loadtest "
+)
+
+var (
+	errTimeout = errors.New("timed out waiting for a reply")
+)
+
+// Config describes a load test.
+type Config struct {
+	// address of the server, as host:port
+	Address string
+	TLS     bool
+	// skip verification of the server's certificate
+	InsecureSkipVerify bool
+	// number of simulated clients
+	Clients int
+	// the clients are distributed over this many channels
+	Channels int
+	// how many new connections to open per second
+	ConnectRate int
+	// how long each client stays connected, after joining its channel
+	Duration time.Duration
+	// how often each client sends a message to its channel
+	Interval time.Duration
+	// every NickEvery messages, the client changes its nickname (0 to disable)
+	NickEvery int
+	// how long to wait for the server to respond to each command
+	Timeout time.Duration
+}
+
+// Operation identifies the kind of command being timed.
+type Operation int
+
+const (
+	// from connecting to receiving RPL_WELCOME
+	OpRegister Operation = iota
+	// from sending JOIN to receiving it back
+	OpJoin
+	// from sending PRIVMSG to its delivery to another member of the channel
+	OpMessage
+	// from sending NICK to receiving it back
+	OpNick
+
+	numOperations
+)
+
+func (op Operation) String() string {
+	switch op {
+	case OpRegister:
+		return "register"
+	case OpJoin:
+		return "join"
+	case OpMessage:
+		return "message"
+	case OpNick:
+		return "nick"
+	default:
+		return "unknown"
+	}
+}
+
+// Latencies holds the latency samples for a single operation.
+type Latencies struct {
+	Count   int // total number of samples, including discarded ones
+	samples []time.Duration
+	sorted  bool
+}
+
+func (l *Latencies) add(latency time.Duration) {
+	l.Count++
+	l.sorted = false
+	if len(l.samples) < maxSamples {
+		l.samples = append(l.samples, latency)
+	} else if i := rand.Intn(l.Count); i < maxSamples {
+		l.samples[i] = latency
+	}
+}
+
+// Percentile returns the latency below which the given percentage of samples fall.
+func (l *Latencies) Percentile(percent float64) time.Duration {
+	if len(l.samples) == 0 {
+		return 0
+	}
+	if !l.sorted {
+		sort.Slice(l.samples, func(i, j int) bool { return l.samples[i] < l.samples[j] })
+		l.sorted = true
+	}
+	index := int(percent / 100 * float64(len(l.samples)))
+	if index >= len(l.samples) {
+		index = len(l.samples) - 1
+	}
+	return l.samples[index]
+}
+
+// Results are the results of a load test.
+type Results struct {
+	sync.Mutex
+
+	Connected int
+	Failed    int
+	Errors    map[string]int // counts of client errors, by message
+
+	Latencies [numOperations]Latencies
+}
+
+func (r *Results) record(op Operation, latency time.Duration) {
+	r.Lock()
+	r.Latencies[op].add(latency)
+	r.Unlock()
+}
+
+func (r *Results) recordError(err error) {
+	r.Lock()
+	r.Errors[err.Error()]++
+	r.Unlock()
+}
+
+// Report formats the results as a human-readable table.
+func (r *Results) Report() string {
+	r.Lock()
+	defer r.Unlock()
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "clients: %d connected, %d failed\n", r.Connected, r.Failed)
+	var errs []string
+	for message := range r.Errors {
+		errs = append(errs, message)
+	}
+	sort.Strings(errs)
+	for _, message := range errs {
+		fmt.Fprintf(&buf, "  %dx %s\n", r.Errors[message], message)
+	}
+	fmt.Fprintf(&buf, "%-10s %10s %10s %10s %10s %10s\n", "operation", "count", "p50", "p90", "p99", "max")
+	for op := Operation(0); op < numOperations; op++ {
+		l := &r.Latencies[op]
+		fmt.Fprintf(&buf, "%-10s %10d %10s %10s %10s %10s\n", op, l.Count,
+			formatLatency(l.Percentile(50)), formatLatency(l.Percentile(90)),
+			formatLatency(l.Percentile(99)), formatLatency(l.Percentile(100)))
+	}
+	return buf.String()
+}
+
+func formatLatency(latency time.Duration) string {
+	return latency.Round(10 * time.Microsecond).String()
+}
+
+// Run performs a load test, blocking until all clients have disconnected.
+func Run(config Config) (results *Results) {
+	results = &Results{Errors: make(map[string]int)}
+	if config.Channels < 1 {
+		config.Channels = 1
+	}
+	if config.ConnectRate < 1 {
+		config.ConnectRate = 1
+	}
+	if config.Interval <= 0 {
+		config.Interval = time.Second
+	}
+
+	var wg sync.WaitGroup
+	ticker := time.NewTicker(time.Second / time.Duration(config.ConnectRate))
+	defer ticker.Stop()
+	for i := 0; i < config.Clients; i++ {
+		if i != 0 {
+			<-ticker.C
+		}
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			c := &client{
+				id:      id,
+				config:  &config,
+				results: results,
+				nick:    fmt.Sprintf("lt%d", id),
+				channel: fmt.Sprintf("#loadtest-%d", id%config.Channels),
+			}
+			c.run()
+		}(i)
+	}
+	wg.Wait()
+	return
+}
+
+// a simulated client
+type client struct {
+	id      int
+	config  *Config
+	results *Results
+
+	conn    net.Conn
+	writeMu sync.Mutex
+
+	nick    string
+	channel string
+
+	// lines received from the server, other than PINGs and channel messages
+	lines chan ircmsg.Message
+}
+
+func (c *client) run() {
+	start := time.Now()
+	err := c.connect()
+	if err == nil {
+		err = c.expect(func(msg ircmsg.Message) bool { return msg.Command == "001" })
+	}
+	if err != nil {
+		c.results.Lock()
+		c.results.Failed++
+		c.results.Unlock()
+		c.results.recordError(err)
+		if c.conn != nil {
+			c.conn.Close()
+		}
+		return
+	}
+	c.results.record(OpRegister, time.Since(start))
+	c.results.Lock()
+	c.results.Connected++
+	c.results.Unlock()
+	defer c.conn.Close()
+
+	if err := c.timed(OpJoin, "JOIN", c.channel); err != nil {
+		c.results.recordError(err)
+		return
+	}
+
+	// stagger the clients' messages
+	interval := c.config.Interval
+	time.Sleep(time.Duration(rand.Int63n(int64(interval))))
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	deadline := time.After(c.config.Duration)
+	for count := 1; ; count++ {
+		select {
+		case <-deadline:
+			c.send("QUIT", "load test finished")
+			return
+		case <-ticker.C:
+		}
+		payload := messagePrefix + strconv.FormatInt(time.Now().UnixNano(), 10)
+		if err := c.send("PRIVMSG", c.channel, payload); err != nil {
+			c.results.recordError(err)
+			return
+		}
+		if c.config.NickEvery != 0 && count%c.config.NickEvery == 0 {
+			newNick := fmt.Sprintf("lt%d-%d", c.id, count)
+			if err := c.timed(OpNick, "NICK", newNick); err != nil {
+				c.results.recordError(err)
+				return
+			}
+			c.nick = newNick
+		}
+	}
+}
+
+func (c *client) connect() (err error) {
+	dialer := &net.Dialer{Timeout: c.config.Timeout}
+	if c.config.TLS {
+		c.conn, err = tls.DialWithDialer(dialer, "tcp", c.config.Address, &tls.Config{
+			InsecureSkipVerify: c.config.InsecureSkipVerify,
+		})
+	} else {
+		c.conn, err = dialer.Dial("tcp", c.config.Address)
+	}
+	if err != nil {
+		return
+	}
+	c.lines = make(chan ircmsg.Message, 16)
+	go c.readLoop()
+	if err = c.send("NICK", c.nick); err == nil {
+		err = c.send("USER", "loadtest", "0", "*", "ergo load test")
+	}
+	return
+}
+
+func (c *client) send(command string, params ...string) error {
+	msg := ircmsg.MakeMessage(nil, "", command, params...)
+	line, err := msg.LineBytes()
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err = c.conn.Write(line)
+	return err
+}
+
+// timed sends a command that the server echoes back to us (JOIN or NICK)
+// and records how long the echo took
+func (c *client) timed(op Operation, command string, param string) error {
+	start := time.Now()
+	if err := c.send(command, param); err != nil {
+		return err
+	}
+	err := c.expect(func(msg ircmsg.Message) bool {
+		return msg.Command == command && len(msg.Params) != 0 && msg.Params[0] == param &&
+			strings.HasPrefix(msg.Source, c.nick+"!")
+	})
+	if err == nil {
+		c.results.record(op, time.Since(start))
+	}
+	return err
+}
+
+// expect waits for a line from the server that matches the predicate
+func (c *client) expect(predicate func(ircmsg.Message) bool) error {
+	timeout := time.After(c.config.Timeout)
+	for {
+		select {
+		case msg, ok := <-c.lines:
+			if !ok {
+				return io.ErrUnexpectedEOF
+			}
+			if msg.Command == "ERROR" && len(msg.Params) != 0 {
+				return fmt.Errorf("server error: %s", msg.Params[len(msg.Params)-1])
+			}
+			if predicate(msg) {
+				return nil
+			}
+		case <-timeout:
+			return errTimeout
+		}
+	}
+}
+
+func (c *client) readLoop() {
+	defer close(c.lines)
+	var reader ircreader.Reader
+	reader.Initialize(c.conn, 1024, ircmsg.MaxlenTagsFromClient+512+1024)
+	for {
+		line, err := reader.ReadLine()
+		if err != nil {
+			return
+		}
+		msg, err := ircmsg.ParseLine(string(line))
+		if err != nil {
+			continue
+		}
+		switch msg.Command {
+		case "PING":
+			c.send("PONG", msg.Params...)
+		case "PRIVMSG":
+			// messages from other clients are timed as they arrive
+			if len(msg.Params) == 2 && strings.HasPrefix(msg.Params[1], messagePrefix) {
+				if sent, err := strconv.ParseInt(strings.TrimPrefix(msg.Params[1], messagePrefix), 10, 64); err == nil {
+					c.results.record(OpMessage, time.Since(time.Unix(0, sent)))
+				}
+			}
+		default:
+			c.deliver(msg)
+		}
+	}
+}
+
+// deliver queues a line for expect(). the queue is bounded and discards the
+// oldest lines when full, so lines nobody waits for (e.g., other clients'
+// JOINs) can't block this loop, and therefore the server
+func (c *client) deliver(msg ircmsg.Message) {
+	for {
+		select {
+		case c.lines <- msg:
+			return
+		default:
+		}
+		select {
+		case <-c.lines:
+		default:
+		}
+	}
+}
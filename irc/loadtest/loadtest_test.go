@@ -0,0 +1,35 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package loadtest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	var l Latencies
+	if l.Percentile(50) != 0 {
+		t.Errorf("empty latencies should have zero percentiles")
+	}
+	for i := 100; i > 0; i-- {
+		l.add(time.Duration(i) * time.Millisecond)
+	}
+	check := func(percent float64, expected time.Duration) {
+		if found := l.Percentile(percent); found != expected {
+			t.Errorf("p%v: expected %v, got %v", percent, expected, found)
+		}
+	}
+	check(0, time.Millisecond)
+	check(50, 51*time.Millisecond)
+	check(99, 100*time.Millisecond)
+	check(100, 100*time.Millisecond)
+
+	// adding samples invalidates the sort
+	l.add(time.Second)
+	check(100, time.Second)
+	if l.Count != 101 {
+		t.Errorf("unexpected count %d", l.Count)
+	}
+}
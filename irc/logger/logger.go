@@ -4,7 +4,6 @@
 package logger
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
 	"os"
@@ -78,7 +77,9 @@ type LoggingConfig struct {
 	MethodStdout  bool
 	MethodStderr  bool
 	MethodFile    bool
+	MethodSyslog  bool
 	Filename      string
+	Rotation      RotationConfig
 	TypeString    string   `yaml:"type"`
 	Types         []string `yaml:"real-types"`
 	ExcludedTypes []string `yaml:"real-excluded-types"`
@@ -128,6 +129,7 @@ func (logger *Manager) ApplyConfig(config []LoggingConfig) error {
 			MethodFile: fileMethod{
 				Enabled:  logConfig.MethodFile,
 				Filename: logConfig.Filename,
+				Rotation: logConfig.Rotation,
 			},
 			Level:           logConfig.Level,
 			Types:           typeMap,
@@ -141,13 +143,17 @@ func (logger *Manager) ApplyConfig(config []LoggingConfig) error {
 			atomic.StoreUint32(&logger.loggingRawIO, 1)
 		}
 		if sLogger.MethodFile.Enabled {
-			file, err := os.OpenFile(sLogger.MethodFile.Filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
-			if err != nil {
+			if err := sLogger.MethodFile.open(); err != nil {
 				lastErr = fmt.Errorf("Could not open log file %s [%s]", sLogger.MethodFile.Filename, err.Error())
 			}
-			writer := bufio.NewWriter(file)
-			sLogger.MethodFile.File = file
-			sLogger.MethodFile.Writer = writer
+		}
+		if logConfig.MethodSyslog {
+			syslog, err := openSyslog()
+			if err != nil {
+				lastErr = fmt.Errorf("Could not connect to syslog [%s]", err.Error())
+			} else {
+				sLogger.MethodSyslog = syslog
+			}
 		}
 		logger.loggers = append(logger.loggers, sLogger)
 	}
@@ -190,11 +196,20 @@ func (logger *Manager) Error(logType string, messageParts ...string) {
 	logger.Log(LogError, logType, messageParts...)
 }
 
+// syslogWriter is implemented by *syslog.Writer
+type syslogWriter interface {
+	Debug(string) error
+	Info(string) error
+	Warning(string) error
+	Err(string) error
+	Close() error
+}
+
 type fileMethod struct {
 	Enabled  bool
 	Filename string
-	File     *os.File
-	Writer   *bufio.Writer
+	Rotation RotationConfig
+	*logFile
 }
 
 // singleLogger represents a single logger instance.
@@ -204,12 +219,16 @@ type singleLogger struct {
 	MethodSTDOUT    bool
 	MethodSTDERR    bool
 	MethodFile      fileMethod
+	MethodSyslog    syslogWriter
 	Level           Level
 	Types           map[string]bool
 	ExcludedTypes   map[string]bool
 }
 
 func (logger *singleLogger) Close() error {
+	if logger.MethodSyslog != nil {
+		logger.MethodSyslog.Close()
+	}
 	if logger.MethodFile.Enabled {
 		flushErr := logger.MethodFile.Writer.Flush()
 		closeErr := logger.MethodFile.File.Close()
@@ -224,7 +243,7 @@ func (logger *singleLogger) Close() error {
 // Log logs the given message with the given details.
 func (logger *singleLogger) Log(level Level, logType string, messageParts ...string) {
 	// no logging enabled
-	if !(logger.MethodSTDOUT || logger.MethodSTDERR || logger.MethodFile.Enabled) {
+	if !(logger.MethodSTDOUT || logger.MethodSTDERR || logger.MethodFile.Enabled || logger.MethodSyslog != nil) {
 		return
 	}
 
@@ -244,7 +263,10 @@ func (logger *singleLogger) Log(level Level, logType string, messageParts ...str
 	var rawBuf bytes.Buffer
 	// XXX magic number here: 10 is len("connect-ip"), the longest log category name
 	// in current use. it's not a big deal if this number gets out of date.
-	fmt.Fprintf(&rawBuf, "%s : %-5s : %-10s : ", time.Now().UTC().Format("2006-01-02T15:04:05.000Z"), LogLevelDisplayNames[level], logType)
+	fmt.Fprintf(&rawBuf, "%s : %-5s : ", time.Now().UTC().Format("2006-01-02T15:04:05.000Z"), LogLevelDisplayNames[level])
+	// syslog supplies its own timestamp and level:
+	messageStart := rawBuf.Len()
+	fmt.Fprintf(&rawBuf, "%-10s : ", logType)
 	for i, p := range messageParts {
 		rawBuf.WriteString(p)
 
@@ -267,8 +289,20 @@ func (logger *singleLogger) Log(level Level, logType string, messageParts ...str
 	}
 	if logger.MethodFile.Enabled {
 		logger.fileWriteLock.Lock()
-		logger.MethodFile.Writer.Write(rawBuf.Bytes())
-		logger.MethodFile.Writer.Flush()
+		logger.MethodFile.write(rawBuf.Bytes())
 		logger.fileWriteLock.Unlock()
 	}
+	if logger.MethodSyslog != nil {
+		message := string(rawBuf.Bytes()[messageStart : rawBuf.Len()-1])
+		switch level {
+		case LogDebug:
+			logger.MethodSyslog.Debug(message)
+		case LogInfo:
+			logger.MethodSyslog.Info(message)
+		case LogWarning:
+			logger.MethodSyslog.Warning(message)
+		default:
+			logger.MethodSyslog.Err(message)
+		}
+	}
 }
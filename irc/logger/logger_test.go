@@ -0,0 +1,188 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeSyslog struct {
+	lines []string
+}
+
+func (f *fakeSyslog) record(level, message string) error {
+	f.lines = append(f.lines, fmt.Sprintf("%s %s", level, message))
+	return nil
+}
+
+func (f *fakeSyslog) Debug(message string) error   { return f.record("debug", message) }
+func (f *fakeSyslog) Info(message string) error    { return f.record("info", message) }
+func (f *fakeSyslog) Warning(message string) error { return f.record("warning", message) }
+func (f *fakeSyslog) Err(message string) error     { return f.record("err", message) }
+func (f *fakeSyslog) Close() error                 { return nil }
+
+func TestSyslogMethod(t *testing.T) {
+	syslog := &fakeSyslog{}
+	logger := singleLogger{
+		MethodSyslog:  syslog,
+		Level:         LogInfo,
+		Types:         map[string]bool{"*": true},
+		ExcludedTypes: map[string]bool{"userinput": true},
+	}
+
+	logger.Log(LogDebug, "server", "too verbose")
+	logger.Log(LogInfo, "server", "Started pprof listener", "localhost:6060")
+	logger.Log(LogWarning, "userinput", "excluded")
+	logger.Log(LogError, "internal", "something broke")
+
+	expected := []string{
+		"info server     : Started pprof listener : localhost:6060",
+		"err internal   : something broke",
+	}
+	if !reflect.DeepEqual(syslog.lines, expected) {
+		t.Errorf("expected %#v, got %#v", expected, syslog.lines)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	cases := map[string]int64{
+		"100":   100,
+		"10k":   10 << 10,
+		"100M":  100 << 20,
+		"100MB": 100 << 20,
+		"2G":    2 << 30,
+	}
+	for input, expected := range cases {
+		if result, err := parseSize(input); err != nil || result != expected {
+			t.Errorf("%s: expected %d, got %d (%v)", input, expected, result, err)
+		}
+	}
+	for _, input := range []string{"", "M", "-1", "0", "ten"} {
+		if _, err := parseSize(input); err == nil {
+			t.Errorf("%s: expected an error", input)
+		}
+	}
+}
+
+// waitForRotated waits for the cleanup goroutines to finish with rotated files
+func waitForRotated(t *testing.T, filename string, count int) []rotatedFile {
+	for i := 0; i < 100; i++ {
+		rotationMutex.Lock()
+		rotated := listRotated(filename)
+		rotationMutex.Unlock()
+		if len(rotated) == count {
+			return rotated
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected %d rotated files, got %v", count, listRotated(filename))
+	return nil
+}
+
+func TestRotation(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "ircd.log")
+	rotation := RotationConfig{MaxSize: "1K", Retain: 2, Compress: true}
+	if err := rotation.Postprocess(); err != nil {
+		t.Fatal(err)
+	}
+	logger := singleLogger{
+		MethodFile:    fileMethod{Enabled: true, Filename: filename, Rotation: rotation},
+		Level:         LogInfo,
+		Types:         map[string]bool{"*": true},
+		ExcludedTypes: map[string]bool{},
+		fileWriteLock: new(sync.Mutex),
+	}
+	if err := logger.MethodFile.open(); err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	line := strings.Repeat("x", 250)
+	// each file holds 3 lines, so this rotates 3 times
+	for i := 0; i < 10; i++ {
+		logger.Log(LogInfo, "server", fmt.Sprintf("%d", i), line)
+		// ensure distinct timestamps for the rotated files
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	rotated := waitForRotated(t, filename, 2)
+	for _, file := range rotated {
+		if !strings.HasSuffix(file.path, compressedSuffix) {
+			t.Errorf("rotated file should be compressed: %s", file.path)
+		}
+	}
+	// the oldest retained file starts with line 3:
+	f, err := os.Open(rotated[0].path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	reader, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(contents), "server     : 3 : ") || strings.Count(string(contents), "\n") != 3 {
+		t.Errorf("unexpected contents of rotated file: %s", contents)
+	}
+
+	current, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(current), "\n") != 1 || !strings.Contains(string(current), "server     : 9 : ") {
+		t.Errorf("unexpected contents of current file: %s", current)
+	}
+}
+
+func TestRotationFailure(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "ircd.log")
+	rotation := RotationConfig{MaxSize: "1K"}
+	if err := rotation.Postprocess(); err != nil {
+		t.Fatal(err)
+	}
+	var renames int
+	renameFile = func(oldpath, newpath string) error {
+		renames++
+		return os.ErrPermission
+	}
+	defer func() { renameFile = os.Rename }()
+
+	method := fileMethod{Enabled: true, Filename: filename, Rotation: rotation}
+	if err := method.open(); err != nil {
+		t.Fatal(err)
+	}
+	defer method.File.Close()
+
+	line := []byte(strings.Repeat("x", 250) + "\n")
+	for i := 0; i < 10; i++ {
+		method.write(line)
+	}
+	// the failed rotation isn't retried on every write:
+	if renames != 1 {
+		t.Errorf("expected 1 rotation attempt, got %d", renames)
+	}
+	if method.size != int64(10*len(line)) {
+		t.Errorf("expected all lines in the current file, size is %d", method.size)
+	}
+
+	// once the retry interval has passed, rotation is attempted again
+	method.retryRotation = time.Now().Add(-time.Second)
+	method.write(line)
+	if renames != 2 {
+		t.Errorf("expected 2 rotation attempts, got %d", renames)
+	}
+}
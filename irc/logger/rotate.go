@@ -0,0 +1,260 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package logger
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ergochat/ergo/irc/custime"
+)
+
+const (
+	// rotated files are named like ircd.log.2006-01-02T15-04-05.000,
+	// so that lexicographic order is chronological order
+	rotationTimeFormat = "2006-01-02T15-04-05.000"
+	compressedSuffix   = ".gz"
+	// after a failed rotation, how long to keep writing to the current
+	// file before trying again
+	rotationRetryInterval = time.Minute
+)
+
+var (
+	// serializes compression and deletion of rotated files (tier 0)
+	rotationMutex sync.Mutex
+
+	// for testing:
+	renameFile = os.Rename
+)
+
+// RotationConfig controls rotation of log files.
+type RotationConfig struct {
+	// rotate the file when it would exceed this size, e.g., "100M"
+	MaxSize string `yaml:"max-size"`
+	// rotate the file when it is older than this
+	MaxAge custime.Duration `yaml:"max-age"`
+	// number of rotated files to keep; 0 keeps all of them
+	Retain int
+	// compress rotated files with gzip
+	Compress bool
+
+	maxSize int64
+}
+
+// Postprocess validates the config and computes derived fields.
+func (config *RotationConfig) Postprocess() (err error) {
+	if config.MaxSize != "" {
+		config.maxSize, err = parseSize(config.MaxSize)
+		if err != nil {
+			return err
+		}
+	}
+	if config.MaxAge < 0 || config.Retain < 0 {
+		return fmt.Errorf("log rotation values cannot be negative")
+	}
+	return nil
+}
+
+func (config *RotationConfig) enabled() bool {
+	return config.maxSize != 0 || config.MaxAge != 0
+}
+
+// parseSize parses a size in bytes, with an optional suffix like K, M, or G
+func parseSize(input string) (result int64, err error) {
+	str := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(input)), "B")
+	multiplier := int64(1)
+	if len(str) != 0 {
+		switch str[len(str)-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		}
+		if multiplier != 1 {
+			str = str[:len(str)-1]
+		}
+	}
+	result, err = strconv.ParseInt(str, 10, 64)
+	if err != nil || result <= 0 {
+		return 0, fmt.Errorf("invalid log rotation size: %s", input)
+	}
+	return result * multiplier, nil
+}
+
+// logFile is the open state of a log file; it's shared between copies
+// of a singleLogger and is protected by the Manager's fileWriteLock.
+type logFile struct {
+	File   *os.File
+	Writer *bufio.Writer
+	size   int64
+	// when the current file was started, for age-based rotation
+	started time.Time
+	// if the last rotation failed, when to try again
+	retryRotation time.Time
+}
+
+func (method *fileMethod) open() error {
+	file, err := os.OpenFile(method.Filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
+	method.logFile = &logFile{
+		File:    file,
+		Writer:  bufio.NewWriter(file),
+		started: time.Now().UTC(),
+	}
+	if err != nil {
+		return err
+	}
+	if stat, err := file.Stat(); err == nil {
+		method.size = stat.Size()
+	}
+	if method.size != 0 && method.Rotation.MaxAge != 0 {
+		// the existing file was started when the previous one was rotated
+		if rotated := listRotated(method.Filename); len(rotated) != 0 {
+			method.started = rotated[len(rotated)-1].time
+		}
+	}
+	return nil
+}
+
+// write writes a line to the file, rotating it first if necessary;
+// the caller must hold fileWriteLock
+func (method *fileMethod) write(line []byte) {
+	if method.needsRotation(len(line)) {
+		method.rotate()
+	}
+	n, _ := method.Writer.Write(line)
+	method.Writer.Flush()
+	method.size += int64(n)
+}
+
+func (method *fileMethod) needsRotation(length int) bool {
+	if method.File == nil || method.size == 0 || !method.Rotation.enabled() {
+		return false
+	}
+	if !method.retryRotation.IsZero() && time.Now().Before(method.retryRotation) {
+		return false
+	}
+	maxSize := method.Rotation.maxSize
+	maxAge := time.Duration(method.Rotation.MaxAge)
+	return (maxSize != 0 && maxSize < method.size+int64(length)) ||
+		(maxAge != 0 && maxAge <= time.Since(method.started))
+}
+
+func (method *fileMethod) rotate() {
+	method.Writer.Flush()
+	method.File.Close()
+	rotated := fmt.Sprintf("%s.%s", method.Filename, time.Now().UTC().Format(rotationTimeFormat))
+	renameErr := renameFile(method.Filename, rotated)
+	if err := method.open(); err != nil {
+		// nowhere else to report this:
+		fmt.Fprintf(os.Stderr, "Could not reopen log file %s [%s]\n", method.Filename, err.Error())
+	}
+	if renameErr == nil {
+		go cleanupRotated(method.Filename, rotated, method.Rotation)
+	} else {
+		// keep appending to the current file for now, rather than
+		// retrying (and failing) on every write:
+		fmt.Fprintf(os.Stderr, "Could not rotate log file %s [%s]\n", method.Filename, renameErr.Error())
+		method.retryRotation = time.Now().Add(rotationRetryInterval)
+	}
+}
+
+type rotatedFile struct {
+	path string
+	time time.Time
+}
+
+// listRotated returns the rotated versions of filename, oldest first;
+// a file that is currently being compressed may appear twice
+func listRotated(filename string) (result []rotatedFile) {
+	dir, base := filepath.Split(filename)
+	prefix := base + "."
+	entries, err := os.ReadDir(filepath.Clean(dir + "."))
+	if err != nil {
+		return nil
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		timestamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), compressedSuffix)
+		t, err := time.Parse(rotationTimeFormat, timestamp)
+		if err != nil {
+			continue
+		}
+		result = append(result, rotatedFile{path: dir + name, time: t})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].path < result[j].path })
+	return
+}
+
+func cleanupRotated(filename, rotated string, config RotationConfig) {
+	rotationMutex.Lock()
+	defer rotationMutex.Unlock()
+
+	if config.Compress {
+		if err := compressFile(rotated); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not compress rotated log file %s [%s]\n", rotated, err.Error())
+		}
+	}
+
+	if config.Retain == 0 {
+		return
+	}
+	files := listRotated(filename)
+	// count distinct rotations, not files:
+	var times []time.Time
+	for _, file := range files {
+		if len(times) == 0 || !times[len(times)-1].Equal(file.time) {
+			times = append(times, file.time)
+		}
+	}
+	if len(times) <= config.Retain {
+		return
+	}
+	cutoff := times[len(times)-config.Retain]
+	for _, file := range files {
+		if file.time.Before(cutoff) {
+			os.Remove(file.path)
+		}
+	}
+}
+
+func compressFile(path string) (err error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer in.Close()
+
+	compressed := path + compressedSuffix
+	out, err := os.OpenFile(compressed, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return
+	}
+	writer := gzip.NewWriter(out)
+	_, err = io.Copy(writer, in)
+	if err == nil {
+		err = writer.Close()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(compressed)
+		return
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,15 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package logger
+
+import (
+	"log/syslog"
+)
+
+func openSyslog() (syslogWriter, error) {
+	return syslog.New(syslog.LOG_DAEMON|syslog.LOG_INFO, "ergo")
+}
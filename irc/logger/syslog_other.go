@@ -0,0 +1,15 @@
+//go:build windows || plan9
+// +build windows plan9
+
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package logger
+
+import (
+	"errors"
+)
+
+func openSyslog() (syslogWriter, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
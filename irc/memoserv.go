@@ -0,0 +1,341 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package irc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidwall/buntdb"
+
+	"github.com/ergochat/ergo/irc/email"
+)
+
+const (
+	memoservHelp = `MemoServ lets you send short messages to registered users
+who are offline; they'll receive them the next time they log in.`
+)
+
+func memoservEnabled(config *Config) bool {
+	return config.Accounts.AuthenticationEnabled && config.Accounts.Memos.Enabled
+}
+
+var (
+	memoservCommands = map[string]*serviceCommand{
+		"send": {
+			handler: msSendHandler,
+			help: `Syntax: $bSEND <account> <message>$b
+
+SEND stores a memo for the given account, which will be delivered the next
+time they log in.`,
+			helpShort:         `$bSEND$b sends a memo to an account.`,
+			authRequired:      true,
+			enabled:           memoservEnabled,
+			minParams:         2,
+			maxParams:         2,
+			unsplitFinalParam: true,
+		},
+		"list": {
+			handler: msListHandler,
+			help: `Syntax: $bLIST$b
+
+LIST lists the memos stored for your account.`,
+			helpShort:    `$bLIST$b lists your memos.`,
+			authRequired: true,
+			enabled:      memoservEnabled,
+		},
+		"read": {
+			handler: msReadHandler,
+			help: `Syntax: $bREAD <number>$b
+
+READ displays one of your memos, by its number in $bLIST$b.`,
+			helpShort:    `$bREAD$b displays a memo.`,
+			authRequired: true,
+			enabled:      memoservEnabled,
+			minParams:    1,
+			maxParams:    1,
+		},
+		"del": {
+			handler: msDelHandler,
+			help: `Syntax: $bDEL <number>|ALL$b
+
+DEL deletes one of your memos, by its number in $bLIST$b, or all of them.`,
+			helpShort:    `$bDEL$b deletes memos.`,
+			authRequired: true,
+			enabled:      memoservEnabled,
+			minParams:    1,
+			maxParams:    1,
+		},
+	}
+)
+
+// Memo is a message stored for an account by MemoServ
+type Memo struct {
+	Sender string
+	Time   time.Time
+	Text   string
+	Read   bool
+}
+
+func (am *AccountManager) loadMemosTx(tx *buntdb.Tx, account string) (memos []Memo) {
+	raw, err := tx.Get(fmt.Sprintf(keyAccountMemos, account))
+	if err == nil {
+		json.Unmarshal([]byte(raw), &memos)
+	}
+	return
+}
+
+func (am *AccountManager) saveMemosTx(tx *buntdb.Tx, account string, memos []Memo) (err error) {
+	key := fmt.Sprintf(keyAccountMemos, account)
+	if len(memos) == 0 {
+		tx.Delete(key)
+		return nil
+	}
+	raw, err := json.Marshal(memos)
+	if err != nil {
+		return
+	}
+	_, _, err = tx.Set(key, string(raw), nil)
+	return
+}
+
+// SendMemo stores a memo from `sender` for the account `recipient`,
+// returning whether it is the recipient's only unread memo
+func (am *AccountManager) SendMemo(sender, recipient, text string, read bool) (onlyUnread bool, err error) {
+	cfRecipient, err := CasefoldName(recipient)
+	if err != nil {
+		return false, errAccountDoesNotExist
+	}
+	account, err := am.LoadAccount(cfRecipient)
+	if err != nil {
+		return false, errAccountDoesNotExist
+	} else if !account.Verified {
+		return false, errAccountUnverified
+	}
+
+	limit := am.server.Config().Accounts.Memos.MaxMemos
+	memo := Memo{
+		Sender: sender,
+		Time:   time.Now().UTC(),
+		Text:   text,
+		Read:   read,
+	}
+	err = am.server.store.Update(func(tx *buntdb.Tx) error {
+		memos := am.loadMemosTx(tx, cfRecipient)
+		if limit != 0 && limit <= len(memos) {
+			return errLimitExceeded
+		}
+		onlyUnread = !read
+		for _, existing := range memos {
+			if !existing.Read {
+				onlyUnread = false
+			}
+		}
+		return am.saveMemosTx(tx, cfRecipient, append(memos, memo))
+	})
+	return
+}
+
+// sendMemoNotification e-mails an offline user about a new memo
+func (am *AccountManager) sendMemoNotification(sender, recipient string) {
+	config := am.server.Config()
+	emailConfig := config.Accounts.Registration.EmailVerification
+	if !config.Accounts.Memos.EmailNotifications || !emailConfig.Enabled {
+		return
+	}
+	account, err := am.LoadAccount(recipient)
+	// only e-mail addresses the user has confirmed, and respect their opt-out
+	settings := account.Settings
+	if err != nil || settings.Email == "" || !settings.EmailVerified || settings.DisableMemoEmails {
+		return
+	}
+
+	// the recipient is offline, so use the language preferences stored with their account
+	lm := am.server.Languages()
+	t := func(s string) string {
+		return lm.Translate(account.Settings.Languages, s)
+	}
+	subject := fmt.Sprintf(t("New memo on %s"), am.server.name)
+	message := email.ComposeMail(emailConfig, account.Settings.Email, subject)
+	fmt.Fprintf(&message, t("%[1]s sent a memo to your account %[2]s on %[3]s."), sender, account.Name, am.server.name)
+	message.WriteString("\r\n")
+	message.WriteString(t("To read it, log in and issue the following command:"))
+	message.WriteString("\r\n")
+	message.WriteString("/MSG MemoServ LIST\r\n")
+
+	err = email.SendMail(emailConfig, account.Settings.Email, message.Bytes())
+	if err != nil {
+		am.server.logger.Error("internal", "Failed to dispatch e-mail to", account.Settings.Email, err.Error())
+	}
+}
+
+// LoadMemos returns the memos stored for an account
+func (am *AccountManager) LoadMemos(account string) (memos []Memo) {
+	am.server.store.View(func(tx *buntdb.Tx) error {
+		memos = am.loadMemosTx(tx, account)
+		return nil
+	})
+	return
+}
+
+// MarkMemoRead marks the memo at `index` as read, or all memos if `index` is negative
+func (am *AccountManager) MarkMemoRead(account string, index int) (err error) {
+	return am.server.store.Update(func(tx *buntdb.Tx) error {
+		memos := am.loadMemosTx(tx, account)
+		for i := range memos {
+			if index < 0 || i == index {
+				memos[i].Read = true
+			}
+		}
+		return am.saveMemosTx(tx, account, memos)
+	})
+}
+
+// DeleteMemo deletes the memo at `index`, or all memos if `index` is negative
+func (am *AccountManager) DeleteMemo(account string, index int) (err error) {
+	return am.server.store.Update(func(tx *buntdb.Tx) error {
+		memos := am.loadMemosTx(tx, account)
+		if index < 0 {
+			memos = nil
+		} else if index < len(memos) {
+			memos = append(memos[:index], memos[index+1:]...)
+		} else {
+			return errNoop
+		}
+		return am.saveMemosTx(tx, account, memos)
+	})
+}
+
+func formatMemo(client *Client, index int, memo Memo) string {
+	return fmt.Sprintf(client.t("%[1]d. [%[2]s] From %[3]s: %[4]s"), index+1, memo.Time.Format(time.RFC1123), memo.Sender, memo.Text)
+}
+
+// deliverMemos sends any unread memos to a client that just logged in
+func deliverMemos(client *Client, rb *ResponseBuffer) {
+	server := client.server
+	if !memoservEnabled(server.Config()) {
+		return
+	}
+	account := client.Account()
+	if account == "" {
+		return
+	}
+	memos := server.accounts.LoadMemos(account)
+	var unread int
+	for _, memo := range memos {
+		if !memo.Read {
+			unread++
+		}
+	}
+	if unread == 0 {
+		return
+	}
+	server.accounts.MarkMemoRead(account, -1)
+	memoservService.Notice(rb, fmt.Sprintf(client.t("You have %d new memo(s):"), unread))
+	for i, memo := range memos {
+		if !memo.Read {
+			memoservService.Notice(rb, formatMemo(client, i, memo))
+		}
+	}
+}
+
+func msSendHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
+	recipient, text := params[0], params[1]
+
+	if throttled, remainingTime := client.checkMemoThrottle(server.Config()); throttled {
+		service.Notice(rb, fmt.Sprintf(client.t("Please wait at least %v and try again"), remainingTime.Round(time.Second)))
+		return
+	}
+
+	online := server.accounts.AccountToClients(recipient)
+	onlyUnread, err := server.accounts.SendMemo(client.AccountName(), recipient, text, len(online) != 0)
+	switch err {
+	case nil:
+		service.Notice(rb, fmt.Sprintf(client.t("Sent a memo to %s"), recipient))
+		if onlyUnread {
+			go server.accounts.sendMemoNotification(client.AccountName(), recipient)
+		}
+	case errAccountDoesNotExist, errAccountUnverified:
+		service.Notice(rb, client.t("No such account"))
+		return
+	case errLimitExceeded:
+		service.Notice(rb, fmt.Sprintf(client.t("%s has too many stored memos"), recipient))
+		return
+	default:
+		server.logger.Error("services", "couldn't store memo", err.Error())
+		service.Notice(rb, client.t("An error occurred"))
+		return
+	}
+
+	// if the recipient is online, deliver it now
+	now := time.Now().UTC().Format(time.RFC1123)
+	for _, target := range online {
+		target.Send(nil, service.prefix, "NOTICE", target.Nick(), fmt.Sprintf(target.t("New memo [%[1]s] from %[2]s: %[3]s"), now, client.AccountName(), text))
+	}
+}
+
+func msListHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
+	memos := server.accounts.LoadMemos(client.Account())
+	if len(memos) == 0 {
+		service.Notice(rb, client.t("You have no memos"))
+		return
+	}
+	service.Notice(rb, fmt.Sprintf(client.t("You have %d memo(s):"), len(memos)))
+	for i, memo := range memos {
+		status := ""
+		if !memo.Read {
+			status = client.t(" (unread)")
+		}
+		service.Notice(rb, fmt.Sprintf(client.t("%[1]d. [%[2]s] From %[3]s%[4]s"), i+1, memo.Time.Format(time.RFC1123), memo.Sender, status))
+	}
+}
+
+func parseMemoIndex(param string, count int) (index int, ok bool) {
+	number, err := strconv.Atoi(param)
+	if err != nil || number < 1 || count < number {
+		return
+	}
+	return number - 1, true
+}
+
+func msReadHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
+	account := client.Account()
+	memos := server.accounts.LoadMemos(account)
+	index, ok := parseMemoIndex(params[0], len(memos))
+	if !ok {
+		service.Notice(rb, client.t("No such memo"))
+		return
+	}
+	if !memos[index].Read {
+		server.accounts.MarkMemoRead(account, index)
+	}
+	service.Notice(rb, formatMemo(client, index, memos[index]))
+}
+
+func msDelHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
+	account := client.Account()
+	index := -1
+	if strings.ToLower(params[0]) != "all" {
+		var ok bool
+		index, ok = parseMemoIndex(params[0], len(server.accounts.LoadMemos(account)))
+		if !ok {
+			service.Notice(rb, client.t("No such memo"))
+			return
+		}
+	}
+
+	err := server.accounts.DeleteMemo(account, index)
+	if err == errNoop {
+		service.Notice(rb, client.t("No such memo"))
+	} else if err != nil {
+		service.Notice(rb, client.t("An error occurred"))
+	} else if index < 0 {
+		service.Notice(rb, client.t("Deleted all your memos"))
+	} else {
+		service.Notice(rb, fmt.Sprintf(client.t("Deleted memo %d"), index+1))
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package irc
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tidwall/buntdb"
+
+	"github.com/ergochat/ergo/irc/languages"
+	"github.com/ergochat/ergo/irc/logger"
+)
+
+func newMemoTestServer(t *testing.T, maxMemos int) *Server {
+	var config Config
+	config.languageManager = new(languages.Manager)
+	config.Accounts.AuthenticationEnabled = true
+	config.Accounts.Memos.Enabled = true
+	config.Accounts.Memos.MaxMemos = maxMemos
+	store, err := buntdb.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	server := &Server{store: store, logger: new(logger.Manager)}
+	server.config.Set(&config)
+	server.accounts.server = server
+
+	store.Update(func(tx *buntdb.Tx) error {
+		for _, name := range []string{"alice", "bob"} {
+			tx.Set(fmt.Sprintf(keyAccountExists, name), "1", nil)
+			tx.Set(fmt.Sprintf(keyAccountName, name), name, nil)
+			tx.Set(fmt.Sprintf(keyAccountCredentials, name), "{}", nil)
+		}
+		// bob's account was never verified
+		tx.Set(fmt.Sprintf(keyAccountVerified, "alice"), "1", nil)
+		return nil
+	})
+	return server
+}
+
+func TestSendMemo(t *testing.T) {
+	type send struct {
+		recipient  string
+		read       bool
+		onlyUnread bool
+		err        error
+	}
+	testCases := []struct {
+		name     string
+		maxMemos int
+		sends    []send
+		// the number of memos alice ends up with
+		stored int
+	}{
+		{
+			name: "first unread memo",
+			sends: []send{
+				{recipient: "alice", onlyUnread: true},
+				{recipient: "alice"},
+			},
+			stored: 2,
+		},
+		{
+			name: "read memos don't count as unread",
+			sends: []send{
+				{recipient: "alice", read: true},
+				{recipient: "alice", onlyUnread: true},
+			},
+			stored: 2,
+		},
+		{
+			name: "recipient is casefolded",
+			sends: []send{
+				{recipient: "ALICE", onlyUnread: true},
+			},
+			stored: 1,
+		},
+		{
+			name: "unknown and unverified accounts",
+			sends: []send{
+				{recipient: "eve", err: errAccountDoesNotExist},
+				{recipient: "bob", err: errAccountUnverified},
+				{recipient: "*", err: errAccountDoesNotExist},
+			},
+			stored: 0,
+		},
+		{
+			name:     "limit",
+			maxMemos: 2,
+			sends: []send{
+				{recipient: "alice", onlyUnread: true},
+				{recipient: "alice"},
+				{recipient: "alice", err: errLimitExceeded},
+				{recipient: "alice", read: true, err: errLimitExceeded},
+			},
+			stored: 2,
+		},
+		{
+			name:     "no limit",
+			maxMemos: 0,
+			sends: []send{
+				{recipient: "alice", onlyUnread: true},
+				{recipient: "alice"},
+				{recipient: "alice"},
+				{recipient: "alice"},
+			},
+			stored: 4,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			server := newMemoTestServer(t, testCase.maxMemos)
+			am := &server.accounts
+			for i, send := range testCase.sends {
+				onlyUnread, err := am.SendMemo("carol", send.recipient, fmt.Sprintf("memo %d", i), send.read)
+				if err != send.err || (err == nil && onlyUnread != send.onlyUnread) {
+					t.Fatalf("send %d to %s: got (%t, %v), expected (%t, %v)", i, send.recipient, onlyUnread, err, send.onlyUnread, send.err)
+				}
+			}
+			assertEqual(len(am.LoadMemos("alice")), testCase.stored)
+			assertEqual(len(am.LoadMemos("bob")), 0)
+		})
+	}
+}
+
+func TestLoadMemos(t *testing.T) {
+	server := newMemoTestServer(t, 0)
+	am := &server.accounts
+	assertEqual(len(am.LoadMemos("alice")), 0)
+
+	before := time.Now().UTC()
+	am.SendMemo("carol", "alice", "hello", false)
+	am.SendMemo("dave", "alice", "goodbye", true)
+	memos := am.LoadMemos("alice")
+	assertEqual(len(memos), 2)
+	// memos are kept in the order they were sent
+	assertEqual(memos[0].Sender, "carol")
+	assertEqual(memos[0].Text, "hello")
+	assertEqual(memos[0].Read, false)
+	assertEqual(memos[1].Sender, "dave")
+	assertEqual(memos[1].Read, true)
+	if memos[0].Time.Before(before.Add(-time.Second)) || memos[0].Time.After(time.Now().Add(time.Second)) {
+		t.Errorf("unexpected memo time %v", memos[0].Time)
+	}
+
+	// reading and deleting
+	assertEqual(am.MarkMemoRead("alice", 0), nil)
+	assertEqual(am.LoadMemos("alice")[0].Read, true)
+	assertEqual(am.DeleteMemo("alice", 0), nil)
+	memos = am.LoadMemos("alice")
+	assertEqual(len(memos), 1)
+	assertEqual(memos[0].Sender, "dave")
+	assertEqual(am.DeleteMemo("alice", 1), errNoop)
+	assertEqual(am.DeleteMemo("alice", -1), nil)
+	assertEqual(len(am.LoadMemos("alice")), 0)
+}
+
+func TestMemoThrottle(t *testing.T) {
+	var config Config
+	config.Accounts.Memos.Throttling.Duration = time.Minute
+	config.Accounts.Memos.Throttling.MaxSends = 2
+	client := new(Client)
+
+	throttled, _ := client.checkMemoThrottle(&config)
+	assertEqual(throttled, false)
+	throttled, _ = client.checkMemoThrottle(&config)
+	assertEqual(throttled, false)
+	throttled, remaining := client.checkMemoThrottle(&config)
+	assertEqual(throttled, true)
+	if remaining <= 0 || remaining > time.Minute {
+		t.Errorf("unexpected remaining time %v", remaining)
+	}
+	// each client is throttled separately
+	throttled, _ = new(Client).checkMemoThrottle(&config)
+	assertEqual(throttled, false)
+
+	// a limit of 0 disables the throttle
+	config.Accounts.Memos.Throttling.MaxSends = 0
+	throttled, _ = client.checkMemoThrottle(&config)
+	assertEqual(throttled, false)
+}
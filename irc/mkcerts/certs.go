@@ -17,7 +17,9 @@ import (
 )
 
 // CreateCertBytes creates a testing ECDSA certificate, returning the cert and key bytes.
-func CreateCertBytes(orgName string, host string) (certBytes []byte, keyBytes []byte, err error) {
+// hosts are the hostnames and IP addresses to list in the certificate, in addition
+// to localhost; the first one (if any) is used as the common name.
+func CreateCertBytes(orgName string, hosts []string) (certBytes []byte, keyBytes []byte, err error) {
 	validFrom := time.Now()
 	validFor := 365 * 24 * time.Hour
 	notAfter := validFrom.Add(validFor)
@@ -33,10 +35,16 @@ func CreateCertBytes(orgName string, host string) (certBytes []byte, keyBytes []
 		return nil, nil, fmt.Errorf("failed to generate serial number: %s", err)
 	}
 
+	var commonName string
+	if len(hosts) != 0 {
+		commonName = hosts[0]
+	}
+
 	template := x509.Certificate{
 		SerialNumber: serialNumber,
 		Subject: pkix.Name{
 			Organization: []string{orgName},
+			CommonName:   commonName,
 		},
 		NotBefore: validFrom,
 		NotAfter:  notAfter,
@@ -46,13 +54,18 @@ func CreateCertBytes(orgName string, host string) (certBytes []byte, keyBytes []
 		BasicConstraintsValid: true,
 	}
 
-	// TODO: allow explicitly listing allowed addresses/names
-	template.IPAddresses = append(template.IPAddresses, net.ParseIP("127.0.0.1"))
-	template.IPAddresses = append(template.IPAddresses, net.ParseIP("::1"))
-	if host != "" {
-		template.DNSNames = append(template.DNSNames, host)
+	seen := make(map[string]bool)
+	for _, host := range append(hosts, "localhost", "127.0.0.1", "::1") {
+		if host == "" || seen[host] {
+			continue
+		}
+		seen[host] = true
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
 	}
-	template.DNSNames = append(template.DNSNames, "localhost")
 
 	derBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
 	if err != nil {
@@ -71,8 +84,8 @@ func CreateCertBytes(orgName string, host string) (certBytes []byte, keyBytes []
 }
 
 // CreateCert creates a testing ECDSA certificate, outputting the cert and key at the given filenames.
-func CreateCert(orgName string, host string, certFilename string, keyFilename string) error {
-	certBytes, keyBytes, err := CreateCertBytes(orgName, host)
+func CreateCert(orgName string, hosts []string, certFilename string, keyFilename string) error {
+	certBytes, keyBytes, err := CreateCertBytes(orgName, hosts)
 
 	if err != nil {
 		return err
@@ -0,0 +1,43 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package mkcerts
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"reflect"
+	"testing"
+)
+
+func TestCreateCertBytes(t *testing.T) {
+	certBytes, keyBytes, err := CreateCertBytes("Ergo", []string{"irc.example.com", "192.0.2.5", "localhost", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, err := tls.X509KeyPair(certBytes, keyBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cert.Subject.CommonName != "irc.example.com" {
+		t.Errorf("unexpected common name %s", cert.Subject.CommonName)
+	}
+	if !reflect.DeepEqual(cert.DNSNames, []string{"irc.example.com", "localhost"}) {
+		t.Errorf("unexpected DNS names %v", cert.DNSNames)
+	}
+	var ips []string
+	for _, ip := range cert.IPAddresses {
+		ips = append(ips, ip.String())
+	}
+	if !reflect.DeepEqual(ips, []string{"192.0.2.5", "127.0.0.1", "::1"}) {
+		t.Errorf("unexpected IP addresses %v", ips)
+	}
+	if err := cert.VerifyHostname("irc.example.com"); err != nil {
+		t.Error(err)
+	}
+}
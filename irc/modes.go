@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ergochat/ergo/irc/modes"
 	"github.com/ergochat/ergo/irc/sno"
@@ -258,6 +259,22 @@ func (channel *Channel) ApplyChannelModeChanges(client *Client, isSamode bool, c
 				applied = append(applied, change)
 			}
 
+		case modes.JoinThrottle:
+			switch change.Op {
+			case modes.Add:
+				limit, duration, err := parseJoinThrottle(change.Arg)
+				if err == nil {
+					channel.setJoinThrottle(limit, duration)
+					change.Arg = fmt.Sprintf("%d:%d", limit, int(duration/time.Second))
+					applied = append(applied, change)
+				} else {
+					rb.Add(nil, client.server.name, ERR_INVALIDMODEPARAM, details.nick, chname, string(change.Mode), utils.SafeErrorParam(change.Arg), fmt.Sprintf(client.t("Invalid mode %[1]s parameter: %[2]s"), string(change.Mode), change.Arg))
+				}
+			case modes.Remove:
+				channel.setJoinThrottle(0, 0)
+				applied = append(applied, change)
+			}
+
 		case modes.Forward:
 			switch change.Op {
 			case modes.Add:
@@ -347,6 +364,33 @@ func (channel *Channel) ApplyChannelModeChanges(client *Client, isSamode bool, c
 	return applied
 }
 
+const (
+	// bounds on the +j parameter; the duration bound also keeps
+	// the conversion to time.Duration from overflowing
+	maxJoinThrottleLimit   = 1000
+	maxJoinThrottleSeconds = 7 * 24 * 60 * 60
+)
+
+// parses a +j parameter of the form <joins>:<seconds>
+func parseJoinThrottle(arg string) (limit int, duration time.Duration, err error) {
+	if arg == "" {
+		return
+	}
+	limitStr, secondsStr, found := strings.Cut(arg, ":")
+	if !found {
+		return 0, 0, errInvalidParams
+	}
+	limit, err = strconv.Atoi(limitStr)
+	if err != nil || limit <= 0 || maxJoinThrottleLimit < limit {
+		return 0, 0, errInvalidParams
+	}
+	seconds, err := strconv.Atoi(secondsStr)
+	if err != nil || seconds <= 0 || maxJoinThrottleSeconds < seconds {
+		return 0, 0, errInvalidParams
+	}
+	return limit, time.Duration(seconds) * time.Second, nil
+}
+
 // tests whether l > r, in the channel-user mode ordering (e.g., Halfop > Voice)
 func umodeGreaterThan(l modes.Mode, r modes.Mode) bool {
 	for _, mode := range modes.ChannelUserModes {
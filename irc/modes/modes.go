@@ -17,14 +17,15 @@ var (
 	// SupportedUserModes are the user modes that we actually support (modifying).
 	SupportedUserModes = Modes{
 		Bot, Invisible, Operator, RegisteredOnly, ServerNotice, UserRoleplaying,
-		UserNoCTCP,
+		UserNoCTCP, CallerID,
 	}
 
 	// SupportedChannelModes are the channel modes that we support.
 	SupportedChannelModes = Modes{
 		BanMask, ChanRoleplaying, ExceptMask, InviteMask, InviteOnly, Key,
 		Moderated, NoOutside, OpOnlyTopic, RegisteredOnly, RegisteredOnlySpeak,
-		Secret, UserLimit, NoCTCP, Auditorium, OpModerated, Forward,
+		Secret, UserLimit, NoCTCP, Auditorium, OpModerated, Forward, JoinThrottle,
+		SecureOnly,
 	}
 )
 
@@ -86,6 +87,29 @@ func (changes ModeChanges) Strings() (result []string) {
 	return
 }
 
+// Split divides the changes into groups, each of which can be rendered
+// by Strings() (joined with spaces) in at most maxLen bytes.
+func (changes ModeChanges) Split(maxLen int) (result []ModeChanges) {
+	var length int
+	start := 0
+	for i, change := range changes {
+		// conservatively assume that every mode is preceded by its op
+		changeLen := 2
+		if change.Arg != "" {
+			changeLen += 1 + len(change.Arg)
+		}
+		if start < i && maxLen < length+changeLen {
+			result = append(result, changes[start:i])
+			start, length = i, 0
+		}
+		length += changeLen
+	}
+	if start < len(changes) {
+		result = append(result, changes[start:])
+	}
+	return
+}
+
 // Modes is just a raw list of modes
 type Modes []Mode
 
@@ -100,6 +124,7 @@ func (modes Modes) String() string {
 // User Modes
 const (
 	Bot             Mode = 'B'
+	CallerID        Mode = 'g'
 	Invisible       Mode = 'i'
 	Operator        Mode = 'o'
 	Restricted      Mode = 'r'
@@ -130,6 +155,8 @@ const (
 	NoCTCP              Mode = 'C' // flag
 	OpModerated         Mode = 'U' // flag
 	Forward             Mode = 'f' // flag arg
+	JoinThrottle        Mode = 'j' // flag arg
+	SecureOnly          Mode = 'z' // flag
 )
 
 var (
@@ -275,7 +302,7 @@ func ParseChannelModeChanges(params ...string) (ModeChanges, map[rune]bool) {
 				} else {
 					continue
 				}
-			case UserLimit, Forward:
+			case UserLimit, Forward, JoinThrottle:
 				// don't require value when removing
 				if change.Op == Add {
 					if len(params) > skipArgs {
@@ -443,7 +470,7 @@ func RplMyInfo() (param1, param2, param3 string) {
 	sort.Sort(ByCodepoint(channelModes))
 
 	// XXX enumerate these by hand, i can't see any way to DRY this
-	channelParametrizedModes := Modes{BanMask, ExceptMask, InviteMask, Key, UserLimit, Forward}
+	channelParametrizedModes := Modes{BanMask, ExceptMask, InviteMask, Key, UserLimit, Forward, JoinThrottle}
 	channelParametrizedModes = append(channelParametrizedModes, ChannelUserModes...)
 	sort.Sort(ByCodepoint(channelParametrizedModes))
 
@@ -457,9 +484,9 @@ func ChanmodesToken() (result string) {
 	// type B: modes with parameters
 	B := Modes{Key}
 	// type C: modes that take a parameter only when set, never when unset
-	C := Modes{UserLimit, Forward}
+	C := Modes{UserLimit, Forward, JoinThrottle}
 	// type D: modes without parameters
-	D := Modes{InviteOnly, Moderated, NoOutside, OpOnlyTopic, ChanRoleplaying, Secret, NoCTCP, RegisteredOnly, RegisteredOnlySpeak, Auditorium, OpModerated}
+	D := Modes{InviteOnly, Moderated, NoOutside, OpOnlyTopic, ChanRoleplaying, Secret, NoCTCP, RegisteredOnly, RegisteredOnlySpeak, Auditorium, OpModerated, SecureOnly}
 
 	sort.Sort(ByCodepoint(A))
 	sort.Sort(ByCodepoint(B))
@@ -277,6 +277,31 @@ func TestModeChangesString(t *testing.T) {
 	assertEqual(m.Strings(), []string{"+R-k+b", "beer", "shivaram"}, t)
 }
 
+func TestModeChangesSplit(t *testing.T) {
+	m := ModeChanges{
+		ModeChange{Op: Add, Mode: RegisteredOnly},
+		ModeChange{Op: Add, Mode: BanMask, Arg: "shivaram!*@*"},
+		ModeChange{Op: Add, Mode: BanMask, Arg: "dan!*@*"},
+		ModeChange{Op: Remove, Mode: Key, Arg: "beer"},
+	}
+	if split := m.Split(512); len(split) != 1 {
+		t.Errorf("short changes should not be split: %v", split)
+	}
+	split := m.Split(20)
+	if len(split) != 2 {
+		t.Fatalf("expected 2 groups, got %v", split)
+	}
+	assertEqual(split[0].Strings(), []string{"+Rb", "shivaram!*@*"}, t)
+	assertEqual(split[1].Strings(), []string{"+b-k", "dan!*@*", "beer"}, t)
+	// a single oversized change can't be split further
+	if split := m[1:2].Split(5); len(split) != 1 {
+		t.Errorf("unexpected split of a single change: %v", split)
+	}
+	if split := (ModeChanges{}).Split(512); len(split) != 0 {
+		t.Errorf("unexpected split of empty changes: %v", split)
+	}
+}
+
 func BenchmarkModeString(b *testing.B) {
 	set := NewModeSet()
 	set.SetMode('A', true)
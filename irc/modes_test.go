@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/ergochat/ergo/irc/modes"
 )
@@ -93,3 +94,22 @@ func TestChannelUserModeHasPrivsOver(t *testing.T) {
 	assertEqual(channelUserModeHasPrivsOver(modes.ChannelFounder, modes.ChannelAdmin), true)
 	assertEqual(channelUserModeHasPrivsOver(modes.ChannelOperator, modes.ChannelOperator), true)
 }
+
+func TestParseJoinThrottle(t *testing.T) {
+	limit, duration, err := parseJoinThrottle("5:10")
+	assertEqual(err, nil)
+	assertEqual(limit, 5)
+	assertEqual(duration, 10*time.Second)
+
+	limit, duration, err = parseJoinThrottle(fmt.Sprintf("%d:%d", maxJoinThrottleLimit, maxJoinThrottleSeconds))
+	assertEqual(err, nil)
+	assertEqual(limit, maxJoinThrottleLimit)
+	assertEqual(duration, 7*24*time.Hour)
+
+	for _, invalid := range []string{"5", "5:", ":10", "0:10", "5:0", "-1:10", "a:b",
+		"1001:10", "5:604801", "5:9223372036854775807", "5:99999999999999999999"} {
+		if limit, duration, err := parseJoinThrottle(invalid); err == nil || limit != 0 || duration != 0 {
+			t.Errorf("expected %s to be invalid", invalid)
+		}
+	}
+}
@@ -19,8 +19,10 @@ type Config struct {
 	Timeout         time.Duration
 	MaxConns        int           `yaml:"max-conns"`
 	ConnMaxLifetime time.Duration `yaml:"conn-max-lifetime"`
+	AsyncWrites     bool          `yaml:"async-writes"`
 
 	// XXX these are copied from elsewhere in the config:
 	ExpireTime           time.Duration
 	TrackAccountMessages bool
+	MaxMessagesPerTarget int
 }
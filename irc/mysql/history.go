@@ -40,13 +40,24 @@ const (
 	keySchemaMinorVersion = "db.minorversion"
 	cleanupRowLimit       = 50
 	cleanupPauseTime      = 10 * time.Minute
+	// maximum number of pending writes; past this, writers block
+	// until the queue drains (crude backpressure)
+	writeQueueSize = 1024
 )
 
 type e struct{}
 
+type writeRequest struct {
+	write func() error
+	// if non-nil, the result of the write is sent here; otherwise
+	// the write is asynchronous and any error is logged
+	result chan error
+}
+
 type MySQL struct {
 	timeout              *int64
 	trackAccountMessages uint32
+	asyncWrites          uint32
 	db                   *sql.DB
 	logger               *logger.Manager
 
@@ -60,6 +71,14 @@ type MySQL struct {
 	config     Config
 
 	wakeForgetter chan e
+
+	// asynchronous writes go through a single goroutine, so they are applied
+	// in order; synchronous writes bypass it, unless asynchronous writes are
+	// still pending (e.g., right after async-writes was disabled by a rehash)
+	queueMutex    sync.RWMutex
+	writeQueue    chan writeRequest
+	writerGroup   sync.WaitGroup
+	pendingWrites int64
 }
 
 func (mysql *MySQL) Initialize(logger *logger.Manager, config Config) {
@@ -76,14 +95,20 @@ func (mysql *MySQL) SetConfig(config Config) {
 		trackAccountMessages = 1
 	}
 	atomic.StoreUint32(&mysql.trackAccountMessages, trackAccountMessages)
+	var asyncWrites uint32
+	if config.AsyncWrites {
+		asyncWrites = 1
+	}
+	atomic.StoreUint32(&mysql.asyncWrites, asyncWrites)
 	mysql.stateMutex.Lock()
 	mysql.config = config
 	mysql.stateMutex.Unlock()
 }
 
-func (mysql *MySQL) getExpireTime() (expireTime time.Duration) {
+func (mysql *MySQL) getRetention() (expireTime time.Duration, maxMessages int) {
 	mysql.stateMutex.Lock()
 	expireTime = mysql.config.ExpireTime
+	maxMessages = mysql.config.MaxMessagesPerTarget
 	mysql.stateMutex.Unlock()
 	return
 }
@@ -119,6 +144,10 @@ func (m *MySQL) Open() (err error) {
 		return err
 	}
 
+	m.writeQueue = make(chan writeRequest, writeQueueSize)
+	m.writerGroup.Add(1)
+	go m.writeLoop()
+
 	go m.cleanupLoop()
 	go m.forgetLoop()
 
@@ -293,27 +322,40 @@ func (mysql *MySQL) cleanupLoop() {
 	}()
 
 	for {
-		expireTime := mysql.getExpireTime()
+		expireTime, maxMessages := mysql.getRetention()
 		if expireTime != 0 {
-			for {
-				startTime := time.Now()
-				rowsDeleted, err := mysql.doCleanup(expireTime)
-				elapsed := time.Now().Sub(startTime)
-				mysql.logError("error during row cleanup", err)
-				// keep going as long as we're accomplishing significant work
-				// (don't busy-wait on small numbers of rows expiring):
-				if rowsDeleted < (cleanupRowLimit / 10) {
-					break
-				}
-				// crude backpressure mechanism: if the database is slow,
-				// give it time to process other queries
-				time.Sleep(elapsed)
-			}
+			mysql.cleanupUntilDone("error during row cleanup", func() (int, error) {
+				return mysql.doCleanup(expireTime)
+			})
+		}
+		if maxMessages != 0 {
+			mysql.cleanupUntilDone("error trimming history", func() (int, error) {
+				return mysql.doTrim(maxMessages)
+			})
 		}
 		time.Sleep(cleanupPauseTime)
 	}
 }
 
+// cleanupUntilDone runs a cleanup pass repeatedly, for as long as it keeps
+// deleting significant numbers of rows
+func (mysql *MySQL) cleanupUntilDone(errContext string, cleanup func() (int, error)) {
+	for {
+		startTime := time.Now()
+		rowsDeleted, err := cleanup()
+		elapsed := time.Now().Sub(startTime)
+		mysql.logError(errContext, err)
+		// keep going as long as we're accomplishing significant work
+		// (don't busy-wait on small numbers of rows expiring):
+		if err != nil || rowsDeleted < (cleanupRowLimit/10) {
+			break
+		}
+		// crude backpressure mechanism: if the database is slow,
+		// give it time to process other queries
+		time.Sleep(elapsed)
+	}
+}
+
 func (mysql *MySQL) doCleanup(age time.Duration) (count int, err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), cleanupPauseTime)
 	defer cancel()
@@ -408,6 +450,91 @@ func (mysql *MySQL) selectCleanupIDs(ctx context.Context, age time.Duration) (id
 	return
 }
 
+// doTrim deletes the oldest messages of any channel or conversation
+// holding more than maxMessages of them
+func (mysql *MySQL) doTrim(maxMessages int) (count int, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupPauseTime)
+	defer cancel()
+
+	ids, err := mysql.selectTrimIDs(ctx, maxMessages)
+	if err != nil || len(ids) == 0 {
+		return
+	}
+
+	mysql.logger.Debug("mysql", fmt.Sprintf("trimming %d history rows, max messages %d", len(ids), maxMessages))
+	return len(ids), mysql.deleteHistoryIDs(ctx, ids)
+}
+
+type trimKey struct {
+	target        string
+	correspondent string
+}
+
+func (mysql *MySQL) selectTrimIDs(ctx context.Context, maxMessages int) (ids []uint64, err error) {
+	keys, err := mysql.selectTrimKeys(ctx, `
+		SELECT target, '' FROM sequence
+		GROUP BY target HAVING COUNT(*) > ? LIMIT ?;`, maxMessages, cleanupRowLimit)
+	if err != nil {
+		return
+	}
+	convKeys, err := mysql.selectTrimKeys(ctx, `
+		SELECT target, correspondent FROM conversations
+		GROUP BY target, correspondent HAVING COUNT(*) > ? LIMIT ?;`, maxMessages, cleanupRowLimit)
+	if err != nil {
+		return
+	}
+	keys = append(keys, convKeys...)
+
+	for _, key := range keys {
+		var rows *sql.Rows
+		// skip the newest maxMessages rows, select the rest:
+		if key.correspondent == "" {
+			rows, err = mysql.db.QueryContext(ctx, `
+				SELECT history_id FROM sequence WHERE target = ?
+				ORDER BY nanotime DESC LIMIT ? OFFSET ?;`, key.target, cleanupRowLimit, maxMessages)
+		} else {
+			rows, err = mysql.db.QueryContext(ctx, `
+				SELECT history_id FROM conversations WHERE target = ? AND correspondent = ?
+				ORDER BY nanotime DESC LIMIT ? OFFSET ?;`, key.target, key.correspondent, cleanupRowLimit, maxMessages)
+		}
+		if err != nil {
+			return
+		}
+		for rows.Next() {
+			var id uint64
+			if err = rows.Scan(&id); err != nil {
+				rows.Close()
+				return
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return
+		}
+		if len(ids) >= cleanupRowLimit {
+			break
+		}
+	}
+	return
+}
+
+func (mysql *MySQL) selectTrimKeys(ctx context.Context, query string, args ...interface{}) (keys []trimKey, err error) {
+	rows, err := mysql.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key trimKey
+		if err = rows.Scan(&key.target, &key.correspondent); err != nil {
+			return
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
 func (mysql *MySQL) deleteCorrespondents(ctx context.Context, threshold int64) {
 	result, err := mysql.db.ExecContext(ctx, `DELETE FROM correspondents WHERE nanotime <= (?);`, threshold)
 	if err != nil {
@@ -558,6 +685,57 @@ func (mysql *MySQL) getTimeout() time.Duration {
 	return time.Duration(atomic.LoadInt64(mysql.timeout))
 }
 
+func (mysql *MySQL) writeLoop() {
+	defer mysql.writerGroup.Done()
+
+	for request := range mysql.writeQueue {
+		err := request.write()
+		atomic.AddInt64(&mysql.pendingWrites, -1)
+		if request.result != nil {
+			request.result <- err
+		} else {
+			mysql.logError("asynchronous write failed", err)
+		}
+	}
+}
+
+// write performs a database write. If async writes are enabled, it is queued
+// for the writer goroutine and write returns immediately (unless the queue is
+// full); otherwise it runs on the calling goroutine and returns its error.
+func (mysql *MySQL) write(write func() error) (err error) {
+	return mysql.doWrite(write, atomic.LoadUint32(&mysql.asyncWrites) != 0)
+}
+
+// doWrite performs a write, asynchronously if async is set. A synchronous
+// write waits behind any queued asynchronous writes, so that it can't be
+// applied ahead of a write that preceded it.
+func (mysql *MySQL) doWrite(write func() error, async bool) (err error) {
+	if !async && atomic.LoadInt64(&mysql.pendingWrites) == 0 {
+		return write()
+	}
+
+	var result chan error
+	if !async {
+		result = make(chan error, 1)
+	}
+
+	mysql.queueMutex.RLock()
+	if mysql.writeQueue == nil {
+		mysql.queueMutex.RUnlock()
+		return write()
+	}
+	// if the queue is full, block rather than writing directly,
+	// which would reorder this write ahead of the queued ones
+	atomic.AddInt64(&mysql.pendingWrites, 1)
+	mysql.writeQueue <- writeRequest{write: write, result: result}
+	mysql.queueMutex.RUnlock()
+
+	if result != nil {
+		return <-result
+	}
+	return nil
+}
+
 func (mysql *MySQL) isTrackingAccountMessages() bool {
 	return atomic.LoadUint32(&mysql.trackAccountMessages) != 0
 }
@@ -599,6 +777,12 @@ func (mysql *MySQL) AddChannelItem(target string, item history.Item, account str
 		return utils.ErrInvalidParams
 	}
 
+	return mysql.write(func() error {
+		return mysql.addChannelItem(target, item, account)
+	})
+}
+
+func (mysql *MySQL) addChannelItem(target string, item history.Item, account string) (err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), mysql.getTimeout())
 	defer cancel()
 
@@ -683,6 +867,12 @@ func (mysql *MySQL) AddDirectMessage(sender, senderAccount, recipient, recipient
 		return utils.ErrInvalidParams
 	}
 
+	return mysql.write(func() error {
+		return mysql.addDirectMessage(sender, senderAccount, recipient, recipientAccount, item)
+	})
+}
+
+func (mysql *MySQL) addDirectMessage(sender, senderAccount, recipient, recipientAccount string, item history.Item) (err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), mysql.getTimeout())
 	defer cancel()
 
@@ -723,32 +913,52 @@ func (mysql *MySQL) AddDirectMessage(sender, senderAccount, recipient, recipient
 	return
 }
 
+func (mysql *MySQL) RenameTarget(oldTarget, newTarget string) (err error) {
+	if mysql.db == nil {
+		return
+	}
+
+	// go through the write queue, so that messages already queued
+	// for the old name are moved as well
+	return mysql.write(func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), mysql.getTimeout())
+		defer cancel()
+		_, err := mysql.db.ExecContext(ctx, `UPDATE sequence SET target = ? WHERE target = ?;`, newTarget, oldTarget)
+		mysql.logError("could not rename history target", err)
+		return err
+	})
+}
+
 // note that accountName is the unfolded name
 func (mysql *MySQL) DeleteMsgid(msgid, accountName string) (err error) {
 	if mysql.db == nil {
 		return nil
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), mysql.getTimeout())
-	defer cancel()
+	// the delete is ordered after any pending write of the message itself,
+	// and always waits for its result (e.g., ErrDisallowed)
+	return mysql.doWrite(func() (err error) {
+		ctx, cancel := context.WithTimeout(context.Background(), mysql.getTimeout())
+		defer cancel()
 
-	_, id, data, err := mysql.lookupMsgid(ctx, msgid, true)
-	if err != nil {
-		return
-	}
+		_, id, data, err := mysql.lookupMsgid(ctx, msgid, true)
+		if err != nil {
+			return
+		}
 
-	if accountName != "*" {
-		var item history.Item
-		err = unmarshalItem(data, &item)
-		// delete if the entry is corrupt
-		if err == nil && item.AccountName != accountName {
-			return ErrDisallowed
+		if accountName != "*" {
+			var item history.Item
+			err = unmarshalItem(data, &item)
+			// delete if the entry is corrupt
+			if err == nil && item.AccountName != accountName {
+				return ErrDisallowed
+			}
 		}
-	}
 
-	err = mysql.deleteHistoryIDs(ctx, []uint64{id})
-	mysql.logError("couldn't delete msgid", err)
-	return
+		err = mysql.deleteHistoryIDs(ctx, []uint64{id})
+		mysql.logError("couldn't delete msgid", err)
+		return
+	}, false)
 }
 
 func (mysql *MySQL) Export(account string, writer io.Writer) {
@@ -1020,6 +1230,15 @@ func (mysql *MySQL) ListChannels(cfchannels []string) (results []history.TargetL
 }
 
 func (mysql *MySQL) Close() {
+	// flush any pending writes before closing the database
+	mysql.queueMutex.Lock()
+	if mysql.writeQueue != nil {
+		close(mysql.writeQueue)
+		mysql.writeQueue = nil
+	}
+	mysql.queueMutex.Unlock()
+	mysql.writerGroup.Wait()
+
 	// closing the database will close our prepared statements as well
 	if mysql.db != nil {
 		mysql.db.Close()
@@ -76,6 +76,13 @@ func performNickChange(server *Server, client *Client, target *Client, session *
 		} else {
 			rb.Add(nil, server.name, "NOTE", "SANICK", "NOOP", utils.SafeErrorParam(nickname), client.t("Client already had the desired nickname"))
 		}
+	} else if qlined, ok := err.(*QLineError); ok {
+		errMsg := qlined.Info.BanMessage(client.t("Nickname is forbidden (%s)"))
+		if !isSanick {
+			rb.Add(nil, server.name, ERR_ERRONEUSNICKNAME, details.nick, utils.SafeErrorParam(nickname), errMsg)
+		} else {
+			rb.Add(nil, server.name, "FAIL", "SANICK", "NICKNAME_INVALID", utils.SafeErrorParam(nickname), errMsg)
+		}
 	} else if err != nil {
 		client.server.logger.Error("internal", "couldn't change nick", nickname, err.Error())
 		if !isSanick {
@@ -15,6 +15,9 @@ import (
 
 	"github.com/ergochat/ergo/irc/caps"
 	"github.com/ergochat/ergo/irc/custime"
+	"github.com/ergochat/ergo/irc/email"
+	"github.com/ergochat/ergo/irc/languages"
+	"github.com/ergochat/ergo/irc/modes"
 	"github.com/ergochat/ergo/irc/passwd"
 	"github.com/ergochat/ergo/irc/sno"
 	"github.com/ergochat/ergo/irc/utils"
@@ -93,6 +96,17 @@ same user account, letting you reclaim your nickname.`,
 			authRequired: true,
 			minParams:    1,
 		},
+		"regain": {
+			handler: nsGhostHandler,
+			help: `Syntax: $bREGAIN <nickname>$b
+
+REGAIN disconnects the given user from the network if they're logged in with
+the same user account (like $bGHOST$b), then changes your nickname to it.`,
+			helpShort:    `$bREGAIN$b reclaims your nickname and switches to it.`,
+			enabled:      servCmdRequiresNickRes,
+			authRequired: true,
+			minParams:    1,
+		},
 		"group": {
 			handler: nsGroupHandler,
 			help: `Syntax: $bGROUP$b
@@ -113,6 +127,16 @@ certfp (your client certificate) if a password is not given.`,
 			enabled:   servCmdRequiresAuthEnabled,
 			minParams: 1,
 		},
+		"logout": {
+			handler: nsLogoutHandler,
+			help: `Syntax: $bLOGOUT$b
+
+LOGOUT logs you out of your account. If your current nickname is reserved,
+you will be renamed.`,
+			helpShort:    `$bLOGOUT$b logs you out of your account.`,
+			enabled:      servCmdRequiresAuthEnabled,
+			authRequired: true,
+		},
 		"list": {
 			handler: nsListHandler,
 			help: `Syntax: $bLIST [regex]$b
@@ -174,7 +198,7 @@ an administrator can set use this command to set up user accounts.`,
 			help: `Syntax: $bSAVERIFY <username>$b
 
 SAVERIFY manually verifies an account that is pending verification.`,
-			helpShort: `$bSAREGISTER$b registers an account on someone else's behalf.`,
+			helpShort: `$bSAVERIFY$b manually verifies an account pending verification.`,
 			enabled:   servCmdRequiresAuthEnabled, // deliberate
 			capabs:    []string{"accreg"},
 			minParams: 1,
@@ -224,6 +248,18 @@ or other verification.`,
 			enabled:   servCmdRequiresAccreg,
 			minParams: 2,
 		},
+		"resend": {
+			handler: nsResendHandler,
+			help: `Syntax: $bRESEND <username>$b
+
+RESEND sends a new verification code for an account that is pending email
+verification, to the address it was registered with. Any previous code for
+the account will stop working. A new code can be requested at most once every
+five minutes for any given account.`,
+			helpShort: `$bRESEND$b resends a verification code for a pending account.`,
+			enabled:   servCmdRequiresAccreg,
+			minParams: 1,
+		},
 		"passwd": {
 			handler: nsPasswdHandler,
 			help: `Syntax: $bPASSWD <current> <new> <new_again>$b
@@ -252,6 +288,18 @@ on the settings and their possible values, see HELP SET.`,
 			enabled:      servCmdRequiresAuthEnabled,
 			minParams:    1,
 		},
+		"settings": {
+			handler: nsSettingsHandler,
+			help: `Syntax: $bSETTINGS$b
+
+SETTINGS lists the current values of all your account settings. For more
+information on the settings and their possible values, see HELP SET.
+Operators with the accreg capability can view the settings of another
+account with SETTINGS <account>.`,
+			helpShort:    `$bSETTINGS$b lists the current values of all your account settings`,
+			authRequired: true,
+			enabled:      servCmdRequiresAuthEnabled,
+		},
 		"saget": {
 			handler: nsGetHandler,
 			help: `Syntax: $bSAGET <account> <setting>$b
@@ -307,6 +355,13 @@ even while you are disconnected from the server. Your options are 'true',
 if you have at most one active session, the server will remember the time
 you disconnect and then replay missed messages to you when you reconnect.
 Your options are 'on' and 'off'.`,
+				`$bAUTOREPLAY-WINDOW$b
+'autoreplay-window' limits how far back autoreplay of missed messages will
+go, e.g., '12h' will replay at most the last 12 hours of missed messages,
+no matter how long you were disconnected, and '50' will replay at most the
+last 50 missed lines of each channel or conversation. Your options are any
+duration, any number of lines, or 'default' (or 0) to replay everything
+you missed.`,
 				`$bDM-HISTORY$b
 'dm-history' is only effective for always-on clients. It lets you control
 how the history of your direct messages is stored. Your options are:
@@ -318,6 +373,33 @@ how the history of your direct messages is stored. Your options are:
 'auto-away' is only effective for always-on clients. If enabled, you will
 automatically be marked away when all your sessions are disconnected, and
 automatically return from away when you connect again.`,
+				`$bFORGET-ON-LOGOUT$b
+'forget-on-logout' deletes the messages you sent from history whenever you log
+out, or disconnect your last client (this has no effect on always-on clients,
+which stay logged in). Your options are 'on' and 'off'. This is only available
+if the server's history storage supports deleting an account's messages.`,
+				`$bHIDE-EMAIL$b
+'hide-email' controls whether your e-mail address is hidden from other users.
+If you set it to 'off', your address is shown to anyone who looks up your
+account with NickServ INFO. The default is 'on'.`,
+				`$bALLOW-PRIVATE-MESSAGES$b
+'allow-private-messages' controls whether other users can send you direct
+messages. If you set it to 'off', only operators, users you have allowed with
+/ACCEPT, and users you have messaged yourself can message you. The default
+is 'on'.`,
+				`$bMEMO-EMAIL$b
+'memo-email' controls whether you are e-mailed when you receive a memo while
+you are offline (if the server operator allows it). Notifications are only
+sent to an e-mail address you have confirmed. The default is 'on'.`,
+				`$bUSER-MODES$b
+'user-modes' sets user modes every time you log in, e.g., '+iR' to become
+invisible and to block direct messages from users who aren't logged in.
+The modes available are +B, +E, +g, +i, +R, and +T. Use 'none' to stop
+setting modes on login.`,
+				`$bLANGUAGE$b
+'language' sets your language preferences every time you log in, as with the
+LANGUAGE command, e.g., 'es' or 'de,en'. Use 'default' to keep the language
+preferences of the client you log in from.`,
 				`$bEMAIL$b
 'email' controls the e-mail address associated with your account (if the
 server operator allows it, this address can be used for password resets).
@@ -431,6 +513,41 @@ func nsGetHandler(service *ircService, server *Server, client *Client, command s
 	displaySetting(service, params[0], accountData.Settings, client, rb)
 }
 
+// the settings shown by NS SETTINGS, in the same order as in HELP SET
+var accountSettingNames = []string{
+	"enforce", "multiclient", "autoreplay-lines", "replay-joins", "always-on",
+	"autoreplay-missed", "autoreplay-window", "dm-history", "auto-away",
+	"forget-on-logout", "email", "hide-email", "allow-private-messages", "memo-email",
+	"user-modes", "language",
+}
+
+func nsSettingsHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
+	account := client.Account()
+	if len(params) != 0 {
+		if !client.HasRoleCapabs("accreg") {
+			service.Notice(rb, client.t("Insufficient privileges"))
+			return
+		}
+		account = params[0]
+	}
+
+	accountData, err := server.accounts.LoadAccount(account)
+	if err == errAccountDoesNotExist {
+		service.Notice(rb, client.t("No such account"))
+		return
+	} else if err != nil {
+		service.Notice(rb, client.t("Error loading account data"))
+		return
+	}
+
+	service.Notice(rb, ircfmt.Unescape(client.t("*** $bNickServ SETTINGS$b ***")))
+	for _, setting := range accountSettingNames {
+		service.Notice(rb, fmt.Sprintf(ircfmt.Unescape("$b%s$b"), strings.ToUpper(setting)))
+		displaySetting(service, setting, accountData.Settings, client, rb)
+	}
+	service.Notice(rb, ircfmt.Unescape(client.t("*** $bEnd of NickServ SETTINGS$b ***")))
+}
+
 func displaySetting(service *ircService, settingName string, settings AccountSettings, client *Client, rb *ResponseBuffer) {
 	config := client.server.Config()
 	switch strings.ToLower(settingName) {
@@ -491,6 +608,14 @@ func displaySetting(service *ircService, settingName string, settings AccountSet
 		} else {
 			service.Notice(rb, client.t("Your account is not configured to receive autoreplayed missed messages"))
 		}
+	case "autoreplay-window":
+		if settings.AutoreplayWindowLines != 0 {
+			service.Notice(rb, fmt.Sprintf(client.t("Autoreplay of missed messages is limited to the last %d lines of each target"), settings.AutoreplayWindowLines))
+		} else if settings.AutoreplayWindow != 0 {
+			service.Notice(rb, fmt.Sprintf(client.t("Autoreplay of missed messages is limited to the last %v"), settings.AutoreplayWindow))
+		} else {
+			service.Notice(rb, client.t("Autoreplay of missed messages is not limited to a time window"))
+		}
 	case "auto-away":
 		stored := settings.AutoAway
 		alwaysOn := persistenceEnabled(config.Accounts.Multiclient.AlwaysOn, settings.AlwaysOn)
@@ -507,6 +632,44 @@ func displaySetting(service *ircService, settingName string, settings AccountSet
 		effectiveValue := historyEnabled(config.History.Persistent.DirectMessages, settings.DMHistory)
 		service.Notice(rb, fmt.Sprintf(client.t("Your stored direct message history setting is: %s"), historyStatusToString(settings.DMHistory)))
 		service.Notice(rb, fmt.Sprintf(client.t("Given current server settings, your direct message history setting is: %s"), historyStatusToString(effectiveValue)))
+	case "forget-on-logout":
+		if settings.ForgetOnLogout {
+			service.Notice(rb, client.t("Your messages will be deleted from history when you log out"))
+		} else {
+			service.Notice(rb, client.t("Your messages will not be deleted from history when you log out"))
+		}
+	case "hide-email":
+		if settings.ShowEmail {
+			service.Notice(rb, client.t("Your e-mail address is shown to other users in NickServ INFO"))
+		} else {
+			service.Notice(rb, client.t("Your e-mail address is hidden from other users"))
+		}
+	case "allow-private-messages":
+		if settings.BlockPrivateMessages {
+			service.Notice(rb, client.t("Only operators and users you have ACCEPTed (or messaged) can send you direct messages"))
+		} else {
+			service.Notice(rb, client.t("Anyone can send you direct messages"))
+		}
+	case "memo-email":
+		if settings.DisableMemoEmails {
+			service.Notice(rb, client.t("You will not be e-mailed about new memos"))
+		} else if settings.Email == "" || !settings.EmailVerified {
+			service.Notice(rb, client.t("You will not be e-mailed about new memos until you confirm an e-mail address"))
+		} else {
+			service.Notice(rb, client.t("You may be e-mailed about new memos while you are offline"))
+		}
+	case "user-modes":
+		if settings.UserModes != "" {
+			service.Notice(rb, fmt.Sprintf(client.t("These user modes will be set whenever you log in: +%s"), settings.UserModes))
+		} else {
+			service.Notice(rb, client.t("No user modes will be set when you log in"))
+		}
+	case "language":
+		if len(settings.Languages) != 0 {
+			service.Notice(rb, fmt.Sprintf(client.t("Your language preferences will be set to %s whenever you log in"), strings.Join(settings.Languages, ",")))
+		} else {
+			service.Notice(rb, client.t("Your language preferences will not be changed when you log in"))
+		}
 	case "email":
 		if settings.Email != "" {
 			service.Notice(rb, fmt.Sprintf(client.t("Your stored e-mail address is: %s"), settings.Email))
@@ -518,6 +681,56 @@ func displaySetting(service *ircService, settingName string, settings AccountSet
 	}
 }
 
+// user modes that can be stored with NS SET USER-MODES; this excludes
+// modes that require privileges (e.g., +o) or must not be set by the user (e.g., +Z)
+var accountUserModes = modes.Modes{
+	modes.Bot, modes.CallerID, modes.Invisible, modes.RegisteredOnly,
+	modes.UserNoCTCP, modes.UserRoleplaying,
+}
+
+// parseAccountUserModes validates a modestring like "+iR", returning the modes
+// (without the +) in canonical order, or "" for "none"
+func parseAccountUserModes(modeString string) (result string, err error) {
+	if strings.ToLower(modeString) == "none" {
+		return "", nil
+	}
+	modeString = strings.TrimPrefix(modeString, "+")
+	if modeString == "" {
+		return "", errInvalidParams
+	}
+	allowed := accountUserModes.String()
+	var uModes modes.Modes
+	for _, char := range modeString {
+		if !strings.ContainsRune(allowed, char) {
+			return "", errInvalidParams
+		}
+		if !strings.ContainsRune(uModes.String(), char) {
+			uModes = append(uModes, modes.Mode(char))
+		}
+	}
+	sort.Sort(modes.ByCodepoint(uModes))
+	return uModes.String(), nil
+}
+
+// parseAccountLanguages validates a comma-separated list of language codes,
+// returning nil for "default"
+func parseAccountLanguages(lm *languages.Manager, value string) (result []string, err error) {
+	if strings.ToLower(value) == "default" {
+		return nil, nil
+	}
+	seen := make(map[string]bool)
+	for _, language := range strings.Split(strings.ToLower(value), ",") {
+		if _, exists := lm.Languages[language]; !exists {
+			return nil, errInvalidParams
+		}
+		if !seen[language] {
+			seen[language] = true
+			result = append(result, language)
+		}
+	}
+	return
+}
+
 func userPersistentStatusToString(status PersistentStatus) string {
 	// #1544: "mandatory" as a user setting should display as "enabled"
 	result := persistentStatusToString(status)
@@ -644,6 +857,32 @@ func nsSetHandler(service *ircService, server *Server, client *Client, command s
 				return
 			}
 		}
+	case "autoreplay-window":
+		// either a number of lines or a duration; setting one clears the other
+		var newValue time.Duration
+		var newLines int
+		if strings.ToLower(params[1]) != "default" {
+			if lines, err_ := strconv.Atoi(params[1]); err_ == nil {
+				if lines < 0 {
+					err = errInvalidParams
+					break
+				}
+				newLines = lines
+			} else {
+				duration, err_ := custime.ParseDuration(params[1])
+				if err_ != nil || duration < 0 {
+					err = errInvalidParams
+					break
+				}
+				newValue = time.Duration(duration)
+			}
+		}
+		munger = func(in AccountSettings) (out AccountSettings, err error) {
+			out = in
+			out.AutoreplayWindow = newValue
+			out.AutoreplayWindowLines = newLines
+			return
+		}
 	case "auto-away":
 		var newValue PersistentStatus
 		newValue, err = persistentStatusFromString(params[1])
@@ -665,11 +904,77 @@ func nsSetHandler(service *ircService, server *Server, client *Client, command s
 				return
 			}
 		}
+	case "forget-on-logout":
+		if !historyForgetEnabled(server.Config()) {
+			err = errFeatureDisabled
+			break
+		}
+		var newValue bool
+		newValue, err = utils.StringToBool(params[1])
+		if err == nil {
+			munger = func(in AccountSettings) (out AccountSettings, err error) {
+				out = in
+				out.ForgetOnLogout = newValue
+				return
+			}
+		}
+	case "hide-email":
+		var newValue bool
+		newValue, err = utils.StringToBool(params[1])
+		if err == nil {
+			munger = func(in AccountSettings) (out AccountSettings, err error) {
+				out = in
+				out.ShowEmail = !newValue
+				return
+			}
+		}
+	case "allow-private-messages":
+		var newValue bool
+		newValue, err = utils.StringToBool(params[1])
+		if err == nil {
+			munger = func(in AccountSettings) (out AccountSettings, err error) {
+				out = in
+				out.BlockPrivateMessages = !newValue
+				return
+			}
+		}
+	case "memo-email":
+		var newValue bool
+		newValue, err = utils.StringToBool(params[1])
+		if err == nil {
+			munger = func(in AccountSettings) (out AccountSettings, err error) {
+				out = in
+				out.DisableMemoEmails = !newValue
+				return
+			}
+		}
+	case "user-modes":
+		var newValue string
+		newValue, err = parseAccountUserModes(params[1])
+		if err == nil {
+			munger = func(in AccountSettings) (out AccountSettings, err error) {
+				out = in
+				out.UserModes = newValue
+				return
+			}
+		}
+	case "language":
+		var newValue []string
+		newValue, err = parseAccountLanguages(server.Languages(), params[1])
+		if err == nil {
+			munger = func(in AccountSettings) (out AccountSettings, err error) {
+				out = in
+				out.Languages = newValue
+				return
+			}
+		}
 	case "email":
 		newValue := params[1]
 		munger = func(in AccountSettings) (out AccountSettings, err error) {
 			out = in
 			out.Email = newValue
+			// an address set by an operator hasn't been confirmed by the user
+			out.EmailVerified = false
 			return
 		}
 	default:
@@ -720,6 +1025,8 @@ func nsSetEmailHandler(service *ircService, client *Client, params []string, rb
 		service.Notice(rb, client.t("Check your e-mail for instructions on how to confirm your change of address"))
 	case errLimitExceeded:
 		service.Notice(rb, client.t("Try again later"))
+	case email.ErrBlacklistedAddress, email.ErrDisallowedDomain:
+		service.Notice(rb, client.t(err.Error()))
 	default:
 		// if appropriate, show the client the error from the attempted email sending
 		if rErr := registrationCallbackErrorText(config, client, err); rErr != "" {
@@ -766,15 +1073,20 @@ func nsDropHandler(service *ircService, server *Server, client *Client, command
 
 func nsGhostHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
 	nick := params[0]
+	regain := command == "regain"
 
 	ghost := server.clients.Get(nick)
-	if ghost == nil {
+	if ghost == nil && !regain {
 		service.Notice(rb, client.t("No such nick"))
 		return
 	} else if ghost == client {
-		service.Notice(rb, client.t("You can't GHOST yourself (try /QUIT instead)"))
+		if regain {
+			service.Notice(rb, client.t("You're already using that nickname"))
+		} else {
+			service.Notice(rb, client.t("You can't GHOST yourself (try /QUIT instead)"))
+		}
 		return
-	} else if ghost.AlwaysOn() {
+	} else if ghost != nil && ghost.AlwaysOn() {
 		service.Notice(rb, client.t("You can't GHOST an always-on client"))
 		return
 	}
@@ -783,15 +1095,22 @@ func nsGhostHandler(service *ircService, server *Server, client *Client, command
 	account := client.Account()
 	if account != "" {
 		// the user must either own the nick, or the target client
-		authorized = (server.accounts.NickToAccount(nick) == account) || (ghost.Account() == account)
+		authorized = (server.accounts.NickToAccount(nick) == account) || (ghost != nil && ghost.Account() == account)
 	}
 	if !authorized {
 		service.Notice(rb, client.t("You don't own that nick"))
 		return
 	}
 
-	ghost.Quit(fmt.Sprintf(ghost.t("GHOSTed by %s"), client.Nick()), nil)
-	ghost.destroy(nil)
+	if ghost != nil {
+		ghost.Quit(fmt.Sprintf(ghost.t("GHOSTed by %s"), client.Nick()), nil)
+		ghost.destroy(nil)
+	}
+
+	if regain {
+		// performNickChange reports its own errors
+		performNickChange(server, client, client, rb.session, nick, rb)
+	}
 }
 
 func nsGroupHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
@@ -816,6 +1135,30 @@ func nsLoginThrottleCheck(service *ircService, client *Client, rb *ResponseBuffe
 	return !throttled
 }
 
+func nsLogoutHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
+	// an always-on client, or one with multiple sessions attached,
+	// depends on the account to stay connected:
+	if client.AlwaysOn() || 1 < len(client.Sessions()) {
+		service.Notice(rb, ircfmt.Unescape(client.t("You can't log out while always-on is enabled or other clients are attached; see $bCLIENTS LOGOUT$b")))
+		return
+	}
+
+	details := client.Details()
+	server.accounts.Logout(client)
+	if client.SetVHost("") {
+		client.sendChghost(details.nickMask, client.Hostname())
+	}
+	service.Notice(rb, client.t("You're now logged out"))
+	dispatchAccountNotify(client, client.NickMaskString(), "*", rb)
+	server.snomasks.Send(sno.LocalAccounts, fmt.Sprintf(ircfmt.Unescape("Client $c[grey][$r%s$c[grey]] logged out of account $c[grey][$r%s$c[grey]]"), details.nickMask, details.accountName))
+
+	// they no longer have title to a reserved nickname
+	cfnick, skeleton := client.uniqueIdentifiers()
+	if account, method := server.accounts.EnforcementStatus(cfnick, skeleton); account != "" && method != NickEnforcementNone {
+		server.RandomlyRename(client)
+	}
+}
+
 func nsIdentifyHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
 	if client.LoggedIntoAccount() {
 		service.Notice(rb, client.t("You're already logged into an account"))
@@ -842,7 +1185,7 @@ func nsIdentifyHandler(service *ircService, server *Server, client *Client, comm
 
 	// try passphrase
 	if passphrase != "" {
-		err = server.accounts.AuthenticateByPassphrase(client, username, passphrase)
+		err = server.accounts.AuthenticateByPassphrase(client, username, passphrase, rb.session.certfp)
 		loginSuccessful = (err == nil)
 	}
 
@@ -936,7 +1279,7 @@ func nsInfoHandler(service *ircService, server *Server, client *Client, command
 	registeredAt := account.RegisteredAt.Format(time.RFC1123)
 	service.Notice(rb, fmt.Sprintf(client.t("Registered at: %s"), registeredAt))
 
-	if account.Name == client.AccountName() || client.HasRoleCapabs("accreg") {
+	if account.Name == client.AccountName() || account.Settings.ShowEmail || client.HasRoleCapabs("accreg") {
 		if account.Settings.Email != "" {
 			service.Notice(rb, fmt.Sprintf(client.t("Email address: %s"), account.Settings.Email))
 		}
@@ -1168,6 +1511,22 @@ func nsVerifyHandler(service *ircService, server *Server, client *Client, comman
 	}
 }
 
+func nsResendHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
+	err := server.accounts.ResendVerificationCode(client, params[0])
+	switch err {
+	case nil:
+		service.Notice(rb, client.t("A new verification code has been sent to the email address for that account"))
+	case errAccountAlreadyLoggedIn, errAccountAlreadyVerified, errAccountDoesNotExist, errLimitExceeded:
+		service.Notice(rb, client.t(err.Error()))
+	default:
+		if message := registrationCallbackErrorText(server.Config(), client, err); message != "" {
+			service.Notice(rb, message)
+		} else {
+			service.Notice(rb, client.t(errAccountVerificationFailed.Error()))
+		}
+	}
+}
+
 func nsConfirmPassword(server *Server, account, passphrase string) (errorMessage string) {
 	accountData, err := server.accounts.LoadAccount(account)
 	if err != nil {
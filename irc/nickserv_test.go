@@ -0,0 +1,96 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package irc
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/buntdb"
+
+	"github.com/ergochat/ergo/irc/languages"
+	"github.com/ergochat/ergo/irc/utils"
+)
+
+func TestParseAccountUserModes(t *testing.T) {
+	for input, expected := range map[string]string{
+		"+iR":  "Ri",
+		"iRi":  "Ri",
+		"+gTB": "BTg",
+		"none": "",
+		"NONE": "",
+	} {
+		result, err := parseAccountUserModes(input)
+		if err != nil || result != expected {
+			t.Errorf("parseAccountUserModes(%s): expected %s, got %s (%v)", input, expected, result, err)
+		}
+	}
+
+	// privileged, unknown, and empty modes are rejected
+	for _, input := range []string{"+o", "+is", "+Z", "+x", "+", ""} {
+		if _, err := parseAccountUserModes(input); err == nil {
+			t.Errorf("parseAccountUserModes(%s) should have failed", input)
+		}
+	}
+}
+
+func TestNsInfoHideEmail(t *testing.T) {
+	db, err := buntdb.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var config Config
+	config.Accounts.AuthenticationEnabled = true
+	config.languageManager = new(languages.Manager)
+	server := &Server{store: db}
+	server.config.Set(&config)
+	server.accounts.server = server
+
+	setSettings := func(settings string) {
+		err := db.Update(func(tx *buntdb.Tx) error {
+			tx.Set(fmt.Sprintf(keyAccountExists, "alice"), "1", nil)
+			tx.Set(fmt.Sprintf(keyAccountName, "alice"), "Alice", nil)
+			tx.Set(fmt.Sprintf(keyAccountCredentials, "alice"), "{}", nil)
+			tx.Set(fmt.Sprintf(keyAccountVerified, "alice"), "1", nil)
+			tx.Set(fmt.Sprintf(keyAccountSettings, "alice"), settings, nil)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// showsEmail returns whether NS INFO alice, issued by client, shows alice's address
+	showsEmail := func(client *Client) bool {
+		rb := NewResponseBuffer(&Session{client: client})
+		nsInfoHandler(nickservService, server, client, "info", []string{"alice"}, rb)
+		for _, message := range rb.messages {
+			if strings.Contains(message.Params[1], "alice@example.com") {
+				return true
+			}
+		}
+		return false
+	}
+
+	alice := &Client{server: server, nick: "alice", account: "alice", accountName: "Alice"}
+	bob := &Client{server: server, nick: "bob", account: "bob", accountName: "bob"}
+	oper := &Client{server: server, nick: "oper", oper: &Oper{
+		Class: &OperClass{Capabilities: utils.HashSet[string]{"accreg": {}}},
+	}}
+
+	// the address is hidden by default, except from its owner and from operators
+	setSettings(`{"Email":"alice@example.com"}`)
+	assertEqual(showsEmail(alice), true)
+	assertEqual(showsEmail(bob), false)
+	assertEqual(showsEmail(oper), true)
+
+	// NS SET HIDE-EMAIL off shows it to everyone
+	setSettings(`{"Email":"alice@example.com","ShowEmail":true}`)
+	assertEqual(showsEmail(alice), true)
+	assertEqual(showsEmail(bob), true)
+	assertEqual(showsEmail(oper), true)
+}
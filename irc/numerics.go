@@ -66,6 +66,7 @@ const (
 	RPL_WHOISIDLE                 = "317"
 	RPL_ENDOFWHOIS                = "318"
 	RPL_WHOISCHANNELS             = "319"
+	RPL_WHOISSPECIAL              = "320"
 	RPL_LIST                      = "322"
 	RPL_LISTEND                   = "323"
 	RPL_CHANNELMODEIS             = "324"
@@ -163,6 +164,7 @@ const (
 	ERR_CANTKILLSERVER            = "483"
 	ERR_RESTRICTED                = "484"
 	ERR_UNIQOPPRIVSNEEDED         = "485"
+	ERR_SECUREONLYCHAN            = "489"
 	ERR_NOOPERHOST                = "491"
 	ERR_UMODEUNKNOWNFLAG          = "501"
 	ERR_USERSDONTMATCH            = "502"
@@ -177,6 +179,9 @@ const (
 	RPL_HELPSTART                 = "704"
 	RPL_HELPTXT                   = "705"
 	RPL_ENDOFHELP                 = "706"
+	ERR_TARGUMODEG                = "716"
+	RPL_TARGNOTIFY                = "717"
+	RPL_UMODEGMSG                 = "718"
 	ERR_NOPRIVS                   = "723"
 	RPL_MONONLINE                 = "730"
 	RPL_MONOFFLINE                = "731"
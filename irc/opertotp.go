@@ -0,0 +1,330 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package irc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ergochat/irc-go/ircfmt"
+	"github.com/ergochat/irc-go/ircmsg"
+	"github.com/tidwall/buntdb"
+
+	"github.com/ergochat/ergo/irc/modes"
+	"github.com/ergochat/ergo/irc/sno"
+	"github.com/ergochat/ergo/irc/totp"
+	"github.com/ergochat/ergo/irc/utils"
+)
+
+const (
+	keyOperTOTP = "oper.totp %s"
+
+	// how long a client has to answer the TOTP challenge after a successful OPER
+	operTOTPTimeout     = 2 * time.Minute
+	operTOTPBackupCodes = 8
+)
+
+// operTOTP is the persisted two-factor state for an oper block
+type operTOTP struct {
+	Secret    string
+	Confirmed bool
+	// last accepted time step, to prevent a code from being replayed
+	LastStep int64
+	// sha256 of each unused backup code
+	BackupCodes []string
+}
+
+// pendingOper is an OPER that passed the password/certfp checks,
+// but is waiting on a TOTP code
+type pendingOper struct {
+	oper    *Oper
+	started time.Time
+}
+
+func (server *Server) loadOperTOTP(name string) (result operTOTP, err error) {
+	var raw string
+	err = server.store.View(func(tx *buntdb.Tx) (err error) {
+		raw, err = tx.Get(fmt.Sprintf(keyOperTOTP, name))
+		return
+	})
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal([]byte(raw), &result)
+	return
+}
+
+func (server *Server) saveOperTOTP(name string, data operTOTP) (err error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	return server.store.Update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set(fmt.Sprintf(keyOperTOTP, name), string(raw), nil)
+		return err
+	})
+}
+
+// modifyOperTOTP loads the TOTP state of an oper block and passes it to
+// modify, saving the result if modify returns true; this happens in a single
+// transaction, so that concurrent attempts can't both consume the same code
+func (server *Server) modifyOperTOTP(name string, modify func(data *operTOTP) bool) (modified bool, err error) {
+	key := fmt.Sprintf(keyOperTOTP, name)
+	err = server.store.Update(func(tx *buntdb.Tx) error {
+		raw, err := tx.Get(key)
+		if err != nil {
+			return err
+		}
+		var data operTOTP
+		if err := json.Unmarshal([]byte(raw), &data); err != nil {
+			return err
+		}
+		if !modify(&data) {
+			return nil
+		}
+		newRaw, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		if _, _, err = tx.Set(key, string(newRaw), nil); err != nil {
+			return err
+		}
+		modified = true
+		return nil
+	})
+	return
+}
+
+func (server *Server) deleteOperTOTP(name string) (err error) {
+	err = server.store.Update(func(tx *buntdb.Tx) error {
+		_, err := tx.Delete(fmt.Sprintf(keyOperTOTP, name))
+		return err
+	})
+	if err == buntdb.ErrNotFound {
+		err = nil
+	}
+	return
+}
+
+// operRequiresTOTP returns whether OPER for this block must be completed with TOTP VERIFY
+func (server *Server) operRequiresTOTP(oper *Oper) bool {
+	data, err := server.loadOperTOTP(oper.Name)
+	return err == nil && data.Confirmed
+}
+
+// autoOperFor returns the auto-oper block matching a certfp, if any,
+// and whether it must still be completed with TOTP VERIFY
+func (server *Server) autoOperFor(certfp string) (oper *Oper, requiresTOTP bool) {
+	for _, candidate := range server.Config().operators {
+		if candidate.Auto && candidate.Pass == nil && candidate.Certfp != "" && candidate.Certfp == certfp {
+			return candidate, server.operRequiresTOTP(candidate)
+		}
+	}
+	return nil, false
+}
+
+func hashBackupCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateBackupCodes() (codes, hashes []string) {
+	codes = make([]string, operTOTPBackupCodes)
+	hashes = make([]string, operTOTPBackupCodes)
+	for i := range codes {
+		codes[i] = utils.GenerateSecretToken()[:10]
+		hashes[i] = hashBackupCode(codes[i])
+	}
+	return
+}
+
+// checkCode validates a TOTP or backup code, updating `data` to consume it
+func (data *operTOTP) checkCode(code string, now time.Time) bool {
+	if step, ok := totp.Validate(data.Secret, code, now); ok {
+		if step <= data.LastStep {
+			return false
+		}
+		data.LastStep = step
+		return true
+	}
+	hashed := hashBackupCode(code)
+	for i, backup := range data.BackupCodes {
+		if utils.SecretTokensMatch(backup, hashed) {
+			data.BackupCodes = append(data.BackupCodes[:i], data.BackupCodes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// consumeOperTOTPCode checks a code for a confirmed enrollment and persists the result
+func (server *Server) consumeOperTOTPCode(name, code string) bool {
+	now := time.Now().UTC()
+	consumed, err := server.modifyOperTOTP(name, func(data *operTOTP) bool {
+		return data.Confirmed && data.checkCode(code, now)
+	})
+	if err != nil && err != buntdb.ErrNotFound {
+		server.logger.Error("opers", "could not save TOTP state", name, err.Error())
+		return false
+	}
+	return consumed
+}
+
+// TOTP <subcommand> [code]
+func totpHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
+	subcommand := strings.ToLower(msg.Params[0])
+	var code string
+	if 1 < len(msg.Params) {
+		code = msg.Params[1]
+	}
+	if subcommand != "enroll" && code == "" {
+		rb.Add(nil, server.name, "FAIL", "TOTP", "INVALID_PARAMS", client.t("Not enough parameters"))
+		return false
+	}
+
+	if subcommand == "verify" {
+		return totpVerifyHandler(server, client, code, rb)
+	}
+
+	oper := client.Oper()
+	if oper == nil {
+		rb.Add(nil, server.name, ERR_NOPRIVILEGES, client.Nick(), client.t("Permission Denied - You're not an IRC operator"))
+		return false
+	}
+
+	switch subcommand {
+	case "enroll":
+		totpEnrollHandler(server, client, oper, rb)
+	case "confirm":
+		totpConfirmHandler(server, client, oper, code, rb)
+	case "disable":
+		totpDisableHandler(server, client, oper, code, rb)
+	case "backupcodes":
+		totpBackupCodesHandler(server, client, oper, code, rb)
+	default:
+		rb.Add(nil, server.name, "FAIL", "TOTP", "UNKNOWN_COMMAND", client.t("Unknown command"))
+	}
+	return false
+}
+
+func totpVerifyHandler(server *Server, client *Client, code string, rb *ResponseBuffer) bool {
+	pending := rb.session.pendingOper
+	rb.session.pendingOper = nil
+	if pending == nil || time.Since(pending.started) > operTOTPTimeout {
+		rb.Add(nil, server.name, "FAIL", "TOTP", "NO_PENDING_OPER", client.t("You have no pending OPER request"))
+		return false
+	}
+	if client.HasMode(modes.Operator) {
+		rb.Add(nil, server.name, ERR_UNKNOWNERROR, client.Nick(), "TOTP", client.t("You're already opered-up!"))
+		return false
+	}
+	// the oper block may have been removed or changed by a rehash:
+	oper := server.GetOperator(pending.oper.Name)
+	if oper == nil || !server.consumeOperTOTPCode(oper.Name, code) {
+		rb.Add(nil, server.name, ERR_PASSWDMISMATCH, client.Nick(), client.t("Password incorrect"))
+		client.Quit(client.t("Password incorrect"), rb.session)
+		return true
+	}
+	applyOper(client, oper, rb)
+	return false
+}
+
+func totpEnrollHandler(server *Server, client *Client, oper *Oper, rb *ResponseBuffer) {
+	if data, err := server.loadOperTOTP(oper.Name); err == nil && data.Confirmed {
+		rb.Add(nil, server.name, "FAIL", "TOTP", "ALREADY_ENROLLED", client.t("This operator block already has a TOTP device; disable it first"))
+		return
+	}
+	data := operTOTP{Secret: totp.GenerateSecret()}
+	if err := server.saveOperTOTP(oper.Name, data); err != nil {
+		server.logger.Error("opers", "could not save TOTP state", oper.Name, err.Error())
+		rb.Notice(client.t("An error occurred"))
+		return
+	}
+	rb.Notice(fmt.Sprintf(client.t("Your TOTP secret is: %s"), data.Secret))
+	rb.Notice(fmt.Sprintf(client.t("Enrollment URI: %s"), totp.URI(server.name, oper.Name, data.Secret)))
+	rb.Notice(client.t("To complete enrollment, send TOTP CONFIRM with a code from your device"))
+}
+
+func totpConfirmHandler(server *Server, client *Client, oper *Oper, code string, rb *ResponseBuffer) {
+	var alreadyEnrolled bool
+	var codes []string
+	now := time.Now().UTC()
+	confirmed, err := server.modifyOperTOTP(oper.Name, func(data *operTOTP) bool {
+		if data.Confirmed {
+			alreadyEnrolled = true
+			return false
+		}
+		step, ok := totp.Validate(data.Secret, code, now)
+		if !ok {
+			return false
+		}
+		data.Confirmed = true
+		data.LastStep = step
+		codes, data.BackupCodes = generateBackupCodes()
+		return true
+	})
+	if err == buntdb.ErrNotFound {
+		rb.Add(nil, server.name, "FAIL", "TOTP", "NOT_ENROLLED", client.t("You must use TOTP ENROLL first"))
+		return
+	} else if err != nil {
+		server.logger.Error("opers", "could not save TOTP state", oper.Name, err.Error())
+		rb.Notice(client.t("An error occurred"))
+		return
+	} else if alreadyEnrolled {
+		rb.Add(nil, server.name, "FAIL", "TOTP", "ALREADY_ENROLLED", client.t("This operator block already has a TOTP device; disable it first"))
+		return
+	} else if !confirmed {
+		rb.Add(nil, server.name, "FAIL", "TOTP", "INVALID_CODE", client.t("Invalid code"))
+		return
+	}
+	server.snomasks.Send(sno.LocalOpers, fmt.Sprintf(ircfmt.Unescape("Oper enrolled a TOTP device $c[grey][$r%s$c[grey], $r%s$c[grey]]"), client.NickMaskString(), oper.Name))
+	rb.Notice(client.t("TOTP is now required to use this operator block"))
+	sendBackupCodes(client, codes, rb)
+}
+
+func totpDisableHandler(server *Server, client *Client, oper *Oper, code string, rb *ResponseBuffer) {
+	if !server.consumeOperTOTPCode(oper.Name, code) {
+		rb.Add(nil, server.name, "FAIL", "TOTP", "INVALID_CODE", client.t("Invalid code"))
+		return
+	}
+	if err := server.deleteOperTOTP(oper.Name); err != nil {
+		server.logger.Error("opers", "could not delete TOTP state", oper.Name, err.Error())
+		rb.Notice(client.t("An error occurred"))
+		return
+	}
+	server.snomasks.Send(sno.LocalOpers, fmt.Sprintf(ircfmt.Unescape("Oper removed a TOTP device $c[grey][$r%s$c[grey], $r%s$c[grey]]"), client.NickMaskString(), oper.Name))
+	rb.Notice(client.t("TOTP is no longer required to use this operator block"))
+}
+
+func totpBackupCodesHandler(server *Server, client *Client, oper *Oper, code string, rb *ResponseBuffer) {
+	var codes []string
+	now := time.Now().UTC()
+	regenerated, err := server.modifyOperTOTP(oper.Name, func(data *operTOTP) bool {
+		if !data.Confirmed || !data.checkCode(code, now) {
+			return false
+		}
+		codes, data.BackupCodes = generateBackupCodes()
+		return true
+	})
+	if err != nil && err != buntdb.ErrNotFound {
+		server.logger.Error("opers", "could not save TOTP state", oper.Name, err.Error())
+		rb.Notice(client.t("An error occurred"))
+		return
+	} else if !regenerated {
+		rb.Add(nil, server.name, "FAIL", "TOTP", "INVALID_CODE", client.t("Invalid code"))
+		return
+	}
+	sendBackupCodes(client, codes, rb)
+}
+
+func sendBackupCodes(client *Client, codes []string, rb *ResponseBuffer) {
+	rb.Notice(client.t("Your backup codes are listed below. Each can be used once in place of a TOTP code; store them somewhere safe:"))
+	for _, code := range codes {
+		rb.Notice(code)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package irc
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/tidwall/buntdb"
+)
+
+func TestAutoOperRequiresTOTP(t *testing.T) {
+	db, err := buntdb.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	server := &Server{store: db}
+	config := &Config{}
+	config.operators = map[string]*Oper{
+		"auto": {Name: "auto", Auto: true, Certfp: "abcdef"},
+	}
+	server.config.Set(config)
+
+	oper, requiresTOTP := server.autoOperFor("abcdef")
+	if oper == nil || oper.Name != "auto" {
+		t.Fatalf("expected auto-oper for matching certfp, got %v", oper)
+	}
+	assertEqual(requiresTOTP, false)
+
+	oper, _ = server.autoOperFor("123456")
+	if oper != nil {
+		t.Errorf("unexpected auto-oper for non-matching certfp: %v", oper)
+	}
+
+	// an unconfirmed enrollment doesn't require TOTP yet
+	if err := server.saveOperTOTP("auto", operTOTP{Secret: "JBSWY3DPEHPK3PXP"}); err != nil {
+		t.Fatal(err)
+	}
+	_, requiresTOTP = server.autoOperFor("abcdef")
+	assertEqual(requiresTOTP, false)
+
+	// once TOTP is confirmed, the certfp alone must not grant oper
+	if err := server.saveOperTOTP("auto", operTOTP{Secret: "JBSWY3DPEHPK3PXP", Confirmed: true}); err != nil {
+		t.Fatal(err)
+	}
+	oper, requiresTOTP = server.autoOperFor("abcdef")
+	if oper == nil {
+		t.Fatalf("expected auto-oper block for matching certfp")
+	}
+	assertEqual(requiresTOTP, true)
+}
+
+func TestConsumeOperTOTPCodeConcurrently(t *testing.T) {
+	db, err := buntdb.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	server := &Server{store: db}
+
+	codes, hashes := generateBackupCodes()
+	err = server.saveOperTOTP("admin", operTOTP{Secret: "JBSWY3DPEHPK3PXP", Confirmed: true, BackupCodes: hashes})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// concurrent attempts with the same backup code: only one may succeed
+	var wg sync.WaitGroup
+	var successes int32
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if server.consumeOperTOTPCode("admin", codes[0]) {
+				atomic.AddInt32(&successes, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assertEqual(successes, int32(1))
+
+	data, err := server.loadOperTOTP("admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(len(data.BackupCodes), operTOTPBackupCodes-1)
+	assertEqual(server.consumeOperTOTPCode("admin", codes[1]), true)
+	assertEqual(server.consumeOperTOTPCode("nobody", codes[2]), false)
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package postgresql
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	// these are intended to be written directly into the config file:
+	Enabled bool
+	Host    string
+	Port    int
+	// if set, the directory containing the server's unix socket
+	SocketPath      string `yaml:"socket-path"`
+	User            string
+	Password        string
+	HistoryDatabase string `yaml:"history-database"`
+	// one of disable, require, verify-ca, or verify-full
+	SSLMode         string `yaml:"ssl-mode"`
+	Timeout         time.Duration
+	MaxConns        int           `yaml:"max-conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn-max-lifetime"`
+	AsyncWrites     bool          `yaml:"async-writes"`
+
+	// XXX these are copied from elsewhere in the config:
+	ExpireTime           time.Duration
+	TrackAccountMessages bool
+	MaxMessagesPerTarget int
+}
+
+// connString builds a libpq-style key/value connection string
+func (config *Config) connString() string {
+	var buf strings.Builder
+	param := func(key, value string) {
+		if value == "" {
+			return
+		}
+		if buf.Len() != 0 {
+			buf.WriteByte(' ')
+		}
+		// values are single-quoted, with quotes and backslashes escaped
+		value = strings.ReplaceAll(value, `\`, `\\`)
+		value = strings.ReplaceAll(value, `'`, `\'`)
+		fmt.Fprintf(&buf, "%s='%s'", key, value)
+	}
+
+	if config.SocketPath != "" {
+		param("host", config.SocketPath)
+	} else {
+		param("host", config.Host)
+	}
+	if config.Port != 0 {
+		param("port", fmt.Sprintf("%d", config.Port))
+	}
+	param("user", config.User)
+	param("password", config.Password)
+	param("dbname", config.HistoryDatabase)
+	sslMode := config.SSLMode
+	if sslMode == "" && config.SocketPath != "" {
+		// the driver defaults to `require`, which is meaningless over a unix socket
+		sslMode = "disable"
+	}
+	param("sslmode", sslMode)
+	return buf.String()
+}
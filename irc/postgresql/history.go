@@ -0,0 +1,1176 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+// Package postgresql implements persistent history on top of PostgreSQL,
+// as an alternative to MySQL. Message times are stored as native timestamps,
+// and message data is partitioned by day so that expiry can drop partitions.
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/ergochat/ergo/irc/history"
+	"github.com/ergochat/ergo/irc/logger"
+	"github.com/ergochat/ergo/irc/utils"
+)
+
+var (
+	ErrDisallowed = errors.New("disallowed")
+)
+
+const (
+	latestDbSchema   = "1"
+	keySchemaVersion = "db.version"
+	cleanupRowLimit  = 50
+	cleanupPauseTime = 10 * time.Minute
+	// batch size for deleting messages over the per-target cap
+	trimRowLimit = 1000
+	// each trim pass also rechecks targets that were active shortly before
+	// the previous pass, in case their messages were written late
+	trimOverlap = time.Minute
+	// maximum number of pending writes; past this, writers block
+	// until the queue drains (crude backpressure)
+	writeQueueSize = 1024
+)
+
+type e struct{}
+
+type writeRequest struct {
+	write func() error
+	// if non-nil, the result of the write is sent here; otherwise
+	// the write is asynchronous and any error is logged
+	result chan error
+}
+
+type PostgreSQL struct {
+	timeout              *int64
+	trackAccountMessages uint32
+	asyncWrites          uint32
+	db                   *sql.DB
+	logger               *logger.Manager
+
+	insertHistory        *sql.Stmt
+	insertSequence       *sql.Stmt
+	insertConversation   *sql.Stmt
+	insertCorrespondent  *sql.Stmt
+	insertAccountMessage *sql.Stmt
+
+	stateMutex sync.Mutex
+	config     Config
+
+	wakeForgetter chan e
+
+	// asynchronous writes go through a single goroutine, so they are applied
+	// in order; synchronous writes bypass it, unless asynchronous writes are
+	// still pending (e.g., right after async-writes was disabled by a rehash)
+	queueMutex    sync.RWMutex
+	writeQueue    chan writeRequest
+	writerGroup   sync.WaitGroup
+	pendingWrites int64
+}
+
+func (pg *PostgreSQL) Initialize(logger *logger.Manager, config Config) {
+	pg.timeout = new(int64)
+	pg.logger = logger
+	pg.wakeForgetter = make(chan e, 1)
+	pg.SetConfig(config)
+}
+
+func (pg *PostgreSQL) SetConfig(config Config) {
+	atomic.StoreInt64(pg.timeout, int64(config.Timeout))
+	var trackAccountMessages uint32
+	if config.TrackAccountMessages {
+		trackAccountMessages = 1
+	}
+	atomic.StoreUint32(&pg.trackAccountMessages, trackAccountMessages)
+	var asyncWrites uint32
+	if config.AsyncWrites {
+		asyncWrites = 1
+	}
+	atomic.StoreUint32(&pg.asyncWrites, asyncWrites)
+	pg.stateMutex.Lock()
+	pg.config = config
+	pg.stateMutex.Unlock()
+}
+
+func (pg *PostgreSQL) getRetention() (expireTime time.Duration, maxMessages int) {
+	pg.stateMutex.Lock()
+	expireTime = pg.config.ExpireTime
+	maxMessages = pg.config.MaxMessagesPerTarget
+	pg.stateMutex.Unlock()
+	return
+}
+
+func (pg *PostgreSQL) Open() (err error) {
+	pg.db, err = sql.Open("postgres", pg.config.connString())
+	if err != nil {
+		return err
+	}
+
+	if pg.config.MaxConns != 0 {
+		pg.db.SetMaxOpenConns(pg.config.MaxConns)
+		pg.db.SetMaxIdleConns(pg.config.MaxConns)
+	}
+	if pg.config.ConnMaxLifetime != 0 {
+		pg.db.SetConnMaxLifetime(pg.config.ConnMaxLifetime)
+	}
+
+	err = pg.fixSchemas()
+	if err != nil {
+		return err
+	}
+
+	err = pg.createPartitions(time.Now())
+	if err != nil {
+		return err
+	}
+
+	err = pg.prepareStatements()
+	if err != nil {
+		return err
+	}
+
+	pg.writeQueue = make(chan writeRequest, writeQueueSize)
+	pg.writerGroup.Add(1)
+	go pg.writeLoop()
+
+	go pg.cleanupLoop()
+	go pg.forgetLoop()
+
+	return nil
+}
+
+func (pg *PostgreSQL) fixSchemas() (err error) {
+	_, err = pg.db.Exec(`CREATE TABLE IF NOT EXISTS metadata (
+		key_name VARCHAR(32) PRIMARY KEY,
+		value VARCHAR(32) NOT NULL
+	);`)
+	if err != nil {
+		return err
+	}
+
+	var schema string
+	err = pg.db.QueryRow(`SELECT value FROM metadata WHERE key_name = $1;`, keySchemaVersion).Scan(&schema)
+	if err == sql.ErrNoRows {
+		err = pg.createTables()
+		if err != nil {
+			return
+		}
+		_, err = pg.db.Exec(`INSERT INTO metadata (key_name, value) VALUES ($1, $2);`, keySchemaVersion, latestDbSchema)
+		return
+	} else if err == nil && schema != latestDbSchema {
+		// TODO figure out what to do about schema changes
+		return fmt.Errorf("incompatible schema: got %s, expected %s", schema, latestDbSchema)
+	}
+	return
+}
+
+func (pg *PostgreSQL) createTables() (err error) {
+	// message times are stored in every partitioned table, since the
+	// partition key must be part of any primary key or unique constraint
+	statements := []string{
+		`CREATE TABLE history (
+			id BIGSERIAL NOT NULL,
+			msgtime TIMESTAMPTZ NOT NULL,
+			data BYTEA NOT NULL,
+			msgid BYTEA NOT NULL,
+			PRIMARY KEY (id, msgtime)
+		) PARTITION BY RANGE (msgtime);`,
+		`CREATE INDEX ON history (msgid);`,
+
+		`CREATE TABLE sequence (
+			history_id BIGINT NOT NULL,
+			target TEXT NOT NULL,
+			msgtime TIMESTAMPTZ NOT NULL
+		) PARTITION BY RANGE (msgtime);`,
+		`CREATE INDEX ON sequence (target, msgtime);`,
+		`CREATE INDEX ON sequence (history_id);`,
+
+		`CREATE TABLE conversations (
+			history_id BIGINT NOT NULL,
+			target TEXT NOT NULL,
+			correspondent TEXT NOT NULL,
+			msgtime TIMESTAMPTZ NOT NULL
+		) PARTITION BY RANGE (msgtime);`,
+		`CREATE INDEX ON conversations (target, correspondent, msgtime);`,
+		`CREATE INDEX ON conversations (history_id);`,
+
+		`CREATE TABLE account_messages (
+			history_id BIGINT NOT NULL,
+			account TEXT NOT NULL,
+			msgtime TIMESTAMPTZ NOT NULL
+		) PARTITION BY RANGE (msgtime);`,
+		`CREATE INDEX ON account_messages (account, history_id);`,
+		`CREATE INDEX ON account_messages (history_id);`,
+
+		// correspondents holds one row per conversation, updated in place,
+		// so it can't be partitioned by time:
+		`CREATE TABLE correspondents (
+			target TEXT NOT NULL,
+			correspondent TEXT NOT NULL,
+			msgtime TIMESTAMPTZ NOT NULL,
+			PRIMARY KEY (target, correspondent)
+		);`,
+		`CREATE INDEX ON correspondents (target, msgtime);`,
+		`CREATE INDEX ON correspondents (msgtime);`,
+
+		`CREATE TABLE forget (
+			id BIGSERIAL PRIMARY KEY,
+			account TEXT NOT NULL
+		);`,
+	}
+	for _, table := range partitionedTables {
+		statements = append(statements, fmt.Sprintf(`CREATE TABLE %s PARTITION OF %s DEFAULT;`,
+			defaultPartitionName(table), table))
+	}
+
+	for _, statement := range statements {
+		_, err = pg.db.Exec(statement)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createPartitions ensures that the daily partitions around `now` exist
+func (pg *PostgreSQL) createPartitions(now time.Time) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupPauseTime)
+	defer cancel()
+
+	for _, start := range wantedPartitions(now) {
+		for _, table := range partitionedTables {
+			_, err = pg.db.ExecContext(ctx, fmt.Sprintf(
+				`CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s');`,
+				partitionName(table, start), table,
+				start.Format(time.RFC3339), start.Add(partitionInterval).Format(time.RFC3339)))
+			if err != nil {
+				return fmt.Errorf("could not create partition of %s: %w", table, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (pg *PostgreSQL) listPartitions(ctx context.Context, table string) (names []string, err error) {
+	rows, err := pg.db.QueryContext(ctx, `
+		SELECT child.relname FROM pg_inherits
+		INNER JOIN pg_class child ON child.oid = pg_inherits.inhrelid
+		WHERE pg_inherits.inhparent = $1::regclass;`, table)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		err = rows.Scan(&name)
+		if err != nil {
+			return
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+func (pg *PostgreSQL) getTimeout() time.Duration {
+	return time.Duration(atomic.LoadInt64(pg.timeout))
+}
+
+func (pg *PostgreSQL) writeLoop() {
+	defer pg.writerGroup.Done()
+
+	for request := range pg.writeQueue {
+		err := request.write()
+		atomic.AddInt64(&pg.pendingWrites, -1)
+		if request.result != nil {
+			request.result <- err
+		} else {
+			pg.logError("asynchronous write failed", err)
+		}
+	}
+}
+
+// write performs a database write. If async writes are enabled, it is queued
+// for the writer goroutine and write returns immediately (unless the queue is
+// full); otherwise it runs on the calling goroutine and returns its error.
+func (pg *PostgreSQL) write(write func() error) (err error) {
+	return pg.doWrite(write, atomic.LoadUint32(&pg.asyncWrites) != 0)
+}
+
+// doWrite performs a write, asynchronously if async is set. A synchronous
+// write waits behind any queued asynchronous writes, so that it can't be
+// applied ahead of a write that preceded it.
+func (pg *PostgreSQL) doWrite(write func() error, async bool) (err error) {
+	if !async && atomic.LoadInt64(&pg.pendingWrites) == 0 {
+		return write()
+	}
+
+	var result chan error
+	if !async {
+		result = make(chan error, 1)
+	}
+
+	pg.queueMutex.RLock()
+	if pg.writeQueue == nil {
+		pg.queueMutex.RUnlock()
+		return write()
+	}
+	// if the queue is full, block rather than writing directly,
+	// which would reorder this write ahead of the queued ones
+	atomic.AddInt64(&pg.pendingWrites, 1)
+	pg.writeQueue <- writeRequest{write: write, result: result}
+	pg.queueMutex.RUnlock()
+
+	if result != nil {
+		return <-result
+	}
+	return nil
+}
+
+func (pg *PostgreSQL) cleanupLoop() {
+	defer func() {
+		if r := recover(); r != nil {
+			pg.logger.Error("postgresql",
+				fmt.Sprintf("Panic in cleanup routine: %v\n%s", r, debug.Stack()))
+			time.Sleep(cleanupPauseTime)
+			go pg.cleanupLoop()
+		}
+	}()
+
+	// when the last successful trim pass started, and what cap it applied
+	var trimmedAt time.Time
+	var trimmedMax int
+	for {
+		now := time.Now()
+		pg.logError("error creating partitions", pg.createPartitions(now))
+		expireTime, maxMessages := pg.getRetention()
+		if expireTime != 0 {
+			pg.logError("error during expiry", pg.doCleanup(now.Add(-expireTime)))
+		}
+		if maxMessages != 0 {
+			// after the first pass, only targets with new messages can be over
+			// the cap, unless the cap itself was lowered
+			var since time.Time
+			if maxMessages >= trimmedMax && !trimmedAt.IsZero() {
+				since = trimmedAt.Add(-trimOverlap)
+			}
+			if !pg.logError("error trimming history", pg.doTrim(maxMessages, since)) {
+				trimmedAt, trimmedMax = now, maxMessages
+			}
+		}
+		time.Sleep(cleanupPauseTime)
+	}
+}
+
+// doCleanup deletes history older than threshold: whole partitions where
+// possible, individual rows from the default partitions and the
+// (unpartitioned) correspondents table
+func (pg *PostgreSQL) doCleanup(threshold time.Time) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupPauseTime)
+	defer cancel()
+
+	for _, table := range partitionedTables {
+		names, err := pg.listPartitions(ctx, table)
+		if err != nil {
+			return err
+		}
+		for _, name := range expiredPartitions(table, names, threshold) {
+			pg.logger.Debug("postgresql", "dropping expired partition", name)
+			_, err = pg.db.ExecContext(ctx, fmt.Sprintf(`DROP TABLE IF EXISTS %s;`, name))
+			if err != nil {
+				return err
+			}
+		}
+		_, err = pg.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE msgtime < $1;`,
+			defaultPartitionName(table)), threshold)
+		if err != nil {
+			return err
+		}
+	}
+
+	result, err := pg.db.ExecContext(ctx, `DELETE FROM correspondents WHERE msgtime <= $1;`, threshold)
+	if err != nil {
+		return
+	}
+	if count, err := result.RowsAffected(); err == nil {
+		pg.logger.Debug("postgresql", fmt.Sprintf("deleted %d correspondents entries", count))
+	}
+	return nil
+}
+
+// doTrim deletes the oldest messages of any channel or conversation
+// holding more than maxMessages of them. only targets with messages since
+// `since` are checked (all of them, if it is zero).
+func (pg *PostgreSQL) doTrim(maxMessages int, since time.Time) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupPauseTime)
+	defer cancel()
+
+	// the time bound lets this skip all but the most recent partitions:
+	keys, err := pg.selectTrimKeys(ctx, `
+		SELECT DISTINCT target, '' FROM sequence WHERE msgtime >= $1;`, since)
+	if err != nil {
+		return
+	}
+	convKeys, err := pg.selectTrimKeys(ctx, `
+		SELECT target, correspondent FROM correspondents WHERE msgtime >= $1;`, since)
+	if err != nil {
+		return
+	}
+	for _, key := range append(keys, convKeys...) {
+		if err = pg.trimTarget(ctx, key, maxMessages); err != nil {
+			return
+		}
+	}
+	return
+}
+
+type trimKey struct {
+	target        string
+	correspondent string
+}
+
+func (pg *PostgreSQL) selectTrimKeys(ctx context.Context, query string, args ...interface{}) (keys []trimKey, err error) {
+	rows, err := pg.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key trimKey
+		if err = rows.Scan(&key.target, &key.correspondent); err != nil {
+			return
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// trimTarget deletes the messages of one channel or conversation past the
+// newest maxMessages, trimRowLimit at a time
+func (pg *PostgreSQL) trimTarget(ctx context.Context, key trimKey, maxMessages int) (err error) {
+	for {
+		var rows *sql.Rows
+		// walk the (target, msgtime) index newest-first, skipping the rows to keep:
+		if key.correspondent == "" {
+			rows, err = pg.db.QueryContext(ctx, `
+				SELECT history_id FROM sequence WHERE target = $1
+				ORDER BY msgtime DESC LIMIT $2 OFFSET $3;`, key.target, trimRowLimit, maxMessages)
+		} else {
+			rows, err = pg.db.QueryContext(ctx, `
+				SELECT history_id FROM conversations WHERE target = $1 AND correspondent = $2
+				ORDER BY msgtime DESC LIMIT $3 OFFSET $4;`, key.target, key.correspondent, trimRowLimit, maxMessages)
+		}
+		if err != nil {
+			return
+		}
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			if err = rows.Scan(&id); err != nil {
+				rows.Close()
+				return
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil || len(ids) == 0 {
+			return
+		}
+		pg.logger.Debug("postgresql", fmt.Sprintf("trimming %d history rows of %s, max messages %d", len(ids), key.target, maxMessages))
+		if err = pg.deleteHistoryIDs(ctx, ids); err != nil || len(ids) < trimRowLimit {
+			return
+		}
+	}
+}
+
+func (pg *PostgreSQL) deleteHistoryIDs(ctx context.Context, ids []int64) (err error) {
+	idArray := pq.Array(ids)
+	_, err = pg.db.ExecContext(ctx, `DELETE FROM conversations WHERE history_id = ANY($1);`, idArray)
+	if err != nil {
+		return
+	}
+	_, err = pg.db.ExecContext(ctx, `DELETE FROM sequence WHERE history_id = ANY($1);`, idArray)
+	if err != nil {
+		return
+	}
+	_, err = pg.db.ExecContext(ctx, `DELETE FROM account_messages WHERE history_id = ANY($1);`, idArray)
+	if err != nil {
+		return
+	}
+	_, err = pg.db.ExecContext(ctx, `DELETE FROM history WHERE id = ANY($1);`, idArray)
+	return
+}
+
+// wait for forget queue items and process them one by one
+func (pg *PostgreSQL) forgetLoop() {
+	defer func() {
+		if r := recover(); r != nil {
+			pg.logger.Error("postgresql",
+				fmt.Sprintf("Panic in forget routine: %v\n%s", r, debug.Stack()))
+			time.Sleep(cleanupPauseTime)
+			go pg.forgetLoop()
+		}
+	}()
+
+	for {
+		for {
+			found, err := pg.doForget()
+			pg.logError("error processing forget", err)
+			if err != nil {
+				time.Sleep(cleanupPauseTime)
+			}
+			if !found {
+				break
+			}
+		}
+
+		<-pg.wakeForgetter
+	}
+}
+
+// dequeue an item from the forget queue and process it
+func (pg *PostgreSQL) doForget() (found bool, err error) {
+	id, account, err := func() (id int64, account string, err error) {
+		ctx, cancel := context.WithTimeout(context.Background(), cleanupPauseTime)
+		defer cancel()
+
+		row := pg.db.QueryRowContext(ctx,
+			`SELECT forget.id, forget.account FROM forget LIMIT 1;`)
+		err = row.Scan(&id, &account)
+		if err == sql.ErrNoRows {
+			return 0, "", nil
+		}
+		return
+	}()
+
+	if err != nil || account == "" {
+		return false, err
+	}
+
+	found = true
+
+	var count int
+	for {
+		start := time.Now()
+		count, err = pg.doForgetIteration(account)
+		elapsed := time.Since(start)
+		if err != nil {
+			return true, err
+		}
+		if count == 0 {
+			break
+		}
+		time.Sleep(elapsed)
+	}
+
+	pg.logger.Debug("postgresql", "forget complete for account", account)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupPauseTime)
+	defer cancel()
+	_, err = pg.db.ExecContext(ctx, `DELETE FROM forget WHERE id = $1;`, id)
+	return
+}
+
+func (pg *PostgreSQL) doForgetIteration(account string) (count int, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupPauseTime)
+	defer cancel()
+
+	rows, err := pg.db.QueryContext(ctx, `
+		SELECT account_messages.history_id
+		FROM account_messages
+		WHERE account_messages.account = $1
+		LIMIT $2;`, account, cleanupRowLimit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		err = rows.Scan(&id)
+		if err != nil {
+			return
+		}
+		ids = append(ids, id)
+	}
+
+	if len(ids) == 0 {
+		return
+	}
+
+	pg.logger.Debug("postgresql", fmt.Sprintf("deleting %d history rows from account %s", len(ids), account))
+	err = pg.deleteHistoryIDs(ctx, ids)
+	return len(ids), err
+}
+
+func (pg *PostgreSQL) prepareStatements() (err error) {
+	pg.insertHistory, err = pg.db.Prepare(`INSERT INTO history
+		(msgtime, data, msgid) VALUES ($1, $2, $3) RETURNING id;`)
+	if err != nil {
+		return
+	}
+	pg.insertSequence, err = pg.db.Prepare(`INSERT INTO sequence
+		(history_id, target, msgtime) VALUES ($1, $2, $3);`)
+	if err != nil {
+		return
+	}
+	pg.insertConversation, err = pg.db.Prepare(`INSERT INTO conversations
+		(history_id, target, correspondent, msgtime) VALUES ($1, $2, $3, $4);`)
+	if err != nil {
+		return
+	}
+	pg.insertCorrespondent, err = pg.db.Prepare(`INSERT INTO correspondents
+		(target, correspondent, msgtime) VALUES ($1, $2, $3)
+		ON CONFLICT (target, correspondent)
+		DO UPDATE SET msgtime = GREATEST(correspondents.msgtime, EXCLUDED.msgtime);`)
+	if err != nil {
+		return
+	}
+	pg.insertAccountMessage, err = pg.db.Prepare(`INSERT INTO account_messages
+		(history_id, account, msgtime) VALUES ($1, $2, $3);`)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (pg *PostgreSQL) isTrackingAccountMessages() bool {
+	return atomic.LoadUint32(&pg.trackAccountMessages) != 0
+}
+
+func (pg *PostgreSQL) logError(context string, err error) (quit bool) {
+	if err != nil {
+		pg.logger.Error("postgresql", context, err.Error())
+		return true
+	}
+	return false
+}
+
+// toTimestamp converts t to the precision of a PostgreSQL timestamp. The server
+// would otherwise round it, which could move a message to the wrong side of a
+// cursor derived from that same message's time.
+func toTimestamp(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Microsecond)
+}
+
+func (pg *PostgreSQL) Forget(account string) {
+	if pg.db == nil || account == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pg.getTimeout())
+	defer cancel()
+
+	_, err := pg.db.ExecContext(ctx, `INSERT INTO forget (account) VALUES ($1);`, account)
+	if pg.logError("can't insert into forget table", err) {
+		return
+	}
+
+	// wake up the forget goroutine if it's blocked:
+	select {
+	case pg.wakeForgetter <- e{}:
+	default:
+	}
+}
+
+func (pg *PostgreSQL) AddChannelItem(target string, item history.Item, account string) (err error) {
+	if pg.db == nil {
+		return
+	}
+
+	if target == "" {
+		return utils.ErrInvalidParams
+	}
+
+	return pg.write(func() error {
+		return pg.addChannelItem(target, item, account)
+	})
+}
+
+func (pg *PostgreSQL) addChannelItem(target string, item history.Item, account string) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), pg.getTimeout())
+	defer cancel()
+
+	msgtime := toTimestamp(item.Message.Time)
+	id, err := pg.insertBase(ctx, msgtime, item)
+	if err != nil {
+		return
+	}
+
+	_, err = pg.insertSequence.ExecContext(ctx, id, target, msgtime)
+	if pg.logError("could not insert sequence entry", err) {
+		return
+	}
+
+	return pg.insertAccountMessageEntry(ctx, id, account, msgtime)
+}
+
+func (pg *PostgreSQL) insertBase(ctx context.Context, msgtime time.Time, item history.Item) (id int64, err error) {
+	value, err := marshalItem(&item)
+	if pg.logError("could not marshal item", err) {
+		return
+	}
+
+	msgidBytes, err := decodeMsgid(item.Message.Msgid)
+	if pg.logError("could not decode msgid", err) {
+		return
+	}
+
+	err = pg.insertHistory.QueryRowContext(ctx, msgtime, value, msgidBytes).Scan(&id)
+	pg.logError("could not insert item", err)
+	return
+}
+
+func (pg *PostgreSQL) insertAccountMessageEntry(ctx context.Context, id int64, account string, msgtime time.Time) (err error) {
+	if account == "" || !pg.isTrackingAccountMessages() {
+		return
+	}
+	_, err = pg.insertAccountMessage.ExecContext(ctx, id, account, msgtime)
+	pg.logError("could not insert account-message entry", err)
+	return
+}
+
+func (pg *PostgreSQL) AddDirectMessage(sender, senderAccount, recipient, recipientAccount string, item history.Item) (err error) {
+	if pg.db == nil {
+		return
+	}
+
+	if senderAccount == "" && recipientAccount == "" {
+		return
+	}
+
+	if sender == "" || recipient == "" {
+		return utils.ErrInvalidParams
+	}
+
+	return pg.write(func() error {
+		return pg.addDirectMessage(sender, senderAccount, recipient, recipientAccount, item)
+	})
+}
+
+func (pg *PostgreSQL) addDirectMessage(sender, senderAccount, recipient, recipientAccount string, item history.Item) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), pg.getTimeout())
+	defer cancel()
+
+	msgtime := toTimestamp(item.Message.Time)
+	id, err := pg.insertBase(ctx, msgtime, item)
+	if err != nil {
+		return
+	}
+
+	insertConversation := func(target, correspondent string) (err error) {
+		_, err = pg.insertConversation.ExecContext(ctx, id, target, correspondent, msgtime)
+		if pg.logError("could not insert conversations entry", err) {
+			return
+		}
+		_, err = pg.insertCorrespondent.ExecContext(ctx, target, correspondent, msgtime)
+		pg.logError("could not insert correspondents entry", err)
+		return
+	}
+
+	if senderAccount != "" {
+		err = insertConversation(senderAccount, recipient)
+		if err != nil {
+			return
+		}
+	}
+
+	if recipientAccount != "" && sender != recipient {
+		err = insertConversation(recipientAccount, sender)
+		if err != nil {
+			return
+		}
+	}
+
+	return pg.insertAccountMessageEntry(ctx, id, senderAccount, msgtime)
+}
+
+func (pg *PostgreSQL) RenameTarget(oldTarget, newTarget string) (err error) {
+	if pg.db == nil {
+		return
+	}
+
+	// go through the write queue, so that messages already queued
+	// for the old name are moved as well
+	return pg.write(func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), pg.getTimeout())
+		defer cancel()
+		_, err := pg.db.ExecContext(ctx, `UPDATE sequence SET target = $1 WHERE target = $2;`, newTarget, oldTarget)
+		pg.logError("could not rename history target", err)
+		return err
+	})
+}
+
+// note that accountName is the unfolded name
+func (pg *PostgreSQL) DeleteMsgid(msgid, accountName string) (err error) {
+	if pg.db == nil {
+		return nil
+	}
+
+	// the delete is ordered after any pending write of the message itself,
+	// and always waits for its result (e.g., ErrDisallowed)
+	return pg.doWrite(func() (err error) {
+		ctx, cancel := context.WithTimeout(context.Background(), pg.getTimeout())
+		defer cancel()
+
+		_, id, data, err := pg.lookupMsgid(ctx, msgid, true)
+		if err != nil {
+			return
+		}
+
+		if accountName != "*" {
+			var item history.Item
+			err = unmarshalItem(data, &item)
+			// delete if the entry is corrupt
+			if err == nil && item.AccountName != accountName {
+				return ErrDisallowed
+			}
+		}
+
+		err = pg.deleteHistoryIDs(ctx, []int64{id})
+		pg.logError("couldn't delete msgid", err)
+		return
+	}, false)
+}
+
+// Export writes out all messages sent by account, both to channels and in DMs
+func (pg *PostgreSQL) Export(account string, writer io.Writer) {
+	if pg.db == nil {
+		return
+	}
+
+	var err error
+	var lastSeen int64
+	for {
+		rows := func() (count int) {
+			ctx, cancel := context.WithTimeout(context.Background(), cleanupPauseTime)
+			defer cancel()
+
+			// for a DM, the conversation entry filed under the sender's account
+			// identifies the recipient:
+			rows, rowsErr := pg.db.QueryContext(ctx, `
+				SELECT account_messages.history_id, history.data,
+					COALESCE(sequence.target, conversations.correspondent, '')
+				FROM account_messages
+				INNER JOIN history ON history.id = account_messages.history_id
+					AND history.msgtime = account_messages.msgtime
+				LEFT JOIN sequence ON sequence.history_id = account_messages.history_id
+					AND sequence.msgtime = account_messages.msgtime
+				LEFT JOIN conversations ON conversations.history_id = account_messages.history_id
+					AND conversations.msgtime = account_messages.msgtime
+					AND conversations.target = account_messages.account
+				WHERE account_messages.account = $1 AND account_messages.history_id > $2
+				ORDER BY account_messages.history_id LIMIT $3;`, account, lastSeen, cleanupRowLimit)
+			if rowsErr != nil {
+				err = rowsErr
+				return
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var id int64
+				var blob, jsonBlob []byte
+				var target string
+				var item history.Item
+				err = rows.Scan(&id, &blob, &target)
+				if err != nil {
+					return
+				}
+				err = unmarshalItem(blob, &item)
+				if err != nil {
+					return
+				}
+				item.CfCorrespondent = target
+				jsonBlob, err = json.Marshal(item)
+				if err != nil {
+					return
+				}
+				count++
+				if lastSeen < id {
+					lastSeen = id
+				}
+				writer.Write(jsonBlob)
+				writer.Write([]byte{'\n'})
+			}
+			return
+		}()
+		if rows == 0 || err != nil {
+			break
+		}
+	}
+
+	pg.logError("could not export history", err)
+	return
+}
+
+func (pg *PostgreSQL) lookupMsgid(ctx context.Context, msgid string, includeData bool) (result time.Time, id int64, data []byte, err error) {
+	decoded, err := decodeMsgid(msgid)
+	if err != nil {
+		return
+	}
+	cols := `history.msgtime`
+	if includeData {
+		cols = `history.msgtime, history.id, history.data`
+	}
+	row := pg.db.QueryRowContext(ctx, fmt.Sprintf(`
+		SELECT %s FROM history WHERE history.msgid = $1 LIMIT 1;`, cols), decoded)
+	if !includeData {
+		err = row.Scan(&result)
+	} else {
+		err = row.Scan(&result, &id, &data)
+	}
+	if err != sql.ErrNoRows {
+		pg.logError("could not resolve msgid to time", err)
+	}
+	result = result.UTC()
+	return
+}
+
+func (pg *PostgreSQL) selectItems(ctx context.Context, query string, args ...interface{}) (results []history.Item, err error) {
+	rows, err := pg.db.QueryContext(ctx, query, args...)
+	if pg.logError("could not select history items", err) {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var blob []byte
+		var item history.Item
+		err = rows.Scan(&blob)
+		if pg.logError("could not scan history item", err) {
+			return
+		}
+		err = unmarshalItem(blob, &item)
+		if pg.logError("could not unmarshal history item", err) {
+			return
+		}
+		results = append(results, item)
+	}
+	return
+}
+
+// queryBuilder accumulates a query along with its positional arguments
+type queryBuilder struct {
+	strings.Builder
+	args []interface{}
+}
+
+// arg adds an argument and returns its placeholder, e.g., $1
+func (q *queryBuilder) arg(value interface{}) string {
+	q.args = append(q.args, value)
+	return fmt.Sprintf("$%d", len(q.args))
+}
+
+func (pg *PostgreSQL) betweenTimestamps(ctx context.Context, target, correspondent string, after, before, cutoff time.Time, limit int) (results []history.Item, err error) {
+	useSequence := correspondent == ""
+	table := "sequence"
+	if !useSequence {
+		table = "conversations"
+	}
+
+	after, before, ascending := history.MinMaxAsc(after, before, cutoff)
+	direction := "ASC"
+	if !ascending {
+		direction = "DESC"
+	}
+
+	var query queryBuilder
+	fmt.Fprintf(&query,
+		"SELECT history.data FROM history INNER JOIN %[1]s ON history.id = %[1]s.history_id AND history.msgtime = %[1]s.msgtime WHERE", table)
+	if useSequence {
+		fmt.Fprintf(&query, " sequence.target = %s", query.arg(target))
+	} else {
+		fmt.Fprintf(&query, " conversations.target = %s AND conversations.correspondent = %s",
+			query.arg(target), query.arg(correspondent))
+	}
+	if !after.IsZero() {
+		fmt.Fprintf(&query, " AND %s.msgtime > %s", table, query.arg(toTimestamp(after)))
+	}
+	if !before.IsZero() {
+		fmt.Fprintf(&query, " AND %s.msgtime < %s", table, query.arg(toTimestamp(before)))
+	}
+	fmt.Fprintf(&query, " ORDER BY %s.msgtime %s LIMIT %s;", table, direction, query.arg(limit))
+
+	results, err = pg.selectItems(ctx, query.String(), query.args...)
+	if err == nil && !ascending {
+		utils.ReverseSlice(results)
+	}
+	return
+}
+
+func (pg *PostgreSQL) listCorrespondentsInternal(ctx context.Context, target string, after, before, cutoff time.Time, limit int) (results []history.TargetListing, err error) {
+	after, before, ascending := history.MinMaxAsc(after, before, cutoff)
+	direction := "ASC"
+	if !ascending {
+		direction = "DESC"
+	}
+
+	var query queryBuilder
+	fmt.Fprintf(&query, `SELECT correspondents.correspondent, correspondents.msgtime FROM correspondents
+		WHERE target = %s`, query.arg(target))
+	if !after.IsZero() {
+		fmt.Fprintf(&query, " AND correspondents.msgtime > %s", query.arg(toTimestamp(after)))
+	}
+	if !before.IsZero() {
+		fmt.Fprintf(&query, " AND correspondents.msgtime < %s", query.arg(toTimestamp(before)))
+	}
+	fmt.Fprintf(&query, " ORDER BY correspondents.msgtime %s LIMIT %s;", direction, query.arg(limit))
+
+	rows, err := pg.db.QueryContext(ctx, query.String(), query.args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	var correspondent string
+	var msgtime time.Time
+	for rows.Next() {
+		err = rows.Scan(&correspondent, &msgtime)
+		if err != nil {
+			return
+		}
+		results = append(results, history.TargetListing{
+			CfName: correspondent,
+			Time:   msgtime.UTC(),
+		})
+	}
+
+	if !ascending {
+		utils.ReverseSlice(results)
+	}
+
+	return
+}
+
+func (pg *PostgreSQL) ListChannels(cfchannels []string) (results []history.TargetListing, err error) {
+	if pg.db == nil {
+		return
+	}
+
+	if len(cfchannels) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pg.getTimeout())
+	defer cancel()
+
+	rows, err := pg.db.QueryContext(ctx, `SELECT sequence.target, MAX(sequence.msgtime) FROM sequence
+		WHERE sequence.target = ANY($1) GROUP BY sequence.target;`, pq.Array(cfchannels))
+	if pg.logError("could not query channel listings", err) {
+		return
+	}
+	defer rows.Close()
+
+	var target string
+	var msgtime time.Time
+	for rows.Next() {
+		err = rows.Scan(&target, &msgtime)
+		if pg.logError("could not scan channel listings", err) {
+			return
+		}
+		results = append(results, history.TargetListing{
+			CfName: target,
+			Time:   msgtime.UTC(),
+		})
+	}
+	return
+}
+
+func (pg *PostgreSQL) Close() {
+	// flush any pending writes before closing the database
+	pg.queueMutex.Lock()
+	if pg.writeQueue != nil {
+		close(pg.writeQueue)
+		pg.writeQueue = nil
+	}
+	pg.queueMutex.Unlock()
+	pg.writerGroup.Wait()
+
+	// closing the database will close our prepared statements as well
+	if pg.db != nil {
+		pg.db.Close()
+	}
+	pg.db = nil
+}
+
+// implements history.Sequence, emulating a single history buffer (for a channel,
+// a single user's DMs, or a DM conversation)
+type postgreSQLHistorySequence struct {
+	pg            *PostgreSQL
+	target        string
+	correspondent string
+	cutoff        time.Time
+}
+
+func (s *postgreSQLHistorySequence) Between(start, end history.Selector, limit int) (results []history.Item, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.pg.getTimeout())
+	defer cancel()
+
+	startTime := start.Time
+	if start.Msgid != "" {
+		startTime, _, _, err = s.pg.lookupMsgid(ctx, start.Msgid, false)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return nil, nil
+			} else {
+				return nil, err
+			}
+		}
+	}
+	endTime := end.Time
+	if end.Msgid != "" {
+		endTime, _, _, err = s.pg.lookupMsgid(ctx, end.Msgid, false)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return nil, nil
+			} else {
+				return nil, err
+			}
+		}
+	}
+
+	return s.pg.betweenTimestamps(ctx, s.target, s.correspondent, startTime, endTime, s.cutoff, limit)
+}
+
+func (s *postgreSQLHistorySequence) Around(start history.Selector, limit int) (results []history.Item, err error) {
+	return history.GenericAround(s, start, limit)
+}
+
+func (seq *postgreSQLHistorySequence) ListCorrespondents(start, end history.Selector, limit int) (results []history.TargetListing, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), seq.pg.getTimeout())
+	defer cancel()
+
+	results, err = seq.pg.listCorrespondentsInternal(ctx, seq.target, start.Time, end.Time, seq.cutoff, limit)
+	seq.pg.logError("could not read correspondents", err)
+	return
+}
+
+func (seq *postgreSQLHistorySequence) Cutoff() time.Time {
+	return seq.cutoff
+}
+
+func (seq *postgreSQLHistorySequence) Ephemeral() bool {
+	return false
+}
+
+func (pg *PostgreSQL) MakeSequence(target, correspondent string, cutoff time.Time) history.Sequence {
+	return &postgreSQLHistorySequence{
+		target:        target,
+		correspondent: correspondent,
+		pg:            pg,
+		cutoff:        cutoff,
+	}
+}
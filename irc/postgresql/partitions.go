@@ -0,0 +1,75 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package postgresql
+
+import (
+	"strings"
+	"time"
+)
+
+// message data is stored in tables partitioned by day on the message time,
+// so that expiring old history is a matter of dropping whole partitions
+// rather than deleting rows one by one. each partitioned table also has a
+// default partition, catching anything (e.g., a message with a wildly skewed
+// timestamp) outside the range of the daily partitions.
+
+const (
+	partitionInterval   = 24 * time.Hour
+	partitionNameFormat = "20060102"
+	// how many future partitions to keep ahead of the current time
+	partitionLookahead = 2
+)
+
+var (
+	partitionedTables = []string{"history", "sequence", "conversations", "account_messages"}
+)
+
+// partitionStart returns the start of the daily partition containing t
+func partitionStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func partitionName(table string, start time.Time) string {
+	return table + "_p" + start.Format(partitionNameFormat)
+}
+
+func defaultPartitionName(table string) string {
+	return table + "_default"
+}
+
+// parsePartitionName recovers the start time of a daily partition of table
+// from its name; ok is false for the default partition, or anything else
+func parsePartitionName(table, name string) (start time.Time, ok bool) {
+	suffix := strings.TrimPrefix(name, table+"_p")
+	if suffix == name {
+		return
+	}
+	start, err := time.ParseInLocation(partitionNameFormat, suffix, time.UTC)
+	return start, err == nil
+}
+
+// wantedPartitions returns the start times of the partitions that should exist
+// at time now: the previous day (in case of messages queued across midnight),
+// the current day, and partitionLookahead days into the future
+func wantedPartitions(now time.Time) (result []time.Time) {
+	start := partitionStart(now).Add(-partitionInterval)
+	for i := 0; i < partitionLookahead+2; i++ {
+		result = append(result, start.Add(time.Duration(i)*partitionInterval))
+	}
+	return
+}
+
+// expiredPartitions returns the partitions of table, among names, whose
+// entire range precedes threshold
+func expiredPartitions(table string, names []string, threshold time.Time) (result []string) {
+	for _, name := range names {
+		if start, ok := parsePartitionName(table, name); ok {
+			if !start.Add(partitionInterval).After(threshold) {
+				result = append(result, name)
+			}
+		}
+	}
+	return
+}
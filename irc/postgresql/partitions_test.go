@@ -0,0 +1,86 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package postgresql
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPartitionNames(t *testing.T) {
+	msgtime := time.Date(2026, 10, 14, 23, 59, 59, 0, time.FixedZone("", -4*60*60))
+	start := partitionStart(msgtime)
+	// partitions are by UTC day
+	if expected := time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC); !start.Equal(expected) {
+		t.Errorf("expected partition start %v, got %v", expected, start)
+	}
+	name := partitionName("sequence", start)
+	if name != "sequence_p20261015" {
+		t.Errorf("unexpected partition name %s", name)
+	}
+	parsed, ok := parsePartitionName("sequence", name)
+	if !ok || !parsed.Equal(start) {
+		t.Errorf("could not round-trip partition name %s: %v %v", name, parsed, ok)
+	}
+
+	for _, name := range []string{"sequence_default", "history_p20261015", "sequence_pfoo", "sequence"} {
+		if _, ok := parsePartitionName("sequence", name); ok {
+			t.Errorf("%s should not parse as a daily partition of sequence", name)
+		}
+	}
+}
+
+func TestWantedPartitions(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	var names []string
+	for _, start := range wantedPartitions(now) {
+		names = append(names, partitionName("history", start))
+	}
+	expected := []string{"history_p20261013", "history_p20261014", "history_p20261015", "history_p20261016"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+}
+
+func TestExpiredPartitions(t *testing.T) {
+	names := []string{
+		"history_default",
+		"history_p20261011",
+		"history_p20261012",
+		"history_p20261013",
+		"history_p20261014",
+	}
+	// a partition is only dropped once everything in it has expired
+	threshold := time.Date(2026, 10, 13, 0, 0, 0, 0, time.UTC)
+	expected := []string{"history_p20261011", "history_p20261012"}
+	if found := expiredPartitions("history", names, threshold); !reflect.DeepEqual(found, expected) {
+		t.Errorf("expected %v, got %v", expected, found)
+	}
+	threshold = threshold.Add(-time.Second)
+	expected = []string{"history_p20261011"}
+	if found := expiredPartitions("history", names, threshold); !reflect.DeepEqual(found, expected) {
+		t.Errorf("expected %v, got %v", expected, found)
+	}
+}
+
+func TestConnString(t *testing.T) {
+	config := Config{
+		Host:            "db.example.com",
+		Port:            5432,
+		User:            "ergo",
+		Password:        `it's a \secret`,
+		HistoryDatabase: "ergo_history",
+	}
+	expected := `host='db.example.com' port='5432' user='ergo' password='it\'s a \\secret' dbname='ergo_history'`
+	if found := config.connString(); found != expected {
+		t.Errorf("expected %s, got %s", expected, found)
+	}
+
+	config = Config{SocketPath: "/var/run/postgresql", User: "ergo", HistoryDatabase: "ergo_history"}
+	expected = `host='/var/run/postgresql' user='ergo' dbname='ergo_history' sslmode='disable'`
+	if found := config.connString(); found != expected {
+		t.Errorf("expected %s, got %s", expected, found)
+	}
+}
@@ -0,0 +1,311 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package irc
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/buntdb"
+
+	"github.com/ergochat/ergo/irc/utils"
+)
+
+const (
+	keyQlineEntry = "bans.qline %s"
+)
+
+// QLineConfig is a forbidden name pattern set in the config file.
+type QLineConfig struct {
+	Mask   string
+	Reason string
+}
+
+// QLineInfo is a forbidden nickname or channel name pattern.
+type QLineInfo struct {
+	// Mask that is forbidden, casefolded; channel masks begin with #
+	Mask string
+	// IsChannel is whether Mask applies to channel names rather than nicknames.
+	IsChannel bool
+	// Matcher, to facilitate fast matching.
+	Matcher *regexp.Regexp
+	// Info contains information on the Q-Line.
+	Info IPBanInfo
+}
+
+// QLineError is returned when a client tries to use a forbidden name.
+type QLineError struct {
+	Info IPBanInfo
+}
+
+func (qe *QLineError) Error() string {
+	return qe.Info.BanMessage("Name is forbidden (%s)")
+}
+
+// CanonicalizeQLineMask casefolds a nickname or channel name pattern.
+func CanonicalizeQLineMask(mask string) (result string, err error) {
+	mask = strings.TrimSpace(mask)
+	if mask == "" {
+		return "", errStringIsEmpty
+	}
+	// XXX as with KLINE, wildcards are not accepted with most unicode masks,
+	// because the * character breaks casefolding
+	result, err = Casefold(mask)
+	if err != nil {
+		return
+	}
+	if utils.SafeErrorParam(result) != result || strings.ContainsAny(result, "!@") {
+		return "", errInvalidCharacter
+	}
+	return
+}
+
+func compileQLine(mask string, info IPBanInfo) (qline QLineInfo, err error) {
+	matcher, err := utils.CompileGlob(mask, false)
+	if err != nil {
+		return
+	}
+	return QLineInfo{Mask: mask, IsChannel: strings.HasPrefix(mask, "#"), Matcher: matcher, Info: info}, nil
+}
+
+func compileConfigQLines(config []QLineConfig) (result []QLineInfo, err error) {
+	for _, entry := range config {
+		mask, err := CanonicalizeQLineMask(entry.Mask)
+		if err != nil {
+			return nil, fmt.Errorf("invalid q-line mask %s: %w", entry.Mask, err)
+		}
+		qline, err := compileQLine(mask, IPBanInfo{Reason: entry.Reason})
+		if err != nil {
+			return nil, fmt.Errorf("invalid q-line mask %s: %w", entry.Mask, err)
+		}
+		result = append(result, qline)
+	}
+	return
+}
+
+// QLineManager manages the Q-Lines added by operators; Q-Lines from the
+// config file are checked separately.
+type QLineManager struct {
+	sync.RWMutex                // tier 1
+	persistenceMutex sync.Mutex // tier 2
+	// q-lined entries
+	entries          map[string]QLineInfo
+	expirationTimers map[string]*time.Timer
+	server           *Server
+}
+
+// NewQLineManager returns a new QLineManager.
+func NewQLineManager(s *Server) *QLineManager {
+	var qm QLineManager
+	qm.entries = make(map[string]QLineInfo)
+	qm.expirationTimers = make(map[string]*time.Timer)
+	qm.server = s
+
+	qm.loadFromDatastore()
+
+	return &qm
+}
+
+// AllBans returns all Q-Lines added by operators (for use with APIs, etc).
+func (qm *QLineManager) AllBans() map[string]IPBanInfo {
+	allb := make(map[string]IPBanInfo)
+
+	qm.RLock()
+	defer qm.RUnlock()
+	for name, info := range qm.entries {
+		allb[name] = info.Info
+	}
+
+	return allb
+}
+
+// AddMask adds to the forbidden list.
+func (qm *QLineManager) AddMask(mask string, duration time.Duration, reason, operReason, operName string) error {
+	qm.persistenceMutex.Lock()
+	defer qm.persistenceMutex.Unlock()
+
+	info := IPBanInfo{
+		Reason:      reason,
+		OperReason:  operReason,
+		OperName:    operName,
+		TimeCreated: time.Now().UTC(),
+		Duration:    duration,
+	}
+	qm.addMaskInternal(mask, info)
+	return qm.persistQLine(mask, info)
+}
+
+func (qm *QLineManager) addMaskInternal(mask string, info IPBanInfo) {
+	qln, err := compileQLine(mask, info)
+	// this is validated externally and shouldn't fail regardless
+	if err != nil {
+		return
+	}
+
+	var timeLeft time.Duration
+	if info.Duration > 0 {
+		timeLeft = info.timeLeft()
+		if timeLeft <= 0 {
+			return
+		}
+	}
+
+	qm.Lock()
+	defer qm.Unlock()
+
+	qm.entries[mask] = qln
+	qm.cancelTimer(mask)
+
+	if info.Duration == 0 {
+		return
+	}
+
+	// set up new expiration timer
+	timeCreated := info.TimeCreated
+	processExpiration := func() {
+		qm.Lock()
+		defer qm.Unlock()
+
+		maskBan, ok := qm.entries[mask]
+		if ok && maskBan.Info.TimeCreated.Equal(timeCreated) {
+			delete(qm.entries, mask)
+			delete(qm.expirationTimers, mask)
+		}
+	}
+	qm.expirationTimers[mask] = time.AfterFunc(timeLeft, processExpiration)
+}
+
+func (qm *QLineManager) cancelTimer(id string) {
+	oldTimer := qm.expirationTimers[id]
+	if oldTimer != nil {
+		oldTimer.Stop()
+		delete(qm.expirationTimers, id)
+	}
+}
+
+func (qm *QLineManager) persistQLine(mask string, info IPBanInfo) error {
+	qlineKey := fmt.Sprintf(keyQlineEntry, mask)
+	b, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	bstr := string(b)
+	var setOptions *buntdb.SetOptions
+	if info.Duration != 0 {
+		setOptions = &buntdb.SetOptions{Expires: true, TTL: info.Duration}
+	}
+
+	return qm.server.store.Update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set(qlineKey, bstr, setOptions)
+		return err
+	})
+}
+
+func (qm *QLineManager) unpersistQLine(mask string) error {
+	qlineKey := fmt.Sprintf(keyQlineEntry, mask)
+	return qm.server.store.Update(func(tx *buntdb.Tx) error {
+		_, err := tx.Delete(qlineKey)
+		return err
+	})
+}
+
+// RemoveMask removes a mask from the forbidden list.
+func (qm *QLineManager) RemoveMask(mask string) error {
+	qm.persistenceMutex.Lock()
+	defer qm.persistenceMutex.Unlock()
+
+	present := func() bool {
+		qm.Lock()
+		defer qm.Unlock()
+		_, ok := qm.entries[mask]
+		if ok {
+			delete(qm.entries, mask)
+		}
+		qm.cancelTimer(mask)
+		return ok
+	}()
+
+	if !present {
+		return errNoExistingBan
+	}
+
+	return qm.unpersistQLine(mask)
+}
+
+// CheckNick returns whether a casefolded nickname is forbidden,
+// either by the config file or by an operator.
+func (qm *QLineManager) CheckNick(casefoldedNick string) (isForbidden bool, info IPBanInfo) {
+	return qm.check(casefoldedNick, false)
+}
+
+// CheckChannel returns whether a casefolded channel name is forbidden,
+// either by the config file or by an operator.
+func (qm *QLineManager) CheckChannel(casefoldedChannel string) (isForbidden bool, info IPBanInfo) {
+	return qm.check(casefoldedChannel, true)
+}
+
+// check matches only the masks of the requested type, since `*` in a
+// nickname mask would otherwise match the # of channel names
+func (qm *QLineManager) check(casefoldedName string, channel bool) (isForbidden bool, info IPBanInfo) {
+	if matched, entry := matchQLines(qm.server.Config().Server.qLines, casefoldedName, channel); matched {
+		return true, entry.Info
+	}
+
+	qm.RLock()
+	defer qm.RUnlock()
+
+	for _, entry := range qm.entries {
+		if entry.IsChannel == channel && entry.Matcher.MatchString(casefoldedName) {
+			return true, entry.Info
+		}
+	}
+
+	return
+}
+
+func matchQLines(qlines []QLineInfo, casefoldedName string, channel bool) (matched bool, entry QLineInfo) {
+	for _, entry := range qlines {
+		if entry.IsChannel == channel && entry.Matcher.MatchString(casefoldedName) {
+			return true, entry
+		}
+	}
+	return
+}
+
+func (qm *QLineManager) loadFromDatastore() {
+	qlinePrefix := fmt.Sprintf(keyQlineEntry, "")
+	qm.server.store.View(func(tx *buntdb.Tx) error {
+		tx.AscendGreaterOrEqual("", qlinePrefix, func(key, value string) bool {
+			if !strings.HasPrefix(key, qlinePrefix) {
+				return false
+			}
+
+			mask := strings.TrimPrefix(key, qlinePrefix)
+
+			var info IPBanInfo
+			err := json.Unmarshal([]byte(value), &info)
+			if err != nil {
+				qm.server.logger.Error("internal", "couldn't unmarshal qline", err.Error())
+				return true
+			}
+
+			if info.OperName == "" {
+				info.OperName = qm.server.name
+			}
+
+			qm.addMaskInternal(mask, info)
+
+			return true
+		})
+		return nil
+	})
+}
+
+func (s *Server) loadQLines() {
+	s.qlines = NewQLineManager(s)
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package irc
+
+import (
+	"testing"
+)
+
+func TestCanonicalizeQLineMask(t *testing.T) {
+	assertEqual := func(input, expected string) {
+		result, err := CanonicalizeQLineMask(input)
+		if err != nil {
+			t.Errorf("unexpected error canonicalizing %s: %v", input, err)
+		}
+		if result != expected {
+			t.Errorf("canonicalizing %s: expected %s, got %s", input, expected, result)
+		}
+	}
+	assertEqual("*Serv", "*serv")
+	assertEqual(" #Staff* ", "#staff*")
+
+	for _, invalid := range []string{"", "  ", "a!b", "a@b", "a b"} {
+		if _, err := CanonicalizeQLineMask(invalid); err == nil {
+			t.Errorf("expected %#v to be invalid", invalid)
+		}
+	}
+}
+
+func TestConfigQLines(t *testing.T) {
+	qlines, err := compileConfigQLines([]QLineConfig{
+		{Mask: "*Serv", Reason: "Reserved for services"},
+		{Mask: "#staff*", Reason: "Reserved for staff"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(name string, channel bool) (reason string) {
+		cfname, err := Casefold(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if matched, qline := matchQLines(qlines, cfname, channel); matched {
+			return qline.Info.Reason
+		}
+		return ""
+	}
+	assertEqual(check("FooServ", false), "Reserved for services")
+	assertEqual(check("#Staff-Lounge", true), "Reserved for staff")
+	assertEqual(check("#lounge", true), "")
+	assertEqual(check("servant", false), "")
+
+	// nickname masks don't apply to channels, even though * matches #
+	assertEqual(check("#ChanServ", true), "")
+	assertEqual(check("#observ", true), "")
+	// and channel masks don't apply to nicknames
+	assertEqual(check("#staff", false), "")
+
+	_, err = compileConfigQLines([]QLineConfig{{Mask: "nick!user@host"}})
+	if err == nil {
+		t.Errorf("expected invalid mask to be rejected")
+	}
+}
@@ -137,12 +137,12 @@ func (rb *ResponseBuffer) AddSplitMessageFromClient(fromNickMask string, fromAcc
 			rb.setNestedBatchTag(&batch[len(batch)-1])
 			rb.messages = append(rb.messages, batch...)
 		} else {
-			for i, messagePair := range message.Split {
+			for i, line := range message.FallbackLines(fallbackLineLen(fromNickMask, command, target)) {
 				var msgid string
 				if i == 0 {
 					msgid = message.Msgid
 				}
-				rb.AddFromClient(message.Time, msgid, fromNickMask, fromAccount, isBot, tags, command, target, messagePair.Message)
+				rb.AddFromClient(message.Time, msgid, fromNickMask, fromAccount, isBot, tags, command, target, line)
 			}
 		}
 	}
@@ -177,6 +177,7 @@ func (rb *ResponseBuffer) sendBatchStart(blocking bool) {
 	if rb.Label != "" {
 		message.SetTag(caps.LabelTagName, rb.Label)
 	}
+	rb.session.setTimeTag(&message, time.Time{})
 	rb.session.SendRawMessage(message, blocking)
 }
 
@@ -187,6 +188,7 @@ func (rb *ResponseBuffer) sendBatchEnd(blocking bool) {
 	}
 
 	message := ircmsg.MakeMessage(nil, rb.target.server.name, "BATCH", "-"+rb.batchID)
+	rb.session.setTimeTag(&message, time.Time{})
 	rb.session.SendRawMessage(message, blocking)
 }
 
@@ -115,7 +115,7 @@ func sendRoleplayMessage(server *Server, client *Client, source string, targetSt
 		target, err := CasefoldName(targetString)
 		user := server.clients.Get(target)
 		if err != nil || user == nil {
-			rb.Add(nil, server.name, ERR_NOSUCHNICK, client.nick, target, client.t("No such nick"))
+			rb.Add(nil, server.name, ERR_NOSUCHNICK, client.nick, utils.SafeErrorParam(targetString), client.t("No such nick"))
 			return
 		}
 
@@ -130,6 +130,17 @@ func sendRoleplayMessage(server *Server, client *Client, source string, targetSt
 		for _, session := range user.Sessions() {
 			session.sendSplitMsgFromClientInternal(false, sourceMask, "*", isBot, nil, "PRIVMSG", tnick, splitMessage)
 		}
+		// as with channels (#865), send the sender's sessions a copy of the message
+		// regardless of echo-message
+		if user != client {
+			for _, session := range client.Sessions() {
+				if rb.session == session {
+					rb.AddSplitMessageFromClient(sourceMask, "*", isBot, nil, "PRIVMSG", tnick, splitMessage)
+				} else {
+					session.sendSplitMsgFromClientInternal(false, sourceMask, "*", isBot, nil, "PRIVMSG", tnick, splitMessage)
+				}
+			}
+		}
 		if away, awayMessage := user.Away(); away {
 			//TODO(dan): possibly implement cooldown of away notifications to users
 			rb.Add(nil, server.name, RPL_AWAY, cnick, tnick, awayMessage)
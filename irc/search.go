@@ -0,0 +1,193 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package irc
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ergochat/irc-go/ircmsg"
+
+	"github.com/ergochat/ergo/irc/caps"
+	"github.com/ergochat/ergo/irc/history"
+	"github.com/ergochat/ergo/irc/utils"
+)
+
+// searchQuery is a parsed SEARCH request; see
+// https://codeberg.org/emersion/soju/src/branch/master/doc/ext/search.md
+type searchQuery struct {
+	target string
+	// casefolded nickname or account name of the sender
+	from string
+	// lowercased substring of the message text
+	text   string
+	after  time.Time
+	before time.Time
+	limit  int
+}
+
+// parseSearchAttributes parses the message-tag-like attribute string of SEARCH,
+// e.g., "in=#ergo;from=shivaram;text=hello"
+func parseSearchAttributes(attrs string, maxLimit int) (query searchQuery, err error) {
+	query.limit = maxLimit
+	for _, attr := range strings.Split(attrs, ";") {
+		if attr == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(attr, "=")
+		value = ircmsg.UnescapeTagValue(value)
+		switch strings.ToLower(key) {
+		case "in":
+			query.target = value
+		case "from":
+			query.from, err = CasefoldName(value)
+		case "text":
+			query.text = strings.ToLower(value)
+		case "after":
+			query.after, err = time.Parse(IRCv3TimestampFormat, value)
+		case "before":
+			query.before, err = time.Parse(IRCv3TimestampFormat, value)
+		case "limit":
+			var limit int
+			limit, err = strconv.Atoi(value)
+			if err == nil && 0 < limit && limit < maxLimit {
+				query.limit = limit
+			}
+		default:
+			err = utils.ErrInvalidParams
+		}
+		if err != nil {
+			return query, utils.ErrInvalidParams
+		}
+	}
+	if query.target == "" {
+		err = utils.ErrInvalidParams
+	}
+	return
+}
+
+func (query *searchQuery) matches(item *history.Item) bool {
+	if item.Type != history.Privmsg && item.Type != history.Notice {
+		return false
+	}
+	if query.from != "" {
+		cfNick, _ := CasefoldName(NUHToNick(item.Nick))
+		cfAccount, _ := CasefoldName(item.AccountName)
+		if query.from != cfNick && query.from != cfAccount {
+			return false
+		}
+	}
+	if query.text != "" {
+		if !strings.Contains(strings.ToLower(item.Message.Message), query.text) {
+			found := false
+			for _, line := range item.Message.Split {
+				if strings.Contains(strings.ToLower(line.Message), query.text) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// SEARCH <attributes>
+func searchHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
+	config := server.Config()
+	if !config.History.Enabled || !config.History.Search.Enabled {
+		rb.Add(nil, server.name, ERR_UNKNOWNCOMMAND, client.Nick(), "SEARCH", client.t("Unknown command"))
+		return false
+	}
+
+	query, err := parseSearchAttributes(msg.Params[0], config.History.ChathistoryMax)
+	if err != nil {
+		rb.Add(nil, server.name, "FAIL", "SEARCH", "INVALID_PARAMS", client.t("Invalid search attributes"))
+		return false
+	}
+
+	if throttled, _ := client.checkSearchThrottle(config); throttled {
+		rb.Add(nil, server.name, "FAIL", "SEARCH", "RATE_LIMITED", client.t("You're searching too often; try again later"))
+		return false
+	}
+
+	channel, sequence, err := server.GetHistorySequence(nil, client, query.target)
+	if sequence == nil || err != nil {
+		rb.Add(nil, server.name, "FAIL", "SEARCH", "INVALID_TARGET", utils.SafeErrorParam(query.target), client.t("Messages could not be retrieved"))
+		return false
+	}
+
+	results, err := query.search(sequence, config.History.Search.MaxScanned)
+	if err != nil {
+		rb.Add(nil, server.name, "FAIL", "SEARCH", "MESSAGE_ERROR", client.t("Messages could not be retrieved"))
+		return false
+	}
+
+	sendSearchResults(client, channel, results, rb)
+	return false
+}
+
+// search scans up to maxScanned messages of the sequence in the query's time range,
+// returning the most recent matches in chronological order
+func (query *searchQuery) search(sequence history.Sequence, maxScanned int) (results []history.Item, err error) {
+	// scan backwards from the end of the range, so that the scanned messages
+	// are the most recent ones: with only `before` (or neither) set, Between
+	// already does this, like BEFORE or LATEST. otherwise, `after` is the start
+	// of the range, and passing it as the end bound makes Between go backwards.
+	start, end := history.Selector{Time: query.after}, history.Selector{Time: query.before}
+	if !query.after.IsZero() {
+		if !query.before.IsZero() && !query.after.Before(query.before) {
+			return // empty range
+		}
+		start.Time = query.before
+		if start.Time.IsZero() {
+			start.Time = time.Now().UTC()
+		}
+		end.Time = query.after
+	}
+	items, err := sequence.Between(start, end, maxScanned)
+	if err != nil {
+		return
+	}
+
+	// keep the most recent matches
+	for i := len(items) - 1; 0 <= i && len(results) < query.limit; i-- {
+		if query.matches(&items[i]) {
+			results = append(results, items[i])
+		}
+	}
+	utils.ReverseSlice(results)
+	return
+}
+
+func sendSearchResults(client *Client, channel *Channel, items []history.Item, rb *ResponseBuffer) {
+	var batchID string
+	if rb.session.capabilities.Has(caps.Batch) {
+		batchID = rb.StartNestedBatch("soju.im/search")
+	}
+	defer rb.EndNestedBatch(batchID)
+
+	details := client.Details()
+	hasTags := rb.session.capabilities.Has(caps.MessageTags)
+	for _, item := range items {
+		command := "PRIVMSG"
+		if item.Type == history.Notice {
+			command = "NOTICE"
+		}
+		var tags map[string]string
+		if hasTags {
+			tags = item.Tags
+		}
+		if channel != nil {
+			rb.AddSplitMessageFromClient(item.Nick, item.AccountName, item.IsBot, tags, command, channel.Name(), item.Message)
+		} else if isSelfMessage(&item, details.nick) {
+			rb.AddSplitMessageFromClient(details.nickMask, item.AccountName, item.IsBot, tags, command, item.Params[0], item.Message)
+		} else {
+			rb.AddSplitMessageFromClient(item.Nick, item.AccountName, item.IsBot, tags, command, details.nick, item.Message)
+		}
+	}
+}
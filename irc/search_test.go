@@ -0,0 +1,116 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package irc
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ergochat/ergo/irc/history"
+	"github.com/ergochat/ergo/irc/utils"
+)
+
+func TestParseSearchAttributes(t *testing.T) {
+	query, err := parseSearchAttributes("in=#ergo;from=Shivaram;text=Hello\\sWorld;after=2026-01-01T00:00:00.000Z;limit=5", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query.target != "#ergo" || query.from != "shivaram" || query.text != "hello world" || query.limit != 5 {
+		t.Errorf("unexpected query %#v", query)
+	}
+	if !query.after.Equal(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected after %v", query.after)
+	}
+
+	// limits above the maximum are clamped
+	query, err = parseSearchAttributes("in=#ergo;limit=500", 100)
+	if err != nil || query.limit != 100 {
+		t.Errorf("expected clamped limit, got %d (%v)", query.limit, err)
+	}
+
+	for _, invalid := range []string{"", "text=hello", "in=#ergo;after=yesterday", "in=#ergo;bogus=1"} {
+		if _, err := parseSearchAttributes(invalid, 100); err == nil {
+			t.Errorf("expected %#v to be rejected", invalid)
+		}
+	}
+}
+
+func TestSearchQueryMatches(t *testing.T) {
+	query := searchQuery{from: "shivaram", text: "world"}
+	item := history.Item{
+		Type:        history.Privmsg,
+		Nick:        "slingamn!~u@localhost",
+		AccountName: "shivaram",
+		Message:     utils.MakeMessage("Hello WORLD"),
+	}
+	if !query.matches(&item) {
+		t.Errorf("message should match by account and text")
+	}
+	item.AccountName = "*"
+	if query.matches(&item) {
+		t.Errorf("message from a different sender should not match")
+	}
+	query.from = "slingamn"
+	if !query.matches(&item) {
+		t.Errorf("message should match by nickname")
+	}
+	item.Type = history.Join
+	if query.matches(&item) {
+		t.Errorf("only messages should match")
+	}
+}
+
+func TestSearchBefore(t *testing.T) {
+	buf := history.NewHistoryBuffer(100, 0)
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		message := utils.MakeMessage(fmt.Sprintf("message %d", i))
+		message.Time = base.Add(time.Duration(i) * time.Minute)
+		buf.Add(history.Item{Type: history.Privmsg, Nick: "slingamn!~u@localhost", Message: message})
+	}
+	sequence := buf.MakeSequence("", time.Time{})
+
+	// only `before`: the most recent matches older than it
+	query := searchQuery{before: base.Add(5 * time.Minute), limit: 3}
+	results, err := query.search(sequence, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var texts []string
+	for _, item := range results {
+		texts = append(texts, item.Message.Message)
+	}
+	assertEqual(strings.Join(texts, ","), "message 2,message 3,message 4")
+
+	// only `after`: results are still the most recent matches
+	query = searchQuery{after: base.Add(5 * time.Minute), limit: 2}
+	results, err = query.search(sequence, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	texts = nil
+	for _, item := range results {
+		texts = append(texts, item.Message.Message)
+	}
+	assertEqual(strings.Join(texts, ","), "message 8,message 9")
+
+	// a bounded scan covers the end of the range, not its start
+	searchTexts := func(query searchQuery, maxScanned int) string {
+		results, err := query.search(sequence, maxScanned)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var texts []string
+		for _, item := range results {
+			texts = append(texts, item.Message.Message)
+		}
+		return strings.Join(texts, ",")
+	}
+	assertEqual(searchTexts(searchQuery{after: base.Add(time.Minute), limit: 2}, 3), "message 8,message 9")
+	assertEqual(searchTexts(searchQuery{after: base.Add(time.Minute), before: base.Add(8 * time.Minute), limit: 2}, 3), "message 6,message 7")
+	assertEqual(searchTexts(searchQuery{after: base.Add(time.Minute), before: base.Add(8 * time.Minute), limit: 10}, 3), "message 5,message 6,message 7")
+	assertEqual(searchTexts(searchQuery{after: base.Add(8 * time.Minute), before: base.Add(time.Minute), limit: 10}, 100), "")
+}
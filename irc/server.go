@@ -6,6 +6,7 @@
 package irc
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
@@ -15,20 +16,24 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/ergochat/irc-go/ircfmt"
 	"github.com/okzk/sdnotify"
 
+	"github.com/ergochat/ergo/irc/bunthistory"
 	"github.com/ergochat/ergo/irc/caps"
 	"github.com/ergochat/ergo/irc/connection_limits"
+	"github.com/ergochat/ergo/irc/dnsbl"
 	"github.com/ergochat/ergo/irc/flatip"
 	"github.com/ergochat/ergo/irc/flock"
 	"github.com/ergochat/ergo/irc/history"
 	"github.com/ergochat/ergo/irc/logger"
 	"github.com/ergochat/ergo/irc/modes"
 	"github.com/ergochat/ergo/irc/mysql"
+	"github.com/ergochat/ergo/irc/postgresql"
 	"github.com/ergochat/ergo/irc/sno"
 	"github.com/ergochat/ergo/irc/utils"
 	"github.com/tidwall/buntdb"
@@ -36,6 +41,9 @@ import (
 
 const (
 	alwaysOnMaintenanceInterval = 30 * time.Minute
+	historyExpiryInterval       = 10 * time.Minute
+	// warn about TLS certificates that will expire this soon:
+	certExpiryWarningThreshold = 7 * 24 * time.Hour
 )
 
 var (
@@ -71,8 +79,11 @@ type Server struct {
 	connectionLimiter connection_limits.Limiter
 	ctime             time.Time
 	dlines            *DLineManager
+	dnsbl             dnsbl.Checker
+	audit             AuditLog
 	helpIndexManager  HelpIndexManager
 	klines            *KLineManager
+	qlines            *QLineManager
 	listeners         map[string]IRCListener
 	logger            *logger.Manager
 	monitorManager    MonitorManager
@@ -81,16 +92,62 @@ type Server struct {
 	rehashMutex       sync.Mutex // tier 4
 	rehashSignal      chan os.Signal
 	pprofServer       *http.Server
+	apiServer         *http.Server
+	apiServerTLS      bool
 	exitSignals       chan os.Signal
 	snomasks          SnoManager
 	store             *buntdb.DB
-	historyDB         mysql.MySQL
+	historyDB         history.Database
 	torLimiter        connection_limits.TorLimiter
 	whoWas            WhoWasList
 	stats             Stats
 	semaphores        ServerSemaphores
 	flock             flock.Flocker
 	defcon            uint32
+	defconMutex       sync.Mutex // tier 1
+	defconTimer       *time.Timer
+	defconGeneration  uint64 // incremented by each DEFCON change; protected by defconMutex
+	rejectNotices     rejectNoticeLimiter
+}
+
+const (
+	// at most this many notices about rejected connections are sent per window;
+	// the rest are counted, and the count is reported with the next notice
+	rejectNoticeLimit  = 10
+	rejectNoticeWindow = time.Minute
+)
+
+// rejectNoticeLimiter rate-limits the snomasks for rejected connections,
+// so that a connection flood doesn't also become a flood of notices
+type rejectNoticeLimiter struct {
+	sync.Mutex
+	throttle   connection_limits.GenericThrottle
+	suppressed int
+}
+
+// touch records a notice, returning whether to send it, and if so, how many
+// notices were suppressed since the last one that was sent
+func (r *rejectNoticeLimiter) touch() (send bool, suppressed int) {
+	r.Lock()
+	defer r.Unlock()
+	r.throttle.Limit, r.throttle.Duration = rejectNoticeLimit, rejectNoticeWindow
+	if throttled, _ := r.throttle.Touch(); throttled {
+		r.suppressed++
+		return false, 0
+	}
+	suppressed, r.suppressed = r.suppressed, 0
+	return true, suppressed
+}
+
+func (server *Server) sendRejectNotice(message string) {
+	send, suppressed := server.rejectNotices.touch()
+	if !send {
+		return
+	}
+	if suppressed != 0 {
+		message = fmt.Sprintf("%s (%d similar notices suppressed)", message, suppressed)
+	}
+	server.snomasks.Send(sno.LocalConnects, message)
 }
 
 // NewServer returns a new Oragono server.
@@ -121,6 +178,7 @@ func NewServer(config *Config, logger *logger.Manager) (*Server, error) {
 	signal.Notify(server.rehashSignal, syscall.SIGHUP)
 
 	time.AfterFunc(alwaysOnMaintenanceInterval, server.periodicAlwaysOnMaintenance)
+	time.AfterFunc(historyExpiryInterval, server.periodicHistoryExpiry)
 
 	return server, nil
 }
@@ -156,7 +214,9 @@ func (server *Server) Run() {
 			return
 		case <-server.rehashSignal:
 			server.logger.Info("server", "Rehashing due to SIGHUP")
-			go server.rehash()
+			go func() {
+				server.notifyRehash("SIGHUP", server.rehash())
+			}()
 		}
 	}
 }
@@ -188,14 +248,22 @@ func (server *Server) checkBans(config *Config, ipaddr net.IP, checkScripts bool
 		}
 	}
 
+	if blocked, country := config.Server.GeoIP.CountryBlocked(ipaddr); blocked {
+		server.logger.Info("connect-ip", "Client rejected by country", ipaddr.String(), country)
+		server.sendRejectNotice(fmt.Sprintf("Client rejected by country [ip:%s] [country:%s]", ipaddr.String(), country))
+		return true, false, "Connections from your country are not allowed on this server"
+	}
+
 	// check connection limits
 	err := server.connectionLimiter.AddClient(flat)
 	if err == connection_limits.ErrLimitExceeded {
 		// too many connections from one client, tell the client and close the connection
 		server.logger.Info("connect-ip", "Client rejected for connection limit", ipaddr.String())
+		server.sendRejectNotice(fmt.Sprintf("Client rejected for connection limit [ip:%s]", ipaddr.String()))
 		return true, false, "Too many clients from your network"
 	} else if err == connection_limits.ErrThrottleExceeded {
 		server.logger.Info("connect-ip", "Client exceeded connection throttle", ipaddr.String())
+		server.sendRejectNotice(fmt.Sprintf("Client exceeded connection throttle [ip:%s]", ipaddr.String()))
 		return true, false, throttleMessage
 	} else if err != nil {
 		server.logger.Warning("internal", "unexpected ban result", err.Error())
@@ -231,6 +299,23 @@ func (server *Server) checkBans(config *Config, ipaddr net.IP, checkScripts bool
 		}
 	}
 
+	if checkScripts && config.Server.DNSBL.Enabled {
+		result := server.dnsbl.Check(ipaddr)
+		switch result.Action {
+		case dnsbl.ActionBlock:
+			// XXX roll back IP connection/throttling addition for the IP
+			server.connectionLimiter.RemoveClient(flat)
+			server.logger.Info("connect-ip", "Rejected client due to dnsbl", ipaddr.String(), result.Host)
+			server.snomasks.Send(sno.LocalConnects, fmt.Sprintf("Client rejected by DNSBL [ip:%s] [list:%s]", ipaddr.String(), result.Host))
+			return true, false, result.Reason
+		case dnsbl.ActionRequireSASL:
+			server.logger.Info("connect-ip", "Requiring SASL from client due to dnsbl", ipaddr.String(), result.Host)
+			return false, true, result.Reason
+		case dnsbl.ActionNotify:
+			server.snomasks.Send(sno.LocalConnects, fmt.Sprintf("Client is listed in DNSBL [ip:%s] [list:%s]", ipaddr.String(), result.Host))
+		}
+	}
+
 	return false, false, ""
 }
 
@@ -275,6 +360,37 @@ func (server *Server) performAlwaysOnMaintenance(checkExpiration, flushTimestamp
 	}
 }
 
+func (server *Server) periodicHistoryExpiry() {
+	defer func() {
+		time.AfterFunc(historyExpiryInterval, server.periodicHistoryExpiry)
+	}()
+
+	defer server.HandlePanic()
+
+	config := server.Config()
+	if config.History.Enabled && config.History.Restrictions.ExpireTime != 0 {
+		server.expireHistory(time.Now().UTC().Add(-time.Duration(config.History.Restrictions.ExpireTime)))
+	}
+}
+
+// expireHistory deletes messages older than cutoff from the in-memory history
+// buffers; the persistent history backends expire their own data
+func (server *Server) expireHistory(cutoff time.Time) {
+	predicate := func(item *history.Item) bool {
+		return !item.Message.Time.IsZero() && item.Message.Time.Before(cutoff)
+	}
+	count := 0
+	for _, channel := range server.channels.Channels() {
+		count += channel.history.Delete(predicate)
+	}
+	for _, client := range server.clients.AllClients() {
+		count += client.history.Delete(predicate)
+	}
+	if count != 0 {
+		server.logger.Debug("history", "expired in-memory history items", strconv.Itoa(count))
+	}
+}
+
 // handles server.ip-check-script.exempt-sasl:
 // run the ip check script at the end of the handshake, only for anonymous connections
 func (server *Server) checkBanScriptExemptSASL(config *Config, session *Session) (outcome AuthOutcome) {
@@ -315,9 +431,19 @@ func (server *Server) tryRegister(c *Client, session *Session) (exiting bool) {
 		return true
 	}
 
+	config := server.Config()
+	if config.Accounts.LoginViaCertfp && c.account == "" && session.certfp != "" && config.Accounts.AuthenticationEnabled {
+		// the client didn't authenticate explicitly, but its certificate may identify an account
+		err := server.accounts.AuthenticateByCertificate(c, session.certfp, session.peerCerts, "")
+		if err == nil {
+			rb := NewResponseBuffer(session)
+			sendSuccessfulAccountAuth(nil, c, rb, false)
+			rb.Send(true)
+		}
+	}
+
 	// client MUST send PASS if necessary, or authenticate with SASL if necessary,
 	// before completing the other registration commands
-	config := server.Config()
 	authOutcome := c.isAuthorized(server, config, session, c.requireSASL)
 	if authOutcome == authSuccess && c.account == "" &&
 		config.Server.IPCheckScript.Enabled && config.Server.IPCheckScript.ExemptSASL {
@@ -403,7 +529,17 @@ func (server *Server) playRegistrationBurst(session *Session) {
 	// continue registration
 	d := c.Details()
 	server.logger.Info("connect", fmt.Sprintf("Client connected [%s] [u:%s] [r:%s]", d.nick, d.username, d.realname))
-	server.snomasks.Send(sno.LocalConnects, fmt.Sprintf("Client connected [%s] [u:%s] [h:%s] [ip:%s] [r:%s]", d.nick, d.username, session.rawHostname, session.IP().String(), d.realname))
+	ipString := session.IP().String()
+	if session.isTor {
+		ipString = "tor"
+	}
+	var geoString string
+	if !session.isTor {
+		if geo := server.Config().Server.GeoIP.Lookup(session.IP()).String(); geo != "" {
+			geoString = fmt.Sprintf(" [geo:%s]", geo)
+		}
+	}
+	server.snomasks.Send(sno.LocalConnects, fmt.Sprintf("Client connected [%s] [u:%s] [h:%s] [ip:%s] [r:%s]%s", d.nick, d.username, session.rawHostname, ipString, d.realname, geoString))
 	if d.account != "" {
 		server.sendLoginSnomask(d.nickMask, d.accountName)
 	}
@@ -430,6 +566,12 @@ func (server *Server) playRegistrationBurst(session *Session) {
 
 	c.attemptAutoOper(session)
 
+	if d.account != "" {
+		rb := NewResponseBuffer(session)
+		deliverMemos(c, rb)
+		rb.Send(true)
+	}
+
 	if server.logger.IsLoggingRawIO() {
 		session.Send(nil, c.server.name, "NOTICE", d.nick, c.t("This server is in debug mode and is logging all user I/O. If you do not wish for everything you send to be readable by the server owner(s), please disconnect."))
 	}
@@ -537,10 +679,21 @@ func (client *Client) getWhoisOf(target *Client, hasPrivs bool, rb *ResponseBuff
 	}
 
 	if client == target || oper.HasRoleCapab("ban") {
+		viaTor := false
 		for _, session := range target.Sessions() {
 			if session.certfp != "" {
 				rb.Add(nil, client.server.name, RPL_WHOISCERTFP, cnick, tnick, fmt.Sprintf(client.t("has client certificate fingerprint %s"), session.certfp))
 			}
+			viaTor = viaTor || session.isTor
+		}
+		if viaTor {
+			// the actual IP shown above is a placeholder; make this explicit:
+			rb.Add(nil, client.server.name, RPL_WHOISSPECIAL, cnick, tnick, client.t("is connected via Tor"))
+		} else if oper.HasRoleCapab("ban") {
+			ip, _ := target.getWhoisActually()
+			if geo := client.server.Config().Server.GeoIP.Lookup(ip).String(); geo != "" {
+				rb.Add(nil, client.server.name, RPL_WHOISSPECIAL, cnick, tnick, fmt.Sprintf(client.t("is connecting from %s"), geo))
+			}
 		}
 	}
 	rb.Add(nil, client.server.name, RPL_WHOISIDLE, cnick, tnick, strconv.FormatUint(target.IdleSeconds(), 10), strconv.FormatInt(target.SignonTime(), 10), client.t("seconds idle, signon time"))
@@ -579,6 +732,50 @@ func (server *Server) rehash() error {
 	return nil
 }
 
+// SetDefcon sets the DEFCON level; if duration is nonzero, the level
+// automatically reverts to 5 (normal operation) after that much time
+func (server *Server) SetDefcon(defcon uint32, duration time.Duration) {
+	server.defconMutex.Lock()
+	defer server.defconMutex.Unlock()
+
+	if server.defconTimer != nil {
+		server.defconTimer.Stop()
+		server.defconTimer = nil
+	}
+	server.defconGeneration++
+	atomic.StoreUint32(&server.defcon, defcon)
+	if duration != 0 && defcon != 5 {
+		generation := server.defconGeneration
+		server.defconTimer = time.AfterFunc(duration, func() {
+			server.expireDefcon(generation)
+		})
+	}
+}
+
+func (server *Server) expireDefcon(generation uint64) {
+	server.defconMutex.Lock()
+	if server.defconGeneration != generation {
+		// superseded by a later DEFCON command
+		server.defconMutex.Unlock()
+		return
+	}
+	server.defconTimer = nil
+	atomic.StoreUint32(&server.defcon, 5)
+	server.defconMutex.Unlock()
+
+	server.snomasks.Send(sno.LocalAnnouncements, "DEFCON level automatically reverted to 5")
+	server.logger.Info("server", "DEFCON level automatically reverted to 5")
+}
+
+// notifyRehash informs operators of the outcome of a rehash
+func (server *Server) notifyRehash(source string, err error) {
+	if err == nil {
+		server.snomasks.Send(sno.LocalOpers, fmt.Sprintf("Rehash initiated by %s completed successfully", source))
+	} else {
+		server.snomasks.Send(sno.LocalOpers, fmt.Sprintf("Rehash initiated by %s failed: %s", source, err.Error()))
+	}
+}
+
 func (server *Server) applyConfig(config *Config) (err error) {
 	oldConfig := server.Config()
 	initial := oldConfig == nil
@@ -589,6 +786,7 @@ func (server *Server) applyConfig(config *Config) (err error) {
 		server.nameCasefolded = config.Server.nameCasefolded
 		globalCasemappingSetting = config.Server.Casemapping
 		globalUtf8EnforcementSetting = config.Server.EnforceUtf8
+		globalUtf8ReplaceInvalid = config.Server.replaceInvalidUtf8
 		MaxLineLen = config.Server.MaxLineLen
 	} else {
 		// enforce configs that can't be changed after launch:
@@ -598,7 +796,7 @@ func (server *Server) applyConfig(config *Config) (err error) {
 			return fmt.Errorf("Datastore path cannot be changed after launching the server, rehash aborted")
 		} else if globalCasemappingSetting != config.Server.Casemapping {
 			return fmt.Errorf("Casemapping cannot be changed after launching the server, rehash aborted")
-		} else if globalUtf8EnforcementSetting != config.Server.EnforceUtf8 {
+		} else if globalUtf8EnforcementSetting != config.Server.EnforceUtf8 || globalUtf8ReplaceInvalid != config.Server.replaceInvalidUtf8 {
 			return fmt.Errorf("UTF-8 enforcement cannot be changed after launching the server, rehash aborted")
 		} else if oldConfig.Accounts.Multiclient.AlwaysOn != config.Accounts.Multiclient.AlwaysOn {
 			return fmt.Errorf("Default always-on setting cannot be changed after launching the server, rehash aborted")
@@ -611,8 +809,15 @@ func (server *Server) applyConfig(config *Config) (err error) {
 			return fmt.Errorf("Cannot change max-concurrency for scripts after launching the server, rehash aborted")
 		} else if oldConfig.Server.OverrideServicesHostname != config.Server.OverrideServicesHostname {
 			return fmt.Errorf("Cannot change override-services-hostname after launching the server, rehash aborted")
+		} else if oldConfig.Limits.WhowasPersistent != config.Limits.WhowasPersistent {
+			return fmt.Errorf("Cannot enable or disable persistent WHOWAS after launching the server, rehash aborted")
 		} else if !oldConfig.Datastore.MySQL.Enabled && config.Datastore.MySQL.Enabled {
 			return fmt.Errorf("Cannot enable MySQL after launching the server, rehash aborted")
+		} else if !oldConfig.Datastore.PostgreSQL.Enabled && config.Datastore.PostgreSQL.Enabled {
+			return fmt.Errorf("Cannot enable PostgreSQL after launching the server, rehash aborted")
+		} else if oldConfig.Datastore.EmbeddedHistory.Enabled != config.Datastore.EmbeddedHistory.Enabled ||
+			oldConfig.Datastore.EmbeddedHistory.Path != config.Datastore.EmbeddedHistory.Path {
+			return fmt.Errorf("Cannot enable, disable, or move embedded history after launching the server, rehash aborted")
 		} else if oldConfig.Server.MaxLineLen != config.Server.MaxLineLen {
 			return fmt.Errorf("Cannot change max-line-len after launching the server, rehash aborted")
 		}
@@ -644,6 +849,10 @@ func (server *Server) applyConfig(config *Config) (err error) {
 	sendRawOutputNotice := !wasLoggingRawIO && nowLoggingRawIO
 
 	server.connectionLimiter.ApplyConfig(&config.Server.IPLimits)
+	server.dnsbl.ApplyConfig(&config.Server.DNSBL)
+	if err = server.audit.ApplyConfig(&config.AuditLog); err != nil {
+		return err
+	}
 
 	tlConf := &config.Server.TorListeners
 	server.torLimiter.Configure(tlConf.MaxConnections, tlConf.ThrottleDuration, tlConf.MaxConnectionsPerDuration)
@@ -696,8 +905,19 @@ func (server *Server) applyConfig(config *Config) (err error) {
 			return err
 		}
 	} else {
-		if config.Datastore.MySQL.Enabled && config.Datastore.MySQL != oldConfig.Datastore.MySQL {
-			server.historyDB.SetConfig(config.Datastore.MySQL)
+		switch historyDB := server.historyDB.(type) {
+		case *mysql.MySQL:
+			if config.Datastore.MySQL.Enabled && config.Datastore.MySQL != oldConfig.Datastore.MySQL {
+				historyDB.SetConfig(config.Datastore.MySQL)
+			}
+		case *postgresql.PostgreSQL:
+			if config.Datastore.PostgreSQL.Enabled && config.Datastore.PostgreSQL != oldConfig.Datastore.PostgreSQL {
+				historyDB.SetConfig(config.Datastore.PostgreSQL)
+			}
+		case *bunthistory.History:
+			if config.Datastore.EmbeddedHistory != oldConfig.Datastore.EmbeddedHistory {
+				historyDB.SetConfig(config.Datastore.EmbeddedHistory)
+			}
 		}
 	}
 
@@ -709,6 +929,8 @@ func (server *Server) applyConfig(config *Config) (err error) {
 	// activate the new config
 	server.config.Set(config)
 
+	server.whoWas.SetMaxAge(time.Duration(config.Limits.WhowasMaxAge))
+
 	// load [dk]-lines, registered users and channels, etc.
 	if initial {
 		if err := server.loadFromDatastore(config); err != nil {
@@ -719,14 +941,15 @@ func (server *Server) applyConfig(config *Config) (err error) {
 	// burst new and removed caps
 	addedCaps, removedCaps := config.Diff(oldConfig)
 	var capBurstSessions []*Session
-	added := make(map[caps.Version][]string)
 	var removed []string
+	// #1428: sessions that must not see STS shouldn't get it via cap-notify either
+	addedCapsWithoutSTS := caps.NewSet()
+	addedCapsWithoutSTS.Union(addedCaps)
+	addedCapsWithoutSTS.Disable(caps.STS)
 
 	if !addedCaps.Empty() || !removedCaps.Empty() {
 		capBurstSessions = server.clients.AllWithCapsNotify()
 
-		added[caps.Cap301] = addedCaps.Strings(caps.Cap301, config.Server.capValues, 0)
-		added[caps.Cap302] = addedCaps.Strings(caps.Cap302, config.Server.capValues, 0)
 		// removed never has values, so we leave it as Cap301
 		removed = removedCaps.Strings(caps.Cap301, config.Server.capValues, 0)
 	}
@@ -737,15 +960,23 @@ func (server *Server) applyConfig(config *Config) (err error) {
 			for _, capStr := range removed {
 				sSession.Send(nil, server.name, "CAP", sSession.client.Nick(), "DEL", capStr)
 			}
+			// a deleted cap is no longer enabled; the client must re-request it
+			// if it is offered again with CAP NEW
+			sSession.capabilities.Subtract(removedCaps)
+		}
+		sessionAddedCaps := addedCaps
+		if sSession.hideSTS {
+			sessionAddedCaps = addedCapsWithoutSTS
 		}
-		if !addedCaps.Empty() {
-			for _, capStr := range added[sSession.capVersion] {
+		if !sessionAddedCaps.Empty() {
+			for _, capStr := range sessionAddedCaps.Strings(sSession.capVersion, config.capValuesFor(sSession), 0) {
 				sSession.Send(nil, server.name, "CAP", sSession.client.Nick(), "NEW", capStr)
 			}
 		}
 	}
 
 	server.setupPprofListener(config)
+	server.setupAPIListener(config)
 
 	// set RPL_ISUPPORT
 	var newISupportReplies [][]string
@@ -779,6 +1010,9 @@ func (server *Server) applyConfig(config *Config) (err error) {
 	}
 
 	// send other config warnings
+	if config.Server.motdError != nil {
+		server.logger.Warning("server", "Warning: could not load MOTD file", config.Server.motdError.Error())
+	}
 	if config.Accounts.RequireSasl.Enabled && config.Accounts.Registration.Enabled {
 		server.logger.Warning("server", "Warning: although require-sasl is enabled, users can still register accounts. If your server is not intended to be public, you must set accounts.registration.enabled to false.")
 	}
@@ -800,7 +1034,7 @@ func (server *Server) setupPprofListener(config *Config) {
 			Addr: pprofListener,
 		}
 		go func() {
-			if err := ps.ListenAndServe(); err != nil {
+			if err := ps.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 				server.logger.Error("server", "pprof listener failed", err.Error())
 			}
 		}()
@@ -836,28 +1070,81 @@ func (server *Server) loadFromDatastore(config *Config) (err error) {
 	server.logger.Debug("server", "Loading D/Klines")
 	server.loadDLines()
 	server.loadKLines()
+	server.loadQLines()
+
+	if err := server.whoWas.Load(server.store, config.Limits.WhowasPersistent); err != nil {
+		server.logger.Error("internal", "could not load WHOWAS entries", err.Error())
+	}
 
 	server.channelRegistry.Initialize(server)
 	server.channels.Initialize(server)
 	server.accounts.Initialize(server)
 
 	if config.Datastore.MySQL.Enabled {
-		server.historyDB.Initialize(server.logger, config.Datastore.MySQL)
-		err = server.historyDB.Open()
+		mysqlDB := new(mysql.MySQL)
+		mysqlDB.Initialize(server.logger, config.Datastore.MySQL)
+		err = mysqlDB.Open()
 		if err != nil {
 			server.logger.Error("internal", "could not connect to mysql", err.Error())
 			return err
 		}
+		server.historyDB = mysqlDB
+	} else if config.Datastore.PostgreSQL.Enabled {
+		pgDB := new(postgresql.PostgreSQL)
+		pgDB.Initialize(server.logger, config.Datastore.PostgreSQL)
+		err = pgDB.Open()
+		if err != nil {
+			server.logger.Error("internal", "could not connect to postgresql", err.Error())
+			return err
+		}
+		server.historyDB = pgDB
+	} else if config.Datastore.EmbeddedHistory.Enabled {
+		buntDB := new(bunthistory.History)
+		buntDB.Initialize(server.logger, config.Datastore.EmbeddedHistory)
+		err = buntDB.Open()
+		if err != nil {
+			server.logger.Error("internal", "could not open history database", err.Error())
+			return err
+		}
+		server.historyDB = buntDB
+	} else {
+		// no persistent history; the zero value is a no-op
+		server.historyDB = new(mysql.MySQL)
 	}
 
 	return nil
 }
 
+// certificates are reloaded from disk on every rehash; log their expiration
+// times so that operators can confirm that a renewed certificate was picked up
+func (server *Server) logCertificateExpiry(addr string, tlsConfig *tls.Config) {
+	now := time.Now()
+	for _, cert := range tlsConfig.Certificates {
+		if cert.Leaf == nil {
+			continue
+		}
+		subject := cert.Leaf.Subject.CommonName
+		if len(cert.Leaf.DNSNames) != 0 {
+			subject = strings.Join(cert.Leaf.DNSNames, ",")
+		}
+		expiry := cert.Leaf.NotAfter
+		message := fmt.Sprintf("certificate for %s on %s expires at %s", subject, addr, expiry.Format(time.RFC3339))
+		if expiry.Before(now.Add(certExpiryWarningThreshold)) {
+			server.logger.Warning("listeners", message)
+		} else {
+			server.logger.Info("listeners", message)
+		}
+	}
+}
+
 func (server *Server) setupListeners(config *Config) (err error) {
 	logListener := func(addr string, config utils.ListenerConfig) {
 		server.logger.Info("listeners",
 			fmt.Sprintf("now listening on %s, tls=%t, proxy=%t, tor=%t, websocket=%t.", addr, (config.TLSConfig != nil), config.RequireProxy, config.Tor, config.WebSocket),
 		)
+		if config.TLSConfig != nil {
+			server.logCertificateExpiry(addr, config.TLSConfig)
+		}
 	}
 
 	// update or destroy all existing listeners
@@ -890,7 +1177,7 @@ func (server *Server) setupListeners(config *Config) (err error) {
 		_, exists := server.listeners[newAddr]
 		if !exists {
 			// make a new listener
-			newListener, newErr := NewListener(server, newAddr, newConfig, config.Server.UnixBindMode)
+			newListener, newErr := NewListener(server, newAddr, newConfig)
 			if newErr == nil {
 				server.listeners[newAddr] = newListener
 				logListener(newAddr, newConfig)
@@ -901,6 +1188,12 @@ func (server *Server) setupListeners(config *Config) (err error) {
 		}
 	}
 
+	configuredAddrs := make([]string, 0, len(config.Server.trueListeners))
+	for addr := range config.Server.trueListeners {
+		configuredAddrs = append(configuredAddrs, addr)
+	}
+	closeUnconfiguredInheritedListeners(configuredAddrs)
+
 	if publicPlaintextListener != "" {
 		server.logger.Warning("listeners", fmt.Sprintf("Warning: your server is configured with public plaintext listener %s. Consider disabling it for improved security and privacy.", publicPlaintextListener))
 	}
@@ -1081,31 +1374,6 @@ func (server *Server) UnfoldName(cfname string) (name string) {
 	return server.clients.UnfoldNick(cfname)
 }
 
-// elistMatcher takes and matches ELIST conditions
-type elistMatcher struct {
-	MinClientsActive bool
-	MinClients       int
-	MaxClientsActive bool
-	MaxClients       int
-}
-
-// Matches checks whether the given channel matches our matches.
-func (matcher *elistMatcher) Matches(channel *Channel) bool {
-	if matcher.MinClientsActive {
-		if len(channel.Members()) < matcher.MinClients {
-			return false
-		}
-	}
-
-	if matcher.MaxClientsActive {
-		if len(channel.Members()) > matcher.MaxClients {
-			return false
-		}
-	}
-
-	return true
-}
-
 var (
 	infoString1 = strings.Split(`
       __ __  ______ ___  ______ ___ 
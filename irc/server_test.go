@@ -0,0 +1,105 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package irc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ergochat/ergo/irc/history"
+	"github.com/ergochat/ergo/irc/logger"
+	"github.com/ergochat/ergo/irc/utils"
+)
+
+func TestExpireHistory(t *testing.T) {
+	server := &Server{logger: new(logger.Manager)}
+	client := &Client{server: server}
+	client.history.Initialize(16, 0)
+	server.clients.byNick = map[string]*Client{"alice": client}
+
+	now := time.Now().UTC()
+	add := func(msgid string, age time.Duration) {
+		client.history.Add(history.Item{
+			Type:    history.Privmsg,
+			Message: utils.SplitMessage{Msgid: msgid, Time: now.Add(-age)},
+		})
+	}
+	add("old", 2*time.Hour)
+	add("older", 3*time.Hour)
+	add("new", time.Minute)
+
+	server.expireHistory(now.Add(-time.Hour))
+
+	items, err := client.history.MakeSequence("", time.Time{}).Between(history.Selector{}, history.Selector{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msgids []string
+	for _, item := range items {
+		if item.Message.Msgid != "" {
+			msgids = append(msgids, item.Message.Msgid)
+		}
+	}
+	assertEqual(msgids, []string{"new"})
+}
+
+func TestSetDefcon(t *testing.T) {
+	server := &Server{defcon: 5, logger: new(logger.Manager)}
+	waitForDefcon := func(expected uint32) {
+		for deadline := time.Now().Add(time.Second); server.Defcon() != expected; {
+			if time.Now().After(deadline) {
+				t.Fatalf("DEFCON is %d, expected %d", server.Defcon(), expected)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// a timed DEFCON reverts to 5
+	server.SetDefcon(3, 10*time.Millisecond)
+	assertEqual(server.Defcon(), uint32(3))
+	waitForDefcon(5)
+
+	// even if it expires immediately
+	server.SetDefcon(3, time.Nanosecond)
+	waitForDefcon(5)
+
+	// a later DEFCON without a duration supersedes the earlier one
+	server.SetDefcon(3, 10*time.Millisecond)
+	server.SetDefcon(2, 0)
+	time.Sleep(50 * time.Millisecond)
+	assertEqual(server.Defcon(), uint32(2))
+
+	// so does a later DEFCON with a longer duration
+	server.SetDefcon(4, 10*time.Millisecond)
+	server.SetDefcon(3, time.Hour)
+	time.Sleep(50 * time.Millisecond)
+	assertEqual(server.Defcon(), uint32(3))
+
+	// and one with a shorter duration
+	server.SetDefcon(4, time.Hour)
+	server.SetDefcon(1, 10*time.Millisecond)
+	waitForDefcon(5)
+}
+
+func TestRejectNoticeLimiter(t *testing.T) {
+	var limiter rejectNoticeLimiter
+	for i := 0; i < rejectNoticeLimit; i++ {
+		send, suppressed := limiter.touch()
+		assertEqual(send, true)
+		assertEqual(suppressed, 0)
+	}
+	for i := 0; i < 5; i++ {
+		send, _ := limiter.touch()
+		assertEqual(send, false)
+	}
+
+	// the first notice of the next window reports the suppressed ones
+	limiter.throttle.Start = time.Now().Add(-2 * rejectNoticeWindow)
+	send, suppressed := limiter.touch()
+	assertEqual(send, true)
+	assertEqual(suppressed, 5)
+	send, suppressed = limiter.touch()
+	assertEqual(send, true)
+	assertEqual(suppressed, 0)
+}
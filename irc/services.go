@@ -89,6 +89,13 @@ var (
 		Commands:       histservCommands,
 		HelpBanner:     histservHelp,
 	}
+	memoservService = &ircService{
+		Name:           "MemoServ",
+		ShortName:      "MS",
+		CommandAliases: []string{"MEMOSERV", "MS"},
+		Commands:       memoservCommands,
+		HelpBanner:     memoservHelp,
+	}
 )
 
 // all services, by lowercase name
@@ -97,6 +104,7 @@ var OragonoServices = map[string]*ircService{
 	"chanserv": chanservService,
 	"hostserv": hostservService,
 	"histserv": histservService,
+	"memoserv": memoservService,
 }
 
 func (service *ircService) Notice(rb *ResponseBuffer, text string) {
@@ -219,6 +227,10 @@ func serviceRunCommand(service *ircService, server *Server, client *Client, cmd
 		return
 	}
 
+	if 0 < len(cmd.capabs) {
+		server.audit.RecordClient(client, fmt.Sprintf("%s %s", strings.ToUpper(service.Name), strings.ToUpper(commandName)), params)
+	}
+
 	server.logger.Debug("services", fmt.Sprintf("Client %s ran %s command %s", client.Nick(), service.Name, commandName))
 	if commandName == "help" {
 		serviceHelpHandler(service, server, client, params, rb)
@@ -54,13 +54,24 @@ type Client struct {
 // Dial returns a new Client connected to an SMTP server at addr.
 // The addr must include a port, as in "mail.example.com:smtp".
 func Dial(addr string, timeout time.Duration) (*Client, error) {
+	return dial(addr, nil, timeout)
+}
+
+// DialTLS is like Dial, but the connection uses TLS from the start
+// ("implicit TLS", as on port 465), instead of being upgraded with STARTTLS.
+func DialTLS(addr string, config *tls.Config, timeout time.Duration) (*Client, error) {
+	return dial(addr, config, timeout)
+}
+
+func dial(addr string, tlsConfig *tls.Config, timeout time.Duration) (*Client, error) {
 	var conn net.Conn
 	var err error
 	start := time.Now()
-	if timeout == 0 {
-		conn, err = net.Dial("tcp", addr)
+	dialer := &net.Dialer{Timeout: timeout}
+	if tlsConfig == nil {
+		conn, err = dialer.Dial("tcp", addr)
 	} else {
-		conn, err = net.DialTimeout("tcp", addr, timeout)
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
 	}
 	if err != nil {
 		return nil, err
@@ -335,8 +346,10 @@ var testHookStartTLS func(*tls.Config) // nil, except for tests
 // attachments (see the mime/multipart package), or other mail
 // functionality. Higher-level packages exist outside of the standard
 // library.
-// XXX: modified in Ergo to add `requireTLS`, `heloDomain`, and `timeout` arguments
-func SendMail(addr string, a Auth, heloDomain string, from string, to []string, msg []byte, requireTLS bool, timeout time.Duration) error {
+// XXX: modified in Ergo to add `requireTLS`, `implicitTLS`, `heloDomain`, and `timeout` arguments;
+// if implicitTLS is true, the connection uses TLS from the start, and the
+// server's certificate is always verified.
+func SendMail(addr string, a Auth, heloDomain string, from string, to []string, msg []byte, requireTLS, implicitTLS bool, timeout time.Duration) error {
 	if err := validateLine(from); err != nil {
 		return err
 	}
@@ -345,7 +358,14 @@ func SendMail(addr string, a Auth, heloDomain string, from string, to []string,
 			return err
 		}
 	}
-	c, err := Dial(addr, timeout)
+	var c *Client
+	var err error
+	if implicitTLS {
+		host, _, _ := net.SplitHostPort(addr)
+		c, err = DialTLS(addr, &tls.Config{ServerName: host}, timeout)
+	} else {
+		c, err = Dial(addr, timeout)
+	}
 	if err != nil {
 		return err
 	}
@@ -353,7 +373,9 @@ func SendMail(addr string, a Auth, heloDomain string, from string, to []string,
 	if err = c.Hello(heloDomain); err != nil {
 		return err
 	}
-	if ok, _ := c.Extension("STARTTLS"); ok {
+	if c.tls {
+		// implicit TLS, nothing to negotiate
+	} else if ok, _ := c.Extension("STARTTLS"); ok {
 		var config *tls.Config
 		if requireTLS {
 			config = &tls.Config{ServerName: c.serverName}
@@ -3,15 +3,40 @@ package irc
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/ergochat/ergo/irc/sno"
 	"github.com/ergochat/irc-go/ircfmt"
 )
 
+const (
+	// number of recent operator actions to remember
+	maxRecentNotices = 100
+)
+
+// snomasks that record operator actions, for the admin dashboard
+var recordedMasks = map[sno.Mask]bool{
+	sno.LocalAnnouncements: true,
+	sno.LocalKills:         true,
+	sno.LocalOpers:         true,
+	sno.LocalVhosts:        true,
+	sno.LocalXline:         true,
+}
+
+// RecentNotice is a server notice that was sent for an operator action
+type RecentNotice struct {
+	Time    time.Time `json:"time"`
+	Mask    string    `json:"mask"`
+	Message string    `json:"message"`
+}
+
 // SnoManager keeps track of which clients to send snomasks to.
 type SnoManager struct {
 	sendListMutex sync.RWMutex // tier 2
 	sendLists     map[sno.Mask]map[*Client]bool
+
+	recentMutex sync.Mutex // tier 1
+	recent      []RecentNotice
 }
 
 func (m *SnoManager) Initialize() {
@@ -74,6 +99,10 @@ func (m *SnoManager) RemoveClient(client *Client) {
 
 // Send sends the given snomask to all users signed up for it.
 func (m *SnoManager) Send(mask sno.Mask, content string) {
+	if recordedMasks[mask] {
+		m.record(mask, content)
+	}
+
 	m.sendListMutex.RLock()
 	defer m.sendListMutex.RUnlock()
 
@@ -96,6 +125,33 @@ func (m *SnoManager) Send(mask sno.Mask, content string) {
 	}
 }
 
+func (m *SnoManager) record(mask sno.Mask, content string) {
+	notice := RecentNotice{
+		Time:    time.Now().UTC(),
+		Mask:    sno.NoticeMaskNames[mask],
+		Message: ircfmt.Strip(content),
+	}
+
+	m.recentMutex.Lock()
+	defer m.recentMutex.Unlock()
+
+	if len(m.recent) == maxRecentNotices {
+		copy(m.recent, m.recent[1:])
+		m.recent = m.recent[:maxRecentNotices-1]
+	}
+	m.recent = append(m.recent, notice)
+}
+
+// Recent returns the most recently recorded operator actions, oldest first.
+func (m *SnoManager) Recent() (result []RecentNotice) {
+	m.recentMutex.Lock()
+	defer m.recentMutex.Unlock()
+
+	result = make([]RecentNotice, len(m.recent))
+	copy(result, m.recent)
+	return
+}
+
 // MasksEnabled returns the snomasks currently enabled.
 func (m *SnoManager) MasksEnabled(client *Client) (result sno.Masks) {
 	m.sendListMutex.RLock()
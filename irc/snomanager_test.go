@@ -0,0 +1,37 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package irc
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ergochat/ergo/irc/sno"
+)
+
+func TestRecentNotices(t *testing.T) {
+	var m SnoManager
+	m.Initialize()
+
+	m.Send(sno.LocalConnects, "Client connected")
+	m.Send(sno.LocalKills, "\x02alice\x0f was killed by bob")
+	recent := m.Recent()
+	if len(recent) != 1 {
+		t.Fatalf("expected only the kill to be recorded, got %v", recent)
+	}
+	if recent[0].Mask != "KILL" || recent[0].Message != "alice was killed by bob" {
+		t.Errorf("unexpected notice: %#v", recent[0])
+	}
+
+	for i := 0; i < maxRecentNotices+10; i++ {
+		m.Send(sno.LocalXline, fmt.Sprintf("ban %d", i))
+	}
+	recent = m.Recent()
+	if len(recent) != maxRecentNotices {
+		t.Fatalf("expected %d notices, got %d", maxRecentNotices, len(recent))
+	}
+	if recent[0].Message != "ban 10" || recent[len(recent)-1].Message != fmt.Sprintf("ban %d", maxRecentNotices+9) {
+		t.Errorf("unexpected notices retained: %s ... %s", recent[0].Message, recent[len(recent)-1].Message)
+	}
+}
@@ -8,8 +8,13 @@ import (
 	"errors"
 	"io"
 	"sync"
+	"time"
+)
 
-	"github.com/ergochat/ergo/irc/utils"
+const (
+	// don't keep a retired buffer list around for reuse if it grew past this
+	// many lines; a single large burst shouldn't pin memory for the socket's lifetime
+	maxSpareBuffers = 64
 )
 
 var (
@@ -19,17 +24,31 @@ var (
 )
 
 // Socket represents an IRC socket.
+//
+// Outgoing lines are appended to `buffers` (bounded by the sendq) and written
+// out by a dedicated writer goroutine, which sleeps until Write or Close wakes
+// it via `writerWake`. Each wakeup flushes everything that accumulated in the
+// meantime with a single WriteLines call, which for stream connections goes
+// through a bufio.Writer, so a burst of lines costs one write(2) (or one TLS
+// record) rather than one per line.
 type Socket struct {
 	sync.Mutex
 
 	conn IRCConn
 
 	maxSendQBytes int
+	// if a write blocks for this long (e.g., because the client stopped reading
+	// and the TCP window is full), it fails and we disconnect the client:
+	writeTimeout time.Duration
 
-	// this is a trylock enforcing that only one goroutine can write to `conn` at a time
-	writerSemaphore utils.Semaphore
+	// signaled, without blocking, when there is data to write or the socket
+	// was closed; a pending signal covers any number of subsequent writes
+	writerWake chan struct{}
+	// enforces that only one goroutine can write to `conn` at a time
+	writeMutex sync.Mutex
 
 	buffers       [][]byte
+	spareBuffers  [][]byte // empty list with spare capacity, reused once the writer is done with it
 	totalLength   int
 	closed        bool
 	sendQExceeded bool
@@ -37,13 +56,15 @@ type Socket struct {
 	finalized     bool
 }
 
-// NewSocket returns a new Socket.
-func NewSocket(conn IRCConn, maxSendQBytes int) *Socket {
+// NewSocket returns a new Socket, and starts its writer goroutine.
+func NewSocket(conn IRCConn, maxSendQBytes int, writeTimeout time.Duration) *Socket {
 	result := Socket{
-		conn:            conn,
-		maxSendQBytes:   maxSendQBytes,
-		writerSemaphore: utils.NewSemaphore(1),
+		conn:          conn,
+		maxSendQBytes: maxSendQBytes,
+		writeTimeout:  writeTimeout,
+		writerWake:    make(chan struct{}, 1),
 	}
+	go result.runWriter()
 	return &result
 }
 
@@ -78,7 +99,7 @@ func (socket *Socket) Read() (string, error) {
 // 1. MUST NOT block for macroscopic amounts of time
 // 2. MUST NOT reorder messages
 // 3. MUST provide mutual exclusion for socket.conn.Write
-// 4. SHOULD NOT tie up additional goroutines, beyond the one blocked on socket.conn.Write
+// 4. SHOULD NOT start additional goroutines, beyond the socket's writer
 func (socket *Socket) Write(data []byte) (err error) {
 	if len(data) == 0 {
 		return
@@ -119,16 +140,8 @@ func (socket *Socket) BlockingWrite(data []byte) (err error) {
 		return
 	}
 
-	// after releasing the semaphore, we must check for fresh data, same as `send`
-	defer func() {
-		if socket.readyToWrite() {
-			socket.wakeWriter()
-		}
-	}()
-
-	// blocking acquire of the trylock
-	socket.writerSemaphore.Acquire()
-	defer socket.writerSemaphore.Release()
+	socket.writeMutex.Lock()
+	defer socket.writeMutex.Unlock()
 
 	// first, flush any buffered data, to preserve the ordering guarantees
 	closed := socket.performWrite()
@@ -136,20 +149,30 @@ func (socket *Socket) BlockingWrite(data []byte) (err error) {
 		return io.EOF
 	}
 
+	socket.setWriteDeadline()
 	err = socket.conn.WriteLine(data)
 	if err != nil {
 		socket.finalize()
+		// let the writer goroutine observe the closure and exit
+		socket.wakeWriter()
 	}
 	return
 }
 
-// wakeWriter starts the goroutine that actually performs the write, without blocking
+// you must be holding writeMutex to call this:
+func (socket *Socket) setWriteDeadline() {
+	if socket.writeTimeout != 0 {
+		socket.conn.SetWriteDeadline(time.Now().Add(socket.writeTimeout))
+	}
+}
+
+// wakeWriter signals the writer goroutine, without blocking
 func (socket *Socket) wakeWriter() {
-	if socket.writerSemaphore.TryAcquire() {
-		// acquired the trylock; send() will release it
-		go socket.send()
+	select {
+	case socket.writerWake <- struct{}{}:
+	default:
+		// a wakeup is already pending; the writer will pick up this data too
 	}
-	// else: do nothing, the holder will check for more data after releasing it
 }
 
 // SetFinalData sets the final data to send when the SocketWriter closes.
@@ -166,49 +189,45 @@ func (socket *Socket) IsClosed() bool {
 	return socket.closed
 }
 
-// is there data to write?
-func (socket *Socket) readyToWrite() bool {
-	socket.Lock()
-	defer socket.Unlock()
-	// on the first time observing socket.closed, we still have to write socket.finalData
-	return !socket.finalized && (socket.totalLength > 0 || socket.closed)
-}
-
-// send actually writes messages to socket.Conn; it may block
-func (socket *Socket) send() {
-	for {
-		// we are holding the trylock: actually do the write
-		socket.performWrite()
-		// surrender the trylock, avoiding a race where a write comes in after we've
-		// checked readyToWrite() and it returned false, but while we still hold the trylock:
-		socket.writerSemaphore.Release()
-		// check if more data came in while we held the trylock:
-		if !socket.readyToWrite() {
+// runWriter is the socket's writer goroutine; it exits once the socket
+// is closed and the final data has been sent
+func (socket *Socket) runWriter() {
+	for range socket.writerWake {
+		socket.writeMutex.Lock()
+		closed := socket.performWrite()
+		socket.writeMutex.Unlock()
+		if closed {
 			return
 		}
-		if !socket.writerSemaphore.TryAcquire() {
-			// failed to acquire; exit and wait for the holder to observe readyToWrite()
-			// after releasing it
-			return
-		}
-		// got the lock again, loop back around and write
 	}
 }
 
 // write the contents of the buffer, then see if we need to close
-// returns whether we closed
+// returns whether we closed. you must be holding writeMutex to call this:
 func (socket *Socket) performWrite() (closed bool) {
 	// retrieve the buffered data, clear the buffer
 	socket.Lock()
 	buffers := socket.buffers
-	socket.buffers = nil
+	socket.buffers = socket.spareBuffers
+	socket.spareBuffers = nil
 	socket.totalLength = 0
 	closed = socket.closed
 	socket.Unlock()
 
 	var err error
 	if 0 < len(buffers) {
+		socket.setWriteDeadline()
 		err = socket.conn.WriteLines(buffers)
+
+		if cap(buffers) <= maxSpareBuffers {
+			// drop the references to the written lines, then recycle the list
+			for i := range buffers {
+				buffers[i] = nil
+			}
+			socket.Lock()
+			socket.spareBuffers = buffers[:0]
+			socket.Unlock()
+		}
 	}
 
 	closed = closed || err != nil
@@ -218,7 +237,7 @@ func (socket *Socket) performWrite() (closed bool) {
 	return
 }
 
-// mark closed and send final data. you must be holding the semaphore to call this:
+// mark closed and send final data. you must be holding writeMutex to call this:
 func (socket *Socket) finalize() {
 	// mark the socket closed (if someone hasn't already), then write error lines
 	socket.Lock()
@@ -236,6 +255,7 @@ func (socket *Socket) finalize() {
 	}
 
 	if len(finalData) != 0 {
+		socket.setWriteDeadline()
 		socket.conn.WriteLine(finalData)
 	}
 
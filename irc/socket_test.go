@@ -0,0 +1,322 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package irc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ergochat/ergo/irc/utils"
+)
+
+// recordingConn is an IRCConn that records the batches written to it;
+// writes block while `gate` is non-nil and fail once `err` is set
+type recordingConn struct {
+	discardConn
+
+	sync.Mutex
+	batches [][]string
+	gate    chan struct{}
+	err     error
+	closed  bool
+	// receives a value, if there is room, whenever a write starts
+	started chan struct{}
+}
+
+func newRecordingConn() *recordingConn {
+	return &recordingConn{started: make(chan struct{}, 16)}
+}
+
+func (rc *recordingConn) WriteLine(buf []byte) error {
+	return rc.WriteLines([][]byte{buf})
+}
+
+func (rc *recordingConn) WriteLines(buffers [][]byte) error {
+	rc.Lock()
+	gate, started := rc.gate, rc.started
+	rc.Unlock()
+	select {
+	case started <- struct{}{}:
+	default:
+	}
+	if gate != nil {
+		<-gate
+	}
+	rc.Lock()
+	defer rc.Unlock()
+	if rc.err != nil {
+		return rc.err
+	}
+	var batch []string
+	for _, buf := range buffers {
+		batch = append(batch, string(buf))
+	}
+	rc.batches = append(rc.batches, batch)
+	return nil
+}
+
+func (rc *recordingConn) Close() error {
+	rc.Lock()
+	rc.closed = true
+	rc.Unlock()
+	return nil
+}
+
+func (rc *recordingConn) isClosed() bool {
+	rc.Lock()
+	defer rc.Unlock()
+	return rc.closed
+}
+
+func (rc *recordingConn) lines() (result []string) {
+	rc.Lock()
+	defer rc.Unlock()
+	for _, batch := range rc.batches {
+		result = append(result, batch...)
+	}
+	return
+}
+
+// newTestSocket returns a Socket over conn, along with a channel that is
+// closed when its writer goroutine exits
+func newTestSocket(conn IRCConn, maxSendQBytes int) (socket *Socket, writerDone chan struct{}) {
+	socket = &Socket{
+		conn:          conn,
+		maxSendQBytes: maxSendQBytes,
+		writerWake:    make(chan struct{}, 1),
+	}
+	writerDone = make(chan struct{})
+	go func() {
+		socket.runWriter()
+		close(writerDone)
+	}()
+	return
+}
+
+func waitForWriterExit(t *testing.T, writerDone chan struct{}) {
+	select {
+	case <-writerDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("writer goroutine did not exit")
+	}
+}
+
+func TestSocketWriteOrdering(t *testing.T) {
+	conn := newRecordingConn()
+	socket, writerDone := newTestSocket(conn, 1<<20)
+
+	var expected []string
+	for i := 0; i < 100; i++ {
+		line := fmt.Sprintf("PRIVMSG alice :%d\r\n", i)
+		expected = append(expected, line)
+		if i%10 == 9 {
+			// BlockingWrite flushes everything that was written before it
+			if err := socket.BlockingWrite([]byte(line)); err != nil {
+				t.Fatal(err)
+			}
+			assertEqual(conn.lines(), expected)
+		} else if err := socket.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	socket.SetFinalData([]byte("ERROR :bye\r\n"))
+	socket.Close()
+	waitForWriterExit(t, writerDone)
+	assertEqual(conn.lines(), append(expected, "ERROR :bye\r\n"))
+	assertEqual(conn.isClosed(), true)
+	if err := socket.Write([]byte("PING\r\n")); err != io.EOF {
+		t.Errorf("expected EOF writing to a closed socket, got %v", err)
+	}
+}
+
+func TestSocketBlockedWrites(t *testing.T) {
+	conn := newRecordingConn()
+	gate := make(chan struct{})
+	conn.gate = gate
+	socket, writerDone := newTestSocket(conn, 64)
+	started := conn.started
+
+	// the first line blocks in the writer; the next ones accumulate,
+	// and are flushed together once it unblocks
+	line := []byte("PRIVMSG alice :0123456789\r\n")
+	socket.Write(line)
+	<-started
+	socket.Write(line)
+	socket.Write(line)
+	conn.Lock()
+	conn.gate = nil
+	conn.Unlock()
+	close(gate)
+	socket.BlockingWrite([]byte("PING\r\n"))
+	conn.Lock()
+	assertEqual(len(conn.batches), 3)
+	assertEqual(len(conn.batches[1]), 2)
+	conn.Unlock()
+
+	// exceeding the sendq while blocked drops the new line and closes the
+	// socket; what was already buffered is sent, followed by the sendq error
+	gate = make(chan struct{})
+	conn.Lock()
+	conn.gate = gate
+	conn.batches = nil
+	conn.started = make(chan struct{}, 16)
+	started = conn.started
+	conn.Unlock()
+	socket.Write(line)
+	<-started
+	socket.Write(line)
+	socket.Write(line)
+	if err := socket.Write(line); err != errSendQExceeded {
+		t.Errorf("expected sendq error, got %v", err)
+	}
+	if err := socket.Write(line); err != io.EOF {
+		t.Errorf("expected EOF after a sendq error, got %v", err)
+	}
+	conn.Lock()
+	conn.gate = nil
+	conn.Unlock()
+	close(gate)
+	waitForWriterExit(t, writerDone)
+	l := string(line)
+	assertEqual(conn.lines(), []string{l, l, l, string(sendQExceededMessage)})
+	assertEqual(conn.isClosed(), true)
+}
+
+func TestSocketWriteError(t *testing.T) {
+	conn := newRecordingConn()
+	socket, writerDone := newTestSocket(conn, 1<<20)
+	socket.SetFinalData([]byte("ERROR :bye\r\n"))
+
+	conn.Lock()
+	conn.err = errors.New("connection reset")
+	conn.Unlock()
+	socket.Write([]byte("PING\r\n"))
+	// a failed write closes the socket and stops the writer
+	waitForWriterExit(t, writerDone)
+	assertEqual(socket.IsClosed(), true)
+	assertEqual(conn.isClosed(), true)
+	if err := socket.BlockingWrite([]byte("PING\r\n")); err != io.EOF {
+		t.Errorf("expected EOF after a write error, got %v", err)
+	}
+}
+
+func TestSocketBlockingWriteError(t *testing.T) {
+	conn := newRecordingConn()
+	socket, writerDone := newTestSocket(conn, 1<<20)
+	conn.Lock()
+	conn.err = errors.New("connection reset")
+	conn.Unlock()
+	if err := socket.BlockingWrite([]byte("PING\r\n")); err == nil {
+		t.Error("expected an error from BlockingWrite")
+	}
+	// the writer goroutine observes the closure and exits
+	waitForWriterExit(t, writerDone)
+	assertEqual(conn.isClosed(), true)
+}
+
+func TestSocketWriteTimeout(t *testing.T) {
+	// writes to a net.Pipe block until the other end reads them,
+	// like a client that has stopped reading from a full TCP window
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	socket := NewSocket(NewIRCStreamConn(&utils.WrappedConn{Conn: serverConn}), 1024, 50*time.Millisecond)
+
+	done := make(chan error)
+	go func() {
+		done <- socket.BlockingWrite([]byte("PING :ergo.test\r\n"))
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("write to a stalled client should fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("write to a stalled client did not time out")
+	}
+	if !socket.IsClosed() {
+		t.Error("socket should be closed after a write timeout")
+	}
+}
+
+// discardConn is an IRCConn that accepts and discards all writes
+type discardConn struct {
+	utils.WrappedConn
+}
+
+func (dc *discardConn) UnderlyingConn() *utils.WrappedConn { return &dc.WrappedConn }
+func (dc *discardConn) WriteLine(buf []byte) error         { return nil }
+func (dc *discardConn) WriteLines(buffers [][]byte) error  { return nil }
+func (dc *discardConn) ReadLine() ([]byte, error)          { select {} }
+func (dc *discardConn) SetWriteDeadline(t time.Time) error { return nil }
+func (dc *discardConn) Close() error                       { return nil }
+
+func BenchmarkSocketWrite(b *testing.B) {
+	socket := NewSocket(new(discardConn), 1<<20, 0)
+	line := []byte(":alice!~u@example.com PRIVMSG #ergo :hello, world\r\n")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// a burst of fanout to one client, then a flush
+		for j := 0; j < 8; j++ {
+			socket.Write(line)
+		}
+		socket.BlockingWrite(line)
+	}
+}
+
+// newLoopbackSocket returns a Socket over a loopback TCP connection
+// whose other end discards everything it reads
+func newLoopbackSocket(b *testing.B) *Socket {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { listener.Close() })
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			io.Copy(io.Discard, conn)
+		}
+	}()
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+	socket := NewSocket(NewIRCStreamConn(&utils.WrappedConn{Conn: conn}), 1<<30, 0)
+	b.Cleanup(socket.Close)
+	return socket
+}
+
+func BenchmarkSocketWriteTCP(b *testing.B) {
+	socket := newLoopbackSocket(b)
+	line := []byte(":alice!~u@example.com PRIVMSG #ergo :hello, world\r\n")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < 8; j++ {
+			socket.Write(line)
+		}
+		socket.BlockingWrite(line)
+	}
+}
+
+func BenchmarkSocketFanoutTCP(b *testing.B) {
+	// lines arrive one at a time from other goroutines (e.g., channel fanout),
+	// and are flushed in the background
+	socket := newLoopbackSocket(b)
+	line := []byte(":alice!~u@example.com PRIVMSG #ergo :hello, world\r\n")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		socket.Write(line)
+	}
+	// wait for everything to be written
+	socket.BlockingWrite(line)
+}
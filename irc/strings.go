@@ -60,6 +60,11 @@ const (
 	// confusables detection: standard skeleton algorithm (which may be ineffective
 	// over the larger set of permitted identifiers)
 	CasemappingPermissive
+	// "rfc1459" is the legacy ircd behavior, for compatibility with old networks:
+	// casefolding/validation: as for "ascii", except that []\~ are additionally
+	// considered to be the uppercase equivalents of {}|^
+	// confusables detection: none
+	CasemappingRFC1459
 )
 
 // XXX this is a global variable without explicit synchronization.
@@ -73,6 +78,10 @@ var globalCasemappingSetting Casemapping = CasemappingPRECIS
 // if this is on, invalid utf8 inputs get a FAIL reply.
 var globalUtf8EnforcementSetting bool
 
+// if this is on (in addition to globalUtf8EnforcementSetting), invalid utf8 sequences
+// are replaced with U+FFFD instead of causing the input to be rejected.
+var globalUtf8ReplaceInvalid bool
+
 // Each pass of PRECIS casefolding is a composition of idempotent operations,
 // but not idempotent itself. Therefore, the spec says "do it four times and hope
 // it converges" (lolwtf). Golang's PRECIS implementation has a "repeat" option,
@@ -110,6 +119,8 @@ func casefoldWithSetting(str string, setting Casemapping) (string, error) {
 		return foldASCII(str)
 	case CasemappingPermissive:
 		return foldPermissive(str)
+	case CasemappingRFC1459:
+		return foldRFC1459(str)
 	}
 }
 
@@ -214,7 +225,7 @@ func Skeleton(name string) (string, error) {
 	switch globalCasemappingSetting {
 	default:
 		return realSkeleton(name)
-	case CasemappingASCII:
+	case CasemappingASCII, CasemappingRFC1459:
 		// identity function is fine because we independently case-normalize in Casefold
 		return name, nil
 	}
@@ -302,6 +313,16 @@ func foldASCII(str string) (result string, err error) {
 	return strings.ToLower(str), nil
 }
 
+var rfc1459Replacer = strings.NewReplacer("[", "{", "]", "}", "\\", "|", "~", "^")
+
+func foldRFC1459(str string) (result string, err error) {
+	result, err = foldASCII(str)
+	if err != nil {
+		return
+	}
+	return rfc1459Replacer.Replace(result), nil
+}
+
 func IsPrintableASCII(str string) bool {
 	for i := 0; i < len(str); i++ {
 		// allow space here because it's technically printable;
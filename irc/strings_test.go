@@ -5,8 +5,10 @@
 package irc
 
 import (
+	"bytes"
 	"fmt"
 	"testing"
+	"unicode/utf8"
 )
 
 func TestCasefoldChannel(t *testing.T) {
@@ -279,3 +281,51 @@ func TestFoldASCIIInvalid(t *testing.T) {
 		t.Errorf("control characters should be invalid in identifiers")
 	}
 }
+
+func TestFoldRFC1459(t *testing.T) {
+	tester := func(first, second string, equal bool) {
+		validFoldTester(first, second, equal, foldRFC1459, t)
+	}
+	tester("shivaram", "SHIVARAM", true)
+	tester("X|Y", "x\\y", true)
+	tester("[away]", "{AWAY}", true)
+	tester("dan~", "dan^", true)
+	tester("a != b", "A != B", true)
+	tester("x|y", "x/y", false)
+
+	_, err := foldRFC1459("\x01")
+	if err == nil {
+		t.Errorf("control characters should be invalid in identifiers")
+	}
+	_, err = foldRFC1459("shïvaram")
+	if err == nil {
+		t.Errorf("non-ASCII characters should be invalid in identifiers")
+	}
+}
+
+func TestEnforceUtf8(t *testing.T) {
+	defer func(saved bool) { globalUtf8ReplaceInvalid = saved }(globalUtf8ReplaceInvalid)
+
+	valid := []byte("PRIVMSG #ergo :hi ☃")
+	invalid := []byte("PRIVMSG #ergo :hi \xff\xfe!")
+
+	globalUtf8ReplaceInvalid = false
+	if line, err := enforceUtf8(valid); err != nil || string(line) != string(valid) {
+		t.Errorf("valid line should be accepted unchanged: %q, %v", line, err)
+	}
+	if _, err := enforceUtf8(invalid); err != errInvalidUtf8 {
+		t.Errorf("invalid line should be rejected, got %v", err)
+	}
+
+	globalUtf8ReplaceInvalid = true
+	if line, err := enforceUtf8(invalid); err != nil || string(line) != "PRIVMSG #ergo :hi �!" {
+		t.Errorf("invalid sequences should be replaced: %q, %v", line, err)
+	}
+
+	// replacement can't push a line past the maximum length
+	long := bytes.Repeat([]byte("a\xff"), maxReadQBytes()/2)
+	line, err := enforceUtf8(long)
+	if err != nil || len(line) > maxReadQBytes() || !utf8.Valid(line) {
+		t.Errorf("replaced line should be valid and within the limit: %d bytes, %v", len(line), err)
+	}
+}
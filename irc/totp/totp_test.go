@@ -0,0 +1,54 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// RFC 6238, appendix B (SHA1, truncated to 6 digits)
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" // "12345678901234567890"
+
+func TestRFCVectors(t *testing.T) {
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, v := range vectors {
+		code, err := CodeForStep(rfcSecret, Step(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != v.code {
+			t.Errorf("at %d: expected %s, got %s", v.unix, v.code, code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := GenerateSecret()
+	now := time.Now()
+	code, err := CodeForStep(secret, Step(now.Add(-Period)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	step, ok := Validate(secret, code, now)
+	if !ok || step != Step(now)-1 {
+		t.Errorf("code from the previous step should be accepted")
+	}
+	if _, ok := Validate(secret, code, now.Add(3*Period)); ok {
+		t.Errorf("stale code should not be accepted")
+	}
+	if _, ok := Validate(secret, "12345", now); ok {
+		t.Errorf("malformed code should not be accepted")
+	}
+}
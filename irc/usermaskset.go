@@ -29,6 +29,12 @@ type UserMaskSet struct {
 	masks                  map[string]MaskInfo
 	regexp                 unsafe.Pointer
 	muteRegexp             unsafe.Pointer
+	extbans                unsafe.Pointer // *compiledExtbans
+}
+
+type compiledExtbans struct {
+	bans  []extbanMatcher
+	mutes []extbanMatcher
 }
 
 func NewUserMaskSet() *UserMaskSet {
@@ -37,7 +43,7 @@ func NewUserMaskSet() *UserMaskSet {
 
 // Add adds the given mask to this set.
 func (set *UserMaskSet) Add(mask, creatorNickmask, creatorAccount string) (maskAdded string, err error) {
-	casefoldedMask, err := CanonicalizeMaskWildcard(mask)
+	casefoldedMask, err := CanonicalizeListMask(mask)
 	if err != nil {
 		return
 	}
@@ -68,7 +74,7 @@ func (set *UserMaskSet) Add(mask, creatorNickmask, creatorAccount string) (maskA
 
 // Remove removes the given mask from this set.
 func (set *UserMaskSet) Remove(mask string) (maskRemoved string, err error) {
-	mask, err = CanonicalizeMaskWildcard(mask)
+	mask, err = CanonicalizeListMask(mask)
 	if err != nil {
 		return
 	}
@@ -132,6 +138,39 @@ func (set *UserMaskSet) MuteRegexp() *regexp.Regexp {
 	return (*regexp.Regexp)(atomic.LoadPointer(&set.muteRegexp))
 }
 
+func (set *UserMaskSet) compiledExtbans() *compiledExtbans {
+	return (*compiledExtbans)(atomic.LoadPointer(&set.extbans))
+}
+
+func matchExtbans(matchers []extbanMatcher, client *Client) bool {
+	for _, matcher := range matchers {
+		if matcher(client) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchClient matches a client (with the given n!u@h) against the
+// standard bans and the extbans.
+func (set *UserMaskSet) MatchClient(client *Client, userhost string) bool {
+	if set.Match(userhost) {
+		return true
+	}
+	extbans := set.compiledExtbans()
+	return extbans != nil && matchExtbans(extbans.bans, client)
+}
+
+// MatchMuteClient matches a client (with the given n!u@h) against the
+// mute masks and the mute extbans.
+func (set *UserMaskSet) MatchMuteClient(client *Client, userhost string) bool {
+	if set.MatchMute(userhost) {
+		return true
+	}
+	extbans := set.compiledExtbans()
+	return extbans != nil && matchExtbans(extbans.mutes, client)
+}
+
 func (set *UserMaskSet) Length() int {
 	set.RLock()
 	defer set.RUnlock()
@@ -141,10 +180,16 @@ func (set *UserMaskSet) Length() int {
 func (set *UserMaskSet) setRegexp() {
 	set.RLock()
 	maskExprs := make([]string, 0, len(set.masks))
-	var muteExprs []string
+	var muteExprs, extbanExprs, muteExtbanExprs []string
 	for mask := range set.masks {
 		if strings.HasPrefix(mask, "m:") {
-			muteExprs = append(muteExprs, mask[2:])
+			if isExtban(mask[2:]) {
+				muteExtbanExprs = append(muteExtbanExprs, mask[2:])
+			} else {
+				muteExprs = append(muteExprs, mask[2:])
+			}
+		} else if isExtban(mask) {
+			extbanExprs = append(extbanExprs, mask)
 		} else {
 			maskExprs = append(maskExprs, mask)
 		}
@@ -164,4 +209,13 @@ func (set *UserMaskSet) setRegexp() {
 
 	atomic.StorePointer(&set.regexp, unsafe.Pointer(re))
 	atomic.StorePointer(&set.muteRegexp, unsafe.Pointer(muteRe))
+
+	var extbans *compiledExtbans
+	if len(extbanExprs) != 0 || len(muteExtbanExprs) != 0 {
+		extbans = &compiledExtbans{
+			bans:  compileExtbans(extbanExprs),
+			mutes: compileExtbans(muteExtbanExprs),
+		}
+	}
+	atomic.StorePointer(&set.extbans, unsafe.Pointer(extbans))
 }
@@ -34,3 +34,46 @@ func TestUserMaskSet(t *testing.T) {
 		t.Errorf("unexpected MatchMute() succeeded")
 	}
 }
+
+func TestCanonicalizeListMask(t *testing.T) {
+	assertEqual := func(supplied, expected string) {
+		canonicalized, err := CanonicalizeListMask(supplied)
+		if err != nil {
+			t.Errorf("unexpected error canonicalizing %s: %v", supplied, err)
+		} else if canonicalized != expected {
+			t.Errorf("expected %s to canonicalize to %s, got %s", supplied, expected, canonicalized)
+		}
+	}
+	assertInvalid := func(supplied string) {
+		if canonicalized, err := CanonicalizeListMask(supplied); err == nil {
+			t.Errorf("expected %s to be invalid, got %s", supplied, canonicalized)
+		}
+	}
+
+	assertEqual("Shivaram", "shivaram!*@*")
+	assertEqual("m:Shivaram", "m:shivaram!*@*")
+	assertEqual("~m:Shivaram", "m:shivaram!*@*")
+	assertEqual("~a:Shivaram", "~a:shivaram")
+	assertEqual("~a:Shiv*", "~a:shiv*")
+	assertEqual("~a", "~a")
+	assertEqual("m:~a:Shivaram", "m:~a:shivaram")
+	assertEqual("~m:~a:Shivaram", "m:~a:shivaram")
+	assertEqual("~z", "~z")
+
+	assertInvalid("~z:shivaram")
+	assertInvalid("~q:shivaram")
+	assertInvalid("~ashivaram")
+}
+
+func TestExtbansNotMatchedAsMasks(t *testing.T) {
+	s := NewUserMaskSet()
+	s.Add("~a:evan", "", "")
+	s.Add("m:~a:horse", "", "")
+	if s.Match("evan!~evan@tor-network.onion") || s.MatchMute("horse!~evan@tor-network.onion") {
+		t.Errorf("extbans should not match as nickmasks")
+	}
+	extbans := s.compiledExtbans()
+	if extbans == nil || len(extbans.bans) != 1 || len(extbans.mutes) != 1 {
+		t.Errorf("expected one ban and one mute extban, got %#v", extbans)
+	}
+}
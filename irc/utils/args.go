@@ -45,6 +45,9 @@ type IncompatibleSchemaError struct {
 }
 
 func (err *IncompatibleSchemaError) Error() string {
+	if err.RequiredVersion < err.CurrentVersion {
+		return fmt.Sprintf("Database was created by a newer version of the server and cannot be downgraded. Expected schema v%d, got v%d", err.RequiredVersion, err.CurrentVersion)
+	}
 	return fmt.Sprintf("Database requires update. Expected schema v%d, got v%d", err.RequiredVersion, err.CurrentVersion)
 }
 
@@ -29,6 +29,12 @@ func AddrToIP(addr net.Addr) net.IP {
 	}
 }
 
+// IsUnixListenAddr returns whether a listener address refers to a unix domain socket
+// (either an absolute path, or a path with an explicit unix: prefix).
+func IsUnixListenAddr(addr string) bool {
+	return strings.HasPrefix(strings.TrimPrefix(addr, "unix:"), "/")
+}
+
 // IPStringToHostname converts a string representation of an IP address to an IRC-ready hostname
 func IPStringToHostname(ipStr string) string {
 	if 0 < len(ipStr) && ipStr[0] == ':' {
@@ -8,6 +8,8 @@ import (
 	"encoding/binary"
 	"io"
 	"net"
+	"os"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
@@ -46,12 +48,23 @@ type ListenerConfig struct {
 	TLSConfig     *tls.Config
 	ProxyDeadline time.Duration
 	RequireProxy  bool
+	// if RequireProxy is set, connections from outside these nets
+	// are dropped without reading a PROXY header:
+	ProxyAllowedFrom []net.IPNet
 	// these are just metadata for easier tracking,
 	// they are not used by ReloadableListener:
 	Tor       bool
 	STSOnly   bool
 	WebSocket bool
 	HideSTS   bool
+	// whether to perform ident (RFC 1413) lookups on new connections:
+	CheckIdent bool
+	// for websocket listeners, the compiled Origin restrictions (empty for none):
+	AllowedOrigins []*regexp.Regexp
+	// for unix domain sockets, the permissions to apply to the socket file
+	// (0 to leave them alone) and its group owner (-1 to leave it alone):
+	UnixBindMode os.FileMode
+	UnixBindGID  int
 }
 
 // read a PROXY header (either v1 or v2), ensuring we don't read anything beyond
@@ -239,21 +252,31 @@ func (rl *ReloadableListener) Reload(config ListenerConfig) {
 }
 
 func (rl *ReloadableListener) Accept() (conn net.Conn, err error) {
-	conn, err = rl.realListener.Accept()
-
-	rl.Lock()
-	config := rl.config
-	isClosed := rl.isClosed
-	rl.Unlock()
+	var config ListenerConfig
+	for {
+		conn, err = rl.realListener.Accept()
+
+		rl.Lock()
+		config = rl.config
+		isClosed := rl.isClosed
+		rl.Unlock()
+
+		if isClosed {
+			if err == nil {
+				conn.Close()
+			}
+			err = net.ErrClosed
+		}
+		if err != nil {
+			return nil, err
+		}
 
-	if isClosed {
-		if err == nil {
+		// don't let untrusted sources tie up the accept loop (or spoof their IP):
+		if config.RequireProxy && !IPInNets(AddrToIP(conn.RemoteAddr()), config.ProxyAllowedFrom) {
 			conn.Close()
+			continue
 		}
-		err = net.ErrClosed
-	}
-	if err != nil {
-		return nil, err
+		break
 	}
 
 	var proxiedIP net.IP
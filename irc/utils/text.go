@@ -88,6 +88,21 @@ func (sm *SplitMessage) IsRestrictedCTCPMessage() bool {
 	return false
 }
 
+// FallbackLines returns the lines of a multiline message, as they should be
+// relayed to clients that don't support multiline: lines sent with the concat
+// tag are rejoined to the preceding line when the result fits in maxLen bytes,
+// and blank lines are dropped.
+func (sm *SplitMessage) FallbackLines(maxLen int) (result []string) {
+	for _, pair := range sm.Split {
+		if pair.Concat && 0 < len(result) && len(result[len(result)-1])+len(pair.Message) <= maxLen {
+			result[len(result)-1] += pair.Message
+		} else if len(pair.Message) != 0 {
+			result = append(result, pair.Message)
+		}
+	}
+	return
+}
+
 func (sm *SplitMessage) Is512() bool {
 	return sm.Split == nil
 }
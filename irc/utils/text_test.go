@@ -4,6 +4,7 @@
 package utils
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -43,3 +44,26 @@ func TestBuildTokenLines(t *testing.T) {
 	val = BuildTokenLines(10, []string{"abcd", "efgh", "ijkl"}, ",")
 	assertEqual(val, []string{"abcd,efgh", "ijkl"}, t)
 }
+
+func TestFallbackLines(t *testing.T) {
+	var sm SplitMessage
+	sm.Append("hello ", false)
+	sm.Append("world", true)
+	sm.Append("", false)
+	sm.Append("second line", false)
+	sm.Append(" is too long to rejoin", true)
+	lines := sm.FallbackLines(20)
+	expected := []string{"hello world", "second line", " is too long to rejoin"}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("expected %#v, got %#v", expected, lines)
+	}
+
+	sm = SplitMessage{}
+	sm.Append("", false)
+	sm.Append("concat after a blank line", true)
+	lines = sm.FallbackLines(512)
+	expected = []string{"concat after a blank line"}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("expected %#v, got %#v", expected, lines)
+	}
+}
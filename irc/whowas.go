@@ -5,7 +5,20 @@
 package irc
 
 import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
 	"sync"
+	"time"
+
+	"github.com/tidwall/buntdb"
+)
+
+const (
+	// the index of the entry in the ring buffer:
+	keyWhowasEntry = "whowas.entry %s"
 )
 
 // WhoWasList holds our list of prior clients (for use with the WHOWAS command).
@@ -19,9 +32,28 @@ type WhoWasList struct {
 	start int
 	end   int
 
+	// entries that signed off longer ago than this are ignored (0 for no limit)
+	maxAge time.Duration
+	// if non-nil, entries are saved here so that they survive restarts
+	store *buntdb.DB
+	// total number of entries appended, to detect overwritten entries
+	appends uint64
+
 	accessMutex sync.RWMutex // tier 1
 }
 
+// persistentWhoWas is the representation of a WhoWas entry in the datastore
+type persistentWhoWas struct {
+	Nick        string
+	Username    string
+	Hostname    string
+	Realname    string
+	IP          net.IP
+	Account     string
+	AccountName string
+	Signoff     time.Time
+}
+
 // NewWhoWasList returns a new WhoWasList
 func (list *WhoWasList) Initialize(size int) {
 	list.buffer = make([]WhoWas, size)
@@ -29,12 +61,78 @@ func (list *WhoWasList) Initialize(size int) {
 	list.end = -1
 }
 
-// Append adds an entry to the WhoWasList.
-func (list *WhoWasList) Append(whowas WhoWas) {
+// SetMaxAge sets the age past which entries are no longer returned.
+func (list *WhoWasList) SetMaxAge(maxAge time.Duration) {
 	list.accessMutex.Lock()
 	defer list.accessMutex.Unlock()
+	list.maxAge = maxAge
+}
+
+// Load restores the entries saved in the datastore, then (if persistent is true)
+// saves future entries there as well. If persistent is false, any entries saved
+// previously are deleted instead.
+func (list *WhoWasList) Load(store *buntdb.DB, persistent bool) (err error) {
+	var keys []string
+	var entries []WhoWas
+	err = store.View(func(tx *buntdb.Tx) error {
+		return tx.AscendKeys(fmt.Sprintf(keyWhowasEntry, "*"), func(key, value string) bool {
+			keys = append(keys, key)
+			var entry persistentWhoWas
+			if json.Unmarshal([]byte(value), &entry) != nil {
+				return true
+			}
+			cfnick, err := CasefoldName(entry.Nick)
+			if err != nil {
+				return true
+			}
+			entries = append(entries, WhoWas{
+				nick:           entry.Nick,
+				nickCasefolded: cfnick,
+				username:       entry.Username,
+				hostname:       entry.Hostname,
+				realname:       entry.Realname,
+				ip:             entry.IP,
+				account:        entry.Account,
+				accountName:    entry.AccountName,
+				signoff:        entry.Signoff,
+			})
+			return true
+		})
+	})
+	if err != nil {
+		return
+	}
+
+	// the size of the list may have changed, so the entries can't stay
+	// where they were; delete them all, then append them in their original order
+	err = store.Update(func(tx *buntdb.Tx) error {
+		for _, key := range keys {
+			tx.Delete(key)
+		}
+		return nil
+	})
+	if err != nil || !persistent {
+		return
+	}
+	list.accessMutex.Lock()
+	list.store = store
+	list.accessMutex.Unlock()
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].signoff.Before(entries[j].signoff) })
+	for _, entry := range entries {
+		list.Append(entry)
+	}
+	return nil
+}
+
+// Append adds an entry to the WhoWasList.
+func (list *WhoWasList) Append(whowas WhoWas) {
+	if whowas.signoff.IsZero() {
+		whowas.signoff = time.Now().UTC()
+	}
 
+	list.accessMutex.Lock()
 	if len(list.buffer) == 0 {
+		list.accessMutex.Unlock()
 		return
 	}
 
@@ -53,6 +151,53 @@ func (list *WhoWasList) Append(whowas WhoWas) {
 	}
 
 	list.buffer[pos] = whowas
+	list.appends++
+	store, maxAge, seq := list.store, list.maxAge, list.appends
+	list.accessMutex.Unlock()
+
+	// don't hold the lock while writing to the datastore:
+	if store != nil {
+		list.persist(store, maxAge, pos, seq, whowas)
+	}
+}
+
+// persist saves the seq'th entry to be appended, which is at `pos` in
+// the ring buffer, unless it was overwritten in the meantime
+func (list *WhoWasList) persist(store *buntdb.DB, maxAge time.Duration, pos int, seq uint64, whowas WhoWas) {
+	data, err := json.Marshal(persistentWhoWas{
+		Nick:        whowas.nick,
+		Username:    whowas.username,
+		Hostname:    whowas.hostname,
+		Realname:    whowas.realname,
+		IP:          whowas.ip,
+		Account:     whowas.account,
+		AccountName: whowas.accountName,
+		Signoff:     whowas.signoff,
+	})
+	if err != nil {
+		return
+	}
+	var setOptions *buntdb.SetOptions
+	if maxAge != 0 {
+		ttl := time.Until(whowas.signoff.Add(maxAge))
+		if ttl <= 0 {
+			return
+		}
+		setOptions = &buntdb.SetOptions{Expires: true, TTL: ttl}
+	}
+	store.Update(func(tx *buntdb.Tx) error {
+		// concurrent appends can reach this out of order; transactions are
+		// serialized, so checking here keeps a stale entry from replacing
+		// a newer one in the same position
+		list.accessMutex.RLock()
+		overwritten := uint64(len(list.buffer)) <= list.appends-seq
+		list.accessMutex.RUnlock()
+		if overwritten {
+			return nil
+		}
+		_, _, err := tx.Set(fmt.Sprintf(keyWhowasEntry, strconv.Itoa(pos)), string(data), setOptions)
+		return err
+	})
 }
 
 // Find tries to find an entry in our WhoWasList with the given details.
@@ -61,18 +206,50 @@ func (list *WhoWasList) Find(nickname string, limit int) (results []WhoWas) {
 	if err != nil {
 		return
 	}
+	return list.find(func(whowas *WhoWas) bool {
+		return whowas.nickCasefolded == casefoldedNickname
+	}, limit)
+}
+
+// FindByAccount finds the entries of clients that were logged into the given account.
+func (list *WhoWasList) FindByAccount(account string, limit int) (results []WhoWas) {
+	casefoldedAccount, err := CasefoldName(account)
+	if err != nil {
+		return
+	}
+	return list.find(func(whowas *WhoWas) bool {
+		return whowas.account == casefoldedAccount
+	}, limit)
+}
 
+// FindByNet finds the entries of clients that connected from the given network.
+func (list *WhoWasList) FindByNet(network net.IPNet, limit int) (results []WhoWas) {
+	return list.find(func(whowas *WhoWas) bool {
+		return whowas.ip != nil && network.Contains(whowas.ip)
+	}, limit)
+}
+
+func (list *WhoWasList) find(matches func(*WhoWas) bool, limit int) (results []WhoWas) {
 	list.accessMutex.RLock()
 	defer list.accessMutex.RUnlock()
 
 	if list.start == -1 {
 		return
 	}
+	var cutoff time.Time
+	if list.maxAge != 0 {
+		cutoff = time.Now().Add(-list.maxAge)
+	}
 	// iterate backwards through the ring buffer
 	pos := list.prev(list.end)
 	for limit == 0 || len(results) < limit {
-		if casefoldedNickname == list.buffer[pos].nickCasefolded {
-			results = append(results, list.buffer[pos])
+		entry := &list.buffer[pos]
+		if entry.signoff.Before(cutoff) {
+			// entries are in chronological order, so the rest are too old as well
+			break
+		}
+		if matches(entry) {
+			results = append(results, *entry)
 		}
 		if pos == list.start {
 			break
@@ -4,7 +4,16 @@
 package irc
 
 import (
+	"fmt"
+	"net"
+	"sort"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/tidwall/buntdb"
+
+	"github.com/ergochat/ergo/irc/utils"
 )
 
 func makeTestWhowas(nick string) WhoWas {
@@ -101,3 +110,140 @@ func TestEmptyWhoWas(t *testing.T) {
 		t.Fatalf("incorrect whowas results: %v", results)
 	}
 }
+
+func TestWhoWasFindByAccountAndNet(t *testing.T) {
+	var wwl WhoWasList
+	wwl.Initialize(10)
+	entry := makeTestWhowas("dan-")
+	entry.account, entry.accountName = "dan", "Dan"
+	entry.ip = net.ParseIP("192.168.1.1")
+	wwl.Append(entry)
+	entry = makeTestWhowas("slingamn")
+	entry.ip = net.ParseIP("192.168.2.1")
+	wwl.Append(entry)
+
+	results := wwl.FindByAccount("DAN", 0)
+	if len(results) != 1 || results[0].nick != "dan-" {
+		t.Fatalf("incorrect whowas results: %v", results)
+	}
+	network, err := utils.NormalizedNetFromString("192.168.0.0/16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results = wwl.FindByNet(network, 0)
+	if len(results) != 2 || results[0].nick != "slingamn" || results[1].nick != "dan-" {
+		t.Fatalf("incorrect whowas results: %v", results)
+	}
+	network, err = utils.NormalizedNetFromString("192.168.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results = wwl.FindByNet(network, 0)
+	if len(results) != 1 || results[0].nick != "slingamn" {
+		t.Fatalf("incorrect whowas results: %v", results)
+	}
+}
+
+func TestWhoWasMaxAge(t *testing.T) {
+	var wwl WhoWasList
+	wwl.Initialize(10)
+	wwl.SetMaxAge(time.Hour)
+	entry := makeTestWhowas("dan-")
+	entry.signoff = time.Now().Add(-2 * time.Hour)
+	wwl.Append(entry)
+	wwl.Append(makeTestWhowas("Dan-"))
+
+	results := wwl.Find("dan-", 0)
+	if len(results) != 1 || results[0].nick != "Dan-" {
+		t.Fatalf("incorrect whowas results: %v", results)
+	}
+}
+
+func TestWhoWasPersistence(t *testing.T) {
+	store, err := buntdb.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	var wwl WhoWasList
+	wwl.Initialize(2)
+	if err := wwl.Load(store, true); err != nil {
+		t.Fatal(err)
+	}
+	for _, nick := range []string{"dan-", "slingamn", "Dan-"} {
+		entry := makeTestWhowas(nick)
+		entry.account, entry.accountName = "dan", "Dan"
+		wwl.Append(entry)
+	}
+
+	// simulate a restart, with a larger list
+	var reloaded WhoWasList
+	reloaded.Initialize(10)
+	if err := reloaded.Load(store, true); err != nil {
+		t.Fatal(err)
+	}
+	results := reloaded.FindByAccount("dan", 0)
+	if len(results) != 2 || results[0].nick != "Dan-" || results[1].nick != "slingamn" {
+		t.Fatalf("incorrect whowas results: %v", results)
+	}
+	if results[0].accountName != "Dan" || results[0].signoff.IsZero() {
+		t.Fatalf("incorrect whowas entry: %v", results[0])
+	}
+
+	// disabling persistence discards the saved entries
+	var empty WhoWasList
+	empty.Initialize(10)
+	if err := empty.Load(store, false); err != nil {
+		t.Fatal(err)
+	}
+	var fresh WhoWasList
+	fresh.Initialize(10)
+	if err := fresh.Load(store, true); err != nil {
+		t.Fatal(err)
+	}
+	if results := fresh.Find("dan-", 0); len(results) != 0 {
+		t.Fatalf("incorrect whowas results: %v", results)
+	}
+}
+
+func TestWhoWasConcurrentPersistence(t *testing.T) {
+	store, err := buntdb.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	var wwl WhoWasList
+	wwl.Initialize(4)
+	if err := wwl.Load(store, true); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				wwl.Append(makeTestWhowas(fmt.Sprintf("nick%d-%d", i, j)))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// whatever order the writes happened in, the saved entries are the ones in memory
+	nicks := func(list *WhoWasList) (result []string) {
+		for _, entry := range list.find(func(*WhoWas) bool { return true }, 0) {
+			result = append(result, entry.nick)
+		}
+		sort.Strings(result)
+		return
+	}
+	var reloaded WhoWasList
+	reloaded.Initialize(4)
+	if err := reloaded.Load(store, true); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(len(nicks(&wwl)), 4)
+	assertEqual(nicks(&reloaded), nicks(&wwl))
+}
@@ -68,7 +68,8 @@ func zncWireTimeToTime(str string) (result time.Time) {
 func timeToZncWireTime(t time.Time) (result string) {
 	secs := t.Unix()
 	nano := t.UnixNano() - (secs * 1000000000)
-	return fmt.Sprintf("%d.%d", secs, nano)
+	// the fractional part must be zero-padded, or e.g. 5ms would read back as 0.5s
+	return fmt.Sprintf("%d.%09d", secs, nano)
 }
 
 type zncPlaybackTimes struct {
@@ -105,6 +106,9 @@ func zncPlaybackHandler(client *Client, command string, params []string, rb *Res
 	case "list":
 		zncPlaybackListHandler(client, command, params, rb)
 	default:
+		// notably, `clear` is unsupported: history is stored by the server and
+		// shared with the other party to each conversation, so it can't be
+		// cleared per-client
 		return
 	}
 }
@@ -172,7 +176,7 @@ func zncPlaybackPlayHandler(client *Client, command string, params []string, rb
 	}
 
 	if playPrivmsgs {
-		zncPlayPrivmsgsFromAll(client, rb, start, end)
+		zncPlayPrivmsgsFromAll(client, rb, start, end, client.server.Config().History.ZNCMax)
 	}
 
 	rb.session.zncPlaybackTimes = &zncPlaybackTimes{
@@ -207,9 +211,8 @@ func zncPlayPrivmsgsFrom(client *Client, rb *ResponseBuffer, target string, star
 	}
 }
 
-func zncPlayPrivmsgsFromAll(client *Client, rb *ResponseBuffer, start, end time.Time) {
-	zncMax := client.server.Config().History.ZNCMax
-	items, err := client.privmsgsBetween(start, end, maxDMTargetsForAutoplay, zncMax)
+func zncPlayPrivmsgsFromAll(client *Client, rb *ResponseBuffer, start, end time.Time, limit int) {
+	items, err := client.privmsgsBetween(start, end, maxDMTargetsForAutoplay, limit)
 	if err == nil && len(items) != 0 {
 		client.replayPrivmsgHistory(rb, items, "", false)
 	}
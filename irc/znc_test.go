@@ -0,0 +1,22 @@
+// Copyright (c) 2026 Ergo contributors
+// released under the MIT license
+
+package irc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestZncWireTime(t *testing.T) {
+	for _, nano := range []int64{0, 5000000, 123456789, 999999999} {
+		original := time.Unix(1558374442, nano).UTC()
+		wire := timeToZncWireTime(original)
+		if roundtrip := zncWireTimeToTime(wire); !roundtrip.Equal(original) {
+			t.Errorf("%v serialized as %s, which parses as %v", original, wire, roundtrip)
+		}
+	}
+	if parsed := zncWireTimeToTime("1558374442.5"); !parsed.Equal(time.Unix(1558374442, 500000000)) {
+		t.Errorf("unexpected parse of fractional time: %v", parsed)
+	}
+}